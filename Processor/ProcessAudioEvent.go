@@ -0,0 +1,106 @@
+// 处理音频子频道的播放、上下麦和成员进出事件
+package Processor
+
+import (
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// AudioNoticeEvent 音频播放与上下麦通知 guild_id与channel_id为真实id
+type AudioNoticeEvent struct {
+	PostType   string `json:"post_type"`
+	NoticeType string `json:"notice_type"`
+	Time       int64  `json:"time"`
+	SelfID     int64  `json:"self_id"`
+	GuildID    string `json:"guild_id"`
+	ChannelID  string `json:"channel_id"`
+	GroupID    int64  `json:"group_id,omitempty"` //开启global_channel_to_group时子频道对应的群号
+	AudioURL   string `json:"audio_url,omitempty"`
+	Text       string `json:"text,omitempty"`
+}
+
+// AudioMemberNoticeEvent 音视频、直播子频道成员进出通知
+type AudioMemberNoticeEvent struct {
+	PostType    string `json:"post_type"`
+	NoticeType  string `json:"notice_type"`
+	SubType     string `json:"sub_type"` // enter exit
+	Time        int64  `json:"time"`
+	SelfID      int64  `json:"self_id"`
+	GuildID     string `json:"guild_id"`
+	ChannelID   string `json:"channel_id"`
+	ChannelType int    `json:"channel_type"` // 2音视频子频道 5直播子频道
+	GroupID     int64  `json:"group_id,omitempty"`
+	UserID      int64  `json:"user_id"`
+	RealUserID  string `json:"real_user_id,omitempty"` //当前真实uid
+}
+
+// 音频事件与通知类型的对应关系
+var audioNoticeTypes = map[dto.EventType]string{
+	dto.EventAudioStart:  "audio_started",
+	dto.EventAudioFinish: "audio_finished",
+	dto.EventAudioOnMic:  "audio_on_mic",
+	dto.EventAudioOffMic: "audio_off_mic",
+}
+
+// ProcessAudioEvent 处理机器人的音频开始、结束播放和上下麦
+func (p *Processors) ProcessAudioEvent(eventType dto.EventType, data *dto.WSAudioData) error {
+	noticeType, ok := audioNoticeTypes[eventType]
+	if !ok {
+		mylog.Printf("未知的音频事件:%v", eventType)
+		return nil
+	}
+	Notice := AudioNoticeEvent{
+		PostType:   "notice",
+		NoticeType: noticeType,
+		Time:       time.Now().Unix(),
+		SelfID:     p.selfID(),
+		GuildID:    data.GuildID,
+		ChannelID:  data.ChannelID,
+		AudioURL:   data.URL,
+		Text:       data.Text,
+	}
+	if p.Settings.GlobalChannelToGroup {
+		Notice.GroupID = storeChannelGroup(data.ChannelID, data.GuildID)
+	}
+
+	mylog.Printf("子频道[%v]%v", data.ChannelID, noticeType)
+	go p.BroadcastMessageToAll(structToMap(Notice), p.Apiv2, data)
+	return nil
+}
+
+// ProcessAudioMemberEvent 处理成员进出音视频、直播子频道
+func (p *Processors) ProcessAudioMemberEvent(eventType dto.EventType, data *dto.WSAudioLiveChannelMemberData) error {
+	subType := "enter"
+	if eventType == dto.EventAudioOrLiveMemberExit {
+		subType = "exit"
+	}
+	userid64, err := storeOptionalID(data.UserID)
+	if err != nil {
+		return nil
+	}
+	Notice := AudioMemberNoticeEvent{
+		PostType:    "notice",
+		NoticeType:  "audio_channel_member",
+		SubType:     subType,
+		Time:        time.Now().Unix(),
+		SelfID:      p.selfID(),
+		GuildID:     data.GuildID,
+		ChannelID:   data.ChannelID,
+		ChannelType: int(data.ChannelType),
+		UserID:      userid64,
+	}
+	if p.Settings.GlobalChannelToGroup {
+		Notice.GroupID = storeChannelGroup(data.ChannelID, data.GuildID)
+	}
+	//增强配置
+	if !config.GetNativeOb11() {
+		Notice.RealUserID = data.UserID
+	}
+
+	mylog.Printf("子频道[%v]成员[%v]%v", data.ChannelID, userid64, subType)
+	go p.BroadcastMessageToAll(structToMap(Notice), p.Apiv2, data)
+	return nil
+}
@@ -20,6 +20,8 @@ import (
 
 // ProcessC2CMessage 处理C2C消息 群私聊
 func (p *Processors) ProcessC2CMessage(data *dto.WSC2CMessageData) error {
+	// 记录信息来源,撤回时只需要message_id
+	idmap.StoreMessageScope(data.ID, idmap.MessageScope{Type: idmap.ScopeGroupPrivate, TargetID: data.Author.ID})
 	// 打印data结构体
 	PrintStructWithFieldNames(data)
 
@@ -53,14 +55,9 @@ func (p *Processors) ProcessC2CMessage(data *dto.WSC2CMessageData) error {
 			if err != nil {
 				mylog.Errorf("Error storing ID: %v", err)
 			}
-			//当参数不全
-			_, _ = idmap.StoreIDv2(data.Author.ID)
 			if !config.GetHashIDValue() {
 				mylog.Fatalf("避坑日志:你开启了高级id转换,请设置hash_id为true,并且删除idmaps并重启")
 			}
-			//补救措施
-			idmap.SimplifiedStoreID(data.Author.ID)
-			//补救措施
 			echo.AddMsgIDv3(AppIDString, data.Author.ID, data.ID)
 		} else {
 			//将真实id转为int userid64
@@ -99,7 +96,9 @@ func (p *Processors) ProcessC2CMessage(data *dto.WSC2CMessageData) error {
 			return nil
 		}
 		//框架内指令
-		p.HandleFrameworkCommand(messageText, data, "group_private")
+		if p.HandleFrameworkCommand(messageText, data, "group_private") {
+			return nil
+		}
 		// 如果在Array模式下, 则处理Message为Segment格式
 		var segmentedMessages interface{} = messageText
 		if config.GetArrayValue() {
@@ -202,10 +201,6 @@ func (p *Processors) ProcessC2CMessage(data *dto.WSC2CMessageData) error {
 				if err != nil {
 					mylog.Errorf("Error storing ID: %v", err)
 				}
-				//当参数不全,降级时
-				_, _ = idmap.StoreIDv2(data.Author.ID)
-				//补救措施
-				idmap.SimplifiedStoreID(data.Author.ID)
 			} else {
 				//将真实id转为int userid64
 				userid64, err = idmap.StoreIDv2(data.Author.ID)
@@ -220,7 +215,9 @@ func (p *Processors) ProcessC2CMessage(data *dto.WSC2CMessageData) error {
 				return nil
 			}
 			//框架内指令
-			p.HandleFrameworkCommand(messageText, data, "group_private")
+			if p.HandleFrameworkCommand(messageText, data, "group_private") {
+				return nil
+			}
 			//映射str的messageID到int
 			var messageID64 int64
 			if config.GetMemoryMsgid() {
@@ -284,24 +281,8 @@ func (p *Processors) ProcessC2CMessage(data *dto.WSC2CMessageData) error {
 				//用向应用端(如果支持)发送echo,来确定客户端的send_msg对应的触发词原文
 				echo.AddMsgIDv3(AppIDString, echostr, messageText)
 			}
-			// 获取MasterID数组
-			masterIDs := config.GetMasterID()
-
-			// 判断userid64是否在masterIDs数组里
-			isMaster := false
-			for _, id := range masterIDs {
-				if strconv.FormatInt(userid64, 10) == id {
-					isMaster = true
-					break
-				}
-			}
-
-			// 根据isMaster的值为groupMsg的Sender赋值role字段
-			if isMaster {
-				groupMsg.Sender.Role = "owner"
-			} else {
-				groupMsg.Sender.Role = "member"
-			}
+			// 根据角色表为Sender赋值role字段 群内角色优先,master_id视为owner
+			groupMsg.Sender.Role = idmap.ResolveRole("", idmap.RoleMember, data.Author.ID, strconv.FormatInt(userid64, 10))
 			//将当前s和appid和message进行映射
 			echo.AddMsgID(AppIDString, s, data.ID)
 			echo.AddMsgType(AppIDString, s, "group_private")
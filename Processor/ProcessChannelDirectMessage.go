@@ -19,6 +19,8 @@ import (
 
 // ProcessChannelDirectMessage 处理频道私信消息 这里我们是被动收到
 func (p *Processors) ProcessChannelDirectMessage(data *dto.WSDirectMessageData) error {
+	// 记录信息来源,撤回时只需要message_id
+	idmap.StoreMessageScope(data.ID, idmap.MessageScope{Type: idmap.ScopeGuildPrivate, TargetID: data.GuildID})
 	// 打印data结构体
 	//PrintStructWithFieldNames(data)
 
@@ -62,13 +64,7 @@ func (p *Processors) ProcessChannelDirectMessage(data *dto.WSDirectMessageData)
 			if !config.GetHashIDValue() {
 				mylog.Fatalf("避坑日志:你开启了高级id转换,请设置hash_id为true,并且删除idmaps并重启")
 			}
-			//补救措施
-			idmap.SimplifiedStoreID(data.Author.ID)
-			//补救措施
-			idmap.SimplifiedStoreID(data.ChannelID)
-			//补救措施
 			echo.AddMsgIDv3(AppIDString, data.ChannelID, data.ID)
-			//补救措施
 			echo.AddMsgIDv3(AppIDString, data.Author.ID, data.ID)
 		} else {
 			//将真实id转为int userid64
@@ -115,7 +111,9 @@ func (p *Processors) ProcessChannelDirectMessage(data *dto.WSDirectMessageData)
 			return nil
 		}
 		//框架内指令
-		p.HandleFrameworkCommand(messageText, data, "guild_private")
+		if p.HandleFrameworkCommand(messageText, data, "guild_private") {
+			return nil
+		}
 		// 如果在Array模式下, 则处理Message为Segment格式
 		var segmentedMessages interface{} = messageText
 		if config.GetArrayValue() {
@@ -198,7 +196,9 @@ func (p *Processors) ProcessChannelDirectMessage(data *dto.WSDirectMessageData)
 				return nil
 			}
 			//框架内指令
-			p.HandleFrameworkCommand(messageText, data, "guild_private")
+			if p.HandleFrameworkCommand(messageText, data, "guild_private") {
+				return nil
+			}
 			//转换appid
 			AppIDString := strconv.FormatUint(p.Settings.AppID, 10)
 			// 获取当前时间的13位毫秒级时间戳
@@ -242,6 +242,8 @@ func (p *Processors) ProcessChannelDirectMessage(data *dto.WSDirectMessageData)
 				SubType: "channel",
 				Time:    t.Unix(),
 				Avatar:  data.Author.Avatar,
+				// 与子频道信息区分,快速操作据此回复私信
+				RealMessageType: "guild_private",
 			}
 			// 根据条件判断是否添加Echo字段
 			if config.GetTwoWayEcho() {
@@ -249,24 +251,8 @@ func (p *Processors) ProcessChannelDirectMessage(data *dto.WSDirectMessageData)
 				//用向应用端(如果支持)发送echo,来确定客户端的send_msg对应的触发词原文
 				echo.AddMsgIDv3(AppIDString, echostr, messageText)
 			}
-			// 获取MasterID数组
-			masterIDs := config.GetMasterID()
-
-			// 判断userid64是否在masterIDs数组里
-			isMaster := false
-			for _, id := range masterIDs {
-				if strconv.FormatInt(userid64, 10) == id {
-					isMaster = true
-					break
-				}
-			}
-
-			// 根据isMaster的值为groupMsg的Sender赋值role字段
-			if isMaster {
-				onebotMsg.Sender.Role = "owner"
-			} else {
-				onebotMsg.Sender.Role = "member"
-			}
+			// 根据角色表为Sender赋值role字段 群内角色优先,master_id视为owner
+			onebotMsg.Sender.Role = idmap.ResolveRole("", idmap.RoleMember, data.Author.ID, strconv.FormatInt(userid64, 10))
 			//将当前s和appid和message进行映射
 			echo.AddMsgID(AppIDString, s, data.ID)
 			//通过echo始终得知真实的事件类型,来对应调用正确的api
@@ -314,10 +300,6 @@ func (p *Processors) ProcessChannelDirectMessage(data *dto.WSDirectMessageData)
 				if !config.GetHashIDValue() {
 					mylog.Fatalf("避坑日志:你开启了高级id转换,请设置hash_id为true,并且删除idmaps并重启")
 				}
-				//补救措施
-				idmap.SimplifiedStoreID(data.Author.ID)
-				//补救措施
-				idmap.SimplifiedStoreID(data.ChannelID)
 			} else {
 				//将真实id转为int userid64
 				userid64, err = idmap.StoreIDv2(data.Author.ID)
@@ -342,7 +324,9 @@ func (p *Processors) ProcessChannelDirectMessage(data *dto.WSDirectMessageData)
 				return nil
 			}
 			//框架内指令
-			p.HandleFrameworkCommand(messageText, data, "guild_private")
+			if p.HandleFrameworkCommand(messageText, data, "guild_private") {
+				return nil
+			}
 			//转换appid
 			AppIDString := strconv.FormatUint(p.Settings.AppID, 10)
 			// 获取当前时间的13位毫秒级时间戳
@@ -418,24 +402,8 @@ func (p *Processors) ProcessChannelDirectMessage(data *dto.WSDirectMessageData)
 				//用向应用端(如果支持)发送echo,来确定客户端的send_msg对应的触发词原文
 				echo.AddMsgIDv3(AppIDString, echostr, messageText)
 			}
-			// 获取MasterID数组
-			masterIDs := config.GetMasterID()
-
-			// 判断userid64是否在masterIDs数组里
-			isMaster := false
-			for _, id := range masterIDs {
-				if strconv.FormatInt(userid64, 10) == id {
-					isMaster = true
-					break
-				}
-			}
-
-			// 根据isMaster的值为groupMsg的Sender赋值role字段
-			if isMaster {
-				groupMsg.Sender.Role = "owner"
-			} else {
-				groupMsg.Sender.Role = "member"
-			}
+			// 根据角色表为Sender赋值role字段 群内角色优先,master_id视为owner
+			groupMsg.Sender.Role = idmap.ResolveRole("", idmap.RoleMember, data.Author.ID, strconv.FormatInt(userid64, 10))
 			//将当前s和appid和message进行映射
 			echo.AddMsgID(AppIDString, s, data.ID)
 			echo.AddMsgType(AppIDString, s, "guild_private")
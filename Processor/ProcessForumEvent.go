@@ -0,0 +1,176 @@
+// 处理论坛子频道的帖子、评论、回复和审核事件
+package Processor
+
+import (
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/handlers"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// ForumNoticeEvent 帖子、评论、回复的通知 guild_id与channel_id为真实id
+type ForumNoticeEvent struct {
+	PostType   string      `json:"post_type"`
+	NoticeType string      `json:"notice_type"`
+	Time       int64       `json:"time"`
+	SelfID     int64       `json:"self_id"`
+	GuildID    string      `json:"guild_id"`
+	ChannelID  string      `json:"channel_id"`
+	GroupID    int64       `json:"group_id,omitempty"` //开启global_channel_to_group时子频道对应的群号
+	UserID     int64       `json:"user_id"`
+	ThreadID   string      `json:"thread_id"`
+	PostID     string      `json:"post_id,omitempty"`
+	ReplyID    string      `json:"reply_id,omitempty"`
+	Title      string      `json:"title,omitempty"`
+	Message    interface{} `json:"message,omitempty"`
+	RawMessage string      `json:"raw_message,omitempty"`
+	RealUserID string      `json:"real_user_id,omitempty"` //当前真实uid
+}
+
+// ForumAuditNoticeEvent 帖子、评论、回复的审核结果 sub_type为pass或reject
+type ForumAuditNoticeEvent struct {
+	PostType    string `json:"post_type"`
+	NoticeType  string `json:"notice_type"`
+	SubType     string `json:"sub_type"`
+	Time        int64  `json:"time"`
+	SelfID      int64  `json:"self_id"`
+	TaskID      string `json:"task_id"` //与发帖时返回的一致
+	PublishType string `json:"publish_type"`
+	GuildID     string `json:"guild_id"`
+	ChannelID   string `json:"channel_id"`
+	GroupID     int64  `json:"group_id,omitempty"`
+	UserID      int64  `json:"user_id,omitempty"`
+	ThreadID    string `json:"thread_id,omitempty"`
+	PostID      string `json:"post_id,omitempty"`
+	ReplyID     string `json:"reply_id,omitempty"`
+	ErrMsg      string `json:"err_msg,omitempty"`
+}
+
+// 论坛事件与通知类型的对应关系
+var forumNoticeTypes = map[dto.EventType]string{
+	dto.EventForumThreadUpdate: "forum_thread_updated",
+	dto.EventForumThreadDelete: "forum_thread_deleted",
+	dto.EventForumPostCreate:   "forum_post_created",
+	dto.EventForumPostDelete:   "forum_post_deleted",
+	dto.EventForumReplyCreate:  "forum_reply_created",
+	dto.EventForumReplyDelete:  "forum_reply_deleted",
+}
+
+// 审核事件中的发表类型
+var forumPublishTypes = map[uint32]string{
+	1: "thread",
+	2: "post",
+	3: "reply",
+}
+
+// ProcessThreadEvent 处理帖子的修改和删除 发帖仍由ProcessThreadMessage上报为信息
+func (p *Processors) ProcessThreadEvent(eventType dto.EventType, data *dto.WSThreadData) error {
+	Notice, ok := p.newForumNotice(eventType, data.GuildID, data.ChannelID, data.AuthorID)
+	if !ok {
+		return nil
+	}
+	Notice.ThreadID = data.ThreadInfo.ThreadID
+	Notice.Title = data.ThreadInfo.Title
+	if eventType != dto.EventForumThreadDelete && data.ThreadInfo.Content != "" {
+		Notice.Message, Notice.RawMessage = handlers.ForumMessage(data.ThreadInfo.Content)
+	}
+	return p.broadcastForumNotice(Notice, data)
+}
+
+// ProcessPostEvent 处理帖子评论的发表和删除
+func (p *Processors) ProcessPostEvent(eventType dto.EventType, data *dto.WSPostData) error {
+	Notice, ok := p.newForumNotice(eventType, data.GuildID, data.ChannelID, data.AuthorID)
+	if !ok {
+		return nil
+	}
+	Notice.ThreadID = data.PostInfo.ThreadID
+	Notice.PostID = data.PostInfo.PostID
+	if data.PostInfo.Content != "" {
+		Notice.Message, Notice.RawMessage = handlers.ForumMessage(data.PostInfo.Content)
+	}
+	return p.broadcastForumNotice(Notice, data)
+}
+
+// ProcessReplyEvent 处理评论回复的发表和删除
+func (p *Processors) ProcessReplyEvent(eventType dto.EventType, data *dto.WSReplyData) error {
+	Notice, ok := p.newForumNotice(eventType, data.GuildID, data.ChannelID, data.AuthorID)
+	if !ok {
+		return nil
+	}
+	Notice.ThreadID = data.ReplyInfo.ThreadID
+	Notice.PostID = data.ReplyInfo.PostID
+	Notice.ReplyID = data.ReplyInfo.ReplyID
+	if data.ReplyInfo.Content != "" {
+		Notice.Message, Notice.RawMessage = handlers.ForumMessage(data.ReplyInfo.Content)
+	}
+	return p.broadcastForumNotice(Notice, data)
+}
+
+// ProcessForumAudit 处理机器人发帖的审核结果 result为0时审核通过
+func (p *Processors) ProcessForumAudit(data *dto.WSForumAuditData) error {
+	Notice := ForumAuditNoticeEvent{
+		PostType:    "notice",
+		NoticeType:  "forum_audit",
+		SubType:     "pass",
+		Time:        time.Now().Unix(),
+		SelfID:      p.selfID(),
+		TaskID:      data.TaskID,
+		PublishType: forumPublishTypes[data.PublishType],
+		GuildID:     data.GuildID,
+		ChannelID:   data.ChannelID,
+		ThreadID:    data.ThreadID,
+		PostID:      data.PostID,
+		ReplyID:     data.ReplyID,
+		ErrMsg:      data.ErrMsg,
+	}
+	if data.Result != 0 {
+		Notice.SubType = "reject"
+	}
+	Notice.UserID, _ = storeOptionalID(data.AuthorID)
+	if p.Settings.GlobalChannelToGroup {
+		Notice.GroupID = storeChannelGroup(data.ChannelID, data.GuildID)
+	}
+
+	mylog.Printf("帖子审核%v task_id[%v]", Notice.SubType, data.TaskID)
+	go p.BroadcastMessageToAll(structToMap(Notice), p.Apiv2, data)
+	return nil
+}
+
+// newForumNotice 生成论坛通知的公共部分
+func (p *Processors) newForumNotice(eventType dto.EventType, guildID, channelID, authorID string) (ForumNoticeEvent, bool) {
+	noticeType, ok := forumNoticeTypes[eventType]
+	if !ok {
+		mylog.Printf("未知的论坛事件:%v", eventType)
+		return ForumNoticeEvent{}, false
+	}
+	userid64, err := storeOptionalID(authorID)
+	if err != nil {
+		return ForumNoticeEvent{}, false
+	}
+	Notice := ForumNoticeEvent{
+		PostType:   "notice",
+		NoticeType: noticeType,
+		Time:       time.Now().Unix(),
+		SelfID:     p.selfID(),
+		GuildID:    guildID,
+		ChannelID:  channelID,
+		UserID:     userid64,
+	}
+	if p.Settings.GlobalChannelToGroup {
+		Notice.GroupID = storeChannelGroup(channelID, guildID)
+	}
+	//增强配置
+	if !config.GetNativeOb11() {
+		Notice.RealUserID = authorID
+	}
+	return Notice, true
+}
+
+// broadcastForumNotice 上报论坛通知
+func (p *Processors) broadcastForumNotice(Notice ForumNoticeEvent, data interface{}) error {
+	mylog.Printf("子频道[%v]帖子[%v]%v", Notice.ChannelID, Notice.ThreadID, Notice.NoticeType)
+	go p.BroadcastMessageToAll(structToMap(Notice), p.Apiv2, data)
+	return nil
+}
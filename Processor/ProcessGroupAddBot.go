@@ -2,10 +2,10 @@
 package Processor
 
 import (
-	"math/rand"
+	"fmt"
 	"strconv"
+	"time"
 
-	"github.com/hoshinonyaruko/gensokyo/callapi"
 	"github.com/hoshinonyaruko/gensokyo/config"
 	"github.com/hoshinonyaruko/gensokyo/echo"
 	"github.com/hoshinonyaruko/gensokyo/handlers"
@@ -43,22 +43,8 @@ type GroupNoticeEvent struct {
 	RealGroupID string `json:"real_group_id,omitempty"` //当前真实gid
 }
 
-// 定义了一个符合 Client 接口的 SelfIntroduceClient 结构体
-type SelfIntroduceClient struct {
-	// 可添加所需字段
-}
-
-// 实现 Client 接口的 SendMessage 方法
-// 假client中不执行任何操作，只是返回 nil 来符合接口要求
-func (c *SelfIntroduceClient) SendMessage(message map[string]interface{}) error {
-	// 不实际发送消息
-	// log.Printf("SendMessage called with: %v", message)
-
-	// 返回nil占位符
-	return nil
-}
-
 // ProcessGroupAddBot 处理机器人增加
+// 机器人此时已经在群内,上报group_increase通知和可被set_group_add_request处理的request事件
 func (p *Processors) ProcessGroupAddBot(data *dto.GroupAddBotEvent) error {
 	var userid64 int64
 	var GroupID64 int64
@@ -82,20 +68,9 @@ func (p *Processors) ProcessGroupAddBot(data *dto.GroupAddBotEvent) error {
 			return nil
 		}
 	}
-	var timestampInt64 int64
-	switch v := data.Timestamp.(type) {
-	case string:
-		timestampInt64, err = strconv.ParseInt(v, 10, 64)
-		if err != nil {
-			mylog.Printf("Error converting timestamp string to int64: %v", err)
-			return nil
-		}
-	case int64:
-		timestampInt64 = v
-	case float64:
-		timestampInt64 = int64(v)
-	default:
-		mylog.Printf("Invalid type for timestamp: %T", v)
+	timestampInt64, err := parseEventTimestamp(data.Timestamp)
+	if err != nil {
+		mylog.Printf("%v", err)
 		return nil
 	}
 
@@ -106,9 +81,36 @@ func (p *Processors) ProcessGroupAddBot(data *dto.GroupAddBotEvent) error {
 		selfid64 = int64(p.Settings.AppID)
 	}
 
+	// 记录已加入的群 新加入的群默认允许主动推送
+	err = idmap.StoreJoinedGroup(idmap.JoinedGroup{
+		GroupOpenID:   data.GroupOpenID,
+		GroupID:       GroupID64,
+		InviterOpenID: data.OpMemberOpenID,
+		JoinTime:      timestampInt64,
+		PushEnabled:   true,
+	})
+	if err != nil {
+		mylog.Printf("记录已加入的群失败: %v", err)
+	}
+
+	// 保存请求 应用端通过flag同意或拒绝
+	groupRequest := idmap.GroupRequest{
+		Flag:        groupAddRequestFlag(data),
+		GroupOpenID: data.GroupOpenID,
+		GroupID:     GroupID64,
+		UserOpenID:  data.OpMemberOpenID,
+		UserID:      userid64,
+		EventID:     data.EventID,
+		Time:        timestampInt64,
+	}
+	err = idmap.StoreGroupRequest(groupRequest)
+	if err != nil {
+		mylog.Printf("保存入群请求失败: %v", err)
+	}
+
 	Request = GroupRequestEvent{
 		Comment:     "",
-		Flag:        "",
+		Flag:        groupRequest.Flag,
 		GroupID:     GroupID64,
 		PostType:    "request",
 		RequestType: "group",
@@ -133,6 +135,11 @@ func (p *Processors) ProcessGroupAddBot(data *dto.GroupAddBotEvent) error {
 		Time:       timestampInt64,
 		UserID:     userid64,
 	}
+	// 按规范上报时加入者是机器人自己,邀请者是操作者
+	if config.GetGroupNoticeStandard() {
+		Notice.UserID = selfid64
+		Notice.OperatorID = userid64
+	}
 	//增强配置
 	if !config.GetNativeOb11() {
 		Notice.RealUserID = data.OpMemberOpenID
@@ -153,39 +160,15 @@ func (p *Processors) ProcessGroupAddBot(data *dto.GroupAddBotEvent) error {
 	// 储存和群号相关的eventid
 	echo.AddEvnetID(AppIDString, GroupID64, data.EventID)
 
-	mylog.Printf("Bot被[%v]邀请进入群[%v]eventid[%v]", userid64, GroupID64, data.EventID)
-
-	// 调用GetSelfIntroduce函数
-	intros := config.GetSelfIntroduce()
-
-	// 检查intros是否为空或只包含空字符串
-	var validIntros []string
-	for _, intro := range intros {
-		if intro != "" {
-			validIntros = append(validIntros, intro)
-		}
-	}
-
-	// 如果设置了自我介绍
-	if len(validIntros) != 0 {
-		// 从validIntros中随机选择一个
-		selectedIntro := validIntros[rand.Intn(len(validIntros))]
+	mylog.Printf("Bot被[%v]邀请进入群[%v]eventid[%v]flag[%v]", userid64, GroupID64, data.EventID, groupRequest.Flag)
 
-		// 创建 ActionMessage 实例
-		message := callapi.ActionMessage{
-			Action: "send_group_msg_group",
-			Params: callapi.ParamsContent{
-				GroupID: strconv.FormatInt(GroupID64, 10), // 转换 GroupID 类型
-				UserID:  strconv.FormatInt(userid64, 10),
-				Message: selectedIntro,
-			},
-		}
-		// clinet是发回值用的 这里相当于和http一样 不发回值所以建立一个假的client
-		client := &SelfIntroduceClient{}
-		// 调用处理函数
-		_, err = handlers.HandleSendGroupMsg(client, p.Api, p.Apiv2, message)
+	// 未开启手动处理时自动同意 直接发送自我介绍
+	if !config.GetGroupAddRequestManual() {
+		groupRequest, err = idmap.ResolveGroupRequest(groupRequest.Flag, true, "")
 		if err != nil {
-			mylog.Printf("自我介绍发送失败%v", err)
+			mylog.Printf("自动同意入群请求失败: %v", err)
+		} else {
+			handlers.SendSelfIntroduce(p.Api, p.Apiv2, groupRequest)
 		}
 	}
 
@@ -197,3 +180,33 @@ func (p *Processors) ProcessGroupAddBot(data *dto.GroupAddBotEvent) error {
 
 	return nil
 }
+
+// groupAddRequestFlag 入群请求的flag 使用事件id保证唯一
+func groupAddRequestFlag(data *dto.GroupAddBotEvent) string {
+	if data.EventID != "" {
+		return "group_add_" + data.EventID
+	}
+	if data.ID != "" {
+		return "group_add_" + data.ID
+	}
+	return "group_add_" + data.GroupOpenID + "_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+}
+
+// parseEventTimestamp 群事件的timestamp可能是字符串或数字
+func parseEventTimestamp(timestamp interface{}) (int64, error) {
+	switch v := timestamp.(type) {
+	case string:
+		timestampInt64, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Error converting timestamp string to int64: %v", err)
+		}
+		return timestampInt64, nil
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	case nil:
+		return time.Now().Unix(), nil
+	}
+	return 0, fmt.Errorf("Invalid type for timestamp: %T", timestamp)
+}
@@ -3,7 +3,6 @@ package Processor
 
 import (
 	"fmt"
-	"strconv"
 
 	"github.com/hoshinonyaruko/gensokyo/config"
 	"github.com/hoshinonyaruko/gensokyo/idmap"
@@ -34,25 +33,21 @@ func (p *Processors) ProcessGroupDelBot(data *dto.GroupAddBotEvent) error {
 			return nil
 		}
 	}
-	var timestampInt64 int64
-	switch v := data.Timestamp.(type) {
-	case string:
-		timestampInt64, err = strconv.ParseInt(v, 10, 64)
-		if err != nil {
-			mylog.Printf("Error converting timestamp string to int64: %v", err)
-			return nil
-		}
-	case int64:
-		timestampInt64 = v
-	case float64:
-		timestampInt64 = int64(v)
-	default:
-		mylog.Printf("Invalid type for timestamp: %T", v)
+	timestampInt64, err := parseEventTimestamp(data.Timestamp)
+	if err != nil {
+		mylog.Printf("%v", err)
 		return nil
 	}
 	mylog.Printf("Bot被[%v]从群[%v]移出", userid64, GroupID64)
 	//从数据库删除群数据(仅删除类型缓存,再次加入会刷新)
 	idmap.DeleteConfigv2(fmt.Sprint(GroupID64), "type")
+	//从已加入的群中移除
+	if err := idmap.RemoveJoinedGroup(data.GroupOpenID); err != nil {
+		mylog.Printf("移除已加入的群失败: %v", err)
+	}
+	if err := idmap.RemoveRosterGroup(data.GroupOpenID); err != nil {
+		mylog.Printf("清除群成员记录失败: %v", err)
+	}
 
 	var selfid64 int64
 	if config.GetUseUin() {
@@ -70,6 +65,11 @@ func (p *Processors) ProcessGroupDelBot(data *dto.GroupAddBotEvent) error {
 		Time:       timestampInt64,
 		UserID:     userid64,
 	}
+	// 按规范上报时离开者是机器人自己,移出者是操作者
+	if config.GetGroupNoticeStandard() {
+		Notice.UserID = selfid64
+		Notice.OperatorID = userid64
+	}
 	//增强配置
 	if !config.GetNativeOb11() {
 		Notice.RealUserID = data.OpMemberOpenID
@@ -20,6 +20,8 @@ import (
 
 // ProcessGroupMessage 处理群组消息
 func (p *Processors) ProcessGroupMessage(data *dto.WSGroupATMessageData) error {
+	// 记录信息来源,撤回时只需要message_id
+	idmap.StoreMessageScope(data.ID, idmap.MessageScope{Type: idmap.ScopeGroup, TargetID: data.GroupID})
 	// 获取s
 	s := client.GetGlobalS()
 
@@ -48,17 +50,9 @@ func (p *Processors) ProcessGroupMessage(data *dto.WSGroupATMessageData) error {
 			if err != nil {
 				mylog.Errorf("Error storing ID: %v", err)
 			}
-			//当参数不全
-			_, _ = idmap.StoreIDv2(data.GroupID)
-			_, _ = idmap.StoreIDv2(data.Author.ID)
 			if !config.GetHashIDValue() {
 				mylog.Fatalf("避坑日志:你开启了高级id转换,请设置hash_id为true,并且删除idmaps并重启")
 			}
-			//补救措施
-			idmap.SimplifiedStoreID(data.Author.ID)
-			//补救措施
-			idmap.SimplifiedStoreID(data.GroupID)
-			//补救措施
 			echo.AddMsgIDv3(AppIDString, data.GroupID, data.ID)
 		} else {
 			// 映射str的GroupID到int
@@ -76,6 +70,10 @@ func (p *Processors) ProcessGroupMessage(data *dto.WSGroupATMessageData) error {
 		}
 	}
 
+	// 记录群成员发言和所在的群
+	idmap.RecordGroupActivity(data.GroupID, data.Author.ID, GroupID64, userid64, data.Author.Username)
+	idmap.EnsureJoinedGroup(data.GroupID, GroupID64)
+
 	var messageText string
 	GetDisableErrorChan := config.GetDisableErrorChan()
 
@@ -89,7 +87,9 @@ func (p *Processors) ProcessGroupMessage(data *dto.WSGroupATMessageData) error {
 		}
 
 		//框架内指令
-		p.HandleFrameworkCommand(messageText, data, "group")
+		if p.HandleFrameworkCommand(messageText, data, "group") {
+			return nil
+		}
 	} else {
 		// 减少无用的性能开支
 		messageText = data.Content
@@ -213,24 +213,8 @@ func (p *Processors) ProcessGroupMessage(data *dto.WSGroupATMessageData) error {
 			//用向应用端(如果支持)发送echo,来确定客户端的send_msg对应的触发词原文
 			echo.AddMsgIDv3(AppIDString, echostr, messageText)
 		}
-		// 获取MasterID数组
-		masterIDs := config.GetMasterID()
-
-		// 判断userid64是否在masterIDs数组里
-		isMaster := false
-		for _, id := range masterIDs {
-			if strconv.FormatInt(userid64, 10) == id {
-				isMaster = true
-				break
-			}
-		}
-
-		// 根据isMaster的值为groupMsg的Sender赋值role字段
-		if isMaster {
-			groupMsg.Sender.Role = "owner"
-		} else {
-			groupMsg.Sender.Role = "member"
-		}
+		// 根据角色表为Sender赋值role字段 群内角色优先,master_id视为owner
+		groupMsg.Sender.Role = idmap.ResolveRole(data.GroupID, idmap.RoleMember, data.Author.ID, strconv.FormatInt(userid64, 10))
 		// 将当前s和appid和message进行映射
 		echo.AddMsgID(AppIDString, s, data.ID)
 		echo.AddMsgType(AppIDString, s, "group")
@@ -302,23 +286,8 @@ func (p *Processors) ProcessGroupMessage(data *dto.WSGroupATMessageData) error {
 			//用向应用端(如果支持)发送echo,来确定客户端的send_msg对应的触发词原文
 			echo.AddMsgIDv3(AppIDString, echostr, messageText)
 		}
-		// 获取MasterID数组
-		masterIDs := config.GetMasterID()
-
-		// 判断userid64是否在masterIDs数组里
-		isMaster := false
-		for _, id := range masterIDs {
-			if strconv.FormatInt(userid64, 10) == id {
-				isMaster = true
-				break
-			}
-		}
-		// 根据isMaster的值为groupMsg的Sender赋值role字段
-		if isMaster {
-			groupMsgS.Sender.Role = "owner"
-		} else {
-			groupMsgS.Sender.Role = "member"
-		}
+		// 根据角色表为Sender赋值role字段 群内角色优先,master_id视为owner
+		groupMsgS.Sender.Role = idmap.ResolveRole(data.GroupID, idmap.RoleMember, data.Author.ID, strconv.FormatInt(userid64, 10))
 		// 将当前s和appid和message进行映射
 		echo.AddMsgID(AppIDString, s, data.ID)
 		echo.AddMsgType(AppIDString, s, "group")
@@ -75,6 +75,16 @@ func (p *Processors) ProcessGroupMsgRecive(data *dto.GroupMsgReceiveEvent) error
 		selfid64 = int64(p.Settings.AppID)
 	}
 
+	// 记录群的主动推送开关
+	if err := idmap.SetGroupPushEnabled(data.GroupOpenID, GroupID64, true); err != nil {
+		mylog.Printf("更新群主动推送状态失败: %v", err)
+	}
+	timestampInt64, err := parseEventTimestamp(data.Timestamp)
+	if err != nil {
+		mylog.Printf("%v", err)
+		timestampInt64 = time.Now().Unix()
+	}
+
 	if !config.GetGlobalGroupMsgRejectReciveEventToMessage() {
 		notice := &OnebotGroupReceiveNotice{
 			GroupID:    GroupID64,
@@ -82,10 +92,19 @@ func (p *Processors) ProcessGroupMsgRecive(data *dto.GroupMsgReceiveEvent) error
 			PostType:   "notice",
 			SelfID:     selfid64,
 			SubType:    "create",
-			Time:       time.Now().Unix(),
+			Time:       timestampInt64,
 			UserID:     userid64,
 			Data:       data,
 		}
+		// 按规范上报推送开关的变化 默认与旧版本一致
+		if config.GetGroupNoticeStandard() {
+			notice.SubType = "enable"
+		}
+		//增强配置
+		if !config.GetNativeOb11() {
+			notice.RealUserID = data.OpMemberOpenID
+			notice.RealGroupID = data.GroupOpenID
+		}
 		//调试
 		PrintStructWithFieldNames(notice)
 
@@ -171,24 +190,8 @@ func (p *Processors) ProcessGroupMsgRecive(data *dto.GroupMsgReceiveEvent) error
 				//用向应用端(如果支持)发送echo,来确定客户端的send_msg对应的触发词原文
 				echo.AddMsgIDv3(AppIDString, echostr, newdata.Content)
 			}
-			// 获取MasterID数组
-			masterIDs := config.GetMasterID()
-
-			// 判断userid64是否在masterIDs数组里
-			isMaster := false
-			for _, id := range masterIDs {
-				if strconv.FormatInt(userid64, 10) == id {
-					isMaster = true
-					break
-				}
-			}
-
-			// 根据isMaster的值为groupMsg的Sender赋值role字段
-			if isMaster {
-				groupMsg.Sender.Role = "owner"
-			} else {
-				groupMsg.Sender.Role = "member"
-			}
+			// 根据角色表为Sender赋值role字段 群内角色优先,master_id视为owner
+			groupMsg.Sender.Role = idmap.ResolveRole(fromgid, idmap.RoleMember, fromuid, strconv.FormatInt(userid64, 10))
 
 			// 映射消息类型
 			echo.AddMsgType(AppIDString, s, "group")
@@ -39,8 +39,6 @@ func (p *Processors) ProcessGroupMsgReject(data *dto.GroupMsgRejectEvent) error
 	// 构造echostr，包括AppID，原始的s变量和当前时间戳
 	echostr := fmt.Sprintf("%s_%d_%d", AppIDString, s, currentTimeMillis)
 
-	fmt.Printf("快乐测试[%v][%v]\n", fromgid, fromuid)
-
 	if config.GetIdmapPro() {
 		//将真实id转为int userid64
 		GroupID64, userid64, err = idmap.StoreIDv2Pro(fromgid, fromuid)
@@ -76,6 +74,16 @@ func (p *Processors) ProcessGroupMsgReject(data *dto.GroupMsgRejectEvent) error
 		selfid64 = int64(p.Settings.AppID)
 	}
 
+	// 记录群的主动推送开关
+	if err := idmap.SetGroupPushEnabled(data.GroupOpenID, GroupID64, false); err != nil {
+		mylog.Printf("更新群主动推送状态失败: %v", err)
+	}
+	timestampInt64, err := parseEventTimestamp(data.Timestamp)
+	if err != nil {
+		mylog.Printf("%v", err)
+		timestampInt64 = time.Now().Unix()
+	}
+
 	if !config.GetGlobalGroupMsgRejectReciveEventToMessage() {
 		notice := &OnebotGroupRejectNotice{
 			GroupID:    GroupID64,
@@ -83,10 +91,19 @@ func (p *Processors) ProcessGroupMsgReject(data *dto.GroupMsgRejectEvent) error
 			PostType:   "notice",
 			SelfID:     selfid64,
 			SubType:    "create",
-			Time:       time.Now().Unix(),
+			Time:       timestampInt64,
 			UserID:     userid64,
 			Data:       data,
 		}
+		// 按规范上报推送开关的变化 默认与旧版本一致
+		if config.GetGroupNoticeStandard() {
+			notice.SubType = "disable"
+		}
+		//增强配置
+		if !config.GetNativeOb11() {
+			notice.RealUserID = data.OpMemberOpenID
+			notice.RealGroupID = data.GroupOpenID
+		}
 		//调试
 		PrintStructWithFieldNames(notice)
 
@@ -172,24 +189,8 @@ func (p *Processors) ProcessGroupMsgReject(data *dto.GroupMsgRejectEvent) error
 				//用向应用端(如果支持)发送echo,来确定客户端的send_msg对应的触发词原文
 				echo.AddMsgIDv3(AppIDString, echostr, newdata.Content)
 			}
-			// 获取MasterID数组
-			masterIDs := config.GetMasterID()
-
-			// 判断userid64是否在masterIDs数组里
-			isMaster := false
-			for _, id := range masterIDs {
-				if strconv.FormatInt(userid64, 10) == id {
-					isMaster = true
-					break
-				}
-			}
-
-			// 根据isMaster的值为groupMsg的Sender赋值role字段
-			if isMaster {
-				groupMsg.Sender.Role = "owner"
-			} else {
-				groupMsg.Sender.Role = "member"
-			}
+			// 根据角色表为Sender赋值role字段 群内角色优先,master_id视为owner
+			groupMsg.Sender.Role = idmap.ResolveRole(fromgid, idmap.RoleMember, fromuid, strconv.FormatInt(userid64, 10))
 
 			// 映射消息类型
 			echo.AddMsgType(AppIDString, s, "group")
@@ -19,6 +19,8 @@ import (
 
 // ProcessGuildATMessage 处理消息，执行逻辑并可能使用 api 发送响应
 func (p *Processors) ProcessGuildATMessage(data *dto.WSATMessageData) error {
+	// 记录信息来源,撤回时只需要message_id
+	idmap.StoreMessageScope(data.ID, idmap.MessageScope{Type: idmap.ScopeGuild, TargetID: data.ChannelID})
 	var AppIDString string
 	if !p.Settings.GlobalChannelToGroup {
 		// 将时间字符串转换为时间戳
@@ -35,7 +37,9 @@ func (p *Processors) ProcessGuildATMessage(data *dto.WSATMessageData) error {
 			return nil
 		}
 		//框架内指令
-		p.HandleFrameworkCommand(messageText, data, "guild")
+		if p.HandleFrameworkCommand(messageText, data, "guild") {
+			return nil
+		}
 		//转换appid
 		AppIDString = strconv.FormatUint(p.Settings.AppID, 10)
 
@@ -93,24 +97,8 @@ func (p *Processors) ProcessGuildATMessage(data *dto.WSATMessageData) error {
 			//用向应用端(如果支持)发送echo,来确定客户端的send_msg对应的触发词原文
 			echo.AddMsgIDv3(AppIDString, echostr, messageText)
 		}
-		// 获取MasterID数组
-		masterIDs := config.GetMasterID()
-
-		// 判断userid64是否在masterIDs数组里
-		isMaster := false
-		for _, id := range masterIDs {
-			if strconv.FormatInt(userid64, 10) == id {
-				isMaster = true
-				break
-			}
-		}
-
-		// 根据isMaster的值为groupMsg的Sender赋值role字段
-		if isMaster {
-			onebotMsg.Sender.Role = "owner"
-		} else {
-			onebotMsg.Sender.Role = "member"
-		}
+		// 根据角色表为Sender赋值role字段 群内角色优先,master_id视为owner
+		onebotMsg.Sender.Role = idmap.ResolveRole(data.ChannelID, idmap.RoleMember, data.Author.ID, strconv.FormatInt(userid64, 10))
 		//将当前s和appid和message进行映射
 		echo.AddMsgID(AppIDString, s, data.ID)
 		echo.AddMsgType(AppIDString, s, "guild")
@@ -148,17 +136,9 @@ func (p *Processors) ProcessGuildATMessage(data *dto.WSATMessageData) error {
 			if err != nil {
 				mylog.Errorf("Error storing ID: %v", err)
 			}
-			//当参数不全时
-			_, _ = idmap.StoreIDv2(data.ChannelID)
-			_, _ = idmap.StoreIDv2(data.Author.ID)
 			if !config.GetHashIDValue() {
 				mylog.Fatalf("避坑日志:你开启了高级id转换,请设置hash_id为true,并且删除idmaps并重启")
 			}
-			//补救措施
-			idmap.SimplifiedStoreID(data.Author.ID)
-			//补救措施
-			idmap.SimplifiedStoreID(data.ChannelID)
-			//补救措施
 			echo.AddMsgIDv3(AppIDString, data.ChannelID, data.ID)
 		} else {
 			//将channelid写入ini,可取出guild_id
@@ -185,7 +165,9 @@ func (p *Processors) ProcessGuildATMessage(data *dto.WSATMessageData) error {
 			return nil
 		}
 		//框架内指令
-		p.HandleFrameworkCommand(messageText, data, "guild")
+		if p.HandleFrameworkCommand(messageText, data, "guild") {
+			return nil
+		}
 		//转换appid
 		AppIDString := strconv.FormatUint(p.Settings.AppID, 10)
 
@@ -266,24 +248,8 @@ func (p *Processors) ProcessGuildATMessage(data *dto.WSATMessageData) error {
 			//用向应用端(如果支持)发送echo,来确定客户端的send_msg对应的触发词原文
 			echo.AddMsgIDv3(AppIDString, echostr, messageText)
 		}
-		// 获取MasterID数组
-		masterIDs := config.GetMasterID()
-
-		// 判断userid64是否在masterIDs数组里
-		isMaster := false
-		for _, id := range masterIDs {
-			if strconv.FormatInt(userid64, 10) == id {
-				isMaster = true
-				break
-			}
-		}
-
-		// 根据isMaster的值为groupMsg的Sender赋值role字段
-		if isMaster {
-			groupMsg.Sender.Role = "owner"
-		} else {
-			groupMsg.Sender.Role = "member"
-		}
+		// 根据角色表为Sender赋值role字段 群内角色优先,master_id视为owner
+		groupMsg.Sender.Role = idmap.ResolveRole(data.ChannelID, idmap.RoleMember, data.Author.ID, strconv.FormatInt(userid64, 10))
 		//将当前s和appid和message进行映射
 		echo.AddMsgID(AppIDString, s, data.ID)
 		echo.AddMsgType(AppIDString, s, "guild")
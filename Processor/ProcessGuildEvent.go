@@ -0,0 +1,249 @@
+// 处理收到的频道、子频道、成员事件
+package Processor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/handlers"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// GuildNoticeEvent 频道模式下的频道、子频道、成员通知 guild_id与channel_id与频道消息一致为真实id
+type GuildNoticeEvent struct {
+	PostType       string             `json:"post_type"`
+	NoticeType     string             `json:"notice_type"`
+	SubType        string             `json:"sub_type,omitempty"`
+	Time           int64              `json:"time"`
+	SelfID         int64              `json:"self_id"`
+	GuildID        string             `json:"guild_id"`
+	ChannelID      string             `json:"channel_id,omitempty"`
+	GroupID        int64              `json:"group_id,omitempty"` //开启global_channel_to_group时子频道对应的群号
+	UserID         int64              `json:"user_id,omitempty"`
+	OperatorID     int64              `json:"operator_id,omitempty"`
+	Nickname       string             `json:"nickname,omitempty"`
+	Roles          []string           `json:"roles,omitempty"`
+	GuildInfo      *GuildNoticeInfo   `json:"guild_info,omitempty"`
+	ChannelInfo    *ChannelNoticeInfo `json:"channel_info,omitempty"`
+	RealUserID     string             `json:"real_user_id,omitempty"`     //当前真实uid
+	RealOperatorID string             `json:"real_operator_id,omitempty"` //操作者真实uid
+}
+
+// GuildNoticeInfo 频道信息
+type GuildNoticeInfo struct {
+	GuildID     string `json:"guild_id"`
+	GuildName   string `json:"guild_name"`
+	MemberCount int    `json:"member_count"`
+	MaxMembers  int64  `json:"max_members"`
+	OwnerID     int64  `json:"owner_id"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+}
+
+// ChannelNoticeInfo 子频道信息
+type ChannelNoticeInfo struct {
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	ChannelType int    `json:"channel_type"`
+	SubType     int    `json:"channel_sub_type"`
+	ParentID    string `json:"parent_id,omitempty"`
+	OwnerID     int64  `json:"owner_id,omitempty"`
+	Position    int64  `json:"position"`
+}
+
+// 频道事件与通知类型的对应关系
+var guildNoticeTypes = map[dto.EventType]string{
+	dto.EventGuildCreate:   "guild_created",
+	dto.EventGuildUpdate:   "guild_updated",
+	dto.EventGuildDelete:   "guild_destroyed",
+	dto.EventChannelCreate: "channel_created",
+	dto.EventChannelUpdate: "channel_updated",
+	dto.EventChannelDelete: "channel_destroyed",
+}
+
+// ProcessGuildEvent 处理机器人加入、退出频道和频道资料变更
+func (p *Processors) ProcessGuildEvent(eventType dto.EventType, data *dto.WSGuildData) error {
+	noticeType, ok := guildNoticeTypes[eventType]
+	if !ok {
+		mylog.Printf("未知的频道事件:%v", eventType)
+		return nil
+	}
+	ownerID, _ := storeOptionalID(data.OwnerID)
+	Notice := GuildNoticeEvent{
+		PostType:   "notice",
+		NoticeType: noticeType,
+		Time:       time.Now().Unix(),
+		SelfID:     p.selfID(),
+		GuildID:    data.ID,
+		GuildInfo: &GuildNoticeInfo{
+			GuildID:     data.ID,
+			GuildName:   data.Name,
+			MemberCount: data.MemberCount,
+			MaxMembers:  data.MaxMembers,
+			OwnerID:     ownerID,
+			Description: data.Desc,
+			Icon:        data.Icon,
+		},
+	}
+	p.fillGuildOperator(&Notice, data.OpUserID)
+
+	mylog.Printf("频道[%v]%v 操作者[%v]", data.ID, noticeType, Notice.OperatorID)
+	go p.BroadcastMessageToAll(structToMap(Notice), p.Apiv2, data)
+	return nil
+}
+
+// ProcessChannelEvent 处理子频道的创建、修改、删除
+func (p *Processors) ProcessChannelEvent(eventType dto.EventType, data *dto.WSChannelData) error {
+	noticeType, ok := guildNoticeTypes[eventType]
+	if !ok {
+		mylog.Printf("未知的子频道事件:%v", eventType)
+		return nil
+	}
+	ownerID, _ := storeOptionalID(data.OwnerID)
+	Notice := GuildNoticeEvent{
+		PostType:   "notice",
+		NoticeType: noticeType,
+		Time:       time.Now().Unix(),
+		SelfID:     p.selfID(),
+		GuildID:    data.GuildID,
+		ChannelID:  data.ID,
+		ChannelInfo: &ChannelNoticeInfo{
+			ChannelID:   data.ID,
+			ChannelName: data.Name,
+			ChannelType: int(data.Type),
+			SubType:     int(data.SubType),
+			ParentID:    data.ParentID,
+			OwnerID:     ownerID,
+			Position:    data.Position,
+		},
+	}
+	p.fillGuildOperator(&Notice, data.OpUserID)
+
+	// 子频道被视为群时附带对应的群号
+	if p.Settings.GlobalChannelToGroup {
+		Notice.GroupID = storeChannelGroup(data.ID, data.GuildID)
+	}
+
+	mylog.Printf("子频道[%v]%v 操作者[%v]", data.ID, noticeType, Notice.OperatorID)
+	go p.BroadcastMessageToAll(structToMap(Notice), p.Apiv2, data)
+	return nil
+}
+
+// ProcessMemberEvent 处理频道成员的加入、退出和资料变更
+// 开启global_channel_to_group时加入和退出上报为group_increase与group_decrease
+// 成员事件属于整个频道而不是某个子频道,group_id为频道id对应的虚拟值,与子频道信息的group_id不同
+// 通知中同时附带真实的guild_id,应用端可以按guild_id找到该频道下的子频道
+func (p *Processors) ProcessMemberEvent(eventType dto.EventType, data *dto.WSGuildMemberData) error {
+	if data.User == nil {
+		mylog.Printf("频道成员事件缺少用户:%v", data)
+		return nil
+	}
+	var subType string
+	switch eventType {
+	case dto.EventGuildMemberAdd:
+		subType = "approve"
+		if data.OpUserID != "" && data.OpUserID != data.User.ID {
+			subType = "invite"
+		}
+	case dto.EventGuildMemberRemove:
+		subType = "leave"
+		if data.User.ID == handlers.BotID {
+			subType = "kick_me"
+		} else if data.OpUserID != "" && data.OpUserID != data.User.ID {
+			subType = "kick"
+		}
+	case dto.EventGuildMemberUpdate:
+	default:
+		mylog.Printf("未知的频道成员事件:%v", eventType)
+		return nil
+	}
+
+	timestamp := time.Now().Unix()
+	if t, err := data.JoinedAt.Time(); err == nil && eventType == dto.EventGuildMemberAdd && !t.IsZero() {
+		timestamp = t.Unix()
+	}
+
+	// 成员属于频道而不是某个子频道,global_channel_to_group时也没有对应的群,仍然上报guild_member_*通知
+	userid64, err := idmap.StoreIDv2(data.User.ID)
+	if err != nil {
+		mylog.Printf("Error storing ID: %v", err)
+		return nil
+	}
+	noticeType := map[dto.EventType]string{
+		dto.EventGuildMemberAdd:    "guild_member_increase",
+		dto.EventGuildMemberRemove: "guild_member_decrease",
+		dto.EventGuildMemberUpdate: "guild_member_updated",
+	}[eventType]
+	Notice := GuildNoticeEvent{
+		PostType:   "notice",
+		NoticeType: noticeType,
+		SubType:    subType,
+		Time:       timestamp,
+		SelfID:     p.selfID(),
+		GuildID:    data.GuildID,
+		UserID:     userid64,
+		OperatorID: userid64,
+		Nickname:   data.Nick,
+		Roles:      data.Roles,
+	}
+	if data.Nick == "" {
+		Notice.Nickname = data.User.Username
+	}
+	p.fillGuildOperator(&Notice, data.OpUserID)
+	//增强配置
+	if !config.GetNativeOb11() {
+		Notice.RealUserID = data.User.ID
+	}
+
+	mylog.Printf("频道[%v]成员[%v]%v", data.GuildID, userid64, noticeType)
+	go p.BroadcastMessageToAll(structToMap(Notice), p.Apiv2, data)
+	return nil
+}
+
+// fillGuildOperator 填写操作者 没有操作者时保持原值
+func (p *Processors) fillGuildOperator(notice *GuildNoticeEvent, opUserID string) {
+	operator64, err := storeOptionalID(opUserID)
+	if err != nil || operator64 == 0 {
+		return
+	}
+	notice.OperatorID = operator64
+	//增强配置
+	if !config.GetNativeOb11() {
+		notice.RealOperatorID = opUserID
+	}
+}
+
+// selfID 上报的self_id
+func (p *Processors) selfID() int64 {
+	if config.GetUseUin() {
+		return config.GetUinint64()
+	}
+	return int64(p.Settings.AppID)
+}
+
+// storeOptionalID 转换可能为空的真实id 为空时返回0
+func storeOptionalID(id string) (int64, error) {
+	if id == "" {
+		return 0, nil
+	}
+	id64, err := idmap.StoreIDv2(id)
+	if err != nil {
+		mylog.Printf("Error storing ID: %v", err)
+		return 0, err
+	}
+	return id64, nil
+}
+
+// storeChannelGroup 子频道对应的群号 与频道信息一致,在虚拟和真实的子频道id下都储存所属的频道
+func storeChannelGroup(channelID, guildID string) int64 {
+	ChannelID64, err := storeOptionalID(channelID)
+	if err != nil || ChannelID64 == 0 {
+		return 0
+	}
+	idmap.WriteConfigv2(fmt.Sprint(ChannelID64), "guild_id", guildID)
+	idmap.WriteConfigv2(channelID, "guild_id", guildID)
+	return ChannelID64
+}
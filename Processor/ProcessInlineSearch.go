@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/hoshinonyaruko/gensokyo/callapi"
 	"github.com/hoshinonyaruko/gensokyo/config"
 	"github.com/hoshinonyaruko/gensokyo/echo"
 	"github.com/hoshinonyaruko/gensokyo/handlers"
@@ -54,6 +55,12 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 	// 构造echostr，包括AppID，原始的s变量和当前时间戳
 	echostr := fmt.Sprintf("%s_%d_%d", AppIDString, s, currentTimeMillis)
 
+	// 分段发送的下一页按钮由gsk处理,不上报应用端 不受put_interaction_except影响,总是回应
+	if handlers.IsPageButton(data.Data.Resolved.ButtonData) {
+		p.Api.PutInteraction(context.TODO(), data.ID, `{"code": 0}`)
+		return handlers.SendNextPage(p.Apiv2, data)
+	}
+
 	// 这里处理自动handle回调回应
 	if config.GetAutoPutInteraction() {
 		exceptions := config.GetPutInteractionExcept() // 会返回一个string[]，即例外列表
@@ -119,6 +126,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 			UserID:     userid64,
 			Data:       data,
 		}
+		fillInteractionNotice(notice, data)
 		//增强配置
 		if !config.GetNativeOb11() {
 			notice.RealUserID = fromuid
@@ -131,7 +139,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 		noticeMap := structToMap(notice)
 
 		//上报信息到onebotv11应用端(正反ws)
-		go p.BroadcastMessageToAll(noticeMap, p.Apiv2, data)
+		go p.broadcastInteraction(noticeMap, data)
 
 		// 转换appid
 		AppIDString := strconv.FormatUint(p.Settings.AppID, 10)
@@ -225,24 +233,8 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 					//用向应用端(如果支持)发送echo,来确定客户端的send_msg对应的触发词原文
 					echo.AddMsgIDv3(AppIDString, echostr, data.Data.Resolved.ButtonData)
 				}
-				// 获取MasterID数组
-				masterIDs := config.GetMasterID()
-
-				// 判断userid64是否在masterIDs数组里
-				isMaster := false
-				for _, id := range masterIDs {
-					if strconv.FormatInt(userid64, 10) == id {
-						isMaster = true
-						break
-					}
-				}
-
-				// 根据isMaster的值为groupMsg的Sender赋值role字段
-				if isMaster {
-					groupMsg.Sender.Role = "owner"
-				} else {
-					groupMsg.Sender.Role = "member"
-				}
+				// 根据角色表为Sender赋值role字段 群内角色优先,master_id视为owner
+				groupMsg.Sender.Role = idmap.ResolveRole(fromgid, idmap.RoleMember, fromuid, strconv.FormatInt(userid64, 10))
 
 				// 映射消息类型
 				echo.AddMsgType(AppIDString, s, "group")
@@ -259,7 +251,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 				// Convert OnebotGroupMessage to map and send
 				groupMsgMap := structToMap(groupMsg)
 				//上报信息到onebotv11应用端(正反ws)
-				go p.BroadcastMessageToAll(groupMsgMap, p.Apiv2, data)
+				go p.broadcastInteraction(groupMsgMap, data)
 
 				// 转换appid
 				AppIDString := strconv.FormatUint(p.Settings.AppID, 10)
@@ -279,6 +271,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 					UserID:     userid64,
 					Data:       data,
 				}
+				fillInteractionNotice(notice, data)
 				//增强配置
 				if !config.GetNativeOb11() {
 					notice.RealUserID = fromuid
@@ -291,7 +284,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 				noticeMap := structToMap(notice)
 
 				//上报信息到onebotv11应用端(正反ws)
-				go p.BroadcastMessageToAll(noticeMap, p.Apiv2, data)
+				go p.broadcastInteraction(noticeMap, data)
 			} else {
 				//群回调
 				newdata := ConvertInteractionToMessage(data)
@@ -348,24 +341,8 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 					//用向应用端(如果支持)发送echo,来确定客户端的send_msg对应的触发词原文
 					echo.AddMsgIDv3(AppIDString, echostr, data.Data.Resolved.ButtonData)
 				}
-				// 获取MasterID数组
-				masterIDs := config.GetMasterID()
-
-				// 判断userid64是否在masterIDs数组里
-				isMaster := false
-				for _, id := range masterIDs {
-					if strconv.FormatInt(userid64, 10) == id {
-						isMaster = true
-						break
-					}
-				}
-
-				// 根据isMaster的值为groupMsg的Sender赋值role字段
-				if isMaster {
-					groupMsg.Sender.Role = "owner"
-				} else {
-					groupMsg.Sender.Role = "member"
-				}
+				// 根据角色表为Sender赋值role字段 群内角色优先,master_id视为owner
+				groupMsg.Sender.Role = idmap.ResolveRole(fromgid, idmap.RoleMember, fromuid, strconv.FormatInt(userid64, 10))
 
 				// 映射消息类型
 				echo.AddMsgType(AppIDString, s, "group")
@@ -382,7 +359,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 				// Convert OnebotGroupMessage to map and send
 				groupMsgMap := structToMap(groupMsg)
 				//上报信息到onebotv11应用端(正反ws)
-				go p.BroadcastMessageToAll(groupMsgMap, p.Apiv2, data)
+				go p.broadcastInteraction(groupMsgMap, data)
 
 				// 转换appid
 				AppIDString := strconv.FormatUint(p.Settings.AppID, 10)
@@ -402,6 +379,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 					UserID:     userid64,
 					Data:       data,
 				}
+				fillInteractionNotice(notice, data)
 				//增强配置
 				if !config.GetNativeOb11() {
 					notice.RealUserID = fromuid
@@ -414,7 +392,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 				noticeMap := structToMap(notice)
 
 				//上报信息到onebotv11应用端(正反ws)
-				go p.BroadcastMessageToAll(noticeMap, p.Apiv2, data)
+				go p.broadcastInteraction(noticeMap, data)
 			}
 		} else if data.UserOpenID != "" {
 
@@ -492,7 +470,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 
 				if privateMsg.RawMessage != "" {
 					//上报信息到onebotv11应用端(正反ws)
-					go p.BroadcastMessageToAll(privateMsgMap, p.Apiv2, data)
+					go p.broadcastInteraction(privateMsgMap, data)
 				}
 
 				// 转换appid
@@ -512,6 +490,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 					UserID:     userid64,
 					Data:       data,
 				}
+				fillInteractionNotice(notice, data)
 				//增强配置
 				if !config.GetNativeOb11() {
 					notice.RealUserID = fromuid
@@ -524,7 +503,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 				noticeMap := structToMap(notice)
 
 				//上报信息到onebotv11应用端(正反ws)
-				go p.BroadcastMessageToAll(noticeMap, p.Apiv2, data)
+				go p.broadcastInteraction(noticeMap, data)
 			} else {
 				// 这里应该还区分 是否虚拟私信为群聊 这里默认是虚拟成群聊
 				//私聊回调
@@ -585,7 +564,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 
 				if privateMsg.RawMessage != "" {
 					//上报信息到onebotv11应用端(正反ws)
-					go p.BroadcastMessageToAll(privateMsgMap, p.Apiv2, data)
+					go p.broadcastInteraction(privateMsgMap, data)
 				}
 
 				// 转换appid
@@ -605,6 +584,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 					UserID:     userid64,
 					Data:       data,
 				}
+				fillInteractionNotice(notice, data)
 				//增强配置
 				if !config.GetNativeOb11() {
 					notice.RealUserID = fromuid
@@ -617,7 +597,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 				noticeMap := structToMap(notice)
 
 				//上报信息到onebotv11应用端(正反ws)
-				go p.BroadcastMessageToAll(noticeMap, p.Apiv2, data)
+				go p.broadcastInteraction(noticeMap, data)
 			}
 		} else {
 			// TODO: 区分频道和频道私信 如果有人提需求
@@ -673,7 +653,7 @@ func (p *Processors) ProcessInlineSearch(data *dto.WSInteractionData) error {
 			msgMap := structToMap(onebotMsg)
 
 			//上报信息到onebotv11应用端(正反ws)
-			go p.BroadcastMessageToAll(msgMap, p.Apiv2, data)
+			go p.broadcastInteraction(msgMap, data)
 
 			// TODO: 实现eventid
 		}
@@ -719,3 +699,57 @@ func DelayedPutInteraction(o openapi.OpenAPI, interactionID, fromuid, fromgid st
 		DelayedPutInteraction(o, interactionID, fromuid, fromgid) // 重新尝试
 	}
 }
+
+// fillInteractionNotice 按钮回调通知中附带按钮与所在信息
+func fillInteractionNotice(notice *OnebotInteractionNotice, data *dto.WSInteractionData) {
+	notice.InteractionID, _ = storeMessageID(data.ID)
+	if data.Data == nil {
+		return
+	}
+	notice.ButtonID = data.Data.Resolved.ButtonID
+	notice.ButtonData = data.Data.Resolved.ButtonData
+	if data.Data.Resolved.MessageID != "" {
+		notice.MessageID, _ = storeMessageID(data.Data.Resolved.MessageID)
+	}
+}
+
+// broadcastInteraction 回调按钮的事件只发给发出该按钮的应用端 找不到或已断开时广播
+func (p *Processors) broadcastInteraction(message map[string]interface{}, data *dto.WSInteractionData) {
+	if config.GetInteractionRoute() && data.Data != nil {
+		if client, ok := callapi.ButtonRoute(interactionTarget(data), data.Data.Resolved.ButtonData); ok && p.isConnected(client) {
+			err := client.SendMessage(message)
+			if err == nil {
+				return
+			}
+			mylog.Printf("回调发送到原应用端失败,改为广播: %v", err)
+		}
+	}
+	p.BroadcastMessageToAll(message, p.Apiv2, data)
+}
+
+// interactionTarget 按钮所在的真实群、频道或用户id
+func interactionTarget(data *dto.WSInteractionData) string {
+	switch {
+	case data.GroupOpenID != "":
+		return data.GroupOpenID
+	case data.ChannelID != "":
+		return data.ChannelID
+	default:
+		return data.UserOpenID
+	}
+}
+
+// isConnected 应用端是否仍在连接中
+func (p *Processors) isConnected(client callapi.Client) bool {
+	for _, c := range p.Wsclient {
+		if callapi.Client(c) == client {
+			return true
+		}
+	}
+	for _, c := range p.WsServerClients {
+		if callapi.Client(c) == client {
+			return true
+		}
+	}
+	return false
+}
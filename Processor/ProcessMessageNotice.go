@@ -0,0 +1,233 @@
+// 处理信息撤回、表情表态、审核结果事件
+package Processor
+
+import (
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/echo"
+	"github.com/hoshinonyaruko/gensokyo/handlers"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// RecallNoticeEvent group_recall friend_recall与频道的guild_channel_recall通知
+type RecallNoticeEvent struct {
+	PostType       string `json:"post_type"`
+	NoticeType     string `json:"notice_type"`
+	Time           int64  `json:"time"`
+	SelfID         int64  `json:"self_id"`
+	GroupID        int64  `json:"group_id,omitempty"`
+	GuildID        string `json:"guild_id,omitempty"`
+	ChannelID      string `json:"channel_id,omitempty"`
+	UserID         int64  `json:"user_id"`
+	OperatorID     int64  `json:"operator_id,omitempty"`
+	MessageID      int    `json:"message_id"`
+	RealMessageID  string `json:"real_message_id,omitempty"`  //真实msg_id
+	RealUserID     string `json:"real_user_id,omitempty"`     //当前真实uid
+	RealOperatorID string `json:"real_operator_id,omitempty"` //操作者真实uid
+	RealGroupID    string `json:"real_group_id,omitempty"`    //当前真实gid
+}
+
+// ReactionNoticeEvent message_reactions_updated通知
+type ReactionNoticeEvent struct {
+	PostType   string        `json:"post_type"`
+	NoticeType string        `json:"notice_type"`
+	SubType    string        `json:"sub_type"` // add remove
+	Time       int64         `json:"time"`
+	SelfID     int64         `json:"self_id"`
+	GroupID    int64         `json:"group_id,omitempty"`
+	GuildID    string        `json:"guild_id"`
+	ChannelID  string        `json:"channel_id"`
+	UserID     int64         `json:"user_id"`
+	OperatorID int64         `json:"operator_id"`
+	MessageID  int           `json:"message_id,omitempty"`
+	TargetID   string        `json:"target_id"`
+	TargetType int32         `json:"target_type"` // 0消息 1帖子 2评论 3回复
+	Emoji      ReactionEmoji `json:"emoji"`
+	RealUserID string        `json:"real_user_id,omitempty"` //当前真实uid
+}
+
+// ReactionEmoji 表态的表情 type为1时是系统表情,2时是emoji
+type ReactionEmoji struct {
+	ID   string `json:"id"`
+	Type int    `json:"type"`
+}
+
+// AuditNoticeEvent message_audit通知 sub_type为pass或reject
+type AuditNoticeEvent struct {
+	PostType      string `json:"post_type"`
+	NoticeType    string `json:"notice_type"`
+	SubType       string `json:"sub_type"`
+	Time          int64  `json:"time"`
+	SelfID        int64  `json:"self_id"`
+	AuditID       string `json:"audit_id"`
+	MessageID     int    `json:"message_id,omitempty"` //审核通过后的信息
+	GroupID       int64  `json:"group_id,omitempty"`
+	UserID        int64  `json:"user_id,omitempty"`
+	GuildID       string `json:"guild_id,omitempty"`
+	ChannelID     string `json:"channel_id,omitempty"`
+	RealMessageID string `json:"real_message_id,omitempty"` //真实msg_id
+}
+
+// ProcessMessageDelete 处理频道、私信中的信息撤回
+// 频道信息开启global_channel_to_group时上报group_recall,否则上报guild_channel_recall,频道私信上报friend_recall
+func (p *Processors) ProcessMessageDelete(eventType dto.EventType, data *dto.MessageDelete) error {
+	msg := data.Message
+	if msg.Author == nil {
+		msg.Author = &dto.User{}
+	}
+	messageID64, err := storeMessageID(msg.ID)
+	if err != nil {
+		mylog.Printf("Error storing ID: %v", err)
+		return nil
+	}
+	userid64, _ := storeOptionalID(msg.Author.ID)
+	operator64, _ := storeOptionalID(data.OpUser.ID)
+	if operator64 == 0 {
+		operator64 = userid64
+	}
+
+	Notice := RecallNoticeEvent{
+		PostType:   "notice",
+		Time:       time.Now().Unix(),
+		SelfID:     p.selfID(),
+		UserID:     userid64,
+		OperatorID: operator64,
+		MessageID:  int(messageID64),
+	}
+	switch {
+	case eventType == dto.EventDirectMessageDelete:
+		Notice.NoticeType = "friend_recall"
+		Notice.OperatorID = 0
+	case p.Settings.GlobalChannelToGroup:
+		Notice.NoticeType = "group_recall"
+		if config.GetIdmapPro() && msg.Author.ID != "" {
+			Notice.GroupID, Notice.UserID, err = idmap.StoreIDv2Pro(msg.ChannelID, msg.Author.ID)
+		} else {
+			Notice.GroupID, err = idmap.StoreIDv2(msg.ChannelID)
+		}
+		if err != nil {
+			mylog.Printf("Error storing ID: %v", err)
+			return nil
+		}
+	default:
+		Notice.NoticeType = "guild_channel_recall"
+		Notice.GuildID = msg.GuildID
+		Notice.ChannelID = msg.ChannelID
+	}
+	//增强配置
+	if !config.GetNativeOb11() {
+		Notice.RealMessageID = msg.ID
+		Notice.RealUserID = msg.Author.ID
+		Notice.RealOperatorID = data.OpUser.ID
+		if Notice.GroupID != 0 {
+			Notice.RealGroupID = msg.ChannelID
+		}
+	}
+
+	mylog.Printf("信息[%v]被[%v]撤回 %v", Notice.MessageID, Notice.OperatorID, Notice.NoticeType)
+	go p.BroadcastMessageToAll(structToMap(Notice), p.Apiv2, data)
+	return nil
+}
+
+// ProcessMessageReaction 处理表情表态的添加和移除
+func (p *Processors) ProcessMessageReaction(eventType dto.EventType, data *dto.WSMessageReactionData) error {
+	userid64, err := idmap.StoreIDv2(data.UserID)
+	if err != nil {
+		mylog.Printf("Error storing ID: %v", err)
+		return nil
+	}
+	subType := "add"
+	if eventType == dto.EventMessageReactionRemove {
+		subType = "remove"
+	}
+	Notice := ReactionNoticeEvent{
+		PostType:   "notice",
+		NoticeType: "message_reactions_updated",
+		SubType:    subType,
+		Time:       time.Now().Unix(),
+		SelfID:     p.selfID(),
+		GuildID:    data.GuildID,
+		ChannelID:  data.ChannelID,
+		UserID:     userid64,
+		OperatorID: userid64,
+		TargetID:   data.Target.ID,
+		TargetType: data.Target.Type,
+		Emoji:      ReactionEmoji{ID: data.Emoji.ID, Type: data.Emoji.Type},
+	}
+	// 表态对象是信息时附带虚拟message_id
+	if data.Target.Type == dto.ReactionTargetTypeMsg && data.Target.ID != "" {
+		if messageID64, err := storeMessageID(data.Target.ID); err == nil {
+			Notice.MessageID = int(messageID64)
+		}
+	}
+	if p.Settings.GlobalChannelToGroup {
+		if ChannelID64, err := idmap.StoreIDv2(data.ChannelID); err == nil {
+			Notice.GroupID = ChannelID64
+		}
+	}
+	//增强配置
+	if !config.GetNativeOb11() {
+		Notice.RealUserID = data.UserID
+	}
+
+	mylog.Printf("子频道[%v]成员[%v]表态%v[%v]", data.ChannelID, userid64, subType, data.Emoji.ID)
+	go p.BroadcastMessageToAll(structToMap(Notice), p.Apiv2, data)
+	return nil
+}
+
+// ProcessMessageAudit 处理机器人信息的审核结果 audit_id与发送信息时返回的一致
+func (p *Processors) ProcessMessageAudit(eventType dto.EventType, data *dto.WSMessageAuditData) error {
+	Notice := AuditNoticeEvent{
+		PostType:   "notice",
+		NoticeType: "message_audit",
+		SubType:    "reject",
+		Time:       time.Now().Unix(),
+		SelfID:     p.selfID(),
+		AuditID:    data.AuditID,
+		GuildID:    data.GuildID,
+		ChannelID:  data.ChannelID,
+	}
+	audit, tracked := handlers.ResolveAudit(data.AuditID)
+	if eventType == dto.EventMessageAuditPass {
+		Notice.SubType = "pass"
+		if data.MessageID != "" {
+			if messageID64, err := storeMessageID(data.MessageID); err == nil {
+				Notice.MessageID = int(messageID64)
+			}
+			// 审核通过的信息同样可以撤回
+			if data.ChannelID != "" {
+				idmap.StoreMessageScope(data.MessageID, idmap.MessageScope{Type: idmap.ScopeGuild, TargetID: data.ChannelID, BotSent: true})
+			}
+			//增强配置
+			if !config.GetNativeOb11() {
+				Notice.RealMessageID = data.MessageID
+			}
+		}
+	}
+	// 由发送时的记录还原群号或用户
+	if tracked {
+		if audit.GroupID != "" {
+			Notice.GroupID, _ = handlers.AuditReportID(audit.GroupID)
+		} else if audit.UserID != "" && audit.ChannelID == "" {
+			Notice.UserID, _ = handlers.AuditReportID(audit.UserID)
+		}
+	}
+	if Notice.GroupID == 0 && p.Settings.GlobalChannelToGroup && data.ChannelID != "" {
+		Notice.GroupID, _ = storeOptionalID(data.ChannelID)
+	}
+
+	mylog.Printf("信息审核%v audit_id[%v]", Notice.SubType, data.AuditID)
+	go p.BroadcastMessageToAll(structToMap(Notice), p.Apiv2, data)
+	return nil
+}
+
+// storeMessageID 真实msg_id转换为虚拟message_id 与上报信息时使用相同的映射
+func storeMessageID(msgID string) (int64, error) {
+	if config.GetMemoryMsgid() {
+		return echo.StoreCacheInMemory(msgID)
+	}
+	return idmap.StoreCachev2(msgID)
+}
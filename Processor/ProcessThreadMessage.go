@@ -2,7 +2,6 @@
 package Processor
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"strconv"
@@ -97,24 +96,8 @@ func (p *Processors) ProcessThreadMessage(data *dto.WSThreadData) error {
 			//用向应用端(如果支持)发送echo,来确定客户端的send_msg对应的触发词原文
 			echo.AddMsgIDv3(AppIDString, echostr, messageText)
 		}
-		// 获取MasterID数组
-		masterIDs := config.GetMasterID()
-
-		// 判断userid64是否在masterIDs数组里
-		isMaster := false
-		for _, id := range masterIDs {
-			if strconv.FormatInt(userid64, 10) == id {
-				isMaster = true
-				break
-			}
-		}
-
-		// 根据isMaster的值为groupMsg的Sender赋值role字段
-		if isMaster {
-			onebotMsg.Sender.Role = "owner"
-		} else {
-			onebotMsg.Sender.Role = "member"
-		}
+		// 根据角色表为Sender赋值role字段 群内角色优先,master_id视为owner
+		onebotMsg.Sender.Role = idmap.ResolveRole(data.ChannelID, idmap.RoleMember, data.AuthorID, strconv.FormatInt(userid64, 10))
 		//将当前s和appid和message进行映射
 		echo.AddMsgID(AppIDString, s, data.ID)
 		echo.AddMsgType(AppIDString, s, "forum")
@@ -216,24 +199,8 @@ func (p *Processors) ProcessThreadMessage(data *dto.WSThreadData) error {
 				//用向应用端(如果支持)发送echo,来确定客户端的send_msg对应的触发词原文
 				echo.AddMsgIDv3(AppIDString, echostr, messageText)
 			}
-			// 获取MasterID数组
-			masterIDs := config.GetMasterID()
-
-			// 判断userid64是否在masterIDs数组里
-			isMaster := false
-			for _, id := range masterIDs {
-				if strconv.FormatInt(userid64, 10) == id {
-					isMaster = true
-					break
-				}
-			}
-
-			// 根据isMaster的值为groupMsg的Sender赋值role字段
-			if isMaster {
-				onebotMsg.Sender.Role = "owner"
-			} else {
-				onebotMsg.Sender.Role = "member"
-			}
+			// 根据角色表为Sender赋值role字段 群内角色优先,master_id视为owner
+			onebotMsg.Sender.Role = idmap.ResolveRole(data.ChannelID, idmap.RoleMember, data.AuthorID, strconv.FormatInt(userid64, 10))
 			//将当前s和appid和message进行映射
 			echo.AddMsgID(AppIDString, s, data.ID)
 			echo.AddMsgType(AppIDString, s, "forum")
@@ -273,17 +240,9 @@ func (p *Processors) ProcessThreadMessage(data *dto.WSThreadData) error {
 				if err != nil {
 					mylog.Errorf("Error storing ID: %v", err)
 				}
-				//当参数不全时
-				_, _ = idmap.StoreIDv2(data.ChannelID)
-				_, _ = idmap.StoreIDv2(data.AuthorID)
 				if !config.GetHashIDValue() {
 					mylog.Fatalf("避坑日志:你开启了高级id转换,请设置hash_id为true,并且删除idmaps并重启")
 				}
-				//补救措施
-				idmap.SimplifiedStoreID(data.AuthorID)
-				//补救措施
-				idmap.SimplifiedStoreID(data.ChannelID)
-				//补救措施
 				echo.AddMsgIDv3(AppIDString, data.ChannelID, data.ID)
 			} else {
 				//将channelid写入ini,可取出guild_id
@@ -409,93 +368,8 @@ func (p *Processors) ProcessThreadMessage(data *dto.WSThreadData) error {
 	return nil
 }
 
-// UnmarshalForumContentElements 动态解析元素类型
-func UnmarshalForumContentElements(content string) ([]dto.ForumContentElement, error) {
-	var contentStructure dto.ForumContentStructure
-	err := json.Unmarshal([]byte(content), &contentStructure)
-	if err != nil {
-		return nil, err
-	}
-
-	var elements []dto.ForumContentElement
-	for _, paragraph := range contentStructure.Paragraphs {
-		for _, rawElem := range paragraph.Elems {
-			var base struct {
-				Type int `json:"type"`
-			}
-			err := json.Unmarshal(rawElem, &base)
-			if err != nil {
-				fmt.Println("Error determining element type:", err)
-				continue
-			}
-
-			switch base.Type {
-			case 1: // 文本元素
-				var textElem dto.ForumTextElement
-				err := json.Unmarshal(rawElem, &textElem)
-				if err != nil {
-					fmt.Println("Error unmarshalling text element:", err)
-					continue
-				}
-				elements = append(elements, textElem)
-			case 3: // URL元素
-				var urlElem dto.ForumURLElement
-				err := json.Unmarshal(rawElem, &urlElem)
-				if err != nil {
-					fmt.Println("Error unmarshalling URL element:", err)
-					continue
-				}
-				elements = append(elements, urlElem)
-			case 5: // 频道元素
-				var channelElem dto.ForumChannelElement
-				err := json.Unmarshal(rawElem, &channelElem)
-				if err != nil {
-					fmt.Println("Error unmarshalling channel element:", err)
-					continue
-				}
-				elements = append(elements, channelElem)
-			default:
-				fmt.Printf("Unknown type: %d\n", base.Type)
-			}
-		}
-	}
-
-	return elements, nil
-}
-
 // parseContent 解析字符串content，并生成消息文本
 func parseContent(content string) (string, error) {
-	elements, err := UnmarshalForumContentElements(content)
-	if err != nil {
-		return "", err
-	}
-	mylog.Printf("测试:%v", elements)
-
-	var messageTextBuilder strings.Builder
-
-	// 计算是不是只有一个ForumTextElement而且没有其他元素
-	onlyOneTextElement := len(elements) == 1
-	if onlyOneTextElement {
-		_, onlyOneTextElement = elements[0].(dto.ForumTextElement)
-	}
-
-	for _, element := range elements {
-		switch e := element.(type) {
-		case dto.ForumTextElement:
-			messageTextBuilder.WriteString(e.TextInfo.Text)
-			if !onlyOneTextElement {
-				messageTextBuilder.WriteString("\n") // 如果不是只有一个ForumTextElement，加换行符
-			}
-		case dto.ForumURLElement:
-			if e.URLInfo.DisplayText != "" {
-				messageTextBuilder.WriteString(e.URLInfo.DisplayText + ": ")
-			}
-			messageTextBuilder.WriteString(e.URLInfo.URL)
-			messageTextBuilder.WriteString("\n")
-		case *dto.ForumChannelElement:
-			// 频道元素被忽略
-		}
-	}
-
-	return messageTextBuilder.String(), nil
+	_, messageText, err := handlers.ParseForumContent(content)
+	return messageText, err
 }
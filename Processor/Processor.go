@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -155,30 +154,39 @@ type OnebotInteractionNotice struct {
 	Data        *dto.WSInteractionData `json:"data,omitempty"`
 	RealUserID  string                 `json:"real_user_id,omitempty"`  //当前真实uid
 	RealGroupID string                 `json:"real_group_id,omitempty"` //当前真实gid
+	// 按钮回调 interaction_id用于put_interaction
+	InteractionID int64  `json:"interaction_id,omitempty"`
+	ButtonID      string `json:"button_id,omitempty"`
+	ButtonData    string `json:"button_data,omitempty"`
+	MessageID     int64  `json:"message_id,omitempty"` // 按钮所在的信息
 }
 
 // onebotv11标准扩展
 type OnebotGroupRejectNotice struct {
-	GroupID    int64                    `json:"group_id,omitempty"`
-	NoticeType string                   `json:"notice_type,omitempty"`
-	PostType   string                   `json:"post_type,omitempty"`
-	SelfID     int64                    `json:"self_id,omitempty"`
-	SubType    string                   `json:"sub_type,omitempty"`
-	Time       int64                    `json:"time,omitempty"`
-	UserID     int64                    `json:"user_id,omitempty"`
-	Data       *dto.GroupMsgRejectEvent `json:"data,omitempty"`
+	GroupID     int64                    `json:"group_id,omitempty"`
+	NoticeType  string                   `json:"notice_type,omitempty"`
+	PostType    string                   `json:"post_type,omitempty"`
+	SelfID      int64                    `json:"self_id,omitempty"`
+	SubType     string                   `json:"sub_type,omitempty"`
+	Time        int64                    `json:"time,omitempty"`
+	UserID      int64                    `json:"user_id,omitempty"`
+	Data        *dto.GroupMsgRejectEvent `json:"data,omitempty"`
+	RealUserID  string                   `json:"real_user_id,omitempty"`  //当前真实uid
+	RealGroupID string                   `json:"real_group_id,omitempty"` //当前真实gid
 }
 
 // onebotv11标准扩展
 type OnebotGroupReceiveNotice struct {
-	GroupID    int64                     `json:"group_id,omitempty"`
-	NoticeType string                    `json:"notice_type,omitempty"`
-	PostType   string                    `json:"post_type,omitempty"`
-	SelfID     int64                     `json:"self_id,omitempty"`
-	SubType    string                    `json:"sub_type,omitempty"`
-	Time       int64                     `json:"time,omitempty"`
-	UserID     int64                     `json:"user_id,omitempty"`
-	Data       *dto.GroupMsgReceiveEvent `json:"data,omitempty"`
+	GroupID     int64                     `json:"group_id,omitempty"`
+	NoticeType  string                    `json:"notice_type,omitempty"`
+	PostType    string                    `json:"post_type,omitempty"`
+	SelfID      int64                     `json:"self_id,omitempty"`
+	SubType     string                    `json:"sub_type,omitempty"`
+	Time        int64                     `json:"time,omitempty"`
+	UserID      int64                     `json:"user_id,omitempty"`
+	Data        *dto.GroupMsgReceiveEvent `json:"data,omitempty"`
+	RealUserID  string                    `json:"real_user_id,omitempty"`  //当前真实uid
+	RealGroupID string                    `json:"real_group_id,omitempty"` //当前真实gid
 }
 
 type PrivateSender struct {
@@ -371,7 +379,7 @@ func (p *Processors) BroadcastMessageToAll(message map[string]interface{}, api o
 	}
 
 	if len(errors) > 0 {
-		return fmt.Errorf(strings.Join(errors, "; "))
+		return fmt.Errorf("%s", strings.Join(errors, "; "))
 	}
 
 	return nil
@@ -453,7 +461,8 @@ func sendPostRequest(jsonString, url string) {
 	mylog.Printf("Posted to %s successfully", url)
 }
 
-func (p *Processors) HandleFrameworkCommand(messageText string, data interface{}, Type string) error {
+// HandleFrameworkCommand 处理框架内指令 返回true时信息已被处理,不再上报应用端(intercept_commands)
+func (p *Processors) HandleFrameworkCommand(messageText string, data interface{}, Type string) bool {
 	// 正则表达式匹配转换后的 CQ 码
 	cqRegex := regexp.MustCompile(`\[CQ:at,qq=\d+\]`)
 
@@ -463,26 +472,24 @@ func (p *Processors) HandleFrameworkCommand(messageText string, data interface{}
 	// 去除字符串前后的空格
 	cleanedMessage = strings.TrimSpace(cleanedMessage)
 	if cleanedMessage == "t" {
-		// 生成临时指令
+		// 生成一次性指令码
 		tempCmd := handleNoPermission()
-		mylog.Printf("临时bind指令: %s 可忽略权限检查1次,或将masterid设置为空数组", tempCmd)
+		mylog.Printf("一次性bind指令码: %s 5分钟内有效,用法: %s 当前虚拟值 目标虚拟值,或发送 %s owner 成为全局owner", tempCmd, tempCmd, tempCmd)
 	}
 	var err error
-	var now, new, newpro1, newpro2 string
-	var nowgroup, newgroup string
+	var new, newpro1, newpro2 string
+	var newgroup string
 	var realid, realid2 string
-	var guildid, guilduserid string
+	var guildid string
 	switch v := data.(type) {
 	case *dto.WSGroupATMessageData:
 		realid = v.Author.ID
 	case *dto.WSATMessageData:
 		realid = v.Author.ID
 		guildid = v.GuildID
-		guilduserid = v.Author.ID
 	case *dto.WSMessageData:
 		realid = v.Author.ID
 		guildid = v.GuildID
-		guilduserid = v.Author.ID
 	case *dto.WSDirectMessageData:
 		realid = v.Author.ID
 	case *dto.WSC2CMessageData:
@@ -502,9 +509,6 @@ func (p *Processors) HandleFrameworkCommand(messageText string, data interface{}
 		realid2 = "group_private"
 	}
 
-	// 获取MasterID数组
-	masterIDs := config.GetMasterID()
-
 	// idmaps-pro获取群和用户id
 	if config.GetIdmapPro() {
 		newpro1, newpro2, err = idmap.RetrieveVirtualValuev2Pro(realid2, realid)
@@ -513,158 +517,144 @@ func (p *Processors) HandleFrameworkCommand(messageText string, data interface{}
 		}
 	} else {
 		// 根据realid获取new(用户id)
-		now, new, err = idmap.RetrieveVirtualValuev2(realid)
+		_, new, err = idmap.RetrieveVirtualValuev2(realid)
 		if err != nil {
 			mylog.Printf("根据realid获取new(用户id) 错误:%v", err)
 		}
 		// 根据realid获取new(群id)
-		nowgroup, newgroup, err = idmap.RetrieveVirtualValuev2(realid2)
+		_, newgroup, err = idmap.RetrieveVirtualValuev2(realid2)
 		if err != nil {
 			mylog.Printf("根据realid获取new(群id)错误:%v", err)
 		}
 	}
-	// 检查真实值或虚拟值是否在数组中
-	var realValueIncluded, virtualValueIncluded bool
-
-	// 如果 masterIDs 数组为空，则这两个值恒为 true
-	if len(masterIDs) == 0 {
-		realValueIncluded = true
-		virtualValueIncluded = true
-	} else {
-		// 否则，检查真实值或虚拟值是否在数组中
-		realValueIncluded = contains(masterIDs, realid)
-		virtualValueIncluded = contains(masterIDs, new)
+	// 群/频道内的角色 包含全局角色与master_id
+	ctx := &CommandContext{
+		P:           p,
+		Data:        data,
+		Type:        Type,
+		Text:        cleanedMessage,
+		RealUserID:  realid,
+		RealGroupID: realid2,
+		UserID:      new,
+		GroupID:     newgroup,
+		GuildID:     guildid,
+		LookupErr:   err,
 	}
-
-	//unlock指令
-	if Type == "guild" && strings.HasPrefix(cleanedMessage, config.GetUnlockPrefix()) {
-		dm := &dto.DirectMessageToCreate{
-			SourceGuildID: guildid,
-			RecipientID:   guilduserid,
-		}
-		cdm, err := p.Api.CreateDirectMessage(context.TODO(), dm)
-		if err != nil {
-			mylog.Printf("unlock指令创建dm失败:%v", err)
-		}
-		msg := &dto.MessageToCreate{
-			Content: "欢迎使用Gensokyo框架部署QQ机器人",
-			MsgType: 0,
-			MsgID:   "",
-		}
-		_, err = p.Api.PostDirectMessage(context.TODO(), cdm, msg)
-		if err != nil {
-			mylog.Printf("unlock指令发送失败:%v", err)
-		}
+	if config.GetIdmapPro() {
+		ctx.UserID, ctx.GroupID = newpro2, newpro1
 	}
-
-	// me指令处理逻辑
-	if strings.HasPrefix(cleanedMessage, config.GetMePrefix()) {
-		if err != nil {
-			// 发送错误信息
-			SendMessage(err.Error(), data, Type, p.Api, p.Apiv2)
-			return err
-		}
-		// 发送成功信息
-		if config.GetIdmapPro() {
-			// 构造清晰的对应关系信息
-			userMapping := fmt.Sprintf("当前真实值（用户）/当前虚拟值（用户） = [%s/%s]", realid, newpro2)
-			groupMapping := fmt.Sprintf("当前真实值（群/频道）/当前虚拟值（群/频道） = [%s/%s]", realid2, newpro1)
-
-			// 构造 bind 指令的使用说明
-			bindInstruction := fmt.Sprintf("bind 指令: %s 当前虚拟值(用户) 目标虚拟值(用户) [当前虚拟值(群/频道) 目标虚拟值(群/频道)]", config.GetBindPrefix())
-
-			// 发送整合后的消息
-			message := fmt.Sprintf("idmaps-pro状态:\n%s\n%s\n%s", userMapping, groupMapping, bindInstruction)
-			SendMessage(message, data, Type, p.Api, p.Apiv2)
-		} else {
-			SendMessage("目前状态:\n当前真实值(用户) "+now+"\n当前虚拟值(用户) "+new+"\n当前真实值(群/频道) "+nowgroup+"\n当前虚拟值(群/频道) "+newgroup+"\nbind指令:"+config.GetBindPrefix()+" 当前虚拟值"+" 目标虚拟值", data, Type, p.Api, p.Apiv2)
-		}
-		return nil
+	if realid2 != "group_private" {
+		ctx.Scope = realid2
 	}
+	ctx.Role = idmap.ResolveRole(ctx.Scope, idmap.RoleMember, realid, ctx.UserID)
+	// 未配置任何owner时保持对所有人开放 角色分配除外
+	ctx.IsOwner = !idmap.HasOwners() || ctx.Role == idmap.RoleOwner
 
-	fields := strings.Fields(cleanedMessage)
-
-	// 首先确保消息不是空的，然后检查是否是有效的临时指令
-	if len(fields) > 0 && isValidTemporaryCommand(fields[0]) {
-		// 执行 bind 操作
-		if config.GetIdmapPro() {
-			err := performBindOperationV2(cleanedMessage, data, Type, p.Api, p.Apiv2, newpro1)
-			if err != nil {
-				mylog.Printf("bind遇到错误:%v", err)
-			}
-		} else {
-			err := performBindOperation(cleanedMessage, data, Type, p.Api, p.Apiv2)
-			if err != nil {
-				mylog.Printf("bind遇到错误:%v", err)
-			}
+	// 首先确保消息不是空的，然后检查是否是有效的一次性指令码 一次性指令码代替bind前缀
+	// 指令码 owner 把发送者设为全局owner
+	if fields := strings.Fields(cleanedMessage); len(fields) > 0 && isValidTemporaryCommand(fields[0]) {
+		if len(fields) == 2 && fields[1] == idmap.RoleOwner {
+			ctx.Reply(claimOwner(realid))
+			return config.GetInterceptCommands()
 		}
-		return nil
-	}
-
-	// 如果不是临时指令，检查是否具有执行bind操作的权限并且消息以特定前缀开始
-	if (realValueIncluded || virtualValueIncluded) && strings.HasPrefix(cleanedMessage, config.GetBindPrefix()) {
-		// 执行 bind 操作
-		if config.GetIdmapPro() {
-			err := performBindOperationV2(cleanedMessage, data, Type, p.Api, p.Apiv2, newpro1)
-			if err != nil {
-				mylog.Printf("bind遇到错误:%v", err)
-			}
-		} else {
-			err := performBindOperation(cleanedMessage, data, Type, p.Api, p.Apiv2)
-			if err != nil {
-				mylog.Printf("bind遇到错误:%v", err)
-			}
+		if err := bindCommand(ctx); err != nil {
+			mylog.Printf("bind遇到错误:%v", err)
 		}
-		return nil
-	} else if strings.HasPrefix(cleanedMessage, config.GetBindPrefix()) {
-		// 生成临时指令
-		tempCmd := handleNoPermission()
-		mylog.Printf("您没有权限,使用临时指令：%s 忽略权限检查,或将masterid设置为空数组", tempCmd)
-		SendMessage("您没有权限,请配置config.yml或查看日志,使用临时指令", data, Type, p.Api, p.Apiv2)
-	}
-
-	//link指令
-	if strings.HasPrefix(cleanedMessage, config.GetLinkPrefix()) {
-		md, kb := generateMdByConfig()
-		SendMessageMd(md, kb, data, Type, p.Api, p.Apiv2)
+		return config.GetInterceptCommands()
 	}
 
-	return nil
+	// 交给注册的框架指令处理
+	return dispatchFrameworkCommand(ctx) && config.GetInterceptCommands()
 }
 
-// 生成由两个英文字母构成的唯一临时指令
-func generateTemporaryCommand() (string, error) {
-	bytes := make([]byte, 1) // 生成1字节的随机数，足以表示2个十六进制字符
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err // 处理随机数生成错误
+// 生成一个新的一次性指令码
+func handleNoPermission() string {
+	cmd, err := idmap.IssueOneTimeCode()
+	if err != nil {
+		mylog.Printf("生成一次性指令码失败:%v", err)
 	}
-	command := hex.EncodeToString(bytes)[:2] // 将1字节转换为2个十六进制字符
-	return command, nil
+	return cmd
 }
 
-// 生成并添加一个新的临时指令
-func handleNoPermission() string {
-	idmap.MutexT.Lock()
-	defer idmap.MutexT.Unlock()
+// 检查指令是否是有效的一次性指令码 验证后即失效
+func isValidTemporaryCommand(cmd string) bool {
+	return idmap.ConsumeOneTimeCode(cmd)
+}
 
-	cmd, _ := generateTemporaryCommand()
-	idmap.TemporaryCommands = append(idmap.TemporaryCommands, cmd)
-	return cmd
+// claimOwner 使用一次性指令码成为全局owner
+func claimOwner(realid string) string {
+	entry, err := idmap.SetRole(idmap.RoleScopeGlobal, realid, idmap.RoleOwner)
+	if err != nil {
+		return err.Error()
+	}
+	mylog.Printf("角色变更: %s 使用一次性指令码成为全局owner", entry.UserID)
+	return "已将您设为全局owner"
 }
 
-// 检查指令是否是有效的临时指令
-func isValidTemporaryCommand(cmd string) bool {
-	idmap.MutexT.Lock()
-	defer idmap.MutexT.Unlock()
+// 执行 role 指令 格式: list [global] | set 用户id 角色 [global] | del 用户id [global]
+func performRoleOperation(args []string, scope, role string, isOwner bool) string {
+	usage := fmt.Sprintf("role指令:\n%[1]s list [global]\n%[1]s set 用户id 角色(owner/admin/member/自定义) [global]\n%[1]s del 用户id [global]", config.GetRolePrefix())
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	target := scope
+	if args[len(args)-1] == idmap.RoleScopeGlobal {
+		target = idmap.RoleScopeGlobal
+		args = args[:len(args)-1]
+	}
+	if target == "" {
+		// 私聊中只能管理全局角色
+		target = idmap.RoleScopeGlobal
+	}
 
-	for i, tempCmd := range idmap.TemporaryCommands {
-		if tempCmd == cmd {
-			// 删除已验证的临时指令
-			idmap.TemporaryCommands = append(idmap.TemporaryCommands[:i], idmap.TemporaryCommands[i+1:]...)
-			return true
+	switch args[0] {
+	case "list":
+		entries, err := idmap.ListRoles(target)
+		if err != nil {
+			return err.Error()
+		}
+		if len(entries) == 0 {
+			return "当前作用域没有分配角色"
+		}
+		var sb strings.Builder
+		sb.WriteString("角色列表(" + target + "):")
+		for _, e := range entries {
+			sb.WriteString("\n" + e.UserID + " " + e.Role)
+		}
+		return sb.String()
+	case "set", "del":
+		if (args[0] == "set" && len(args) != 3) || (args[0] == "del" && len(args) != 2) {
+			return usage
+		}
+		// 还没有owner时谁都可以通过isOwner,第一个owner只能由master_id、一次性指令码、webui或命令行指定
+		if !idmap.HasOwners() {
+			return "还没有owner,请在config.yml配置master_id,或发送日志中的一次性指令码加owner,或在webui、命令行(-idmap role)中分配owner"
+		}
+		// owner可管理全部角色 admin只能在群内管理低于admin的角色
+		if !isOwner {
+			if idmap.RoleLevel(role) < 1 || target == idmap.RoleScopeGlobal {
+				return "您没有权限管理角色"
+			}
+			current := idmap.ResolveRole(target, idmap.RoleMember, idmap.NormalizeRoleID(args[1]), args[1])
+			if idmap.RoleLevel(current) >= 1 || (args[0] == "set" && idmap.RoleLevel(strings.ToLower(args[2])) >= 1) {
+				return "admin只能管理member与自定义角色"
+			}
+		}
+		if args[0] == "del" {
+			if err := idmap.RemoveRole(target, args[1]); err != nil {
+				return err.Error()
+			}
+			return "已移除" + args[1] + "的角色"
 		}
+		entry, err := idmap.SetRole(target, args[1], args[2])
+		if err != nil {
+			return err.Error()
+		}
+		mylog.Printf("角色变更: %s 在 %s 的角色设为 %s", entry.UserID, entry.Scope, entry.Role)
+		return "已将" + args[1] + "的角色设为" + entry.Role
+	default:
+		return usage
 	}
-	return false
 }
 
 // 执行 bind 操作的逻辑
@@ -672,7 +662,7 @@ func performBindOperation(cleanedMessage string, data interface{}, Type string,
 	// 分割指令以获取参数
 	parts := strings.Fields(cleanedMessage)
 	if len(parts) != 3 {
-		mylog.Printf("bind指令参数错误\n正确的格式" + config.GetBindPrefix() + " 当前虚拟值 新虚拟值")
+		mylog.Printf("bind指令参数错误\n正确的格式%s 当前虚拟值 新虚拟值", config.GetBindPrefix())
 		return nil
 	}
 
@@ -709,7 +699,7 @@ func performBindOperationV2(cleanedMessage string, data interface{}, Type string
 
 	// 检查参数数量
 	if len(parts) < 3 || len(parts) > 5 {
-		mylog.Printf("bind指令参数错误\n正确的格式: " + config.GetBindPrefix() + " 当前虚拟值(用户) 新虚拟值(用户) [当前虚拟值(群) 新虚拟值(群)]")
+		mylog.Printf("bind指令参数错误\n正确的格式: %s 当前虚拟值(用户) 新虚拟值(用户) [当前虚拟值(群) 新虚拟值(群)]", config.GetBindPrefix())
 		return nil
 	}
 
@@ -0,0 +1,362 @@
+package Processor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/botstats"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// 框架指令可用的场景 与HandleFrameworkCommand的Type一致
+const (
+	CommandScopeGroup        = "group"
+	CommandScopeGuild        = "guild"
+	CommandScopeGuildPrivate = "guild_private"
+	CommandScopeGroupPrivate = "group_private"
+)
+
+// FrameworkCommand 框架内指令 消息以Trigger或Aliases开头时触发
+type FrameworkCommand struct {
+	Name    string        // 指令名称 用于disabled_commands与help
+	Trigger func() string // 触发词 来自配置 返回空时指令关闭
+	Aliases []string      // 额外的触发词
+	Role    string        // 最低角色 空为所有人
+	Scopes  []string      // 可用场景 空为全部
+	Help    string        // 帮助文本
+	Handler func(ctx *CommandContext) error
+}
+
+// CommandContext 框架指令执行时的上下文
+type CommandContext struct {
+	P           *Processors
+	Data        interface{}
+	Type        string
+	Text        string   // 去除at后的完整消息
+	Args        []string // 触发词之后的参数
+	RealUserID  string
+	RealGroupID string // 群/频道的真实id 单聊时为group_private
+	UserID      string // 用户虚拟值
+	GroupID     string // 群/频道虚拟值
+	GuildID     string
+	Scope       string // 角色作用域 单聊时为空
+	Role        string
+	IsOwner     bool
+	LookupErr   error // 查询虚拟值时的错误
+}
+
+var (
+	commands   []*FrameworkCommand
+	commandsMu sync.RWMutex
+)
+
+// RegisterFrameworkCommand 注册框架指令 同名指令会被替换
+func RegisterFrameworkCommand(cmd FrameworkCommand) {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	for i, c := range commands {
+		if c.Name == cmd.Name {
+			commands[i] = &cmd
+			return
+		}
+	}
+	commands = append(commands, &cmd)
+}
+
+// Reply 在指令来源处回复文本
+func (ctx *CommandContext) Reply(text string) {
+	SendMessage(text, ctx.Data, ctx.Type, ctx.P.Api, ctx.P.Apiv2)
+}
+
+// triggers 当前生效的触发词
+func (cmd *FrameworkCommand) triggers() []string {
+	var list []string
+	if cmd.Trigger != nil {
+		if t := cmd.Trigger(); t != "" {
+			list = append(list, t)
+		}
+	}
+	for _, alias := range cmd.Aliases {
+		if alias != "" {
+			list = append(list, alias)
+		}
+	}
+	return list
+}
+
+// available 指令是否在当前场景开放
+func (cmd *FrameworkCommand) available(Type string) bool {
+	if contains(config.GetDisabledCommands(), cmd.Name) {
+		return false
+	}
+	return len(cmd.Scopes) == 0 || contains(cmd.Scopes, Type)
+}
+
+// permitted 当前角色是否满足指令要求
+func (cmd *FrameworkCommand) permitted(ctx *CommandContext) bool {
+	return cmd.Role == "" || ctx.IsOwner || idmap.RoleLevel(ctx.Role) >= idmap.RoleLevel(cmd.Role)
+}
+
+// matchFrameworkCommand 找到触发词最长的匹配指令 返回触发词后的参数
+func matchFrameworkCommand(text, Type string) (*FrameworkCommand, []string) {
+	commandsMu.RLock()
+	defer commandsMu.RUnlock()
+	var matched *FrameworkCommand
+	var matchedTrigger string
+	for _, cmd := range commands {
+		if !cmd.available(Type) {
+			continue
+		}
+		for _, t := range cmd.triggers() {
+			// 与原有指令一致为前缀匹配
+			if len(t) <= len(matchedTrigger) || !strings.HasPrefix(text, t) {
+				continue
+			}
+			matched, matchedTrigger = cmd, t
+		}
+	}
+	if matched == nil {
+		return nil, nil
+	}
+	return matched, strings.Fields(text[len(matchedTrigger):])
+}
+
+// dispatchFrameworkCommand 执行匹配到的框架指令 没有匹配时返回false
+func dispatchFrameworkCommand(ctx *CommandContext) bool {
+	cmd, args := matchFrameworkCommand(ctx.Text, ctx.Type)
+	if cmd == nil {
+		return false
+	}
+	ctx.Args = args
+	if !cmd.permitted(ctx) {
+		if cmd.Name == "bind" {
+			// bind可以使用日志中的一次性指令码代替
+			tempCmd := handleNoPermission()
+			mylog.Printf("用户%s没有权限,一次性bind指令码：%s 5分钟内有效,用法: %s 当前虚拟值 目标虚拟值,或发送 %s owner 成为全局owner", ctx.RealUserID, tempCmd, tempCmd, tempCmd)
+			ctx.Reply("您没有权限,请配置config.yml或在日志中获取一次性指令码")
+		} else {
+			ctx.Reply("您没有权限使用" + cmd.Name + "指令,需要" + cmd.Role + "角色")
+		}
+		return true
+	}
+	if err := cmd.Handler(ctx); err != nil {
+		mylog.Printf("%s指令遇到错误:%v", cmd.Name, err)
+	}
+	return true
+}
+
+func init() {
+	RegisterFrameworkCommand(FrameworkCommand{
+		Name:    "unlock",
+		Trigger: config.GetUnlockPrefix,
+		Scopes:  []string{CommandScopeGuild},
+		Help:    "在子频道发送后机器人会主动发起频道私信",
+		Handler: unlockCommand,
+	})
+	RegisterFrameworkCommand(FrameworkCommand{
+		Name:    "me",
+		Trigger: config.GetMePrefix,
+		Help:    "查看自己和当前群/频道的真实值与虚拟值",
+		Handler: meCommand,
+	})
+	RegisterFrameworkCommand(FrameworkCommand{
+		Name:    "bind",
+		Trigger: config.GetBindPrefix,
+		Role:    idmap.RoleOwner,
+		Help:    "修改虚拟值: 当前虚拟值 目标虚拟值",
+		Handler: bindCommand,
+	})
+	RegisterFrameworkCommand(FrameworkCommand{
+		Name:    "role",
+		Trigger: config.GetRolePrefix,
+		Help:    "管理角色: list|set|del [global]",
+		Handler: roleCommand,
+	})
+	RegisterFrameworkCommand(FrameworkCommand{
+		Name:    "link",
+		Trigger: config.GetLinkPrefix,
+		Help:    "发送友情链接",
+		Handler: func(ctx *CommandContext) error {
+			md, kb := generateMdByConfig()
+			return SendMessageMd(md, kb, ctx.Data, ctx.Type, ctx.P.Api, ctx.P.Apiv2)
+		},
+	})
+	RegisterFrameworkCommand(FrameworkCommand{
+		Name:    "help",
+		Trigger: config.GetHelpPrefix,
+		Help:    "列出可用的框架指令",
+		Handler: helpCommand,
+	})
+	RegisterFrameworkCommand(FrameworkCommand{
+		Name:    "ping",
+		Trigger: config.GetPingPrefix,
+		Help:    "检查机器人是否在线",
+		Handler: pingCommand,
+	})
+	RegisterFrameworkCommand(FrameworkCommand{
+		Name:    "status",
+		Trigger: config.GetStatusPrefix,
+		Role:    idmap.RoleAdmin,
+		Help:    "查看连接与收发统计",
+		Handler: statusCommand,
+	})
+	RegisterFrameworkCommand(FrameworkCommand{
+		Name:    "whois",
+		Trigger: config.GetWhoisPrefix,
+		Role:    idmap.RoleAdmin,
+		Help:    "查询id映射: 虚拟值或真实值",
+		Handler: whoisCommand,
+	})
+}
+
+// unlockCommand 创建频道私信 解决频道私信无法主动发起的问题
+func unlockCommand(ctx *CommandContext) error {
+	dm := &dto.DirectMessageToCreate{
+		SourceGuildID: ctx.GuildID,
+		RecipientID:   ctx.RealUserID,
+	}
+	cdm, err := ctx.P.Api.CreateDirectMessage(context.TODO(), dm)
+	if err != nil {
+		return fmt.Errorf("unlock指令创建dm失败:%v", err)
+	}
+	msg := &dto.MessageToCreate{
+		Content: "欢迎使用Gensokyo框架部署QQ机器人",
+		MsgType: 0,
+		MsgID:   "",
+	}
+	_, err = ctx.P.Api.PostDirectMessage(context.TODO(), cdm, msg)
+	return err
+}
+
+// meCommand 发送当前的id映射状态
+func meCommand(ctx *CommandContext) error {
+	if ctx.LookupErr != nil {
+		// 发送错误信息
+		ctx.Reply(ctx.LookupErr.Error())
+		return ctx.LookupErr
+	}
+	if config.GetIdmapPro() {
+		// 构造清晰的对应关系信息
+		userMapping := fmt.Sprintf("当前真实值（用户）/当前虚拟值（用户） = [%s/%s]", ctx.RealUserID, ctx.UserID)
+		groupMapping := fmt.Sprintf("当前真实值（群/频道）/当前虚拟值（群/频道） = [%s/%s]", ctx.RealGroupID, ctx.GroupID)
+
+		// 构造 bind 指令的使用说明
+		bindInstruction := fmt.Sprintf("bind 指令: %s 当前虚拟值(用户) 目标虚拟值(用户) [当前虚拟值(群/频道) 目标虚拟值(群/频道)]", config.GetBindPrefix())
+
+		// 发送整合后的消息
+		ctx.Reply(fmt.Sprintf("idmaps-pro状态:\n%s\n%s\n当前角色 %s\n%s", userMapping, groupMapping, ctx.Role, bindInstruction))
+		return nil
+	}
+	ctx.Reply("目前状态:\n当前真实值(用户) " + ctx.RealUserID + "\n当前虚拟值(用户) " + ctx.UserID + "\n当前真实值(群/频道) " + ctx.RealGroupID + "\n当前虚拟值(群/频道) " + ctx.GroupID + "\n当前角色 " + ctx.Role + "\nbind指令:" + config.GetBindPrefix() + " 当前虚拟值" + " 目标虚拟值")
+	return nil
+}
+
+// bindCommand 修改虚拟值
+func bindCommand(ctx *CommandContext) error {
+	if config.GetIdmapPro() {
+		return performBindOperationV2(ctx.Text, ctx.Data, ctx.Type, ctx.P.Api, ctx.P.Apiv2, ctx.GroupID)
+	}
+	return performBindOperation(ctx.Text, ctx.Data, ctx.Type, ctx.P.Api, ctx.P.Apiv2)
+}
+
+// roleCommand 管理角色 权限在performRoleOperation内按操作区分
+func roleCommand(ctx *CommandContext) error {
+	ctx.Reply(performRoleOperation(ctx.Args, ctx.Scope, ctx.Role, ctx.IsOwner))
+	return nil
+}
+
+// helpCommand 列出当前场景下有权限使用的指令
+func helpCommand(ctx *CommandContext) error {
+	commandsMu.RLock()
+	var lines []string
+	for _, cmd := range commands {
+		triggers := cmd.triggers()
+		if len(triggers) == 0 || !cmd.available(ctx.Type) || !cmd.permitted(ctx) {
+			continue
+		}
+		lines = append(lines, strings.Join(triggers, "|")+" "+cmd.Help)
+	}
+	commandsMu.RUnlock()
+	sort.Strings(lines)
+	ctx.Reply("框架指令:\n" + strings.Join(lines, "\n"))
+	return nil
+}
+
+// pingCommand 回复pong与消息到达的延迟
+func pingCommand(ctx *CommandContext) error {
+	reply := "pong"
+	if ts := messageTimestamp(ctx.Data); ts != "" {
+		if t, err := time.Parse(time.RFC3339, ts); err == nil {
+			reply += fmt.Sprintf(" %dms", time.Since(t).Milliseconds())
+		}
+	}
+	ctx.Reply(reply)
+	return nil
+}
+
+// statusCommand 回复运行状态
+func statusCommand(ctx *CommandContext) error {
+	status := botstats.GetStatus()
+	ctx.Reply(fmt.Sprintf("在线: %v\n应用端: %v(连接数 %d)\n收包: %d 发包: %d 丢包: %d\n断线次数: %d",
+		status.Online, status.AppGood, botstats.AppConnections(),
+		status.Stat.PacketReceived, status.Stat.PacketSent, status.Stat.PacketLost,
+		status.Stat.DisconnectTimes))
+	return nil
+}
+
+// whoisCommand 查询虚拟值对应的真实值 或真实值对应的虚拟值
+func whoisCommand(ctx *CommandContext) error {
+	if len(ctx.Args) != 1 {
+		ctx.Reply("用法: " + config.GetWhoisPrefix() + " 虚拟值或真实值")
+		return nil
+	}
+	id := ctx.Args[0]
+	var reply string
+	if _, err := strconv.ParseInt(id, 10, 64); err == nil {
+		realID, err := idmap.RetrieveRowByIDv2(id)
+		if err != nil {
+			reply = "未找到虚拟值" + id + "的映射"
+		} else {
+			reply = "虚拟值 " + id + "\n真实值 " + realID
+			id = realID
+		}
+	} else {
+		_, virtualID, err := idmap.RetrieveVirtualValuev2(id)
+		if err != nil {
+			reply = "未找到真实值" + id + "的映射"
+		} else {
+			reply = "真实值 " + id + "\n虚拟值 " + virtualID
+		}
+	}
+	if t, err := idmap.ReadConfigv2(id, "type"); err == nil && t != "" {
+		reply += "\n类型 " + t
+	}
+	reply += "\n角色 " + idmap.ResolveRole(ctx.Scope, idmap.RoleMember, id)
+	ctx.Reply(reply)
+	return nil
+}
+
+// messageTimestamp 获取消息事件的时间戳
+func messageTimestamp(data interface{}) string {
+	switch v := data.(type) {
+	case *dto.WSGroupATMessageData:
+		return string(v.Timestamp)
+	case *dto.WSATMessageData:
+		return string(v.Timestamp)
+	case *dto.WSMessageData:
+		return string(v.Timestamp)
+	case *dto.WSDirectMessageData:
+		return string(v.Timestamp)
+	case *dto.WSC2CMessageData:
+		return string(v.Timestamp)
+	}
+	return ""
+}
@@ -0,0 +1,487 @@
+// Package backup 为gensokyo使用的bbolt数据库提供在线热备份、校验与恢复
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// ManifestName 每个备份目录中的清单文件
+	ManifestName = "manifest.json"
+	// PendingFile 记录待恢复的备份,下次启动时在打开数据库之前恢复
+	PendingFile = "restore.pending"
+	// 备份目录名称的时间格式
+	snapshotLayout = "20060102-150405"
+)
+
+// 命令行备份恢复时等待数据库文件锁的时间 超时说明gensokyo仍在运行
+var lockTimeout = 3 * time.Second
+
+var (
+	ErrSnapshotNotFound = errors.New("backup not found")
+	ErrChecksumMismatch = errors.New("backup checksum mismatch")
+	ErrDatabaseInUse    = errors.New("database is in use, stop gensokyo first")
+)
+
+// File 备份中的单个数据库文件 Path为数据库打开时的路径,恢复时写回该路径
+type File struct {
+	Name   string `json:"name"`
+	Path   string `json:"path,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest 一次备份的清单
+type Manifest struct {
+	Name  string `json:"name"`
+	Time  int64  `json:"time"`
+	Files []File `json:"files"`
+}
+
+var (
+	registry   = make(map[string]*bbolt.DB) // 数据库文件路径 -> 已打开的数据库
+	registryMu sync.Mutex
+	// 同一时间只进行一次备份或恢复
+	snapshotMu sync.Mutex
+
+	stopOnce sync.Once
+	stopChan = make(chan struct{})
+)
+
+// Register 登记已打开的数据库 path为数据库文件相对工作目录的路径
+func Register(path string, db *bbolt.DB) {
+	registryMu.Lock()
+	registry[path] = db
+	registryMu.Unlock()
+}
+
+// Unregister 数据库关闭前取消登记
+func Unregister(path string) {
+	registryMu.Lock()
+	delete(registry, path)
+	registryMu.Unlock()
+}
+
+// Dir 备份保存目录
+func Dir() string {
+	if dir := config.GetDBBackupDir(); dir != "" {
+		return dir
+	}
+	return "backups"
+}
+
+func keep() int {
+	if n := config.GetDBBackupKeep(); n > 0 {
+		return n
+	}
+	return 7
+}
+
+// Snapshot 对所有已登记的数据库做一次一致性热备份,并按保留数量清理旧备份
+func Snapshot() (Manifest, error) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+
+	registryMu.Lock()
+	dbs := make(map[string]*bbolt.DB, len(registry))
+	for path, db := range registry {
+		dbs[path] = db
+	}
+	registryMu.Unlock()
+	return snapshot(dbs)
+}
+
+// SnapshotFiles 命令行备份 以只读方式打开paths中存在的数据库并备份
+// gensokyo运行中时数据库被锁定,等待lockTimeout后返回ErrDatabaseInUse
+func SnapshotFiles(paths []string) (Manifest, error) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+
+	dbs := make(map[string]*bbolt.DB, len(paths))
+	defer func() {
+		for _, db := range dbs {
+			db.Close()
+		}
+	}()
+	for _, path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		db, err := openLocked(path, true)
+		if err != nil {
+			return Manifest{}, err
+		}
+		dbs[path] = db
+	}
+	return snapshot(dbs)
+}
+
+// openLocked 带超时地打开数据库 避免在gensokyo运行时一直等待文件锁
+func openLocked(path string, readOnly bool) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: lockTimeout, ReadOnly: readOnly})
+	if errors.Is(err, bbolt.ErrTimeout) {
+		return nil, fmt.Errorf("%w: %s", ErrDatabaseInUse, path)
+	}
+	return db, err
+}
+
+// snapshot 备份dbs中的数据库 调用方持有snapshotMu
+func snapshot(dbs map[string]*bbolt.DB) (Manifest, error) {
+	paths := make([]string, 0, len(dbs))
+	for path := range dbs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	now := time.Now()
+	manifest := Manifest{Name: snapshotName(now.Format(snapshotLayout)), Time: now.Unix()}
+	dir := filepath.Join(Dir(), manifest.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return manifest, err
+	}
+
+	for _, path := range paths {
+		file, err := writeSnapshot(dbs[path], path, dir)
+		if err != nil {
+			os.RemoveAll(dir)
+			return manifest, fmt.Errorf("backup %s: %w", path, err)
+		}
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		os.RemoveAll(dir)
+		return manifest, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestName), data, 0644); err != nil {
+		os.RemoveAll(dir)
+		return manifest, err
+	}
+
+	prune()
+	return manifest, nil
+}
+
+// snapshotName 同一秒内重复备份时在已有的最大序号上加一
+// 不复用已被清理的名称,否则新备份会被当作最旧的清理掉
+func snapshotName(base string) string {
+	entries, _ := os.ReadDir(Dir())
+	next := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == base && next == 0 {
+			next = 1
+		}
+		if suffix, ok := strings.CutPrefix(name, base+"-"); ok {
+			if n, err := strconv.Atoi(suffix); err == nil && n >= next {
+				next = n + 1
+			}
+		}
+	}
+	if next == 0 {
+		return base
+	}
+	return fmt.Sprintf("%s-%d", base, next)
+}
+
+// writeSnapshot 在读事务中用WriteTo写出数据库的一致性副本,同时计算校验和
+func writeSnapshot(db *bbolt.DB, path, dir string) (File, error) {
+	file := File{Name: filepath.Base(path), Path: path}
+	out, err := os.OpenFile(filepath.Join(dir, file.Name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return file, err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	err = db.View(func(tx *bbolt.Tx) error {
+		n, err := tx.WriteTo(io.MultiWriter(out, hash))
+		file.Size = n
+		return err
+	})
+	if err != nil {
+		return file, err
+	}
+	if err := out.Sync(); err != nil {
+		return file, err
+	}
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return file, nil
+}
+
+// prune 删除超出保留数量的旧备份
+func prune() {
+	manifests, err := List()
+	if err != nil {
+		return
+	}
+	for i := keep(); i < len(manifests); i++ {
+		if err := os.RemoveAll(filepath.Join(Dir(), manifests[i].Name)); err != nil {
+			mylog.Printf("删除旧备份%s失败: %v", manifests[i].Name, err)
+		}
+	}
+}
+
+// List 列出全部备份 新的在前
+func List() ([]Manifest, error) {
+	entries, err := os.ReadDir(Dir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifests []Manifest
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		manifest, err := readManifest(entry.Name())
+		if err != nil {
+			continue
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		if manifests[i].Time != manifests[j].Time {
+			return manifests[i].Time > manifests[j].Time
+		}
+		// 同一秒内序号大的较新
+		if len(manifests[i].Name) != len(manifests[j].Name) {
+			return len(manifests[i].Name) > len(manifests[j].Name)
+		}
+		return manifests[i].Name > manifests[j].Name
+	})
+	return manifests, nil
+}
+
+func readManifest(name string) (Manifest, error) {
+	var manifest Manifest
+	// 备份名称只能是备份目录下的子目录
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return manifest, ErrSnapshotNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(Dir(), name, ManifestName))
+	if os.IsNotExist(err) {
+		return manifest, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, err
+	}
+	manifest.Name = name
+	return manifest, nil
+}
+
+// Verify 按清单校验备份文件的大小和sha256
+func Verify(name string) (Manifest, error) {
+	manifest, err := readManifest(name)
+	if err != nil {
+		return manifest, err
+	}
+	for _, file := range manifest.Files {
+		if err := verifyFile(filepath.Join(Dir(), name, file.Name), file); err != nil {
+			return manifest, err
+		}
+	}
+	return manifest, nil
+}
+
+func verifyFile(path string, file File) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	n, err := io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	if n != file.Size || hex.EncodeToString(hash.Sum(nil)) != file.SHA256 {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, file.Name)
+	}
+	return nil
+}
+
+// Restore 校验后用备份覆盖数据库文件 原文件改名为.before-restore保留
+// 数据库仍被gensokyo打开时返回ErrDatabaseInUse
+func Restore(name string) error {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+
+	manifest, err := Verify(name)
+	if err != nil {
+		return err
+	}
+	return restoreFiles(filepath.Join(Dir(), name), manifest)
+}
+
+// restoreFiles 把dir中已校验的备份文件写回各自的数据库路径
+func restoreFiles(dir string, manifest Manifest) error {
+	for _, file := range manifest.Files {
+		dst, err := restorePath(file)
+		if err != nil {
+			return err
+		}
+		if err := restoreFile(filepath.Join(dir, file.Name), dst); err != nil {
+			return fmt.Errorf("restore %s: %w", dst, err)
+		}
+		mylog.Printf("已从备份%s恢复%s", dir, dst)
+	}
+	return nil
+}
+
+// restorePath 数据库文件的恢复位置 旧清单没有path时为工作目录下的同名文件
+func restorePath(file File) (string, error) {
+	if file.Name == "" || file.Name != filepath.Base(file.Name) || strings.HasPrefix(file.Name, ".") {
+		return "", fmt.Errorf("invalid file name in manifest: %q", file.Name)
+	}
+	if file.Path == "" {
+		return file.Name, nil
+	}
+	// path只能指向同名的数据库文件
+	if filepath.Base(file.Path) != file.Name {
+		return "", fmt.Errorf("manifest path %q does not match %q", file.Path, file.Name)
+	}
+	return file.Path, nil
+}
+
+func restoreFile(src, dst string) error {
+	// 覆盖前确认数据库没有被打开 损坏无法打开的数据库照常覆盖
+	if _, err := os.Stat(dst); err == nil {
+		db, err := openLocked(dst, true)
+		if errors.Is(err, ErrDatabaseInUse) {
+			return err
+		}
+		if err == nil {
+			db.Close()
+		}
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".restoring"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	out.Close()
+
+	if _, err := os.Stat(dst); err == nil {
+		if err := os.Rename(dst, dst+".before-restore"); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, dst)
+}
+
+// ScheduleRestore 校验备份并记录为待恢复,下次启动gensokyo时生效
+func ScheduleRestore(name string) error {
+	if _, err := Verify(name); err != nil {
+		return err
+	}
+	return os.WriteFile(PendingFile, []byte(filepath.Join(Dir(), name)), 0644)
+}
+
+// ApplyPending 恢复restore.pending中记录的备份 必须在打开任何数据库之前调用
+// 记录的是备份目录的完整路径,不依赖配置
+func ApplyPending() error {
+	data, err := os.ReadFile(PendingFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// 无论成功与否只尝试一次,避免每次启动都覆盖数据库
+	os.Remove(PendingFile)
+
+	dir := strings.TrimSpace(string(data))
+	raw, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return err
+	}
+	for _, file := range manifest.Files {
+		if err := verifyFile(filepath.Join(dir, file.Name), file); err != nil {
+			return err
+		}
+	}
+	if err := restoreFiles(dir, manifest); err != nil {
+		return err
+	}
+	log.Printf("已从备份%s恢复%d个数据库,原文件保留为.before-restore", dir, len(manifest.Files))
+	return nil
+}
+
+// Start 按db_backup_interval定时备份 间隔为0时不备份,修改配置后下一轮生效
+func Start() {
+	go func() {
+		for {
+			interval := config.GetDBBackupInterval()
+			wait := time.Duration(interval) * time.Minute
+			if interval <= 0 {
+				// 未开启时每分钟检查一次配置
+				wait = time.Minute
+			}
+			select {
+			case <-stopChan:
+				return
+			case <-time.After(wait):
+			}
+			if config.GetDBBackupInterval() <= 0 {
+				continue
+			}
+			manifest, err := Snapshot()
+			if err != nil {
+				mylog.Printf("数据库备份失败: %v", err)
+				continue
+			}
+			mylog.Printf("数据库已备份到%s", filepath.Join(Dir(), manifest.Name))
+		}
+	}()
+}
+
+// Stop 停止定时备份
+func Stop() {
+	stopOnce.Do(func() { close(stopChan) })
+}
@@ -0,0 +1,250 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// openTestDB 在工作目录下创建并登记一个数据库,写入key=value
+func openTestDB(t *testing.T, path, value string) *bbolt.DB {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putValue(t, db, value)
+	Register(path, db)
+	t.Cleanup(func() {
+		Unregister(path)
+		db.Close()
+	})
+	return db
+}
+
+func putValue(t *testing.T, db *bbolt.DB, value string) {
+	t.Helper()
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("test"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte(value))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readValue(t *testing.T, path string) string {
+	t.Helper()
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var value string
+	db.View(func(tx *bbolt.Tx) error {
+		value = string(tx.Bucket([]byte("test")).Get([]byte("key")))
+		return nil
+	})
+	return value
+}
+
+// closeDB 关闭并取消登记 模拟gensokyo退出
+func closeDB(path string, db *bbolt.DB) {
+	Unregister(path)
+	db.Close()
+}
+
+func TestSnapshotManifest(t *testing.T) {
+	t.Chdir(t.TempDir())
+	openTestDB(t, "a.db", "a")
+	openTestDB(t, filepath.Join("data", "b.db"), "b")
+
+	manifest, err := Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 2 {
+		t.Fatalf("got %d files", len(manifest.Files))
+	}
+	if f := manifest.Files[1]; f.Name != "b.db" || f.Path != filepath.Join("data", "b.db") || f.Size == 0 || len(f.SHA256) != 64 {
+		t.Errorf("unexpected file %+v", f)
+	}
+
+	list, err := List()
+	if err != nil || len(list) != 1 || list[0].Name != manifest.Name {
+		t.Fatalf("List() = %+v, %v", list, err)
+	}
+	if _, err := Verify(manifest.Name); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if got := readValue(t, filepath.Join(Dir(), manifest.Name, "b.db")); got != "b" {
+		t.Errorf("backup of b.db holds %q", got)
+	}
+}
+
+func TestVerifyDetectsCorruption(t *testing.T) {
+	t.Chdir(t.TempDir())
+	openTestDB(t, "a.db", "a")
+	manifest, err := Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(Dir(), manifest.Name, "a.db")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(manifest.Name); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Verify corrupted backup: %v", err)
+	}
+	if err := Restore(manifest.Name); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Restore corrupted backup: %v", err)
+	}
+
+	for _, name := range []string{"", "..", "../" + manifest.Name, ".hidden", "missing"} {
+		if _, err := Verify(name); !errors.Is(err, ErrSnapshotNotFound) {
+			t.Errorf("Verify(%q) = %v", name, err)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	t.Chdir(t.TempDir())
+	path := filepath.Join("data", "b.db")
+	db := openTestDB(t, path, "old")
+	manifest, err := Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	putValue(t, db, "new")
+
+	// 数据库仍被打开时拒绝覆盖
+	lockTimeout = 50 * time.Millisecond
+	defer func() { lockTimeout = 3 * time.Second }()
+	if err := Restore(manifest.Name); !errors.Is(err, ErrDatabaseInUse) {
+		t.Fatalf("Restore with open database: %v", err)
+	}
+
+	closeDB(path, db)
+	if err := Restore(manifest.Name); err != nil {
+		t.Fatal(err)
+	}
+	if got := readValue(t, path); got != "old" {
+		t.Errorf("restored value %q", got)
+	}
+	if got := readValue(t, path+".before-restore"); got != "new" {
+		t.Errorf("before-restore value %q", got)
+	}
+	// 恢复到数据库的路径,而不是工作目录下的同名文件
+	if _, err := os.Stat("b.db"); !os.IsNotExist(err) {
+		t.Errorf("b.db written to the working directory: %v", err)
+	}
+}
+
+func TestRestorePath(t *testing.T) {
+	cases := []struct {
+		file File
+		want string
+		ok   bool
+	}{
+		{File{Name: "idmap.db"}, "idmap.db", true},
+		{File{Name: "idmap.db", Path: filepath.Join("data", "idmap.db")}, filepath.Join("data", "idmap.db"), true},
+		{File{Name: "idmap.db", Path: filepath.Join("data", "other.db")}, "", false},
+		{File{Name: "../idmap.db"}, "", false},
+		{File{Name: ""}, "", false},
+	}
+	for _, c := range cases {
+		got, err := restorePath(c.file)
+		if (err == nil) != c.ok || got != c.want {
+			t.Errorf("restorePath(%+v) = %q, %v", c.file, got, err)
+		}
+	}
+}
+
+func TestApplyPending(t *testing.T) {
+	t.Chdir(t.TempDir())
+	db := openTestDB(t, "a.db", "old")
+	manifest, err := Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	putValue(t, db, "new")
+	closeDB("a.db", db)
+
+	if err := ScheduleRestore(manifest.Name); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyPending(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readValue(t, "a.db"); got != "old" {
+		t.Errorf("restored value %q", got)
+	}
+	if _, err := os.Stat(PendingFile); !os.IsNotExist(err) {
+		t.Errorf("pending file left behind: %v", err)
+	}
+	// 没有待恢复的备份时什么都不做
+	if err := ApplyPending(); err != nil {
+		t.Errorf("ApplyPending without pending file: %v", err)
+	}
+}
+
+func TestSnapshotFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	db := openTestDB(t, "a.db", "a")
+	closeDB("a.db", db)
+
+	manifest, err := SnapshotFiles([]string{"a.db", "missing.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 1 || manifest.Files[0].Name != "a.db" {
+		t.Fatalf("unexpected files %+v", manifest.Files)
+	}
+	if _, err := Verify(manifest.Name); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	// gensokyo运行中时超时退出
+	openTestDB(t, "a.db", "a")
+	lockTimeout = 50 * time.Millisecond
+	defer func() { lockTimeout = 3 * time.Second }()
+	if _, err := SnapshotFiles([]string{"a.db"}); !errors.Is(err, ErrDatabaseInUse) {
+		t.Errorf("SnapshotFiles with open database: %v", err)
+	}
+}
+
+func TestSnapshotPrune(t *testing.T) {
+	t.Chdir(t.TempDir())
+	openTestDB(t, "a.db", "a")
+	var last Manifest
+	for i := 0; i < keep()+5; i++ {
+		m, err := Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = m
+	}
+	list, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != keep() || list[0].Name != last.Name {
+		t.Errorf("kept %d backups, newest %q, want %d and %q", len(list), list[0].Name, keep(), last.Name)
+	}
+}
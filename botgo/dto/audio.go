@@ -18,6 +18,14 @@ type AudioControl struct {
 	Status AudioStatus `json:"status"`
 }
 
+// AudioLiveChannelMember 音视频/直播子频道成员进出事件
+type AudioLiveChannelMember struct {
+	GuildID     string      `json:"guild_id"`
+	ChannelID   string      `json:"channel_id"`
+	ChannelType ChannelType `json:"channel_type"`
+	UserID      string      `json:"user_id"`
+}
+
 // AudioAction 音频动作
 type AudioAction struct {
 	GuildID   string `json:"guild_id"`
@@ -31,6 +31,70 @@ type ForumURLElement struct {
 	} `json:"url_info"`
 }
 
+// ForumImageElement 图片元素结构体 发帖时使用third_url,收到的帖子中为plat_image
+type ForumImageElement struct {
+	Type      int            `json:"type"` // 类型标识，2代表图片
+	ImageInfo ForumImageInfo `json:"image"`
+}
+
+// ForumImageInfo 图片元素内容
+type ForumImageInfo struct {
+	ThirdURL     string          `json:"third_url,omitempty"`
+	WidthPercent float64         `json:"width_percent,omitempty"`
+	PlatImage    *ForumPlatImage `json:"plat_image,omitempty"`
+}
+
+// ForumPlatImage 平台图片
+type ForumPlatImage struct {
+	URL     string `json:"url"`
+	Width   uint32 `json:"width"`
+	Height  uint32 `json:"height"`
+	ImageID string `json:"image_id"`
+}
+
+// ForumVideoElement 视频元素结构体
+type ForumVideoElement struct {
+	Type      int            `json:"type"` // 类型标识，3代表视频
+	VideoInfo ForumVideoInfo `json:"video"`
+}
+
+// ForumVideoInfo 视频元素内容
+type ForumVideoInfo struct {
+	ThirdURL  string          `json:"third_url,omitempty"`
+	PlatVideo *ForumPlatVideo `json:"plat_video,omitempty"`
+}
+
+// ForumPlatVideo 平台视频
+type ForumPlatVideo struct {
+	URL      string `json:"url"`
+	Width    uint32 `json:"width"`
+	Height   uint32 `json:"height"`
+	VideoID  string `json:"video_id"`
+	Duration uint32 `json:"duration"`
+	Cover    struct {
+		URL string `json:"url"`
+	} `json:"cover"`
+}
+
+// ForumLinkElement 文档中的链接元素结构体
+type ForumLinkElement struct {
+	Type     int `json:"type"` // 类型标识，4代表链接
+	LinkInfo struct {
+		URL  string `json:"url"`
+		Desc string `json:"desc"`
+	} `json:"url"`
+}
+
+// ForumRichText 发帖时的富文本内容 format为4
+type ForumRichText struct {
+	Paragraphs []ForumParagraph `json:"paragraphs"`
+}
+
+// ForumParagraph 富文本段落
+type ForumParagraph struct {
+	Elems []ForumContentElement `json:"elems"`
+}
+
 // 定义匹配JSON结构的新结构体
 type ForumContentStructure struct {
 	Paragraphs []struct {
@@ -104,3 +168,60 @@ type ForumAuditResult struct {
 	ErrMsg      string `json:"err_msg"`
 	DateTime    string `json:"date_time"`
 }
+
+// ThreadList 帖子列表 IsFinish为1时已拉取全部帖子
+type ThreadList struct {
+	Threads  []*Thread `json:"threads"`
+	IsFinish uint32    `json:"is_finish"`
+}
+
+// ThreadDetail 帖子详情
+type ThreadDetail struct {
+	Thread Thread `json:"thread"`
+}
+
+// UnmarshalForumContent 按段落解析帖子、评论、回复的富文本内容 无法识别的元素会被跳过
+func UnmarshalForumContent(content string) ([][]ForumContentElement, error) {
+	var contentStructure ForumContentStructure
+	if err := json.Unmarshal([]byte(content), &contentStructure); err != nil {
+		return nil, err
+	}
+
+	paragraphs := make([][]ForumContentElement, 0, len(contentStructure.Paragraphs))
+	for _, paragraph := range contentStructure.Paragraphs {
+		var elements []ForumContentElement
+		for _, rawElem := range paragraph.Elems {
+			var base struct {
+				Type    int             `json:"type"`
+				URLInfo json.RawMessage `json:"url_info"`
+			}
+			if err := json.Unmarshal(rawElem, &base); err != nil {
+				continue
+			}
+			var elem ForumContentElement
+			switch {
+			case base.Type == 1:
+				elem = &ForumTextElement{}
+			case base.Type == 2:
+				elem = &ForumImageElement{}
+			// 实际推送中链接元素的类型为3且内容在url_info中
+			case base.Type == 3 && base.URLInfo != nil:
+				elem = &ForumURLElement{}
+			case base.Type == 3:
+				elem = &ForumVideoElement{}
+			case base.Type == 4:
+				elem = &ForumLinkElement{}
+			case base.Type == 5:
+				elem = &ForumChannelElement{}
+			default:
+				continue
+			}
+			if err := json.Unmarshal(rawElem, elem); err != nil {
+				continue
+			}
+			elements = append(elements, elem)
+		}
+		paragraphs = append(paragraphs, elements)
+	}
+	return paragraphs, nil
+}
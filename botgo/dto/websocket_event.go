@@ -6,44 +6,46 @@ func init() {
 
 // 事件类型
 const (
-	EventGuildCreate           EventType = "GUILD_CREATE"
-	EventGuildUpdate           EventType = "GUILD_UPDATE"
-	EventGuildDelete           EventType = "GUILD_DELETE"
-	EventChannelCreate         EventType = "CHANNEL_CREATE"
-	EventChannelUpdate         EventType = "CHANNEL_UPDATE"
-	EventChannelDelete         EventType = "CHANNEL_DELETE"
-	EventGuildMemberAdd        EventType = "GUILD_MEMBER_ADD"
-	EventGuildMemberUpdate     EventType = "GUILD_MEMBER_UPDATE"
-	EventGuildMemberRemove     EventType = "GUILD_MEMBER_REMOVE"
-	EventMessageCreate         EventType = "MESSAGE_CREATE"
-	EventMessageReactionAdd    EventType = "MESSAGE_REACTION_ADD"
-	EventMessageReactionRemove EventType = "MESSAGE_REACTION_REMOVE"
-	EventAtMessageCreate       EventType = "AT_MESSAGE_CREATE"
-	EventPublicMessageDelete   EventType = "PUBLIC_MESSAGE_DELETE"
-	EventDirectMessageCreate   EventType = "DIRECT_MESSAGE_CREATE"
-	EventDirectMessageDelete   EventType = "DIRECT_MESSAGE_DELETE"
-	EventAudioStart            EventType = "AUDIO_START"
-	EventAudioFinish           EventType = "AUDIO_FINISH"
-	EventAudioOnMic            EventType = "AUDIO_ON_MIC"
-	EventAudioOffMic           EventType = "AUDIO_OFF_MIC"
-	EventMessageAuditPass      EventType = "MESSAGE_AUDIT_PASS"
-	EventMessageAuditReject    EventType = "MESSAGE_AUDIT_REJECT"
-	EventMessageDelete         EventType = "MESSAGE_DELETE"
-	EventForumThreadCreate     EventType = "FORUM_THREAD_CREATE"
-	EventForumThreadUpdate     EventType = "FORUM_THREAD_UPDATE"
-	EventForumThreadDelete     EventType = "FORUM_THREAD_DELETE"
-	EventForumPostCreate       EventType = "FORUM_POST_CREATE"
-	EventForumPostDelete       EventType = "FORUM_POST_DELETE"
-	EventForumReplyCreate      EventType = "FORUM_REPLY_CREATE"
-	EventForumReplyDelete      EventType = "FORUM_REPLY_DELETE"
-	EventForumAuditResult      EventType = "FORUM_PUBLISH_AUDIT_RESULT"
-	EventInteractionCreate     EventType = "INTERACTION_CREATE"
-	EventGroupAtMessageCreate  EventType = "GROUP_AT_MESSAGE_CREATE"
-	EventC2CMessageCreate      EventType = "C2C_MESSAGE_CREATE"
-	EventGroupAddRobot         EventType = "GROUP_ADD_ROBOT"
-	EventGroupDelRobot         EventType = "GROUP_DEL_ROBOT"
-	EventGroupMsgReject        EventType = "GROUP_MSG_REJECT"
-	EventGroupMsgReceive       EventType = "GROUP_MSG_RECEIVE"
+	EventGuildCreate            EventType = "GUILD_CREATE"
+	EventGuildUpdate            EventType = "GUILD_UPDATE"
+	EventGuildDelete            EventType = "GUILD_DELETE"
+	EventChannelCreate          EventType = "CHANNEL_CREATE"
+	EventChannelUpdate          EventType = "CHANNEL_UPDATE"
+	EventChannelDelete          EventType = "CHANNEL_DELETE"
+	EventGuildMemberAdd         EventType = "GUILD_MEMBER_ADD"
+	EventGuildMemberUpdate      EventType = "GUILD_MEMBER_UPDATE"
+	EventGuildMemberRemove      EventType = "GUILD_MEMBER_REMOVE"
+	EventMessageCreate          EventType = "MESSAGE_CREATE"
+	EventMessageReactionAdd     EventType = "MESSAGE_REACTION_ADD"
+	EventMessageReactionRemove  EventType = "MESSAGE_REACTION_REMOVE"
+	EventAtMessageCreate        EventType = "AT_MESSAGE_CREATE"
+	EventPublicMessageDelete    EventType = "PUBLIC_MESSAGE_DELETE"
+	EventDirectMessageCreate    EventType = "DIRECT_MESSAGE_CREATE"
+	EventDirectMessageDelete    EventType = "DIRECT_MESSAGE_DELETE"
+	EventAudioStart             EventType = "AUDIO_START"
+	EventAudioFinish            EventType = "AUDIO_FINISH"
+	EventAudioOnMic             EventType = "AUDIO_ON_MIC"
+	EventAudioOffMic            EventType = "AUDIO_OFF_MIC"
+	EventAudioOrLiveMemberEnter EventType = "AUDIO_OR_LIVE_CHANNEL_MEMBER_ENTER"
+	EventAudioOrLiveMemberExit  EventType = "AUDIO_OR_LIVE_CHANNEL_MEMBER_EXIT"
+	EventMessageAuditPass       EventType = "MESSAGE_AUDIT_PASS"
+	EventMessageAuditReject     EventType = "MESSAGE_AUDIT_REJECT"
+	EventMessageDelete          EventType = "MESSAGE_DELETE"
+	EventForumThreadCreate      EventType = "FORUM_THREAD_CREATE"
+	EventForumThreadUpdate      EventType = "FORUM_THREAD_UPDATE"
+	EventForumThreadDelete      EventType = "FORUM_THREAD_DELETE"
+	EventForumPostCreate        EventType = "FORUM_POST_CREATE"
+	EventForumPostDelete        EventType = "FORUM_POST_DELETE"
+	EventForumReplyCreate       EventType = "FORUM_REPLY_CREATE"
+	EventForumReplyDelete       EventType = "FORUM_REPLY_DELETE"
+	EventForumAuditResult       EventType = "FORUM_PUBLISH_AUDIT_RESULT"
+	EventInteractionCreate      EventType = "INTERACTION_CREATE"
+	EventGroupAtMessageCreate   EventType = "GROUP_AT_MESSAGE_CREATE"
+	EventC2CMessageCreate       EventType = "C2C_MESSAGE_CREATE"
+	EventGroupAddRobot          EventType = "GROUP_ADD_ROBOT"
+	EventGroupDelRobot          EventType = "GROUP_DEL_ROBOT"
+	EventGroupMsgReject         EventType = "GROUP_MSG_REJECT"
+	EventGroupMsgReceive        EventType = "GROUP_MSG_RECEIVE"
 )
 
 // intentEventMap 不同 intent 对应的事件定义
@@ -65,7 +67,8 @@ var intentEventMap = map[Intent][]EventType{
 		EventForumThreadCreate, EventForumThreadUpdate, EventForumThreadDelete, EventForumPostCreate,
 		EventForumPostDelete, EventForumReplyCreate, EventForumReplyDelete, EventForumAuditResult,
 	},
-	IntentInteraction: {EventInteractionCreate},
+	IntentInteraction:              {EventInteractionCreate},
+	IntentAudioOrLiveChannelMember: {EventAudioOrLiveMemberEnter, EventAudioOrLiveMemberExit},
 }
 
 var eventIntentMap = transposeIntentEventMap(intentEventMap)
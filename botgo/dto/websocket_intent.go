@@ -43,6 +43,11 @@ const (
 	IntentDirectMessageReactions
 	IntentDirectMessageTyping
 
+	// IntentAudioOrLiveChannelMember 音视频/直播子频道成员进出事件
+	//  - AUDIO_OR_LIVE_CHANNEL_MEMBER_ENTER // 当用户进入音视频/直播子频道时
+	//  - AUDIO_OR_LIVE_CHANNEL_MEMBER_EXIT  // 当用户离开音视频/直播子频道时
+	IntentAudioOrLiveChannelMember Intent = 1 << 19
+
 	// IntentGroupMessages 群消息事件
 	// - GROUP_AT_MESSAGE_CREATE // 群中@机器人时的消息
 	IntentGroupMessages Intent = 1 << 25 // 群消息事件
@@ -88,6 +88,9 @@ type WSDirectMessageDeleteData MessageDelete
 // WSAudioData 音频机器人的音频流事件
 type WSAudioData AudioAction
 
+// WSAudioLiveChannelMemberData 音视频/直播子频道成员进出事件
+type WSAudioLiveChannelMemberData AudioLiveChannelMember
+
 // WSMessageReactionData 表情表态事件
 type WSMessageReactionData MessageReaction
 
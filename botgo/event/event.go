@@ -61,6 +61,9 @@ var eventParseFuncMap = map[dto.OPCode]map[dto.EventType]eventParseFunc{
 		dto.EventAudioOnMic:  audioHandler,
 		dto.EventAudioOffMic: audioHandler,
 
+		dto.EventAudioOrLiveMemberEnter: audioLiveChannelMemberHandler,
+		dto.EventAudioOrLiveMemberExit:  audioLiveChannelMemberHandler,
+
 		dto.EventMessageAuditPass:   messageAuditHandler,
 		dto.EventMessageAuditReject: messageAuditHandler,
 
@@ -326,6 +329,17 @@ func audioHandler(payload *dto.WSPayload, message []byte) error {
 	return nil
 }
 
+func audioLiveChannelMemberHandler(payload *dto.WSPayload, message []byte) error {
+	data := &dto.WSAudioLiveChannelMemberData{}
+	if err := ParseData(message, data); err != nil {
+		return err
+	}
+	if DefaultHandlers.AudioLiveChannelMember != nil {
+		return DefaultHandlers.AudioLiveChannelMember(payload, data)
+	}
+	return nil
+}
+
 func threadHandler(payload *dto.WSPayload, message []byte) error {
 	data := &dto.WSThreadData{}
 	if err := ParseData(message, data); err != nil {
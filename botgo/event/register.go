@@ -23,7 +23,8 @@ var DefaultHandlers struct {
 	PublicMessageDelete PublicMessageDeleteEventHandler
 	DirectMessageDelete DirectMessageDeleteEventHandler
 
-	Audio AudioEventHandler
+	Audio                  AudioEventHandler
+	AudioLiveChannelMember AudioLiveChannelMemberEventHandler
 
 	Thread     ThreadEventHandler
 	Post       PostEventHandler
@@ -83,6 +84,9 @@ type DirectMessageEventHandler func(event *dto.WSPayload, data *dto.WSDirectMess
 // AudioEventHandler 音频机器人事件 handler
 type AudioEventHandler func(event *dto.WSPayload, data *dto.WSAudioData) error
 
+// AudioLiveChannelMemberEventHandler 音视频/直播子频道成员进出事件 handler
+type AudioLiveChannelMemberEventHandler func(event *dto.WSPayload, data *dto.WSAudioLiveChannelMemberData) error
+
 // MessageAuditEventHandler 消息审核事件 handler
 type MessageAuditEventHandler func(event *dto.WSPayload, data *dto.WSMessageAuditData) error
 
@@ -140,6 +144,9 @@ func RegisterHandlers(handlers ...interface{}) dto.Intent {
 				dto.EventAudioStart, dto.EventAudioFinish,
 				dto.EventAudioOnMic, dto.EventAudioOffMic,
 			)
+		case AudioLiveChannelMemberEventHandler:
+			DefaultHandlers.AudioLiveChannelMember = handle
+			i = i | dto.EventToIntent(dto.EventAudioOrLiveMemberEnter, dto.EventAudioOrLiveMemberExit)
 		case InteractionEventHandler:
 			DefaultHandlers.Interaction = handle
 			i = i | dto.EventToIntent(dto.EventInteractionCreate)
@@ -65,3 +65,24 @@ func DoRespFilterChains(req *http.Request, resp *http.Response) error {
 	}
 	return nil
 }
+
+// HTTPErrorHook 请求失败钩子，网络错误与非成功状态码都会触发
+type HTTPErrorHook func(req *http.Request, err error)
+
+var errorHooks []HTTPErrorHook
+
+// RegisterErrorHook 注册请求失败钩子
+func RegisterErrorHook(hook HTTPErrorHook) {
+	filterLock.Lock()
+	defer filterLock.Unlock()
+	errorHooks = append(errorHooks, hook)
+}
+
+// DoErrorHooks 按照注册顺序执行请求失败钩子
+func DoErrorHooks(req *http.Request, err error) {
+	filterLock.RLock()
+	defer filterLock.RUnlock()
+	for _, hook := range errorHooks {
+		hook(req, err)
+	}
+}
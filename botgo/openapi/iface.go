@@ -37,6 +37,7 @@ type OpenAPI interface {
 	WebhookAPI
 	InteractionAPI
 	MessageSettingAPI
+	ForumAPI
 }
 
 // Base 基础能力接口
@@ -264,3 +265,13 @@ type WebhookAPI interface {
 type MessageSettingAPI interface {
 	GetMessageSetting(ctx context.Context, guildID string) (*dto.MessageSetting, error)
 }
+
+// ForumAPI 论坛帖子相关接口 发帖为MessageAPI的PostFourm
+type ForumAPI interface {
+	// ListThreads 获取子频道的帖子列表
+	ListThreads(ctx context.Context, channelID string) (*dto.ThreadList, error)
+	// GetThread 获取帖子详情
+	GetThread(ctx context.Context, channelID, threadID string) (*dto.Thread, error)
+	// DeleteThread 删除帖子
+	DeleteThread(ctx context.Context, channelID, threadID string) error
+}
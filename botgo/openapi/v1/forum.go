@@ -0,0 +1,41 @@
+package v1
+
+import (
+	"context"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// ListThreads 获取子频道的帖子列表
+func (o *openAPI) ListThreads(ctx context.Context, channelID string) (*dto.ThreadList, error) {
+	resp, err := o.request(ctx).
+		SetResult(dto.ThreadList{}).
+		SetPathParam("channel_id", channelID).
+		Get(o.getURL(fourmMessagesURI))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Result().(*dto.ThreadList), nil
+}
+
+// GetThread 获取帖子详情
+func (o *openAPI) GetThread(ctx context.Context, channelID, threadID string) (*dto.Thread, error) {
+	resp, err := o.request(ctx).
+		SetResult(dto.ThreadDetail{}).
+		SetPathParam("channel_id", channelID).
+		SetPathParam("thread_id", threadID).
+		Get(o.getURL(fourmMessageURI))
+	if err != nil {
+		return nil, err
+	}
+	return &resp.Result().(*dto.ThreadDetail).Thread, nil
+}
+
+// DeleteThread 删除帖子
+func (o *openAPI) DeleteThread(ctx context.Context, channelID, threadID string) error {
+	_, err := o.request(ctx).
+		SetPathParam("channel_id", channelID).
+		SetPathParam("thread_id", threadID).
+		Delete(o.getURL(fourmMessageURI))
+	return err
+}
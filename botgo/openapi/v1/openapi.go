@@ -117,6 +117,12 @@ func (o *openAPI) setupClient() {
 				}
 				return nil
 			},
+		).
+		// 请求失败时通知钩子，便于统计接口调用失败
+		OnError(
+			func(req *resty.Request, err error) {
+				openapi.DoErrorHooks(req.RawRequest, err)
+			},
 		)
 }
 
@@ -28,6 +28,7 @@ const (
 
 	messagesURI       uri = "/channels/{channel_id}/messages"
 	fourmMessagesURI  uri = "/channels/{channel_id}/threads"
+	fourmMessageURI   uri = "/channels/{channel_id}/threads/{thread_id}"
 	groupMessagesURI  uri = "/v2/groups/{group_id}/messages"
 	groupRichMediaURI uri = "/v2/groups/{group_id}/files"
 
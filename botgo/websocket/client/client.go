@@ -50,6 +50,8 @@ type Client struct {
 	user            *dto.WSUser
 	closeChan       closeErrorChan
 	heartBeatTicker *time.Ticker // 用于维持定时心跳
+	online          int32        // 是否已计入在线连接
+	resuming        int32        // 是否处于 resume 中
 }
 
 type messageChan chan *dto.WSPayload
@@ -92,6 +94,7 @@ func (c *Client) Listening() error {
 		select {
 		case <-resumeSignal: // 使用信号量控制连接立即重连
 			log.Infof("%s, received resumeSignal signal", c.session)
+			c.markOffline()
 			return errs.ErrNeedReConnect
 		case err := <-c.closeChan:
 			// 关闭连接的错误码 https://bot.q.qq.com/wiki/develop/api/gateway/error/error.html
@@ -109,6 +112,10 @@ func (c *Client) Listening() error {
 			if wss.IsUnexpectedCloseError(err, 4009) {
 				err = errs.New(errs.CodeConnCloseCantResume, err.Error())
 			}
+			c.markOffline()
+			if err == errs.ErrInvalidSession {
+				atomic.AddUint32(&invalidSessionTimes, 1)
+			}
 			if event.DefaultHandlers.ErrorNotify != nil {
 				// 通知到使用方错误
 				event.DefaultHandlers.ErrorNotify(err)
@@ -135,9 +142,11 @@ func (c *Client) Write(message *dto.WSPayload) error {
 
 	if err := c.conn.WriteMessage(wss.TextMessage, m); err != nil {
 		log.Errorf("%s WriteMessage failed, %v", c.session, err)
+		atomic.AddUint32(&packetsLost, 1)
 		c.closeChan <- err
 		return err
 	}
+	atomic.AddUint64(&packetsSent, 1)
 	return nil
 }
 
@@ -151,6 +160,7 @@ func (c *Client) Resume() error {
 		},
 	}
 	payload.OPCode = dto.WSResume // 内嵌结构体字段，单独赋值
+	c.markResuming()
 	return c.Write(payload)
 }
 
@@ -196,9 +206,11 @@ func (c *Client) readMessageToQueue() {
 			c.closeChan <- err
 			return
 		}
+		atomic.AddUint64(&packetsReceived, 1)
 		payload := &dto.WSPayload{}
 		if err := json.Unmarshal(message, payload); err != nil {
 			log.Errorf("%s json failed, %v", c.session, err)
+			atomic.AddUint32(&packetsLost, 1)
 			continue
 		}
 		// 更新 global_s 的值
@@ -235,6 +247,10 @@ func (c *Client) listenMessageAndHandle() {
 			c.readyHandler(payload)
 			continue
 		}
+		// resume 成功后连接恢复在线，事件仍然投递给业务
+		if payload.Type == "RESUMED" {
+			c.markOnline()
+		}
 
 		// 性能不够 报错也没用 就扬了
 		go event.ParseAndHandle(payload)
@@ -259,7 +275,8 @@ func (c *Client) isHandleBuildIn(payload *dto.WSPayload) bool {
 	switch payload.OPCode {
 	case dto.WSHello: // 接收到 hello 后需要开始发心跳
 		c.startHeartBeatTicker(payload.RawMessage)
-	case dto.WSHeartbeatAck: // 心跳 ack 不需要业务处理
+	case dto.WSHeartbeatAck: // 心跳 ack 不需要业务处理 仅记录时间
+		atomic.StoreInt64(&lastHeartbeatAck, time.Now().Unix())
 	case dto.WSReconnect: // 达到连接时长，需要重新连接，此时可以通过 resume 续传原连接上的事件
 		c.closeChan <- errs.ErrNeedReConnect
 	case dto.WSInvalidSession: // 无效的 sessionLog，需要重新鉴权
@@ -278,6 +295,7 @@ func (c *Client) startHeartBeatTicker(message []byte) {
 	}
 	// 根据 hello 的回包，重新设置心跳的定时器时间
 	c.heartBeatTicker.Reset(time.Duration(helloData.HeartbeatInterval) * time.Millisecond)
+	atomic.StoreInt64(&heartbeatIntervalMs, int64(helloData.HeartbeatInterval))
 }
 
 // readyHandler 针对ready返回的处理，需要记录 sessionID 等相关信息
@@ -296,6 +314,7 @@ func (c *Client) readyHandler(payload *dto.WSPayload) {
 		Username: readyData.User.Username,
 		Bot:      readyData.User.Bot,
 	}
+	c.markOnline()
 	// 调用自定义的 ready 回调
 	if event.DefaultHandlers.Ready != nil {
 		event.DefaultHandlers.Ready(payload, readyData)
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 网关连接的运行状态计数，所有分片共用，供上层查询连接是否可用
+var (
+	sessionsOnline      int32  // 已完成 ready/resumed 的连接数
+	sessionsResuming    int32  // 正在 resume 的连接数
+	packetsReceived     uint64 // 从网关收到的包数
+	packetsSent         uint64 // 写入网关成功的包数
+	packetsLost         uint32 // 写入失败或无法解析的包数
+	disconnectTimes     uint32 // 网关连接断开次数
+	invalidSessionTimes uint32 // 会话失效需要重新鉴权的次数
+	lastHeartbeatAck    int64  // 最近一次收到心跳 ack 的时间(unix 秒)
+	heartbeatIntervalMs int64  // hello 下发的心跳间隔(毫秒)
+)
+
+// GatewayStatus 网关连接状态快照
+type GatewayStatus struct {
+	SessionsOnline      int
+	SessionsResuming    int
+	PacketsReceived     uint64
+	PacketsSent         uint64
+	PacketsLost         uint32
+	DisconnectTimes     uint32
+	InvalidSessionTimes uint32
+	LastHeartbeatAck    int64
+	HeartbeatInterval   time.Duration
+}
+
+// GetGatewayStatus 获取当前网关连接状态
+func GetGatewayStatus() GatewayStatus {
+	return GatewayStatus{
+		SessionsOnline:      int(atomic.LoadInt32(&sessionsOnline)),
+		SessionsResuming:    int(atomic.LoadInt32(&sessionsResuming)),
+		PacketsReceived:     atomic.LoadUint64(&packetsReceived),
+		PacketsSent:         atomic.LoadUint64(&packetsSent),
+		PacketsLost:         atomic.LoadUint32(&packetsLost),
+		DisconnectTimes:     atomic.LoadUint32(&disconnectTimes),
+		InvalidSessionTimes: atomic.LoadUint32(&invalidSessionTimes),
+		LastHeartbeatAck:    atomic.LoadInt64(&lastHeartbeatAck),
+		HeartbeatInterval:   time.Duration(atomic.LoadInt64(&heartbeatIntervalMs)) * time.Millisecond,
+	}
+}
+
+// HeartbeatHealthy 心跳 ack 是否在允许的时间窗口内，尚未收到过 ack 时视为正常
+func (s GatewayStatus) HeartbeatHealthy(now time.Time) bool {
+	if s.LastHeartbeatAck == 0 || s.HeartbeatInterval <= 0 {
+		return true
+	}
+	// 允许错过一次心跳
+	deadline := time.Unix(s.LastHeartbeatAck, 0).Add(2*s.HeartbeatInterval + 5*time.Second)
+	return now.Before(deadline)
+}
+
+// markOnline 连接收到 ready 或 resumed 后标记为在线
+func (c *Client) markOnline() {
+	if atomic.CompareAndSwapInt32(&c.online, 0, 1) {
+		atomic.AddInt32(&sessionsOnline, 1)
+	}
+	if atomic.CompareAndSwapInt32(&c.resuming, 1, 0) {
+		atomic.AddInt32(&sessionsResuming, -1)
+	}
+}
+
+// markOffline 连接断开，只统计一次
+func (c *Client) markOffline() {
+	if atomic.CompareAndSwapInt32(&c.online, 1, 0) {
+		atomic.AddInt32(&sessionsOnline, -1)
+	}
+	if atomic.CompareAndSwapInt32(&c.resuming, 1, 0) {
+		atomic.AddInt32(&sessionsResuming, -1)
+	}
+	atomic.AddUint32(&disconnectTimes, 1)
+}
+
+// markResuming 发送 resume 后到收到 resumed 之前处于续连状态
+func (c *Client) markResuming() {
+	if atomic.CompareAndSwapInt32(&c.resuming, 0, 1) {
+		atomic.AddInt32(&sessionsResuming, 1)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/hoshinonyaruko/gensokyo/backup"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
 	"go.etcd.io/bbolt"
 )
@@ -15,15 +16,17 @@ import (
 var db *bbolt.DB
 
 const (
+	DBName     = "botstats.db"
 	bucketName = "stats"
 )
 
 func InitializeDB() {
 	var err error
-	db, err = bbolt.Open("botstats.db", 0600, nil)
+	db, err = bbolt.Open(DBName, 0600, nil)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
+	backup.Register(DBName, db)
 
 	db.Update(func(tx *bbolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists([]byte(bucketName))
@@ -130,5 +133,6 @@ func getLastMessageTime(b *bbolt.Bucket) int64 {
 }
 
 func CloseDB() {
+	backup.Unregister(DBName)
 	db.Close()
 }
@@ -0,0 +1,135 @@
+package botstats
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/openapi"
+	"github.com/tencent-connect/botgo/websocket/client"
+)
+
+// 运行时计数 只保存在内存中 重启后归零
+var (
+	reverseWsOnline int32  // 已连接的反向ws应用端数量
+	forwardWsOnline int32  // 已连接的正向ws应用端数量
+	appDisconnects  uint32 // 应用端连接断开次数
+	openapiRequests uint64 // openapi 请求数
+	openapiFailures uint32 // openapi 请求失败数
+	webhookReceived uint64 // webhook 收到的事件数
+	webhookDropped  uint32 // webhook 队列已满被丢弃的事件数
+)
+
+// Status onebot get_status 与 heartbeat 元事件中的 status 字段
+type Status struct {
+	AppInitialized bool       `json:"app_initialized"`
+	AppEnabled     bool       `json:"app_enabled"`
+	PluginsGood    bool       `json:"plugins_good"`
+	AppGood        bool       `json:"app_good"`
+	Online         bool       `json:"online"`
+	Good           bool       `json:"good"`
+	Stat           Statistics `json:"stat"`
+}
+
+// Statistics 收发统计
+type Statistics struct {
+	PacketReceived  uint64 `json:"packet_received"`
+	PacketSent      uint64 `json:"packet_sent"`
+	PacketLost      uint32 `json:"packet_lost"`
+	MessageReceived int    `json:"message_received"`
+	MessageSent     int    `json:"message_sent"`
+	DisconnectTimes uint32 `json:"disconnect_times"`
+	LostTimes       uint32 `json:"lost_times"`
+	LastMessageTime int64  `json:"last_message_time"`
+}
+
+func init() {
+	openapi.RegisterReqFilter("botstats", func(req *http.Request, _ *http.Response) error {
+		atomic.AddUint64(&openapiRequests, 1)
+		return nil
+	})
+	openapi.RegisterErrorHook(func(req *http.Request, err error) {
+		atomic.AddUint32(&openapiFailures, 1)
+	})
+}
+
+// RecordReverseWsConnected 反向ws连接成功(含重连成功)
+func RecordReverseWsConnected() {
+	atomic.AddInt32(&reverseWsOnline, 1)
+}
+
+// RecordReverseWsDisconnected 反向ws连接断开
+func RecordReverseWsDisconnected() {
+	atomic.AddInt32(&reverseWsOnline, -1)
+	atomic.AddUint32(&appDisconnects, 1)
+}
+
+// RecordForwardWsConnected 正向ws应用端接入
+func RecordForwardWsConnected() {
+	atomic.AddInt32(&forwardWsOnline, 1)
+}
+
+// RecordForwardWsDisconnected 正向ws应用端断开
+func RecordForwardWsDisconnected() {
+	atomic.AddInt32(&forwardWsOnline, -1)
+	atomic.AddUint32(&appDisconnects, 1)
+}
+
+// RecordWebhookReceived webhook 收到事件
+func RecordWebhookReceived() {
+	atomic.AddUint64(&webhookReceived, 1)
+}
+
+// RecordWebhookDropped webhook 队列已满 事件被丢弃
+func RecordWebhookDropped() {
+	atomic.AddUint32(&webhookDropped, 1)
+}
+
+// AppConnections 当前可以投递事件的应用端连接数 (反向ws 正向ws)
+func AppConnections() int {
+	return int(atomic.LoadInt32(&reverseWsOnline) + atomic.LoadInt32(&forwardWsOnline))
+}
+
+// GetStatus 汇总网关与应用端状态
+// online 代表网关会话在线且心跳正常 good 代表事件可以从网关一路投递到应用端
+func GetStatus() Status {
+	gateway := client.GetGatewayStatus()
+	messageReceived, messageSent, lastMessageTime, err := GetStats()
+	if err != nil {
+		mylog.Printf("获取机器人发信状态错误:%v", err)
+	}
+
+	online := gateway.SessionsOnline > 0 && gateway.HeartbeatHealthy(time.Now())
+	appGood := AppConnections() > 0 || hasPostURL()
+
+	return Status{
+		AppInitialized: true,
+		AppEnabled:     true,
+		PluginsGood:    true,
+		AppGood:        appGood,
+		Online:         online,
+		Good:           online && appGood,
+		Stat: Statistics{
+			PacketReceived:  gateway.PacketsReceived + atomic.LoadUint64(&webhookReceived),
+			PacketSent:      gateway.PacketsSent + atomic.LoadUint64(&openapiRequests),
+			PacketLost:      gateway.PacketsLost + atomic.LoadUint32(&openapiFailures) + atomic.LoadUint32(&webhookDropped),
+			MessageReceived: messageReceived,
+			MessageSent:     messageSent,
+			DisconnectTimes: gateway.DisconnectTimes + atomic.LoadUint32(&appDisconnects),
+			LostTimes:       gateway.InvalidSessionTimes,
+			LastMessageTime: lastMessageTime,
+		},
+	}
+}
+
+// hasPostURL 是否配置了http上报地址
+func hasPostURL() bool {
+	for _, u := range config.GetPostUrl() {
+		if u != "" {
+			return true
+		}
+	}
+	return false
+}
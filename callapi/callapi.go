@@ -15,6 +15,8 @@ type ActionMessage struct {
 	Echo        interface{}   `json:"echo,omitempty"`
 	PostType    string        `json:"post_type,omitempty"`
 	MessageType string        `json:"message_type,omitempty"`
+	// 快速操作的回复 被动回复params中的message_id 不由应用端传入
+	QuickReply bool `json:"-"`
 }
 
 func (a *ActionMessage) UnmarshalJSON(data []byte) error {
@@ -78,29 +80,92 @@ type ParamsContent struct {
 	UserID    interface{} `json:"user_id,omitempty"`    // 这里使用interface{}因为它可能是多种类型
 	Duration  int         `json:"duration,omitempty"`   // 可选的整数
 	Enable    bool        `json:"enable,omitempty"`     // 可选的布尔值
+	Limit     int         `json:"limit,omitempty"`      // 可选的数量限制
+	// 处理加群/加好友请求
+	Flag    string `json:"flag,omitempty"`     // 请求的flag
+	SubType string `json:"sub_type,omitempty"` // 请求子类型 add invite
+	Approve *bool  `json:"approve,omitempty"`  // 是否同意 默认为true
+	Remark  string `json:"remark,omitempty"`   // 好友备注
+	Reason  string `json:"reason,omitempty"`   // 拒绝理由
 	// handle quick operation
 	Context   Context   `json:"context,omitempty"`   // context 字段
 	Operation Operation `json:"operation,omitempty"` // operation 字段
+	// 频道管理 id类参数可能是数字或字符串
+	RoleID           interface{}   `json:"role_id,omitempty"`            // 身份组id
+	Users            []interface{} `json:"users,omitempty"`              // 批量操作的用户
+	StartIndex       string        `json:"start_index,omitempty"`        // 分页查询的起始位置 即上次返回的next
+	Set              *bool         `json:"set,omitempty"`                // 设置或取消 默认为设置
+	Name             string        `json:"name,omitempty"`               // 身份组 子频道 日程名称
+	Color            uint32        `json:"color,omitempty"`              // 身份组颜色 ARGB
+	Hoist            *bool         `json:"hoist,omitempty"`              // 身份组是否在成员列表单独展示
+	Content          string        `json:"content,omitempty"`            // 公告内容
+	NoticeID         interface{}   `json:"notice_id,omitempty"`          // 公告id 即公告信息的message_id
+	ChannelType      int           `json:"channel_type,omitempty"`       // 子频道类型
+	ChannelSubType   int           `json:"channel_sub_type,omitempty"`   // 子频道子类型
+	ParentID         interface{}   `json:"parent_id,omitempty"`          // 子频道分组id
+	Position         int64         `json:"position,omitempty"`           // 子频道排序
+	PrivateType      int           `json:"private_type,omitempty"`       // 子频道可见性
+	SpeakPermission  int           `json:"speak_permission,omitempty"`   // 子频道发言权限
+	Add              string        `json:"add,omitempty"`                // 增加的子频道权限 位图字符串
+	Remove           string        `json:"remove,omitempty"`             // 移除的子频道权限 位图字符串
+	ScheduleID       interface{}   `json:"schedule_id,omitempty"`        // 日程id
+	Description      string        `json:"description,omitempty"`        // 日程描述
+	StartTime        int64         `json:"start_time,omitempty"`         // 日程开始时间 毫秒时间戳
+	EndTime          int64         `json:"end_time,omitempty"`           // 日程结束时间 毫秒时间戳
+	JumpChannelID    interface{}   `json:"jump_channel_id,omitempty"`    // 日程开始时跳转的子频道
+	RemindType       string        `json:"remind_type,omitempty"`        // 日程提醒类型 0-5
+	Since            uint64        `json:"since,omitempty"`              // 日程列表的起始时间 毫秒时间戳
+	EmojiID          interface{}   `json:"emoji_id,omitempty"`           // 表情id
+	EmojiType        int           `json:"emoji_type,omitempty"`         // 表情类型 1系统表情 2emoji 默认1
+	RejectAddRequest bool          `json:"reject_add_request,omitempty"` // 踢出频道时拉黑
+	// 论坛帖子
+	Title    string      `json:"title,omitempty"`     // 帖子标题 为空时使用bot_forum_title
+	ThreadID interface{} `json:"thread_id,omitempty"` // 帖子id
+	// 音频子频道
+	AudioURL string `json:"audio_url,omitempty"` // 播放的音频地址
+	Text     string `json:"text,omitempty"`      // 播放状态文本
+	// 按钮回调
+	InteractionID interface{} `json:"interaction_id,omitempty"` // 回调通知中的interaction_id
+	Code          *int        `json:"code,omitempty"`           // 回应按钮回调的结果 0成功 1失败 2频繁 3重复 4没有权限 5仅管理员
+	// 流式回复
+	StreamID string `json:"stream_id,omitempty"` // open_stream返回的流id
+	Seq      *int   `json:"seq,omitempty"`       // 分段序号 从0开始 乱序到达时按序号重排
+	// 语音
+	File      string `json:"file,omitempty"`       // record段中的file
+	OutFormat string `json:"out_format,omitempty"` // get_record的目标格式 wav或mp3
 }
 
-// Context 结构体用于存储 context 字段相关信息
+// Context 结构体用于存储 context 字段相关信息,即触发快速操作的事件本身
 type Context struct {
-	Avatar      string `json:"avatar,omitempty"`       // 用户头像链接
-	Font        int    `json:"font,omitempty"`         // 字体（假设是整数类型）
-	MessageID   int    `json:"message_id,omitempty"`   // 消息 ID
-	MessageSeq  int    `json:"message_seq,omitempty"`  // 消息序列号
-	MessageType string `json:"message_type,omitempty"` // 消息类型
-	PostType    string `json:"post_type,omitempty"`    // 帖子类型
-	SubType     string `json:"sub_type,omitempty"`     // 子类型
-	Time        int64  `json:"time,omitempty"`         // 时间戳
-	UserID      int    `json:"user_id,omitempty"`      // 用户 ID
-	GroupID     int    `json:"group_id,omitempty"`     // 群号
+	Avatar          string      `json:"avatar,omitempty"`            // 用户头像链接
+	Font            int         `json:"font,omitempty"`              // 字体（假设是整数类型）
+	MessageID       interface{} `json:"message_id,omitempty"`        // 消息 ID 频道原生事件为字符串
+	MessageSeq      int         `json:"message_seq,omitempty"`       // 消息序列号
+	MessageType     string      `json:"message_type,omitempty"`      // 消息类型
+	RealMessageType string      `json:"real_message_type,omitempty"` // 消息的真实类型 group group_private guild guild_private
+	PostType        string      `json:"post_type,omitempty"`         // 上报类型
+	SubType         string      `json:"sub_type,omitempty"`          // 子类型
+	RequestType     string      `json:"request_type,omitempty"`      // 请求类型 friend group
+	Flag            string      `json:"flag,omitempty"`              // 请求的flag
+	Time            int64       `json:"time,omitempty"`              // 时间戳
+	UserID          interface{} `json:"user_id,omitempty"`           // 用户 ID 可能是数字或字符串
+	GroupID         interface{} `json:"group_id,omitempty"`          // 群号 可能是数字或字符串
+	GuildID         interface{} `json:"guild_id,omitempty"`          // 频道 ID
+	ChannelID       interface{} `json:"channel_id,omitempty"`        // 子频道 ID
 }
 
 // Operation 结构体用于存储 operation 字段相关信息
 type Operation struct {
-	Reply    string `json:"reply,omitempty"`     // 回复内容
-	AtSender bool   `json:"at_sender,omitempty"` // 是否 @ 发送者
+	Reply       interface{} `json:"reply,omitempty"`        // 回复内容 字符串或消息段数组
+	AtSender    *bool       `json:"at_sender,omitempty"`    // 是否 @ 发送者 群聊中默认为true
+	AutoEscape  bool        `json:"auto_escape,omitempty"`  // 回复内容作为纯文本发送,不解析CQ码
+	Delete      bool        `json:"delete,omitempty"`       // 撤回该条消息
+	Kick        bool        `json:"kick,omitempty"`         // 把发送者踢出
+	Ban         bool        `json:"ban,omitempty"`          // 禁言发送者
+	BanDuration int         `json:"ban_duration,omitempty"` // 禁言时长(秒) 默认30分钟
+	Approve     *bool       `json:"approve,omitempty"`      // 是否同意请求
+	Remark      string      `json:"remark,omitempty"`       // 好友备注
+	Reason      string      `json:"reason,omitempty"`       // 拒绝理由
 }
 
 // 自定义一个ParamsContent的UnmarshalJSON 让GroupID同时兼容str和int
@@ -206,6 +271,12 @@ func RegisterHandler(action string, handler HandlerFunc) {
 	handlers[action] = handler
 }
 
+// GetHandler 获取已注册的handler,供快速操作等内部调用
+func GetHandler(action string) (HandlerFunc, bool) {
+	handler, ok := handlers[action]
+	return handler, ok
+}
+
 // CallAPIFromDict 处理信息 by calling the 对应的 handler.
 func CallAPIFromDict(client Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message ActionMessage) string {
 	handler, ok := handlers[message.Action]
@@ -0,0 +1,75 @@
+package callapi
+
+import (
+	"sync"
+	"time"
+)
+
+// 回调按钮的路由保留时间,过期后回调重新广播给所有应用端
+const buttonRouteTTL = 24 * time.Hour
+
+// 超过这个数量时清理过期的路由
+const buttonRouteSweep = 4096
+
+type buttonRoute struct {
+	client    Client
+	ambiguous bool // 同一个目标中有多个应用端发出相同data的按钮
+	expires   time.Time
+}
+
+var (
+	buttonRoutes   = make(map[string]*buttonRoute)
+	buttonRoutesMu sync.Mutex
+)
+
+// buttonRouteKey 路由按发出按钮的目标(真实的群、频道或用户id)和按钮data区分
+func buttonRouteKey(target, data string) string {
+	return target + "\x00" + data
+}
+
+// RegisterButtonRoute 记录在target中发出回调按钮的应用端,按钮被点击时回调只发给它
+// 同一个target中多个应用端发出相同data的按钮时无法区分,路由过期前回调都广播
+func RegisterButtonRoute(target, data string, client Client) {
+	if target == "" || data == "" || client == nil {
+		return
+	}
+	buttonRoutesMu.Lock()
+	defer buttonRoutesMu.Unlock()
+	now := time.Now()
+	if len(buttonRoutes) >= buttonRouteSweep {
+		for key, route := range buttonRoutes {
+			if now.After(route.expires) {
+				delete(buttonRoutes, key)
+			}
+		}
+	}
+	key := buttonRouteKey(target, data)
+	route, ok := buttonRoutes[key]
+	if !ok || now.After(route.expires) {
+		buttonRoutes[key] = &buttonRoute{client: client, expires: now.Add(buttonRouteTTL)}
+		return
+	}
+	if route.client != client {
+		route.ambiguous = true
+	}
+	route.expires = now.Add(buttonRouteTTL)
+}
+
+// ButtonRoute 查找target中按钮data对应的应用端 没有记录或有多个应用端时返回false
+func ButtonRoute(target, data string) (Client, bool) {
+	buttonRoutesMu.Lock()
+	defer buttonRoutesMu.Unlock()
+	key := buttonRouteKey(target, data)
+	route, ok := buttonRoutes[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(route.expires) {
+		delete(buttonRoutes, key)
+		return nil, false
+	}
+	if route.ambiguous {
+		return nil, false
+	}
+	return route.client, true
+}
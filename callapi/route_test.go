@@ -0,0 +1,34 @@
+package callapi
+
+import "testing"
+
+type testClient struct{ name string }
+
+func (c *testClient) SendMessage(message map[string]interface{}) error { return nil }
+
+func TestButtonRoute(t *testing.T) {
+	a, b := &testClient{"a"}, &testClient{"b"}
+	RegisterButtonRoute("group1", "confirm", a)
+	RegisterButtonRoute("group2", "confirm", b)
+
+	// 不同目标中相同data的按钮互不影响
+	if c, ok := ButtonRoute("group1", "confirm"); !ok || c != a {
+		t.Errorf("group1 routed to %v", c)
+	}
+	if c, ok := ButtonRoute("group2", "confirm"); !ok || c != b {
+		t.Errorf("group2 routed to %v", c)
+	}
+	if _, ok := ButtonRoute("group3", "confirm"); ok {
+		t.Error("unknown target should broadcast")
+	}
+
+	// 同一个目标中两个应用端发出相同data时广播
+	RegisterButtonRoute("group1", "confirm", a)
+	if _, ok := ButtonRoute("group1", "confirm"); !ok {
+		t.Error("the same client sending again should keep the route")
+	}
+	RegisterButtonRoute("group1", "confirm", b)
+	if _, ok := ButtonRoute("group1", "confirm"); ok {
+		t.Error("ambiguous route should broadcast")
+	}
+}
@@ -954,6 +954,23 @@ func ComposeWebUIURLv2(useBackupPort bool) string {
 	return fmt.Sprintf("%s://%s:%s/webui", protocol, ip, port)
 }
 
+// ComposeChannelTempURL 组合本地媒体目录channel_temp中文件的访问地址
+func ComposeChannelTempURL(fileName string) string {
+	serverDir := GetServer_dir()
+
+	port := GetPortValue()
+	if frpPort := GetFrpPort(); frpPort != "0" {
+		port = frpPort
+	}
+
+	protocol := "http"
+	if port == "443" || GetForceSsl() {
+		protocol = "https"
+	}
+
+	return fmt.Sprintf("%s://%s:%s/channel_temp/%s", protocol, serverDir, port, fileName)
+}
+
 // GetServerUserName 获取服务器用户名
 func GetServerUserName() string {
 	mu.RLock()
@@ -1138,6 +1155,19 @@ func GetRecordBitRate() int {
 	return instance.Settings.RecordBitRate
 }
 
+// GetRecordNativeSilk 是否使用纯go转码语音
+func GetRecordNativeSilk() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get RecordNativeSilk value.")
+		return false
+	}
+
+	return instance.Settings.RecordNativeSilk
+}
+
 // 获取NoWhiteResponse的值
 func GetNoWhiteResponse() string {
 	mu.RLock()
@@ -2494,3 +2524,705 @@ func GetHttpPortAfterSsl() string {
 
 	return instance.Settings.HttpPortAfterSSL
 }
+
+// 获取RecordDecode的值
+func GetRecordDecode() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get RecordDecode.")
+		return false
+	}
+	return instance.Settings.RecordDecode
+}
+
+// 获取RecordDecodeType的值
+func GetRecordDecodeType() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get RecordDecodeType.")
+		return "wav"
+	}
+	return instance.Settings.RecordDecodeType
+}
+
+// 获取S3兼容存储的endpoint
+func GetS3Endpoint() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get S3Endpoint.")
+		return ""
+	}
+	return instance.Settings.S3Endpoint
+}
+
+// 获取S3兼容存储的地域
+func GetS3Region() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get S3Region.")
+		return ""
+	}
+	return instance.Settings.S3Region
+}
+
+// 获取S3兼容存储的桶名称
+func GetS3Bucket() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get S3Bucket.")
+		return ""
+	}
+	return instance.Settings.S3Bucket
+}
+
+// 获取S3兼容存储的AccessKey
+func GetS3AccessKey() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get S3AccessKey.")
+		return ""
+	}
+	return instance.Settings.S3AccessKey
+}
+
+// 获取S3兼容存储的SecretKey
+func GetS3SecretKey() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get S3SecretKey.")
+		return ""
+	}
+	return instance.Settings.S3SecretKey
+}
+
+// 获取S3兼容存储是否使用路径风格访问
+func GetS3PathStyle() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get S3PathStyle.")
+		return false
+	}
+	return instance.Settings.S3PathStyle
+}
+
+// 获取S3兼容存储对外访问的地址前缀
+func GetS3PublicURL() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get S3PublicURL.")
+		return ""
+	}
+	return instance.Settings.S3PublicURL
+}
+
+// 获取独立于存储的审核方式
+func GetOssAudit() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get OssAudit.")
+		return ""
+	}
+	return instance.Settings.OssAudit
+}
+
+// 获取是否启用发送前审核
+func GetModerationEnable() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get ModerationEnable.")
+		return false
+	}
+	return instance.Settings.ModerationEnable
+}
+
+// 获取发送前审核的审核方列表
+func GetModerationProviders() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get ModerationProviders.")
+		return nil
+	}
+	return instance.Settings.ModerationProviders
+}
+
+// 获取发送前审核的本地规则
+func GetModerationRules() []structs.ModerationRule {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get ModerationRules.")
+		return nil
+	}
+	return instance.Settings.ModerationRules
+}
+
+// 获取回调审核地址
+func GetModerationWebhook() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get ModerationWebhook.")
+		return ""
+	}
+	return instance.Settings.ModerationWebhook
+}
+
+// 获取回调审核的token
+func GetModerationWebhookToken() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get ModerationWebhookToken.")
+		return ""
+	}
+	return instance.Settings.ModerationWebhookToken
+}
+
+// 获取审核方出错时的处理方式
+func GetModerationFailAction() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get ModerationFailAction.")
+		return ""
+	}
+	return instance.Settings.ModerationFailAction
+}
+
+// 获取云审核图片不合规时的处理方式
+func GetModerationImageAction() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get ModerationImageAction.")
+		return ""
+	}
+	return instance.Settings.ModerationImageAction
+}
+
+// 获取文本审核的默认替换文本
+func GetModerationReplaceText() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get ModerationReplaceText.")
+		return ""
+	}
+	return instance.Settings.ModerationReplaceText
+}
+
+// 获取图片审核的替换图片url
+func GetModerationReplaceImage() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get ModerationReplaceImage.")
+		return ""
+	}
+	return instance.Settings.ModerationReplaceImage
+}
+
+// 获取审核日志文件名
+func GetModerationLog() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get ModerationLog.")
+		return ""
+	}
+	return instance.Settings.ModerationLog
+}
+
+// 获取是否记录审核通过的决定
+func GetModerationLogPass() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get ModerationLogPass.")
+		return false
+	}
+	return instance.Settings.ModerationLogPass
+}
+
+// 获取回调审核超时时间 单位毫秒
+func GetModerationWebhookTimeout() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get ModerationWebhookTimeout.")
+		return 3000
+	}
+	if instance.Settings.ModerationWebhookTimeout <= 0 {
+		return 3000
+	}
+	return instance.Settings.ModerationWebhookTimeout
+}
+
+// 获取从gsk使用的凭据id
+func GetLotusID() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get LotusID.")
+		return ""
+	}
+	return instance.Settings.LotusID
+}
+
+// 获取从gsk使用的凭据密钥
+func GetLotusSecret() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get LotusSecret.")
+		return ""
+	}
+	return instance.Settings.LotusSecret
+}
+
+// 获取lotus是否使用双向TLS
+func GetLotusMtls() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get LotusMtls.")
+		return false
+	}
+	return instance.Settings.LotusMtls
+}
+
+// 获取lotus grpc是否使用TLS
+func GetLotusGrpcTls() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get LotusGrpcTls.")
+		return false
+	}
+	return instance.Settings.LotusGrpcTls
+}
+
+// 获取lotus使用的CA证书路径
+func GetLotusTlsCa() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get LotusTlsCa.")
+		return ""
+	}
+	return instance.Settings.LotusTlsCa
+}
+
+// 获取lotus使用的证书路径
+func GetLotusTlsCert() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get LotusTlsCert.")
+		return ""
+	}
+	return instance.Settings.LotusTlsCert
+}
+
+// 获取lotus使用的证书密钥路径
+func GetLotusTlsKey() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get LotusTlsKey.")
+		return ""
+	}
+	return instance.Settings.LotusTlsKey
+}
+
+// 获取GroupAddRequestManual的值
+func GetGroupAddRequestManual() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get GroupAddRequestManual.")
+		return false
+	}
+	return instance.Settings.GroupAddRequestManual
+}
+
+// 获取RolePrefix的值
+func GetRolePrefix() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get RolePrefix.")
+		return "/role"
+	}
+	return instance.Settings.RolePrefix
+}
+
+// 获取DisabledCommands的值
+func GetDisabledCommands() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get DisabledCommands.")
+		return nil
+	}
+	return instance.Settings.DisabledCommands
+}
+
+// 获取数据库备份间隔(分钟)
+func GetDBBackupInterval() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get DBBackupInterval.")
+		return 0
+	}
+	return instance.Settings.DBBackupInterval
+}
+
+// 获取数据库备份目录
+func GetDBBackupDir() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get DBBackupDir.")
+		return "backups"
+	}
+	return instance.Settings.DBBackupDir
+}
+
+// 获取数据库备份保留数量
+func GetDBBackupKeep() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get DBBackupKeep.")
+		return 7
+	}
+	return instance.Settings.DBBackupKeep
+}
+
+// 获取具名md模板
+func GetMarkdownTemplates() []structs.MarkdownTemplate {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get MarkdownTemplates.")
+		return nil
+	}
+	return instance.Settings.MarkdownTemplates
+}
+
+// 获取是否在发送前校验md
+func GetMarkdownValidate() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get MarkdownValidate.")
+		return false
+	}
+	return instance.Settings.MarkdownValidate
+}
+
+// 获取md链接域名白名单
+func GetMarkdownLinkWhitelist() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get MarkdownLinkWhitelist.")
+		return nil
+	}
+	return instance.Settings.MarkdownLinkWhitelist
+}
+
+// 获取是否将按钮回调只上报给发出按钮的应用端
+func GetInteractionRoute() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get InteractionRoute.")
+		return false
+	}
+	return instance.Settings.InteractionRoute
+}
+
+// 获取流式回复合并推送的间隔 毫秒
+func GetStreamInterval() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get StreamInterval.")
+		return 500
+	}
+	if instance.Settings.StreamInterval <= 0 {
+		return 500
+	}
+	return instance.Settings.StreamInterval
+}
+
+// 获取流式回复的空闲超时 秒
+func GetStreamTimeout() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get StreamTimeout.")
+		return 60
+	}
+	if instance.Settings.StreamTimeout <= 0 {
+		return 60
+	}
+	return instance.Settings.StreamTimeout
+}
+
+// 获取分段发送每段的最大字数 0为不分段
+func GetSplitLength() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get SplitLength.")
+		return 0
+	}
+	return instance.Settings.SplitLength
+}
+
+// 获取一条信息最多分成的段数
+func GetSplitMaxParts() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get SplitMaxParts.")
+		return 5
+	}
+	if instance.Settings.SplitMaxParts <= 0 {
+		return 5
+	}
+	return instance.Settings.SplitMaxParts
+}
+
+// 获取超过最大段数时的处理方式
+func GetSplitOverflow() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get SplitOverflow.")
+		return ""
+	}
+	return instance.Settings.SplitOverflow
+}
+
+// 获取文字转图片使用的中文字体路径
+func GetText2imgFont() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get Text2imgFont.")
+		return ""
+	}
+	return instance.Settings.Text2imgFont
+}
+
+// 获取文字转图片的中文字体下载地址
+func GetText2imgFontURL() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get Text2imgFontURL.")
+		return ""
+	}
+	return instance.Settings.Text2imgFontURL
+}
+
+// 获取文字转图片的图片宽度
+func GetText2imgWidth() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get Text2imgWidth.")
+		return 800
+	}
+	if instance.Settings.Text2imgWidth <= 0 {
+		return 800
+	}
+	return instance.Settings.Text2imgWidth
+}
+
+// 获取文字转图片的正文字号
+func GetText2imgFontSize() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get Text2imgFontSize.")
+		return 24
+	}
+	if instance.Settings.Text2imgFontSize <= 0 {
+		return 24
+	}
+	return instance.Settings.Text2imgFontSize
+}
+
+// 获取自动转为图片的文本字数 0为不转换
+func GetText2imgLength() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get Text2imgLength.")
+		return 0
+	}
+	return instance.Settings.Text2imgLength
+}
+
+// 获取含有链接时是否自动转为图片
+func GetText2imgURL() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get Text2imgURL.")
+		return false
+	}
+	return instance.Settings.Text2imgURL
+}
+
+// 获取help指令的触发词 为空时关闭
+func GetHelpPrefix() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get HelpPrefix.")
+		return ""
+	}
+	return instance.Settings.HelpPrefix
+}
+
+// 获取ping指令的触发词 为空时关闭
+func GetPingPrefix() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get PingPrefix.")
+		return ""
+	}
+	return instance.Settings.PingPrefix
+}
+
+// 获取status指令的触发词 为空时关闭
+func GetStatusPrefix() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get StatusPrefix.")
+		return ""
+	}
+	return instance.Settings.StatusPrefix
+}
+
+// 获取whois指令的触发词 为空时关闭
+func GetWhoisPrefix() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get WhoisPrefix.")
+		return ""
+	}
+	return instance.Settings.WhoisPrefix
+}
+
+// 获取框架指令处理后是否不再上报应用端
+func GetInterceptCommands() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get InterceptCommands.")
+		return false
+	}
+	return instance.Settings.InterceptCommands
+}
+
+// 获取是否兼容旧版lotus md5 token
+func GetLotusLegacyToken() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get LotusLegacyToken.")
+		return false
+	}
+	return instance.Settings.LotusLegacyToken
+}
+
+// 获取是否按onebot规范上报群通知的sub_type与user_id
+func GetGroupNoticeStandard() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to get GroupNoticeStandard.")
+		return false
+	}
+	return instance.Settings.GroupNoticeStandard
+}
@@ -66,6 +66,31 @@ const routes: RouteRecordRaw[] = [
         component: () => import('pages/AccountDeviceEditorView.vue'),
         props: transform({ uin: Number }),
       },
+      {
+        path: '/accounts/:uin(\\d+)/lotus',
+        component: () => import('pages/LotusView.vue'),
+        props: transform({ uin: Number }),
+      },
+      {
+        path: '/accounts/:uin(\\d+)/roles',
+        component: () => import('pages/RolesView.vue'),
+        props: transform({ uin: Number }),
+      },
+      {
+        path: '/accounts/:uin(\\d+)/idmap',
+        component: () => import('pages/IdmapView.vue'),
+        props: transform({ uin: Number }),
+      },
+      {
+        path: '/accounts/:uin(\\d+)/backup',
+        component: () => import('pages/BackupView.vue'),
+        props: transform({ uin: Number }),
+      },
+      {
+        path: '/accounts/:uin(\\d+)/markdown',
+        component: () => import('pages/MarkdownView.vue'),
+        props: transform({ uin: Number }),
+      },
     ],
   },
 
@@ -140,7 +140,6 @@ func EncodePcmBuffToSilk(src []byte, sampleRate, bitRate int, tencent bool) (dst
 		return nil, fmt.Errorf("SKP_Silk_reset_encoder returned %d", ret)
 	}
 	var frameSize = sampleRate / 1000 * 40
-	fmt.Printf("包长:%v", frameSize)
 	var (
 		nBytes  = int16(250 * 5)
 		in      = make([]byte, frameSize)
@@ -187,7 +186,6 @@ func EncodePcmBuffToSilk(src []byte, sampleRate, bitRate int, tencent bool) (dst
 	// }
 
 	dst = out.Bytes()
-	fmt.Printf("dst 长度: %d\n", len(dst))
 
 	return
 }
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+)
+
+// newRandomID 随机的十六进制id
+func newRandomID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// captureClient 接收发送handler的回执,不转发给应用端
+// 回执可能在另一个goroutine中发出(threads_ret_msg),handler返回后用wait读取
+type captureClient struct {
+	mu       sync.Mutex
+	response map[string]interface{}
+	pending  bool // 回执将在另一个goroutine中发出
+	done     chan struct{}
+}
+
+// 等待回执的最长时间 发送已经完成,只等待回执的生成
+const captureTimeout = 10 * time.Second
+
+var (
+	errNoReceipt      = errors.New("send handler returned without sending the message")
+	errReceiptTimeout = errors.New("timed out waiting for the send receipt")
+)
+
+// receiptExpecter 需要知道回执是否在另一个goroutine中发出的client
+type receiptExpecter interface {
+	expectReceipt()
+}
+
+// expectAsyncReceipt 在go SendResponse之前调用 捕获回执的client据此等待,而不是把没有回执视为失败
+func expectAsyncReceipt(client callapi.Client) {
+	if c, ok := client.(receiptExpecter); ok {
+		c.expectReceipt()
+	}
+}
+
+func (c *captureClient) expectReceipt() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = true
+}
+
+func (c *captureClient) SendMessage(message map[string]interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.response == nil {
+		close(c.doneLocked())
+	}
+	c.response = message
+	return nil
+}
+
+func (c *captureClient) doneLocked() chan struct{} {
+	if c.done == nil {
+		c.done = make(chan struct{})
+	}
+	return c.done
+}
+
+func (c *captureClient) last() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.response
+}
+
+// wait 在handler返回后读取第一个回执
+// 开启no_ret_msg时不会有回执,返回nil;回执在协程中生成时最多等待captureTimeout
+// 其余情况没有回执说明handler在发送前就返回了,视为失败
+func (c *captureClient) wait() (map[string]interface{}, error) {
+	c.mu.Lock()
+	response, pending := c.response, c.pending
+	done := c.doneLocked()
+	c.mu.Unlock()
+	if response != nil || config.GetNoRetMsg() {
+		return response, nil
+	}
+	if !pending {
+		return nil, errNoReceipt
+	}
+	select {
+	case <-done:
+		return c.last(), nil
+	case <-time.After(captureTimeout):
+		mylog.Printf("等待发送回执超时")
+		return nil, errReceiptTimeout
+	}
+}
+
+// err 回执中的失败 没有回执时按wait的规则判断
+func (c *captureClient) err() error {
+	response, err := c.wait()
+	if err != nil {
+		return err
+	}
+	if status, _ := response["status"].(string); status == "failed" {
+		return fmt.Errorf("%v", response["message"])
+	}
+	return nil
+}
+
+// result 回执中的message_id 回执失败时返回错误
+func (c *captureClient) result() (int64, error) {
+	response, err := c.wait()
+	if err != nil {
+		return 0, err
+	}
+	if response == nil {
+		// 开启no_ret_msg时没有回执,消息已经发出,只是不知道message_id
+		return 0, nil
+	}
+	if status, _ := response["status"].(string); status == "failed" {
+		return 0, fmt.Errorf("send_msg failed: %v", response["message"])
+	}
+	data, _ := response["data"].(map[string]interface{})
+	switch id := data["message_id"].(type) {
+	case float64:
+		return int64(id), nil
+	case string:
+		var n int64
+		fmt.Sscan(id, &n)
+		return n, nil
+	}
+	return 0, nil
+}
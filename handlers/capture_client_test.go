@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCaptureClientWithoutReceipt(t *testing.T) {
+	// handler在发送前返回 不需要等待回执
+	start := time.Now()
+	if err := (&captureClient{}).err(); err != errNoReceipt {
+		t.Errorf("err = %v, want errNoReceipt", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("waited for a receipt that was never coming")
+	}
+}
+
+func TestCaptureClientAsyncReceipt(t *testing.T) {
+	c := &captureClient{}
+	expectAsyncReceipt(c)
+	go c.SendMessage(map[string]interface{}{"status": "failed", "message": "boom"})
+	if err := c.err(); err == nil || err.Error() != "boom" {
+		t.Errorf("err = %v, want boom", err)
+	}
+}
@@ -3,11 +3,10 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/hoshinonyaruko/gensokyo/callapi"
-	"github.com/hoshinonyaruko/gensokyo/config"
-	"github.com/hoshinonyaruko/gensokyo/echo"
 	"github.com/hoshinonyaruko/gensokyo/idmap"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
 	"github.com/tencent-connect/botgo/openapi"
@@ -17,105 +16,112 @@ func init() {
 	callapi.RegisterHandler("delete_msg", DeleteMsg)
 }
 
+// 群聊和单聊中只能撤回机器人自己发出的信息
+var errRetractUserMessage = errors.New("only messages sent by the bot can be recalled in groups and c2c")
+
 func DeleteMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
-	var RealMsgID string
 	var err error
+	//还原msgid
+	rowID, _ := message.Params.MessageID.(string)
+	RealMsgID := resolveMessageID(rowID)
+
+	if RealMsgID == "" {
+		err = fmt.Errorf("message_id %v not found", message.Params.MessageID)
+	} else if scope, ok := idmap.RetrieveMessageScope(RealMsgID); ok {
+		// 根据缓存时记录的来源撤回,只需要message_id
+		err = retractMessage(api, RealMsgID, scope)
+	} else {
+		// 没有记录来源的信息,按应用端传入的id撤回
+		err = retractMessageByParams(api, RealMsgID, message.Params)
+	}
 
-	// 如果从内存取
-	if config.GetMemoryMsgid() {
-		//还原msgid
-		RealMsgID, _ = echo.GetCacheIDFromMemoryByRowID(message.Params.MessageID.(string))
+	var response GetStatusResponse
+	response.Echo = message.Echo
+	if err != nil {
+		mylog.Printf("撤回信息失败: %v", err)
+		response.Message = err.Error()
+		response.RetCode = 100
+		response.Status = "failed"
 	} else {
-		//还原msgid
-		RealMsgID, err = idmap.RetrieveRowByCachev2(message.Params.MessageID.(string))
-		if err != nil {
-			mylog.Printf("error retrieving real RChannelID: %v", err)
+		response.Message = ""
+		response.RetCode = 0
+		response.Status = "ok"
+	}
+
+	outputMap := structToMap(response)
+
+	mylog.Printf("delete_msg: %+v\n", outputMap)
+
+	err = client.SendMessage(outputMap)
+	if err != nil {
+		mylog.Printf("Error sending message via client: %v", err)
+	}
+	//把结果从struct转换为json
+	result, err := json.Marshal(response)
+	if err != nil {
+		mylog.Printf("Error marshaling data: %v", err)
+		//todo 符合onebotv11 ws返回的错误码
+		return "", nil
+	}
+	return string(result), nil
+}
+
+// retractMessage 按信息来源选择撤回接口
+func retractMessage(api openapi.OpenAPI, msgID string, scope idmap.MessageScope) error {
+	switch scope.Type {
+	case idmap.ScopeGroup:
+		if !scope.BotSent {
+			return errRetractUserMessage
 		}
+		return api.RetractGroupMessage(context.TODO(), scope.TargetID, msgID, openapi.RetractMessageOptionHidetip)
+	case idmap.ScopeGroupPrivate:
+		if !scope.BotSent {
+			return errRetractUserMessage
+		}
+		return api.RetractC2CMessage(context.TODO(), scope.TargetID, msgID, openapi.RetractMessageOptionHidetip)
+	case idmap.ScopeGuild:
+		return api.RetractMessage(context.TODO(), scope.TargetID, msgID, openapi.RetractMessageOptionHidetip)
+	case idmap.ScopeGuildPrivate:
+		return api.RetractDMMessage(context.TODO(), scope.TargetID, msgID, openapi.RetractMessageOptionHidetip)
 	}
+	return fmt.Errorf("unknown message scope: %s", scope.Type)
+}
 
-	//重新赋值
-	message.Params.MessageID = RealMsgID
+// retractMessageByParams 兼容旧的调用方式 由应用端传入group_id channel_id guild_id或user_id
+func retractMessageByParams(api openapi.OpenAPI, msgID string, params callapi.ParamsContent) error {
 	//撤回频道信息
-	if message.Params.ChannelID != nil && message.Params.ChannelID != "" {
-		var RChannelID string
-		var err error
+	if channelID, ok := params.ChannelID.(string); ok && channelID != "" {
 		// 使用RetrieveRowByIDv2还原真实的ChannelID
-		RChannelID, err = idmap.RetrieveRowByIDv2(message.Params.ChannelID.(string))
-		if err != nil {
-			mylog.Printf("error retrieving real RChannelID: %v", err)
-		}
-		message.Params.ChannelID = RChannelID
-		err = api.RetractMessage(context.TODO(), message.Params.ChannelID.(string), message.Params.MessageID.(string), openapi.RetractMessageOptionHidetip)
+		RChannelID, err := idmap.RetrieveRowByIDv2(channelID)
 		if err != nil {
-			fmt.Println("Error retracting channel message:", err)
+			return fmt.Errorf("error retrieving real ChannelID: %v", err)
 		}
-
+		return api.RetractMessage(context.TODO(), RChannelID, msgID, openapi.RetractMessageOptionHidetip)
 	}
 
 	//撤回频道私信
-	if message.Params.GuildID != nil && message.Params.GuildID != "" {
-		//这里很复杂 要取的话需要调用internal-api 根据情况还原，虚拟成群就用群（channel-id）还原完整channel-id，
-		//然后internal-api读配置获取guild-id ，虚拟成私信就用userid还原完整userid，然后读channel-id然后读guild-id
-		//因为GuildID本身不直接出现在ob11事件里。
-		err := api.RetractDMMessage(context.TODO(), message.Params.GuildID.(string), message.Params.MessageID.(string), openapi.RetractMessageOptionHidetip)
-		if err != nil {
-			fmt.Println("Error retracting DM message:", err)
-		}
-
+	if guildID, ok := params.GuildID.(string); ok && guildID != "" {
+		return api.RetractDMMessage(context.TODO(), guildID, msgID, openapi.RetractMessageOptionHidetip)
 	}
 
 	//撤回群信息
-	if message.Params.GroupID != nil && message.Params.GroupID != "" {
-		var originalGroupID string
-		originalGroupID, err := idmap.RetrieveRowByIDv2(message.Params.GroupID.(string))
-		if err != nil {
-			mylog.Printf("Error retrieving original GroupID: %v", err)
-		}
-		message.Params.GroupID = originalGroupID
-		err = api.RetractGroupMessage(context.TODO(), message.Params.GroupID.(string), message.Params.MessageID.(string), openapi.RetractMessageOptionHidetip)
+	if groupID, ok := params.GroupID.(string); ok && groupID != "" {
+		originalGroupID, err := idmap.RetrieveRowByIDv2(groupID)
 		if err != nil {
-			fmt.Println("Error retracting group message:", err)
+			return fmt.Errorf("error retrieving original GroupID: %v", err)
 		}
-
+		return api.RetractGroupMessage(context.TODO(), originalGroupID, msgID, openapi.RetractMessageOptionHidetip)
 	}
 
 	//撤回C2C私信消息列表
-	if message.Params.UserID != nil && message.Params.UserID != "" {
-		var UserID string
+	if userID, ok := params.UserID.(string); ok && userID != "" {
 		//还原真实的userid
-		UserID, err := idmap.RetrieveRowByIDv2(message.Params.UserID.(string))
+		UserID, err := idmap.RetrieveRowByIDv2(userID)
 		if err != nil {
-			mylog.Printf("Error reading config: %v", err)
-			return "", nil
+			return fmt.Errorf("error retrieving real UserID: %v", err)
 		}
-		message.Params.UserID = UserID
-		err = api.RetractC2CMessage(context.TODO(), message.Params.UserID.(string), message.Params.MessageID.(string), openapi.RetractMessageOptionHidetip)
-		if err != nil {
-			fmt.Println("Error retracting C2C message:", err)
-		}
-
+		return api.RetractC2CMessage(context.TODO(), UserID, msgID, openapi.RetractMessageOptionHidetip)
 	}
 
-	var response GetStatusResponse
-	response.Message = ""
-	response.RetCode = 0
-	response.Status = "ok"
-	response.Echo = message.Echo
-
-	outputMap := structToMap(response)
-
-	mylog.Printf("delete_msg: %+v\n", outputMap)
-
-	err = client.SendMessage(outputMap)
-	if err != nil {
-		mylog.Printf("Error sending message via client: %v", err)
-	}
-	//把结果从struct转换为json
-	result, err := json.Marshal(response)
-	if err != nil {
-		mylog.Printf("Error marshaling data: %v", err)
-		//todo 符合onebotv11 ws返回的错误码
-		return "", nil
-	}
-	return string(result), nil
+	return fmt.Errorf("unknown source of message %s, pass group_id, user_id, channel_id or guild_id", msgID)
 }
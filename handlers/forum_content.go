@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// ParseForumContent 将帖子、评论、回复的富文本内容转换为消息段和raw_message
+// 段落之间以换行分隔,链接转为文本,图片与视频转为image与video消息段
+func ParseForumContent(content string) ([]map[string]interface{}, string, error) {
+	paragraphs, err := dto.UnmarshalForumContent(content)
+	if err != nil {
+		return nil, "", err
+	}
+	var segments []map[string]interface{}
+	var raw strings.Builder
+	// 连续的文本合并为一个text段
+	var text strings.Builder
+	flushText := func() {
+		if text.Len() == 0 {
+			return
+		}
+		segments = append(segments, map[string]interface{}{
+			"type": "text",
+			"data": map[string]interface{}{"text": text.String()},
+		})
+		text.Reset()
+	}
+	writeText := func(s string) {
+		text.WriteString(s)
+		raw.WriteString(s)
+	}
+	writeMedia := func(segType, url string) {
+		if url == "" {
+			return
+		}
+		flushText()
+		segments = append(segments, map[string]interface{}{
+			"type": segType,
+			"data": map[string]interface{}{"file": url, "url": url},
+		})
+		raw.WriteString("[CQ:" + segType + ",file=" + url + "]")
+	}
+
+	for i, elements := range paragraphs {
+		if i > 0 {
+			writeText("\n")
+		}
+		for _, element := range elements {
+			switch e := element.(type) {
+			case *dto.ForumTextElement:
+				writeText(e.TextInfo.Text)
+			case *dto.ForumURLElement:
+				if e.URLInfo.DisplayText != "" {
+					writeText(e.URLInfo.DisplayText + ": ")
+				}
+				writeText(e.URLInfo.URL)
+			case *dto.ForumLinkElement:
+				if e.LinkInfo.Desc != "" {
+					writeText(e.LinkInfo.Desc + ": ")
+				}
+				writeText(e.LinkInfo.URL)
+			case *dto.ForumImageElement:
+				url := e.ImageInfo.ThirdURL
+				if e.ImageInfo.PlatImage != nil && e.ImageInfo.PlatImage.URL != "" {
+					url = e.ImageInfo.PlatImage.URL
+				}
+				writeMedia("image", url)
+			case *dto.ForumVideoElement:
+				url := e.VideoInfo.ThirdURL
+				if e.VideoInfo.PlatVideo != nil && e.VideoInfo.PlatVideo.URL != "" {
+					url = e.VideoInfo.PlatVideo.URL
+				}
+				writeMedia("video", url)
+			case *dto.ForumChannelElement:
+				// 频道元素被忽略
+			}
+		}
+	}
+	flushText()
+	return segments, raw.String(), nil
+}
+
+// ForumMessage 上报帖子、评论、回复时的message与raw_message array模式下message为消息段
+func ForumMessage(content string) (interface{}, string) {
+	segments, raw, err := ParseForumContent(content)
+	if err != nil {
+		// 不是富文本时按纯文本处理
+		raw = content
+		segments = []map[string]interface{}{{
+			"type": "text",
+			"data": map[string]interface{}{"text": content},
+		}}
+	}
+	if config.GetArrayValue() {
+		return segments, raw
+	}
+	return raw, raw
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// 未指定duration时统计最近一天发过言的成员
+const defaultActiveDuration = 24 * 60 * 60
+
+func init() {
+	callapi.RegisterHandler("get_group_active_members", GetGroupActiveMembers)
+}
+
+// GetGroupActiveMembers 获取群内最近发过言的成员 duration为统计的秒数 limit为最多返回的数量
+func GetGroupActiveMembers(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	groupID, _ := message.Params.GroupID.(string)
+	duration := message.Params.Duration
+	if duration <= 0 {
+		duration = defaultActiveDuration
+	}
+	since := time.Now().Unix() - int64(duration)
+
+	group, ok := idmap.ResolveJoinedGroup(groupID)
+	var roster []idmap.RosterMember
+	if ok {
+		var err error
+		roster, err = idmap.ListActiveMembers(group.GroupOpenID, since, message.Params.Limit)
+		if err != nil {
+			mylog.Printf("Error listing active members: %v", err)
+		}
+	}
+
+	groupIDInt, _ := strconv.ParseUint(groupID, 10, 64)
+	members := make([]MemberList, 0, len(roster))
+	for _, m := range roster {
+		members = append(members, rosterToMember(m, groupIDInt))
+	}
+	responseJSON := buildResponse(members, message.Echo)
+	// 附加发言次数
+	if data, ok := responseJSON["data"].([]map[string]interface{}); ok {
+		for i := range data {
+			data[i]["message_count"] = roster[i].MessageCount
+		}
+	}
+	mylog.Printf("get_group_active_members: %s\n", responseJSON)
+
+	err := client.SendMessage(responseJSON)
+	if err != nil {
+		mylog.Printf("Error sending message via client: %v", err)
+	}
+	result, err := ConvertMapToJSONString(responseJSON)
+	if err != nil {
+		mylog.Printf("Error marshaling data: %v", err)
+		return "", nil
+	}
+	return string(result), nil
+}
+
+// rosterMemberList 从群成员记录生成成员列表 since为0时返回全部
+func rosterMemberList(groupID string, since int64, limit int) []MemberList {
+	group, ok := idmap.ResolveJoinedGroup(groupID)
+	if !ok {
+		return nil
+	}
+	roster, err := idmap.ListActiveMembers(group.GroupOpenID, since, limit)
+	if err != nil {
+		mylog.Printf("Error listing group roster: %v", err)
+		return nil
+	}
+	groupIDInt, _ := strconv.ParseUint(groupID, 10, 64)
+	var members []MemberList
+	for _, m := range roster {
+		members = append(members, rosterToMember(m, groupIDInt))
+	}
+	return members
+}
+
+// rosterToMember 群成员记录转为onebot群成员 加群时间为首次发言时间
+func rosterToMember(m idmap.RosterMember, groupID uint64) MemberList {
+	return MemberList{
+		UserID:       uint64(m.UserID),
+		GroupID:      groupID,
+		Nickname:     m.Nickname,
+		Card:         m.Nickname,
+		Sex:          "0",
+		Area:         "0",
+		JoinTime:     int32(m.FirstSeen),
+		LastSentTime: int32(m.LastSeen),
+		Level:        "0",
+		Role:         rosterRole(m),
+	}
+}
@@ -143,6 +143,13 @@ func GetGroupList(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.Open
 		}
 	}
 
+	//优先使用入群事件和群消息维护的已加入群,成员数为观察到的发言成员数
+	joinedGroups, err := idmap.ListJoinedGroups()
+	if err != nil {
+		mylog.Printf("Error ListJoinedGroups %s", err)
+	}
+	listed := make(map[string]bool)
+
 	//从idmaps数据库找群,组合成群列表需要的格式
 	groupIDs, err := idmap.FindKeysBySubAndType("group", "type")
 	if err != nil {
@@ -153,7 +160,21 @@ func GetGroupList(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.Open
 
 	// 判断是否string返回
 	if !config.GetStringOb11() {
+		for _, joined := range joinedGroups {
+			if joined.GroupID == 0 {
+				continue
+			}
+			listed[strconv.FormatInt(joined.GroupID, 10)] = true
+			groupList.Data = append(groupList.Data, Group{
+				GroupCreateTime: int32(joined.JoinTime),
+				GroupID:         joined.GroupID,
+				MemberCount:     int32(idmap.CountRosterMembers(joined.GroupOpenID)),
+			})
+		}
 		for _, idStr := range groupIDs {
+			if listed[idStr] {
+				continue
+			}
 			groupID, err := strconv.ParseInt(idStr, 10, 64)
 			if err != nil {
 				mylog.Printf("Error converting group ID %s to int64: %v", idStr, err)
@@ -187,9 +208,17 @@ func GetGroupList(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.Open
 		isNumeric := func(s string) bool {
 			return regexp.MustCompile(`^\d+$`).MatchString(s)
 		}
+		for _, joined := range joinedGroups {
+			listed[joined.GroupOpenID] = true
+			groupListString.Data = append(groupListString.Data, GroupString{
+				GroupCreateTime: int32(joined.JoinTime),
+				GroupID:         joined.GroupOpenID,
+				MemberCount:     int32(idmap.CountRosterMembers(joined.GroupOpenID)),
+			})
+		}
 		for _, idStr := range groupIDs {
 			var originalGroupID string
-			if isNumeric(idStr) {
+			if isNumeric(idStr) || listed[idStr] {
 				continue
 			} else {
 				originalGroupID = idStr
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"strconv"
+
 	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
 	"github.com/tencent-connect/botgo/openapi"
 )
@@ -65,25 +68,29 @@ func buildResponseForSingleMember(memberInfo *MemberInfo, echoValue interface{})
 }
 
 // getGroupMemberInfo是处理获取群成员信息的函数
+// 加群时间和最后发言时间来自群消息维护的成员记录,没有记录时只返回基本信息
 func GetGroupMemberInfo(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
-	// 使用虚拟数据构造 MemberInfo
+	groupID, _ := message.Params.GroupID.(string)
+	userID, _ := message.Params.UserID.(string)
+	groupIDInt, _ := strconv.ParseInt(groupID, 10, 64)
+	userIDInt, _ := strconv.ParseInt(userID, 10, 64)
+
 	memberInfo := &MemberInfo{
-		UserID:          123456789, // 虚拟的 QQ 号
-		GroupID:         987654321, // 虚拟的群号
-		Nickname:        "主人",      // 虚拟昵称
-		Card:            "主人",
-		Sex:             "unknown", // 性别未知
-		Age:             20,        // 虚拟年龄
-		Area:            "虚拟地区",
-		JoinTime:        1630416000, // 虚拟加群时间戳
-		LastSentTime:    1630502400, // 虚拟最后发言时间戳
-		Level:           "1",        // 虚拟成员等级
-		Role:            "member",   // 角色为普通成员
-		Unfriendly:      false,      // 没有不良记录
-		Title:           "虚拟头衔",
-		TitleExpireTime: 1630598800, // 虚拟头衔过期时间
-		CardChangeable:  true,       // 允许修改群名片
-		ShutUpTimestamp: 0,          // 不在禁言中
+		UserID:   userIDInt,
+		GroupID:  groupIDInt,
+		Nickname: "",
+		Card:     "",
+		Sex:      "unknown",
+		Area:     "",
+		Level:    "0",
+		Role:     memberRole(groupID, userID, "", "member"),
+	}
+	if m, ok := findRosterMember(groupID, userID); ok {
+		memberInfo.Nickname = m.Nickname
+		memberInfo.Card = m.Nickname
+		memberInfo.JoinTime = int32(m.FirstSeen)
+		memberInfo.LastSentTime = int32(m.LastSeen)
+		memberInfo.Role = rosterRole(m)
 	}
 
 	// 构建响应JSON
@@ -103,3 +110,39 @@ func GetGroupMemberInfo(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 	}
 	return string(result), nil
 }
+
+// memberRole 群成员的角色 与消息事件中的sender.role一致,没有分配角色时为fallback
+// groupID与userID为应用端使用的id,不知道真实的userID时realUserID为空
+func memberRole(groupID, userID, realUserID, fallback string) string {
+	if realUserID == "" {
+		realUserID = realTargetID(userID, "")
+	}
+	return idmap.ResolveRole(realTargetID(groupID, userID), fallback, realUserID, userID)
+}
+
+// rosterRole 成员记录中已有真实id,不需要还原
+func rosterRole(m idmap.RosterMember) string {
+	return idmap.ResolveRole(m.GroupOpenID, idmap.RoleMember, m.UserOpenID, strconv.FormatInt(m.UserID, 10))
+}
+
+// findRosterMember 在群成员记录中查找 user_id可以是转换后的数字id或真实id
+func findRosterMember(groupID, userID string) (idmap.RosterMember, bool) {
+	group, ok := idmap.ResolveJoinedGroup(groupID)
+	if !ok {
+		return idmap.RosterMember{}, false
+	}
+	if m, ok := idmap.GetRosterMember(group.GroupOpenID, userID); ok {
+		return m, true
+	}
+	roster, err := idmap.ListRosterMembers(group.GroupOpenID)
+	if err != nil {
+		mylog.Printf("Error listing group roster: %v", err)
+		return idmap.RosterMember{}, false
+	}
+	for _, m := range roster {
+		if m.UserID != 0 && strconv.FormatInt(m.UserID, 10) == userID {
+			return m, true
+		}
+	}
+	return idmap.RosterMember{}, false
+}
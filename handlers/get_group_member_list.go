@@ -55,49 +55,51 @@ func GetGroupMemberList(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 
 	switch msgType {
 	case "group":
-		mylog.Printf("getGroupMemberList(group): 开始从本地获取群成员列表(请在config打开idmap-pro以缓存群成员列表)")
-		// 实现的功能
-		var members []MemberList
-
-		// 使用 message.Params.GroupID.(string) 作为 id 来调用 FindSubKeysById
-		userIDs, err := idmap.FindSubKeysByIdPro(message.Params.GroupID.(string))
-		if err != nil {
-			mylog.Printf("Error retrieving user IDs: %v", err)
-			return "", nil // 或者处理错误
-		}
-
-		// 获取当前时间的前一天，并转换为10位时间戳
-		yesterday := time.Now().AddDate(0, 0, -1).Unix()
+		// 优先使用群消息维护的成员记录
+		members := rosterMemberList(message.Params.GroupID.(string), 0, 0)
+		if len(members) == 0 {
+			mylog.Printf("getGroupMemberList(group): 开始从本地获取群成员列表(请在config打开idmap-pro以缓存群成员列表)")
 
-		for _, userID := range userIDs {
-			userIDInt, err := strconv.ParseUint(userID, 10, 64)
+			// 使用 message.Params.GroupID.(string) 作为 id 来调用 FindSubKeysById
+			userIDs, err := idmap.FindSubKeysByIdPro(message.Params.GroupID.(string))
 			if err != nil {
-				mylog.Printf("Error ParseInt73: %v", err)
-			}
-			groupIDInt, err := strconv.ParseUint(message.Params.GroupID.(string), 10, 64)
-			if err != nil {
-				mylog.Printf("Error ParseInt76: %v", err)
+				mylog.Printf("Error retrieving user IDs: %v", err)
+				return "", nil // 或者处理错误
 			}
-			joinTimeInt := int32(yesterday)
-			member := MemberList{
-				UserID:          userIDInt,
-				GroupID:         groupIDInt,
-				Nickname:        "主人",
-				Card:            "主人",
-				Sex:             "0",
-				Age:             0,
-				Area:            "0",
-				JoinTime:        joinTimeInt,
-				LastSentTime:    0,
-				Level:           "0",
-				Role:            "member",
-				Unfriendly:      false,
-				Title:           "0",
-				TitleExpireTime: 0,
-				CardChangeable:  false,
-				ShutUpTimestamp: 0,
+
+			// 获取当前时间的前一天，并转换为10位时间戳
+			yesterday := time.Now().AddDate(0, 0, -1).Unix()
+
+			for _, userID := range userIDs {
+				userIDInt, err := strconv.ParseUint(userID, 10, 64)
+				if err != nil {
+					mylog.Printf("Error ParseInt73: %v", err)
+				}
+				groupIDInt, err := strconv.ParseUint(message.Params.GroupID.(string), 10, 64)
+				if err != nil {
+					mylog.Printf("Error ParseInt76: %v", err)
+				}
+				joinTimeInt := int32(yesterday)
+				member := MemberList{
+					UserID:          userIDInt,
+					GroupID:         groupIDInt,
+					Nickname:        "主人",
+					Card:            "主人",
+					Sex:             "0",
+					Age:             0,
+					Area:            "0",
+					JoinTime:        joinTimeInt,
+					LastSentTime:    0,
+					Level:           "0",
+					Role:            memberRole(message.Params.GroupID.(string), userID, "", "member"),
+					Unfriendly:      false,
+					Title:           "0",
+					TitleExpireTime: 0,
+					CardChangeable:  false,
+					ShutUpTimestamp: 0,
+				}
+				members = append(members, member)
 			}
-			members = append(members, member)
 		}
 		mylog.Printf("member message.Echors: %+v\n", message.Echo)
 
@@ -199,7 +201,7 @@ func GetGroupMemberList(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 					JoinTime:        joinTimeInt,
 					LastSentTime:    0,
 					Level:           "0",
-					Role:            "member",
+					Role:            memberRole(message.Params.GroupID.(string), userID, "", "member"),
 					Unfriendly:      false,
 					Title:           "0",
 					TitleExpireTime: 0,
@@ -329,6 +331,8 @@ func GetGroupMemberList(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 					break
 				}
 			}
+			// 框架分配的角色优先,与消息事件中的sender.role一致
+			member.Role = memberRole(message.Params.GroupID.(string), strconv.FormatUint(member.UserID, 10), memberFromAPI.User.ID, member.Role)
 			members = append(members, member)
 		}
 
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+func init() {
+	callapi.RegisterHandler("get_record", GetRecord)
+}
+
+// GetRecord 获取解码后的语音 收到语音时已在后台解码,这里等待解码完成
+func GetRecord(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	if !config.GetRecordDecode() {
+		return sendActionResponse(client, message, nil, errors.New("record_decode is disabled"))
+	}
+	if message.Params.File == "" {
+		return sendActionResponse(client, message, nil, errors.New("file is required"))
+	}
+	format := message.Params.OutFormat
+	if format == "" {
+		format = config.GetRecordDecodeType()
+	}
+	localPath, localURL, err := decodeVoice(voiceNameFromFile(message.Params.File), recordDecodeFormat(format))
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	return sendActionResponse(client, message, map[string]interface{}{
+		"file": localPath,
+		"url":  localURL,
+	}, nil)
+}
@@ -17,26 +17,10 @@ type GetStatusResponse struct {
 	Echo    interface{} `json:"echo"`
 }
 
-type StatusData struct {
-	AppInitialized bool       `json:"app_initialized"`
-	AppEnabled     bool       `json:"app_enabled"`
-	PluginsGood    bool       `json:"plugins_good"`
-	AppGood        bool       `json:"app_good"`
-	Online         bool       `json:"online"`
-	Good           bool       `json:"good"`
-	Stat           Statistics `json:"stat"`
-}
+// StatusData 与心跳元事件共用 botstats 中的状态结构
+type StatusData = botstats.Status
 
-type Statistics struct {
-	PacketReceived  uint64 `json:"packet_received"`
-	PacketSent      uint64 `json:"packet_sent"`
-	PacketLost      uint32 `json:"packet_lost"`
-	MessageReceived int    `json:"message_received"`
-	MessageSent     int    `json:"message_sent"`
-	DisconnectTimes uint32 `json:"disconnect_times"`
-	LostTimes       uint32 `json:"lost_times"`
-	LastMessageTime int64  `json:"last_message_time"`
-}
+type Statistics = botstats.Statistics
 
 func init() {
 	callapi.RegisterHandler("get_status", GetStatus)
@@ -46,28 +30,7 @@ func GetStatus(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI
 
 	var response GetStatusResponse
 
-	messageReceived, messageSent, lastMessageTime, err := botstats.GetStats()
-	if err != nil {
-		mylog.Printf("get_status错误,获取机器人发信状态错误:%v", err)
-	}
-	response.Data = StatusData{
-		AppInitialized: true,
-		AppEnabled:     true,
-		PluginsGood:    true,
-		AppGood:        true,
-		Online:         true, //测试数据
-		Good:           true, //测试数据
-		Stat: Statistics{
-			PacketReceived:  1000,            //测试数据
-			PacketSent:      950,             //测试数据
-			PacketLost:      50,              //测试数据
-			MessageReceived: messageReceived, //实际数据
-			MessageSent:     messageSent,     //实际数据
-			DisconnectTimes: 5,               //测试数据
-			LostTimes:       2,               //测试数据
-			LastMessageTime: lastMessageTime, //实际数据
-		},
-	}
+	response.Data = botstats.GetStatus()
 	response.Message = ""
 	response.RetCode = 0
 	response.Status = "ok"
@@ -77,7 +40,7 @@ func GetStatus(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI
 
 	mylog.Printf("get_status: %+v\n", outputMap)
 
-	err = client.SendMessage(outputMap)
+	err := client.SendMessage(outputMap)
 	if err != nil {
 		mylog.Printf("Error sending message via client: %v", err)
 	}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"encoding/json"
+	"runtime"
+	"runtime/debug"
 
 	"github.com/hoshinonyaruko/gensokyo/callapi"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
@@ -44,7 +46,7 @@ func GetVersionInfo(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.Op
 	response.Data = VersionData{
 		AppFullName:              "gensokyo",
 		AppName:                  "gensokyo",
-		AppVersion:               "v1.0.0",
+		AppVersion:               appVersion(),
 		CoolQDirectory:           "",
 		CoolQEdition:             "pro",
 		GoCQHTTP:                 true,
@@ -53,9 +55,9 @@ func GetVersionInfo(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.Op
 		PluginVersion:            "4.15.0",
 		ProtocolName:             4,
 		ProtocolVersion:          "v11",
-		RuntimeOS:                "windows",
-		RuntimeVersion:           "go1.20.2",
-		Version:                  "v1.0.0",
+		RuntimeOS:                runtime.GOOS,
+		RuntimeVersion:           runtime.Version(),
+		Version:                  appVersion(),
 	}
 	response.Message = ""
 	response.RetCode = 0
@@ -80,3 +82,11 @@ func GetVersionInfo(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.Op
 	}
 	return string(result), nil
 }
+
+// appVersion 从编译信息读取版本 本地编译时为 (devel)
+func appVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "v1.0.0"
+}
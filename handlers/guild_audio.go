@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// 音频控制动作与播放状态的对应关系
+var guildAudioStatus = map[string]dto.AudioStatus{
+	"play_guild_audio":   dto.AudioStatusStart,
+	"pause_guild_audio":  dto.AudioStatusPause,
+	"resume_guild_audio": dto.AudioStatusResume,
+	"stop_guild_audio":   dto.AudioStatusStop,
+}
+
+func init() {
+	for action := range guildAudioStatus {
+		callapi.RegisterHandler(action, ControlGuildAudio)
+	}
+	callapi.RegisterHandler("set_guild_mic", SetGuildMic)
+	callapi.RegisterHandler("get_guild_voice_channel_members", GetGuildVoiceChannelMembers)
+}
+
+// ControlGuildAudio 在音频子频道播放、暂停、继续、停止音频 播放时需要audio_url,text为播放状态文本
+func ControlGuildAudio(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireChannel(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	control := &dto.AudioControl{
+		URL:    message.Params.AudioURL,
+		Text:   message.Params.Text,
+		Status: guildAudioStatus[message.Action],
+	}
+	if control.Status == dto.AudioStatusStart && control.URL == "" {
+		return sendActionResponse(client, message, nil, errors.New("audio_url is required"))
+	}
+	_, err = api.PostAudio(context.TODO(), target.ChannelID, control)
+	return sendActionResponse(client, message, nil, err)
+}
+
+// SetGuildMic 机器人在音视频子频道上麦 set为false时下麦
+func SetGuildMic(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireChannel(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	if paramSet(message.Params) {
+		err = api.PutMic(context.TODO(), target.ChannelID)
+	} else {
+		err = api.DeleteMic(context.TODO(), target.ChannelID)
+	}
+	return sendActionResponse(client, message, nil, err)
+}
+
+// GetGuildVoiceChannelMembers 获取语音子频道中的成员
+func GetGuildVoiceChannelMembers(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireChannel(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	members, err := api.ListVoiceChannelMembers(context.TODO(), target.ChannelID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	list := make([]GuildMemberInfo, 0, len(members))
+	for _, member := range members {
+		if member.User == nil {
+			continue
+		}
+		list = append(list, guildMemberInfo(member))
+	}
+	return sendActionResponse(client, message, list, nil)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// GuildChannelInfo 子频道信息 group_id为开启global_channel_to_group时子频道对应的群号
+type GuildChannelInfo struct {
+	GuildID         string `json:"guild_id"`
+	ChannelID       string `json:"channel_id"`
+	GroupID         int64  `json:"group_id"`
+	ChannelName     string `json:"channel_name"`
+	ChannelType     int    `json:"channel_type"`
+	SubType         int    `json:"channel_sub_type"`
+	ParentID        string `json:"parent_id,omitempty"`
+	Position        int64  `json:"position"`
+	PrivateType     int    `json:"private_type"`
+	SpeakPermission int    `json:"speak_permission"`
+	OwnerID         int64  `json:"owner_id,omitempty"`
+}
+
+// GuildChannelPermissions 成员或身份组在子频道的权限 permissions为位图字符串
+type GuildChannelPermissions struct {
+	ChannelID   string `json:"channel_id"`
+	UserID      int64  `json:"user_id,omitempty"`
+	RoleID      string `json:"role_id,omitempty"`
+	Permissions string `json:"permissions"`
+}
+
+func init() {
+	callapi.RegisterHandler("create_guild_channel", CreateGuildChannel)
+	callapi.RegisterHandler("update_guild_channel", UpdateGuildChannel)
+	callapi.RegisterHandler("delete_guild_channel", DeleteGuildChannel)
+	callapi.RegisterHandler("get_guild_channel_permissions", GetGuildChannelPermissions)
+	callapi.RegisterHandler("set_guild_channel_permissions", SetGuildChannelPermissions)
+}
+
+// CreateGuildChannel 创建子频道 私密子频道可以用users指定成员
+func CreateGuildChannel(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireGuild(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	if message.Params.Name == "" {
+		return sendActionResponse(client, message, nil, errors.New("name is required"))
+	}
+	value := channelValue(message.Params)
+	for _, user := range message.Params.Users {
+		realUserID, err := resolveGuildUser(user)
+		if err != nil {
+			return sendActionResponse(client, message, nil, err)
+		}
+		value.PrivateUserIDs = append(value.PrivateUserIDs, realUserID)
+	}
+	channel, err := api.PostChannel(context.TODO(), target.GuildID, value)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	return sendActionResponse(client, message, guildChannelInfo(channel), nil)
+}
+
+// UpdateGuildChannel 修改子频道 只修改传入的字段
+func UpdateGuildChannel(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireChannel(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	channel, err := api.PatchChannel(context.TODO(), target.ChannelID, channelValue(message.Params))
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	return sendActionResponse(client, message, guildChannelInfo(channel), nil)
+}
+
+// DeleteGuildChannel 删除子频道
+func DeleteGuildChannel(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireChannel(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	err = api.DeleteChannel(context.TODO(), target.ChannelID)
+	return sendActionResponse(client, message, nil, err)
+}
+
+// GetGuildChannelPermissions 获取成员或身份组在子频道的权限 传入role_id时查询身份组
+func GetGuildChannelPermissions(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireChannel(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	info := GuildChannelPermissions{ChannelID: target.ChannelID}
+	if roleID := paramString(message.Params.RoleID); roleID != "" {
+		permissions, err := api.ChannelRolesPermissions(context.TODO(), target.ChannelID, roleID)
+		if err != nil {
+			return sendActionResponse(client, message, nil, err)
+		}
+		info.RoleID = roleID
+		info.Permissions = permissions.Permissions
+		return sendActionResponse(client, message, info, nil)
+	}
+	realUserID, err := resolveGuildUser(message.Params.UserID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	permissions, err := api.ChannelPermissions(context.TODO(), target.ChannelID, realUserID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	info.UserID = virtualUserID(realUserID)
+	info.Permissions = permissions.Permissions
+	return sendActionResponse(client, message, info, nil)
+}
+
+// SetGuildChannelPermissions 修改成员或身份组在子频道的权限 add与remove为权限位图字符串
+func SetGuildChannelPermissions(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireChannel(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	update := &dto.UpdateChannelPermissions{Add: message.Params.Add, Remove: message.Params.Remove}
+	if roleID := paramString(message.Params.RoleID); roleID != "" {
+		err = api.PutChannelRolesPermissions(context.TODO(), target.ChannelID, roleID, update)
+		return sendActionResponse(client, message, nil, err)
+	}
+	realUserID, err := resolveGuildUser(message.Params.UserID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	err = api.PutChannelPermissions(context.TODO(), target.ChannelID, realUserID, update)
+	return sendActionResponse(client, message, nil, err)
+}
+
+// channelValue 由参数生成子频道的值 为0的字段不会修改
+func channelValue(params callapi.ParamsContent) *dto.ChannelValueObject {
+	return &dto.ChannelValueObject{
+		Name:            params.Name,
+		Type:            dto.ChannelType(params.ChannelType),
+		SubType:         dto.ChannelSubType(params.ChannelSubType),
+		Position:        params.Position,
+		ParentID:        paramString(params.ParentID),
+		PrivateType:     dto.ChannelPrivateType(params.PrivateType),
+		SpeakPermission: dto.SpeakPermissionType(params.SpeakPermission),
+	}
+}
+
+// guildChannelInfo 转换子频道 同时记录子频道与频道的关系,与频道消息一致
+func guildChannelInfo(channel *dto.Channel) GuildChannelInfo {
+	info := GuildChannelInfo{
+		GuildID:         channel.GuildID,
+		ChannelID:       channel.ID,
+		ChannelName:     channel.Name,
+		ChannelType:     int(channel.Type),
+		SubType:         int(channel.SubType),
+		ParentID:        channel.ParentID,
+		Position:        channel.Position,
+		PrivateType:     int(channel.PrivateType),
+		SpeakPermission: int(channel.SpeakPermission),
+		OwnerID:         virtualUserID(channel.OwnerID),
+	}
+	ChannelID64, err := idmap.StoreIDv2(channel.ID)
+	if err != nil {
+		mylog.Printf("Error storing ID: %v", err)
+		return info
+	}
+	info.GroupID = ChannelID64
+	if channel.GuildID != "" {
+		idmap.WriteConfigv2(channel.ID, "guild_id", channel.GuildID)
+	}
+	return info
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// ForumThreadInfo 帖子信息 message在array模式下为消息段
+type ForumThreadInfo struct {
+	GuildID    string      `json:"guild_id"`
+	ChannelID  string      `json:"channel_id"`
+	UserID     int64       `json:"user_id"`
+	ThreadID   string      `json:"thread_id"`
+	Title      string      `json:"title"`
+	Message    interface{} `json:"message"`
+	RawMessage string      `json:"raw_message"`
+	Time       int64       `json:"time"`
+	RealUserID string      `json:"real_user_id,omitempty"` //当前真实uid
+}
+
+func init() {
+	callapi.RegisterHandler("get_guild_forum_list", GetGuildForumList)
+	callapi.RegisterHandler("get_guild_forum", GetGuildForum)
+	callapi.RegisterHandler("delete_guild_forum", DeleteGuildForum)
+}
+
+// GetGuildForumList 获取论坛子频道的帖子列表
+func GetGuildForumList(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireChannel(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	list, err := api.ListThreads(context.TODO(), target.ChannelID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	threads := make([]ForumThreadInfo, 0, len(list.Threads))
+	for _, thread := range list.Threads {
+		threads = append(threads, forumThreadInfo(thread))
+	}
+	return sendActionResponse(client, message, map[string]interface{}{"threads": threads, "is_finish": list.IsFinish == 1}, nil)
+}
+
+// GetGuildForum 获取帖子详情
+func GetGuildForum(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, threadID, err := resolveThread(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	thread, err := api.GetThread(context.TODO(), target.ChannelID, threadID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	return sendActionResponse(client, message, forumThreadInfo(thread), nil)
+}
+
+// DeleteGuildForum 删除帖子
+func DeleteGuildForum(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, threadID, err := resolveThread(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	err = api.DeleteThread(context.TODO(), target.ChannelID, threadID)
+	return sendActionResponse(client, message, nil, err)
+}
+
+// resolveThread 帖子所在的子频道与thread_id
+func resolveThread(api openapi.OpenAPI, params callapi.ParamsContent) (guildTarget, string, error) {
+	target, err := requireChannel(api, params)
+	if err != nil {
+		return target, "", err
+	}
+	threadID := paramString(params.ThreadID)
+	if threadID == "" {
+		return target, "", errors.New("thread_id is required")
+	}
+	return target, threadID, nil
+}
+
+// forumThreadInfo 转换帖子 作者转换为虚拟user_id
+func forumThreadInfo(thread *dto.Thread) ForumThreadInfo {
+	info := ForumThreadInfo{
+		GuildID:   thread.GuildID,
+		ChannelID: thread.ChannelID,
+		UserID:    virtualUserID(thread.AuthorID),
+		ThreadID:  thread.ThreadInfo.ThreadID,
+		Title:     thread.ThreadInfo.Title,
+	}
+	info.Message, info.RawMessage = ForumMessage(thread.ThreadInfo.Content)
+	if t, err := time.Parse(time.RFC3339, thread.ThreadInfo.DateTime); err == nil {
+		info.Time = t.Unix()
+	}
+	//增强配置
+	if !config.GetNativeOb11() {
+		info.RealUserID = thread.AuthorID
+	}
+	return info
+}
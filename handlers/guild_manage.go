@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/echo"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// 频道管理类动作只能作用于频道,群聊和私聊的虚拟群没有对应的接口
+var errNotGuildTarget = errors.New("this action is only available for guild channels")
+
+// ActionResponse 返回data的动作的回执
+type ActionResponse struct {
+	Data    interface{} `json:"data"`
+	Message string      `json:"message"`
+	RetCode int         `json:"retcode"`
+	Status  string      `json:"status"`
+	Echo    interface{} `json:"echo"`
+}
+
+// GuildMemberInfo 频道成员
+type GuildMemberInfo struct {
+	UserID     int64    `json:"user_id"`
+	Nickname   string   `json:"nickname"`
+	Roles      []string `json:"roles"`
+	JoinedAt   int64    `json:"joined_at"`
+	RealUserID string   `json:"real_user_id,omitempty"` //当前真实uid
+}
+
+// guildTarget 频道管理动作作用的频道与子频道 均为真实id
+type guildTarget struct {
+	GuildID   string
+	ChannelID string
+}
+
+// sendActionResponse 按动作结果返回 出错时retcode为100
+func sendActionResponse(client callapi.Client, message callapi.ActionMessage, data interface{}, err error) (string, error) {
+	var response ActionResponse
+	response.Echo = message.Echo
+	if err != nil {
+		mylog.Printf("%v 失败: %v", message.Action, err)
+		response.Message = err.Error()
+		response.RetCode = 100
+		response.Status = "failed"
+	} else {
+		response.Data = data
+		response.RetCode = 0
+		response.Status = "ok"
+	}
+
+	outputMap := structToMap(response)
+
+	mylog.Printf("%v: %+v\n", message.Action, outputMap)
+
+	err = client.SendMessage(outputMap)
+	if err != nil {
+		mylog.Printf("Error sending message via client: %v", err)
+	}
+	//把结果从struct转换为json
+	result, err := json.Marshal(response)
+	if err != nil {
+		mylog.Printf("Error marshaling data: %v", err)
+		return "", nil
+	}
+	return string(result), nil
+}
+
+// paramString id类参数转换为字符串 数字参数不使用科学计数法
+func paramString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// resolveGuildTarget 由group_id channel_id guild_id得到真实的频道和子频道
+// group_id为子频道或频道对应的虚拟群号,channel_id与guild_id与频道消息上报一致为真实id
+func resolveGuildTarget(api openapi.OpenAPI, params callapi.ParamsContent) (guildTarget, error) {
+	target := guildTarget{
+		GuildID:   paramString(params.GuildID),
+		ChannelID: paramString(params.ChannelID),
+	}
+	if groupID := paramString(params.GroupID); groupID != "" && target.ChannelID == "" {
+		msgType, _ := idmap.ReadConfigv2(groupID, "type")
+		if msgType == "group" || msgType == "private" {
+			return target, errNotGuildTarget
+		}
+		realID, err := idmap.RetrieveRowByIDv2(groupID)
+		if err != nil {
+			return target, fmt.Errorf("group_id %s not found: %v", groupID, err)
+		}
+		// 频道成员通知中的group_id是频道本身
+		if guildID, err := idmap.ReadConfigv2(groupID, "guild_id"); err == nil && guildID != "" {
+			target.ChannelID = realID
+			if target.GuildID == "" {
+				target.GuildID = guildID
+			}
+		} else if channel, err := api.Channel(context.TODO(), realID); err == nil {
+			target.ChannelID = realID
+			if target.GuildID == "" {
+				target.GuildID = channel.GuildID
+			}
+		} else if target.GuildID == "" {
+			target.GuildID = realID
+		}
+	}
+	if target.ChannelID != "" && target.GuildID == "" {
+		if guildID, err := idmap.ReadConfigv2(target.ChannelID, "guild_id"); err == nil && guildID != "" {
+			target.GuildID = guildID
+		} else if channel, err := api.Channel(context.TODO(), target.ChannelID); err == nil {
+			target.GuildID = channel.GuildID
+		}
+	}
+	if target.GuildID == "" && target.ChannelID == "" {
+		return target, errors.New("group_id, channel_id or guild_id is required")
+	}
+	return target, nil
+}
+
+// requireGuild 需要频道的动作
+func requireGuild(api openapi.OpenAPI, params callapi.ParamsContent) (guildTarget, error) {
+	target, err := resolveGuildTarget(api, params)
+	if err == nil && target.GuildID == "" {
+		err = errors.New("guild of the channel not found, pass guild_id")
+	}
+	return target, err
+}
+
+// requireChannel 需要子频道的动作
+func requireChannel(api openapi.OpenAPI, params callapi.ParamsContent) (guildTarget, error) {
+	target, err := resolveGuildTarget(api, params)
+	if err == nil && target.ChannelID == "" {
+		err = errors.New("channel_id or group_id of a channel is required")
+	}
+	return target, err
+}
+
+// resolveGuildUser 虚拟user_id还原为真实id
+func resolveGuildUser(userID interface{}) (string, error) {
+	id := paramString(userID)
+	if id == "" {
+		return "", errors.New("user_id is required")
+	}
+	realUserID, err := idmap.RetrieveRowByIDv2(id)
+	if err != nil {
+		return "", fmt.Errorf("user_id %s not found: %v", id, err)
+	}
+	return realUserID, nil
+}
+
+// resolveGuildMessage 虚拟message_id还原为真实id及其所在的子频道
+func resolveGuildMessage(api openapi.OpenAPI, params callapi.ParamsContent, messageID interface{}) (string, string, error) {
+	rowID := paramString(messageID)
+	realMsgID := resolveMessageID(rowID)
+	if realMsgID == "" {
+		return "", "", fmt.Errorf("message_id %v not found", rowID)
+	}
+	if scope, ok := idmap.RetrieveMessageScope(realMsgID); ok {
+		if scope.Type != idmap.ScopeGuild {
+			return "", "", errNotGuildTarget
+		}
+		return scope.TargetID, realMsgID, nil
+	}
+	// 没有记录来源的信息,按应用端传入的id
+	target, err := requireChannel(api, params)
+	if err != nil {
+		return "", "", err
+	}
+	return target.ChannelID, realMsgID, nil
+}
+
+// virtualUserID 真实用户id转换为上报时使用的user_id
+func virtualUserID(userID string) int64 {
+	if userID == "" {
+		return 0
+	}
+	userid64, err := idmap.StoreIDv2(userID)
+	if err != nil {
+		mylog.Printf("Error storing ID: %v", err)
+	}
+	return userid64
+}
+
+// virtualMessageID 真实msg_id转换为上报时使用的message_id
+func virtualMessageID(msgID string) int64 {
+	var messageID64 int64
+	var err error
+	if config.GetMemoryMsgid() {
+		messageID64, err = echo.StoreCacheInMemory(msgID)
+	} else {
+		messageID64, err = idmap.StoreCachev2(msgID)
+	}
+	if err != nil {
+		mylog.Printf("Error storing ID: %v", err)
+	}
+	return messageID64
+}
+
+// guildMemberInfo 转换频道成员 user_id转换为虚拟值
+func guildMemberInfo(member *dto.Member) GuildMemberInfo {
+	info := GuildMemberInfo{
+		UserID:   virtualUserID(member.User.ID),
+		Nickname: member.Nick,
+		Roles:    member.Roles,
+	}
+	if info.Nickname == "" {
+		info.Nickname = member.User.Username
+	}
+	if t, err := member.JoinedAt.Time(); err == nil {
+		info.JoinedAt = t.Unix()
+	}
+	//增强配置
+	if !config.GetNativeOb11() {
+		info.RealUserID = member.User.ID
+	}
+	return info
+}
+
+// paramSet set参数 默认为设置
+func paramSet(params callapi.ParamsContent) bool {
+	return params.Set == nil || *params.Set
+}
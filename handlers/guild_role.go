@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// 子频道管理员身份组 设置时需要指定子频道
+const channelAdminRoleID = "5"
+
+// 未指定分页大小时每页的成员数
+const defaultRoleMembersLimit = 100
+
+// GuildRoleInfo 身份组信息
+type GuildRoleInfo struct {
+	RoleID      string `json:"role_id"`
+	RoleName    string `json:"role_name"`
+	Color       uint32 `json:"color"`
+	Hoist       bool   `json:"hoist"`
+	MemberCount uint32 `json:"member_count"`
+	MemberLimit uint32 `json:"member_limit"`
+}
+
+func init() {
+	callapi.RegisterHandler("get_guild_roles", GetGuildRoles)
+	callapi.RegisterHandler("create_guild_role", CreateGuildRole)
+	callapi.RegisterHandler("update_guild_role", UpdateGuildRole)
+	callapi.RegisterHandler("delete_guild_role", DeleteGuildRole)
+	callapi.RegisterHandler("set_guild_member_role", SetGuildMemberRole)
+	callapi.RegisterHandler("get_guild_role_members", GetGuildRoleMembers)
+}
+
+// GetGuildRoles 获取频道的身份组列表
+func GetGuildRoles(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireGuild(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	roles, err := api.Roles(context.TODO(), target.GuildID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	data := make([]GuildRoleInfo, 0, len(roles.Roles))
+	for _, role := range roles.Roles {
+		data = append(data, guildRoleInfo(role))
+	}
+	return sendActionResponse(client, message, data, nil)
+}
+
+// CreateGuildRole 创建身份组 返回role_id
+func CreateGuildRole(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireGuild(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	if message.Params.Name == "" {
+		return sendActionResponse(client, message, nil, errors.New("name is required"))
+	}
+	role := &dto.Role{Name: message.Params.Name, Color: message.Params.Color}
+	if message.Params.Hoist != nil && *message.Params.Hoist {
+		role.Hoist = 1
+	}
+	result, err := api.PostRole(context.TODO(), target.GuildID, role)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	return sendActionResponse(client, message, map[string]interface{}{"role_id": string(result.RoleID)}, nil)
+}
+
+// UpdateGuildRole 修改身份组 未传入的名称、颜色、是否单独展示保持不变
+func UpdateGuildRole(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireGuild(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	roleID := paramString(message.Params.RoleID)
+	// 修改接口会覆盖全部字段,先取回原值
+	roles, err := api.Roles(context.TODO(), target.GuildID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	var role *dto.Role
+	for _, r := range roles.Roles {
+		if string(r.ID) == roleID {
+			role = &dto.Role{Name: r.Name, Color: r.Color, Hoist: r.Hoist}
+			break
+		}
+	}
+	if role == nil {
+		return sendActionResponse(client, message, nil, fmt.Errorf("role_id %s not found", roleID))
+	}
+	if message.Params.Name != "" {
+		role.Name = message.Params.Name
+	}
+	if message.Params.Color != 0 {
+		role.Color = message.Params.Color
+	}
+	if message.Params.Hoist != nil {
+		role.Hoist = 0
+		if *message.Params.Hoist {
+			role.Hoist = 1
+		}
+	}
+	_, err = api.PatchRole(context.TODO(), target.GuildID, dto.RoleID(roleID), role)
+	return sendActionResponse(client, message, nil, err)
+}
+
+// DeleteGuildRole 删除身份组
+func DeleteGuildRole(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireGuild(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	roleID := paramString(message.Params.RoleID)
+	if roleID == "" {
+		return sendActionResponse(client, message, nil, errors.New("role_id is required"))
+	}
+	err = api.DeleteRole(context.TODO(), target.GuildID, dto.RoleID(roleID))
+	return sendActionResponse(client, message, nil, err)
+}
+
+// SetGuildMemberRole 为user_id或users中的成员设置或取消身份组 set为false时取消
+// 子频道管理员身份组需要channel_id或子频道对应的group_id
+func SetGuildMemberRole(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireGuild(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	roleID := paramString(message.Params.RoleID)
+	if roleID == "" {
+		return sendActionResponse(client, message, nil, errors.New("role_id is required"))
+	}
+	var body *dto.MemberAddRoleBody
+	if roleID == channelAdminRoleID {
+		if target.ChannelID == "" {
+			return sendActionResponse(client, message, nil, errors.New("channel_id is required for channel admin role"))
+		}
+		body = &dto.MemberAddRoleBody{Channel: &dto.Channel{ID: target.ChannelID}}
+	}
+	users := message.Params.Users
+	if len(users) == 0 {
+		users = []interface{}{message.Params.UserID}
+	}
+	for _, user := range users {
+		realUserID, err := resolveGuildUser(user)
+		if err != nil {
+			return sendActionResponse(client, message, nil, err)
+		}
+		if paramSet(message.Params) {
+			err = api.MemberAddRole(context.TODO(), target.GuildID, dto.RoleID(roleID), realUserID, body)
+		} else {
+			err = api.MemberDeleteRole(context.TODO(), target.GuildID, dto.RoleID(roleID), realUserID, body)
+		}
+		if err != nil {
+			return sendActionResponse(client, message, nil, err)
+		}
+	}
+	return sendActionResponse(client, message, nil, nil)
+}
+
+// GetGuildRoleMembers 分页获取身份组成员 next为空时已经是最后一页
+func GetGuildRoleMembers(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireGuild(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	roleID := paramString(message.Params.RoleID)
+	if roleID == "" {
+		return sendActionResponse(client, message, nil, errors.New("role_id is required"))
+	}
+	limit := message.Params.Limit
+	if limit <= 0 {
+		limit = defaultRoleMembersLimit
+	}
+	pager := &dto.GuildRoleMembersPager{StartIndex: message.Params.StartIndex, Limit: strconv.Itoa(limit)}
+	members, next, err := api.GuildRoleMembers(context.TODO(), target.GuildID, roleID, pager)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	list := make([]GuildMemberInfo, 0, len(members))
+	for _, member := range members {
+		if member.User == nil {
+			continue
+		}
+		list = append(list, guildMemberInfo(member))
+	}
+	return sendActionResponse(client, message, map[string]interface{}{"members": list, "next": next}, nil)
+}
+
+// guildRoleInfo 转换身份组
+func guildRoleInfo(role *dto.Role) GuildRoleInfo {
+	return GuildRoleInfo{
+		RoleID:      string(role.ID),
+		RoleName:    role.Name,
+		Color:       role.Color,
+		Hoist:       role.Hoist == 1,
+		MemberCount: role.MemberCount,
+		MemberLimit: role.MemberLimit,
+	}
+}
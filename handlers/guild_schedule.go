@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// GuildSchedule 日程信息 时间均为毫秒时间戳
+type GuildSchedule struct {
+	ScheduleID    string `json:"schedule_id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	StartTime     int64  `json:"start_time"`
+	EndTime       int64  `json:"end_time"`
+	JumpChannelID string `json:"jump_channel_id,omitempty"`
+	RemindType    string `json:"remind_type"`
+	CreatorID     int64  `json:"creator_id,omitempty"`
+}
+
+func init() {
+	callapi.RegisterHandler("get_guild_schedule_list", GetGuildScheduleList)
+	callapi.RegisterHandler("get_guild_schedule", GetGuildSchedule)
+	callapi.RegisterHandler("create_guild_schedule", CreateGuildSchedule)
+	callapi.RegisterHandler("update_guild_schedule", UpdateGuildSchedule)
+	callapi.RegisterHandler("delete_guild_schedule", DeleteGuildSchedule)
+}
+
+// GetGuildScheduleList 获取日程子频道中since当天的日程 since为0时为今天
+func GetGuildScheduleList(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireChannel(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	schedules, err := api.ListSchedules(context.TODO(), target.ChannelID, message.Params.Since)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	list := make([]GuildSchedule, 0, len(schedules))
+	for _, schedule := range schedules {
+		list = append(list, guildSchedule(schedule))
+	}
+	return sendActionResponse(client, message, list, nil)
+}
+
+// GetGuildSchedule 获取单个日程
+func GetGuildSchedule(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, scheduleID, err := resolveSchedule(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	schedule, err := api.GetSchedule(context.TODO(), target.ChannelID, scheduleID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	return sendActionResponse(client, message, guildSchedule(schedule), nil)
+}
+
+// CreateGuildSchedule 在日程子频道创建日程
+func CreateGuildSchedule(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireChannel(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	if message.Params.Name == "" || message.Params.StartTime == 0 || message.Params.EndTime == 0 {
+		return sendActionResponse(client, message, nil, errors.New("name, start_time and end_time are required"))
+	}
+	schedule := &dto.Schedule{RemindType: "0"}
+	applyScheduleParams(schedule, message.Params)
+	created, err := api.CreateSchedule(context.TODO(), target.ChannelID, schedule)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	return sendActionResponse(client, message, guildSchedule(created), nil)
+}
+
+// UpdateGuildSchedule 修改日程 未传入的字段保持不变
+func UpdateGuildSchedule(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, scheduleID, err := resolveSchedule(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	// 修改接口需要完整的日程,先取回原值
+	schedule, err := api.GetSchedule(context.TODO(), target.ChannelID, scheduleID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	schedule.Creator = nil
+	applyScheduleParams(schedule, message.Params)
+	modified, err := api.ModifySchedule(context.TODO(), target.ChannelID, scheduleID, schedule)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	return sendActionResponse(client, message, guildSchedule(modified), nil)
+}
+
+// DeleteGuildSchedule 删除日程
+func DeleteGuildSchedule(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, scheduleID, err := resolveSchedule(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	err = api.DeleteSchedule(context.TODO(), target.ChannelID, scheduleID)
+	return sendActionResponse(client, message, nil, err)
+}
+
+// resolveSchedule 日程所在的子频道与schedule_id
+func resolveSchedule(api openapi.OpenAPI, params callapi.ParamsContent) (guildTarget, string, error) {
+	target, err := requireChannel(api, params)
+	if err != nil {
+		return target, "", err
+	}
+	scheduleID := paramString(params.ScheduleID)
+	if scheduleID == "" {
+		return target, "", errors.New("schedule_id is required")
+	}
+	return target, scheduleID, nil
+}
+
+// applyScheduleParams 用传入的参数覆盖日程
+func applyScheduleParams(schedule *dto.Schedule, params callapi.ParamsContent) {
+	if params.Name != "" {
+		schedule.Name = params.Name
+	}
+	if params.Description != "" {
+		schedule.Description = params.Description
+	}
+	if params.StartTime != 0 {
+		schedule.StartTimestamp = strconv.FormatInt(params.StartTime, 10)
+	}
+	if params.EndTime != 0 {
+		schedule.EndTimestamp = strconv.FormatInt(params.EndTime, 10)
+	}
+	// 跳转的子频道与channel_id一致为真实id
+	if jumpChannelID := paramString(params.JumpChannelID); jumpChannelID != "" {
+		schedule.JumpChannelID = jumpChannelID
+	}
+	if params.RemindType != "" {
+		schedule.RemindType = params.RemindType
+	}
+}
+
+// guildSchedule 转换日程 创建者转换为虚拟user_id
+func guildSchedule(schedule *dto.Schedule) GuildSchedule {
+	info := GuildSchedule{
+		ScheduleID:    schedule.ID,
+		Name:          schedule.Name,
+		Description:   schedule.Description,
+		JumpChannelID: schedule.JumpChannelID,
+		RemindType:    schedule.RemindType,
+	}
+	info.StartTime, _ = strconv.ParseInt(schedule.StartTimestamp, 10, 64)
+	info.EndTime, _ = strconv.ParseInt(schedule.EndTimestamp, 10, 64)
+	if schedule.Creator != nil && schedule.Creator.User != nil {
+		info.CreatorID = virtualUserID(schedule.Creator.User.ID)
+	}
+	return info
+}
@@ -1,40 +1,127 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"strconv"
 
 	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/dto"
 	"github.com/tencent-connect/botgo/openapi"
 )
 
+// 快速禁言的默认时长 与onebotv11一致为30分钟
+const defaultQuickBanDuration = 30 * 60
+
 func init() {
 	callapi.RegisterHandler(".handle_quick_operation", Handle_quick_operation)
 }
 
+// Handle_quick_operation 对事件执行快速操作 回复、撤回、踢出、禁言和处理请求
+// 各子操作依次执行,有失败时返回第一个失败的原因
 func Handle_quick_operation(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
-	// 使用 CreateSendGroupMsgAction 函数来确定如何处理消息
-	newMsg := CreateSendGroupMsgAction(message)
-	var retmsg string
-	// 根据返回的 ActionMessage 类型调用相应的处理函数
-	if newMsg != nil {
-		switch newMsg.Action {
-		case "send_group_msg":
-			retmsg, _ = HandleSendGroupMsg(client, api, apiv2, *newMsg)
-		case "send_private_msg":
-			retmsg, _ = HandleSendPrivateMsg(client, api, apiv2, *newMsg)
+	ctx := message.Params.Context
+	op := message.Params.Operation
+
+	var errs []error
+	fail := func(name string, err error) {
+		if err != nil {
+			mylog.Printf("快速操作%s失败: %v", name, err)
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+		}
+	}
+
+	if ctx.PostType == "request" {
+		fail("处理请求", quickHandleRequest(api, apiv2, ctx, op))
+	} else {
+		// 使用 CreateSendGroupMsgAction 函数来确定如何回复
+		if newMsg := CreateSendGroupMsgAction(message); newMsg != nil {
+			capture := &captureClient{}
+			var err error
+			switch newMsg.Action {
+			case "send_group_msg":
+				_, err = HandleSendGroupMsg(capture, api, apiv2, *newMsg)
+			case "send_private_msg":
+				_, err = HandleSendPrivateMsg(capture, api, apiv2, *newMsg)
+			case "send_guild_channel_msg":
+				_, err = HandleSendGuildChannelMsg(capture, api, apiv2, *newMsg)
+			case "send_guild_private_msg":
+				guildID := quickOperationID(newMsg.Params.GuildID)
+				channelID := quickOperationID(newMsg.Params.ChannelID)
+				_, err = HandleSendGuildChannelPrivateMsg(capture, api, apiv2, *newMsg, &guildID, &channelID)
+			}
+			// handler在发送前返回时不会有回执,capture.err()会报告失败
+			if err == nil {
+				err = capture.err()
+			}
+			fail("回复", err)
 		}
+		if op.Delete {
+			fail("撤回", quickDeleteMessage(api, ctx))
+		}
+		if op.Kick {
+			fail("踢出", quickKickSender(api, ctx))
+		}
+		if op.Ban {
+			fail("禁言", quickBanSender(api, ctx, op.BanDuration))
+		}
+	}
+
+	var response ServerResponse
+	response.Echo = message.Echo
+	if len(errs) > 0 {
+		response.RetCode = 100
+		response.Status = "failed"
+		response.Message = errs[0].Error()
+	} else {
+		response.RetCode = 0
+		response.Status = "ok"
 	}
-	return retmsg, nil
+
+	outputMap := structToMap(response)
+	// 快速操作没有返回数据
+	outputMap["data"] = nil
+	if err := client.SendMessage(outputMap); err != nil {
+		mylog.Printf("Error sending message via client: %v", err)
+	}
+	result, err := json.Marshal(outputMap)
+	if err != nil {
+		mylog.Printf("Error marshaling data: %v", err)
+		return "", nil
+	}
+	return string(result), nil
 }
 
+// CreateSendGroupMsgAction 根据事件的来源构造回复动作,message_id为事件本身,以被动信息回复
 func CreateSendGroupMsgAction(originalMsg callapi.ActionMessage) *callapi.ActionMessage {
-	switch originalMsg.Params.Context.MessageType {
+	action := quickReplyAction(originalMsg)
+	if action != nil {
+		action.QuickReply = true
+	}
+	return action
+}
+
+func quickReplyAction(originalMsg callapi.ActionMessage) *callapi.ActionMessage {
+	ctx := originalMsg.Params.Context
+	op := originalMsg.Params.Operation
+	if op.Reply == nil || op.Reply == "" {
+		return nil
+	}
+	userID := quickOperationID(ctx.UserID)
+	messageID := quickOperationID(ctx.MessageID)
+
+	switch ctx.MessageType {
 	case "group":
 		return &callapi.ActionMessage{
 			Action: "send_group_msg",
 			Params: callapi.ParamsContent{
-				GroupID: strconv.Itoa(originalMsg.Params.Context.GroupID), // 将int转换为string
-				Message: originalMsg.Params.Operation.Reply,
+				GroupID:   quickOperationID(ctx.GroupID),
+				UserID:    userID,
+				MessageID: messageID,
+				Message:   quickReplyMessage(op, userID, true),
 			},
 		}
 
@@ -42,12 +129,238 @@ func CreateSendGroupMsgAction(originalMsg callapi.ActionMessage) *callapi.Action
 		return &callapi.ActionMessage{
 			Action: "send_private_msg",
 			Params: callapi.ParamsContent{
-				UserID:  strconv.Itoa(originalMsg.Params.Context.UserID), // 将int转换为string
-				Message: originalMsg.Params.Operation.Reply,
+				UserID:    userID,
+				MessageID: messageID,
+				Message:   quickReplyMessage(op, userID, false),
 			},
 		}
 
+	case "guild":
+		guildID := quickOperationID(ctx.GuildID)
+		channelID := quickOperationID(ctx.ChannelID)
+		// 频道私信
+		if ctx.RealMessageType == "guild_private" {
+			return &callapi.ActionMessage{
+				Action: "send_guild_private_msg",
+				Params: callapi.ParamsContent{
+					GuildID:   guildID,
+					ChannelID: channelID,
+					UserID:    userID,
+					MessageID: messageID,
+					Message:   quickReplyMessage(op, userID, false),
+				},
+			}
+		}
+		// group_id同时传入子频道id,使send_guild_channel_msg按频道信息发送
+		return &callapi.ActionMessage{
+			Action: "send_guild_channel_msg",
+			Params: callapi.ParamsContent{
+				GuildID:   guildID,
+				ChannelID: channelID,
+				GroupID:   channelID,
+				MessageID: messageID,
+				Message:   quickReplyMessage(op, userID, true),
+			},
+		}
+
+	default:
+		return nil
+	}
+}
+
+// quickReplyMessage 处理at_sender和auto_escape 群聊和频道中默认at发送者
+func quickReplyMessage(op callapi.Operation, userID string, group bool) interface{} {
+	reply := op.Reply
+	// 以消息段发送文本,不会被当作CQ码解析出图片语音等
+	if text, ok := reply.(string); ok && op.AutoEscape {
+		reply = []interface{}{textSegment(text)}
+	}
+	if !group || userID == "" || (op.AtSender != nil && !*op.AtSender) {
+		return reply
+	}
+	switch r := reply.(type) {
+	case string:
+		return "[CQ:at,qq=" + userID + "] " + r
+	case []interface{}:
+		at := map[string]interface{}{"type": "at", "data": map[string]interface{}{"qq": userID}}
+		return append([]interface{}{at, textSegment(" ")}, r...)
+	case map[string]interface{}:
+		at := map[string]interface{}{"type": "at", "data": map[string]interface{}{"qq": userID}}
+		return []interface{}{at, textSegment(" "), r}
+	}
+	return reply
+}
+
+func textSegment(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "text", "data": map[string]interface{}{"text": text}}
+}
+
+// quickMessageScope 事件的真实类型 group group_private guild guild_private
+func quickMessageScope(ctx callapi.Context) string {
+	switch ctx.MessageType {
+	case "guild":
+		if ctx.RealMessageType == "guild_private" {
+			return "guild_private"
+		}
+		return "guild"
+	case "group":
+		if ctx.RealMessageType != "" {
+			return ctx.RealMessageType
+		}
+		if msgType := GetMessageTypeByGroupidV2(quickOperationID(ctx.GroupID)); msgType != "" {
+			return msgType
+		}
+		return "group"
+	case "private":
+		if ctx.RealMessageType != "" {
+			return ctx.RealMessageType
+		}
+		if msgType := GetMessageTypeByUseridV2(quickOperationID(ctx.UserID)); msgType != "" {
+			return msgType
+		}
+		return "group_private"
+	}
+	return ""
+}
+
+// quickDeleteMessage 撤回触发快速操作的信息
+func quickDeleteMessage(api openapi.OpenAPI, ctx callapi.Context) error {
+	msgID := resolveMessageID(quickOperationID(ctx.MessageID))
+	if msgID == "" {
+		return fmt.Errorf("message_id %v not found", ctx.MessageID)
+	}
+	if scope, ok := idmap.RetrieveMessageScope(msgID); ok {
+		return retractMessage(api, msgID, scope)
+	}
+	scope := quickMessageScope(ctx)
+
+	// 频道原生事件中的id是真实id
+	if ctx.MessageType == "guild" {
+		if scope == "guild_private" {
+			return api.RetractDMMessage(context.TODO(), quickOperationID(ctx.GuildID), msgID, openapi.RetractMessageOptionHidetip)
+		}
+		return api.RetractMessage(context.TODO(), quickOperationID(ctx.ChannelID), msgID, openapi.RetractMessageOptionHidetip)
+	}
+
+	switch scope {
+	case "group":
+		groupID, err := idmap.RetrieveRowByIDv2(quickOperationID(ctx.GroupID))
+		if err != nil {
+			return err
+		}
+		return api.RetractGroupMessage(context.TODO(), groupID, msgID, openapi.RetractMessageOptionHidetip)
+	case "group_private":
+		userID, err := idmap.RetrieveRowByIDv2(quickOperationID(ctx.UserID))
+		if err != nil {
+			return err
+		}
+		return api.RetractC2CMessage(context.TODO(), userID, msgID, openapi.RetractMessageOptionHidetip)
+	case "guild":
+		channelID, err := idmap.RetrieveRowByIDv2(quickOperationID(ctx.GroupID))
+		if err != nil {
+			return err
+		}
+		return api.RetractMessage(context.TODO(), channelID, msgID, openapi.RetractMessageOptionHidetip)
+	case "guild_private":
+		guildID, _, err := getGuildIDFromMessage(callapi.ActionMessage{Params: callapi.ParamsContent{UserID: quickOperationID(ctx.UserID)}})
+		if err != nil {
+			return err
+		}
+		return api.RetractDMMessage(context.TODO(), guildID, msgID, openapi.RetractMessageOptionHidetip)
+	}
+	return fmt.Errorf("delete is not supported for %s messages", scope)
+}
+
+// quickGuildMember 还原频道场景下的guild_id和真实user_id,其他场景返回空
+func quickGuildMember(ctx callapi.Context) (string, string, error) {
+	var guildID string
+	switch {
+	case ctx.MessageType == "guild" && ctx.RealMessageType != "guild_private":
+		guildID = quickOperationID(ctx.GuildID)
+	case ctx.MessageType == "group" && quickMessageScope(ctx) == "guild":
+		var err error
+		guildID, err = idmap.ReadConfigv2(quickOperationID(ctx.GroupID), "guild_id")
+		if err != nil {
+			return "", "", err
+		}
 	default:
-		return nil // 或处理其他类型消息的逻辑
+		return "", "", nil
+	}
+	userID, err := idmap.RetrieveRowByIDv2(quickOperationID(ctx.UserID))
+	if err != nil {
+		return "", "", err
+	}
+	return guildID, userID, nil
+}
+
+// quickKickSender 踢出发送者 目前只有频道开放了该能力
+func quickKickSender(api openapi.OpenAPI, ctx callapi.Context) error {
+	guildID, userID, err := quickGuildMember(ctx)
+	if err != nil {
+		return err
+	}
+	if guildID == "" {
+		return fmt.Errorf("kick is not supported for %s messages", quickMessageScope(ctx))
+	}
+	return api.DeleteGuildMember(context.TODO(), guildID, userID)
+}
+
+// quickBanSender 禁言发送者 目前只有频道开放了该能力
+func quickBanSender(api openapi.OpenAPI, ctx callapi.Context, duration int) error {
+	if duration <= 0 {
+		duration = defaultQuickBanDuration
+	}
+	guildID, userID, err := quickGuildMember(ctx)
+	if err != nil {
+		return err
+	}
+	if guildID == "" {
+		return fmt.Errorf("ban is not supported for %s messages", quickMessageScope(ctx))
+	}
+	mute := &dto.UpdateGuildMute{
+		MuteSeconds: strconv.Itoa(duration),
+		UserIDs:     []string{userID},
+	}
+	return api.MemberMute(context.TODO(), guildID, userID, mute)
+}
+
+// quickHandleRequest 同意或拒绝请求 交给set_group_add_request/set_friend_add_request处理
+func quickHandleRequest(api openapi.OpenAPI, apiv2 openapi.OpenAPI, ctx callapi.Context, op callapi.Operation) error {
+	if op.Approve == nil {
+		return nil
+	}
+	action := "set_" + ctx.RequestType + "_add_request"
+	handler, ok := callapi.GetHandler(action)
+	if !ok {
+		return fmt.Errorf("暂不支持处理%s请求", ctx.RequestType)
+	}
+	capture := &captureClient{}
+	handler(capture, api, apiv2, callapi.ActionMessage{
+		Action: action,
+		Params: callapi.ParamsContent{
+			GroupID: quickOperationID(ctx.GroupID),
+			UserID:  quickOperationID(ctx.UserID),
+			Flag:    ctx.Flag,
+			SubType: ctx.SubType,
+			Approve: op.Approve,
+			Remark:  op.Remark,
+			Reason:  op.Reason,
+		},
+	})
+	return capture.err()
+}
+
+// quickOperationID 事件中的id可能是数字或字符串,统一转为字符串
+func quickOperationID(id interface{}) string {
+	switch v := id.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
 	}
+	return ""
 }
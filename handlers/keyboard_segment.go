@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/markdown"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/dto/keyboard"
+)
+
+// [CQ:keyboard,id=按钮模板id] 或 [CQ:keyboard,data=base64://json]
+var keyboardPattern = regexp.MustCompile(`\[CQ:keyboard,(id|data)=([^\]]+)\]`)
+
+// 纯数字的按钮权限用户视为虚拟user_id
+var numericIDPattern = regexp.MustCompile(`^\d+$`)
+
+// keyboardSegment 解析keyboard段 data中直接写按钮,或在data.data中给出json/base64://
+// 得到的按钮经过校验,未通过时返回全部问题,整条信息不发送 回调按钮记录发出它的应用端和目标
+func keyboardSegment(data map[string]interface{}, message callapi.ActionMessage, client callapi.Client) (string, error) {
+	var raw []byte
+	var err error
+	switch v := data["data"].(type) {
+	case string:
+		if strings.HasPrefix(v, "base64://") {
+			raw, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(v, "base64://"))
+		} else {
+			raw = []byte(cqUnescaper.Replace(v))
+		}
+	case map[string]interface{}:
+		raw, err = json.Marshal(v)
+	default:
+		raw, err = json.Marshal(data)
+	}
+	if err != nil {
+		return "", fmt.Errorf("keyboard: %v", err)
+	}
+
+	kb, err := markdown.ParseKeyboard(raw)
+	if err != nil {
+		return "", err
+	}
+	resolveKeyboardUsers(kb)
+	registerKeyboardRoutes(kb, message, client)
+
+	kbBytes, err := json.Marshal(kb)
+	if err != nil {
+		return "", fmt.Errorf("keyboard: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(kbBytes), nil
+}
+
+// keyboardCQ 解析cq码形式的keyboard段
+func keyboardCQ(key, value string, message callapi.ActionMessage, client callapi.Client) (string, error) {
+	if key == "id" {
+		return keyboardSegment(map[string]interface{}{"id": cqUnescaper.Replace(value)}, message, client)
+	}
+	return keyboardSegment(map[string]interface{}{"data": value}, message, client)
+}
+
+// resolveKeyboardUsers 指定用户可操作的按钮 虚拟user_id还原为真实id
+func resolveKeyboardUsers(kb *keyboard.MessageKeyboard) {
+	if kb.Content == nil {
+		return
+	}
+	for _, row := range kb.Content.Rows {
+		for _, button := range row.Buttons {
+			if button.Action == nil || button.Action.Permission == nil {
+				continue
+			}
+			ids := button.Action.Permission.SpecifyUserIDs
+			for i, id := range ids {
+				if !numericIDPattern.MatchString(id) {
+					continue
+				}
+				if realID, err := idmap.RetrieveRowByIDv2(id); err == nil {
+					ids[i] = realID
+				}
+			}
+		}
+	}
+}
+
+// registerKeyboardRoutes 回调按钮被点击时,回调只发给在同一个目标中发出它的应用端
+func registerKeyboardRoutes(kb *keyboard.MessageKeyboard, message callapi.ActionMessage, client callapi.Client) {
+	if client == nil || kb.Content == nil {
+		return
+	}
+	target := ""
+	for _, row := range kb.Content.Rows {
+		for _, button := range row.Buttons {
+			if button.Action == nil || button.Action.Type != keyboard.ActionTypeCallback {
+				continue
+			}
+			if target == "" {
+				if target = buttonTarget(message); target == "" {
+					return
+				}
+			}
+			callapi.RegisterButtonRoute(target, button.Action.Data, client)
+		}
+	}
+}
+
+// buttonTarget 信息发往的真实群、频道或用户id 与按钮回调事件中的目标对应
+func buttonTarget(message callapi.ActionMessage) string {
+	groupID, channelID, userID := paramString(message.Params.GroupID), paramString(message.Params.ChannelID), paramString(message.Params.UserID)
+	switch {
+	case strings.Contains(message.Action, "private"):
+		return realTargetID(userID, "")
+	case groupID != "":
+		return realTargetID(groupID, userID)
+	case channelID != "":
+		return realTargetID(channelID, userID)
+	default:
+		return realTargetID(userID, "")
+	}
+}
+
+// realTargetID 虚拟id还原为真实id 已经是真实id时原样返回
+func realTargetID(id, userID string) string {
+	if id == "" || id == "0" {
+		return ""
+	}
+	if config.GetIdmapPro() && userID != "" && userID != "0" {
+		if realID, _, err := idmap.RetrieveRowByIDv2Pro(id, userID); err == nil && realID != "" {
+			return realID
+		}
+	}
+	if realID, err := idmap.RetrieveRowByIDv2(id); err == nil && realID != "" {
+		return realID
+	}
+	return id
+}
+
+// attachKeyboard 把keyboard段合并到markdown中 平台只允许按钮随md发送
+// 没有markdown段时,文本作为原生markdown发送
+func attachKeyboard(messageText string, foundItems map[string][]string) string {
+	kbItems := foundItems["keyboard"]
+	if len(kbItems) == 0 {
+		return messageText
+	}
+	delete(foundItems, "keyboard")
+	kbBytes, err := base64.StdEncoding.DecodeString(kbItems[0])
+	if err != nil {
+		mylog.Printf("Error decoding keyboard: %v", err)
+		return messageText
+	}
+
+	mdData := make(map[string]json.RawMessage)
+	if mdItems := foundItems["markdown"]; len(mdItems) > 0 {
+		mdBytes, err := base64.StdEncoding.DecodeString(mdItems[0])
+		if err == nil {
+			err = json.Unmarshal(mdBytes, &mdData)
+		}
+		if err != nil {
+			mylog.Printf("Error decoding markdown for keyboard: %v", err)
+			return messageText
+		}
+	} else {
+		content, _ := json.Marshal(map[string]string{"content": messageText})
+		mdData["markdown"] = content
+		messageText = ""
+	}
+	mdData["keyboard"] = kbBytes
+
+	mdBytes, err := json.Marshal(mdData)
+	if err != nil {
+		mylog.Printf("Error marshaling markdown with keyboard: %v", err)
+		return messageText
+	}
+	encoded := base64.StdEncoding.EncodeToString(mdBytes)
+	if len(foundItems["markdown"]) > 0 {
+		foundItems["markdown"][0] = encoded
+	} else {
+		foundItems["markdown"] = []string{encoded}
+	}
+	return messageText
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+)
+
+// [CQ:markdown,template=名称,变量=值,...]
+var mdTemplatePattern = regexp.MustCompile(`\[CQ:markdown,template=([^\]]+)\]`)
+
+// cq码参数中的转义
+var cqUnescaper = strings.NewReplacer("&#44;", ",", "&#91;", "[", "&#93;", "]", "&amp;", "&")
+
+// markdownTemplateSegment 具名模板形式的markdown段,转换为parseMDData使用的base64数据
+// data为 {"template":"名称","vars":{...}} 或把变量直接写在data中 {"template":"名称","city":"北京"}
+func markdownTemplateSegment(data map[string]interface{}) (string, bool) {
+	name, ok := data["template"].(string)
+	if !ok || name == "" {
+		return "", false
+	}
+	vars, ok := data["vars"].(map[string]interface{})
+	if !ok {
+		vars = make(map[string]interface{})
+		for key, v := range data {
+			if key != "template" && key != "keyboard" {
+				vars[key] = v
+			}
+		}
+	}
+	mdData := map[string]interface{}{
+		"markdown": map[string]interface{}{"template": name, "vars": vars},
+	}
+	if kb, ok := data["keyboard"]; ok {
+		mdData["keyboard"] = kb
+	}
+	mdBytes, err := json.Marshal(mdData)
+	if err != nil {
+		mylog.Printf("Error marshaling markdown template segment: %v", err)
+		return "", false
+	}
+	return base64.StdEncoding.EncodeToString(mdBytes), true
+}
+
+// markdownTemplateCQ 解析cq码 template=之后的 名称,变量=值,...
+func markdownTemplateCQ(params string) (string, bool) {
+	parts := strings.Split(params, ",")
+	data := map[string]interface{}{"template": cqUnescaper.Replace(parts[0])}
+	vars := make(map[string]interface{})
+	for _, part := range parts[1:] {
+		key, value, found := strings.Cut(part, "=")
+		if !found || key == "" {
+			mylog.Printf("Error: markdown template param %q is not key=value", part)
+			continue
+		}
+		vars[key] = cqUnescaper.Replace(value)
+	}
+	data["vars"] = vars
+	return markdownTemplateSegment(data)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+)
+
+// 审核结果一般在几分钟内推送 超时的记录会被清理
+const pendingAuditTTL = 30 * time.Minute
+
+var auditIDPattern = regexp.MustCompile(`"audit_id"\s*:\s*"([^"]+)"`)
+
+// PendingAudit 发送后进入审核的信息
+type PendingAudit struct {
+	AuditID   string
+	GroupID   string // 发送时的group_id 应用端的虚拟值或已还原的真实id
+	ChannelID string // 真实子频道id
+	GuildID   string // 频道私信的guild_id
+	UserID    string // 发送时的user_id 应用端的虚拟值或真实openid
+	Time      time.Time
+}
+
+var (
+	pendingAudits   = make(map[string]PendingAudit)
+	pendingAuditsMu sync.Mutex
+)
+
+// TrackAudit 从发送失败的错误中取出audit_id并记录 不是审核中时返回空
+func TrackAudit(err error, audit PendingAudit) string {
+	if err == nil {
+		return ""
+	}
+	match := auditIDPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return ""
+	}
+	audit.AuditID = match[1]
+	audit.Time = time.Now()
+
+	pendingAuditsMu.Lock()
+	defer pendingAuditsMu.Unlock()
+	for id, a := range pendingAudits {
+		if time.Since(a.Time) > pendingAuditTTL {
+			delete(pendingAudits, id)
+		}
+	}
+	pendingAudits[audit.AuditID] = audit
+	return audit.AuditID
+}
+
+// ResolveAudit 取出并移除审核记录
+func ResolveAudit(auditID string) (PendingAudit, bool) {
+	pendingAuditsMu.Lock()
+	defer pendingAuditsMu.Unlock()
+	audit, ok := pendingAudits[auditID]
+	delete(pendingAudits, auditID)
+	return audit, ok
+}
+
+// auditOf 由发送请求的参数生成审核记录 id保持发送时的原样,上报时用AuditReportID转换
+func auditOf(message *callapi.ActionMessage) PendingAudit {
+	var audit PendingAudit
+	audit.GroupID, _ = message.Params.GroupID.(string)
+	audit.ChannelID, _ = message.Params.ChannelID.(string)
+	audit.GuildID, _ = message.Params.GuildID.(string)
+	audit.UserID, _ = message.Params.UserID.(string)
+	return audit
+}
+
+// AuditReportID 审核记录中的id转为上报的虚拟值 已是虚拟值的直接使用,不写入映射
+func AuditReportID(id string) (int64, bool) {
+	if id == "" {
+		return 0, false
+	}
+	if virtualID, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return virtualID, true
+	}
+	// 真实id在发送时已经有映射
+	_, virtualID, err := idmap.RetrieveVirtualValuev2(id)
+	if err != nil {
+		return 0, false
+	}
+	virtualID64, err := strconv.ParseInt(virtualID, 10, 64)
+	return virtualID64, err == nil
+}
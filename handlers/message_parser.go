@@ -24,6 +24,7 @@ import (
 	"github.com/hoshinonyaruko/gensokyo/echo"
 	"github.com/hoshinonyaruko/gensokyo/idmap"
 	"github.com/hoshinonyaruko/gensokyo/images"
+	"github.com/hoshinonyaruko/gensokyo/markdown"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
 	"github.com/hoshinonyaruko/gensokyo/structs"
 	"github.com/hoshinonyaruko/gensokyo/url"
@@ -41,7 +42,8 @@ var AppID string
 // 定义响应结构体
 type ServerResponse struct {
 	Data struct {
-		MessageID int `json:"message_id"`
+		MessageID int    `json:"message_id"`
+		AuditID   string `json:"audit_id,omitempty"` //信息进入审核时的审核id 审核结果以message_audit通知上报
 	} `json:"data"`
 	Message   string      `json:"message"`
 	GroupID   int64       `json:"group_id,omitempty"`
@@ -57,6 +59,7 @@ type ServerResponse struct {
 type ServerResponseSB struct {
 	Data struct {
 		MessageID string `json:"message_id"`
+		AuditID   string `json:"audit_id,omitempty"`
 	} `json:"data"`
 	Message   string      `json:"message"`
 	GroupID   string      `json:"group_id,omitempty"`
@@ -174,6 +177,12 @@ func SendResponse(client callapi.Client, err error, message *callapi.ActionMessa
 				return "", nil
 			}
 		}
+		// 记录信息来源,撤回时只需要message_id
+		if groupID, ok := message.Params.GroupID.(string); ok && groupID != "" {
+			idmap.StoreMessageScope(resp.Message.ID, idmap.MessageScope{Type: idmap.ScopeGroup, TargetID: groupID, BotSent: true})
+		} else if userID, ok := message.Params.UserID.(string); ok && userID != "" {
+			idmap.StoreMessageScope(resp.Message.ID, idmap.MessageScope{Type: idmap.ScopeGroupPrivate, TargetID: userID, BotSent: true})
+		}
 
 		response.Data.MessageID = int(messageID64)
 		// 发送成功 增加今日发信息数
@@ -238,6 +247,7 @@ func SendResponse(client callapi.Client, err error, message *callapi.ActionMessa
 		//response.Status = "failed"
 		response.RetCode = 0 //官方api审核异步的 审核中默认返回失败,但其实信息发送成功了
 		response.Status = "ok"
+		response.Data.AuditID = TrackAudit(err, auditOf(message))
 	} else {
 		response.Message = ""
 		response.RetCode = 0
@@ -284,6 +294,7 @@ func SendResponseSB(client callapi.Client, err error, message *callapi.ActionMes
 		//response.Status = "failed"
 		response.RetCode = 0 //官方api审核异步的 审核中默认返回失败,但其实信息发送成功了
 		response.Status = "ok"
+		response.Data.AuditID = TrackAudit(err, auditOf(message))
 	} else {
 		response.Message = ""
 		response.RetCode = 0
@@ -329,6 +340,10 @@ func SendGuildResponse(client callapi.Client, err error, message *callapi.Action
 				return "", nil
 			}
 		}
+		// 记录信息来源,撤回时只需要message_id
+		if channelID, ok := message.Params.ChannelID.(string); ok && channelID != "" {
+			idmap.StoreMessageScope(resp.ID, idmap.MessageScope{Type: idmap.ScopeGuild, TargetID: channelID, BotSent: true})
+		}
 		response.Data.MessageID = int(messageID64)
 		// 发送成功 增加今日发信息数
 		botstats.RecordMessageSent()
@@ -350,6 +365,7 @@ func SendGuildResponse(client callapi.Client, err error, message *callapi.Action
 		//response.Status = "failed"
 		response.RetCode = 0 //官方api审核异步的 审核中默认返回失败,但其实信息发送成功了
 		response.Status = "ok"
+		response.Data.AuditID = TrackAudit(err, auditOf(message))
 	} else {
 		response.Message = ""
 		response.RetCode = 0
@@ -395,6 +411,10 @@ func SendC2CResponse(client callapi.Client, err error, message *callapi.ActionMe
 				return "", nil
 			}
 		}
+		// 记录信息来源,撤回时只需要message_id
+		if userID, ok := message.Params.UserID.(string); ok && userID != "" {
+			idmap.StoreMessageScope(resp.Message.ID, idmap.MessageScope{Type: idmap.ScopeGroupPrivate, TargetID: userID, BotSent: true})
+		}
 		response.Data.MessageID = int(messageID64)
 		// 发送成功 增加今日发信息数
 		botstats.RecordMessageSent()
@@ -415,6 +435,7 @@ func SendC2CResponse(client callapi.Client, err error, message *callapi.ActionMe
 		//response.Status = "failed"
 		response.RetCode = 0 //官方api审核异步的 审核中默认返回失败,但其实信息发送成功了
 		response.Status = "ok"
+		response.Data.AuditID = TrackAudit(err, auditOf(message))
 	} else {
 		response.Message = ""
 		response.RetCode = 0
@@ -460,6 +481,8 @@ func SendGuildPrivateResponse(client callapi.Client, err error, message *callapi
 				return "", nil
 			}
 		}
+		// 记录信息来源,撤回时只需要message_id
+		idmap.StoreMessageScope(resp.ID, idmap.MessageScope{Type: idmap.ScopeGuildPrivate, TargetID: guildID, BotSent: true})
 		response.Data.MessageID = int(messageID64)
 	} else {
 		// Default ID handling
@@ -473,6 +496,7 @@ func SendGuildPrivateResponse(client callapi.Client, err error, message *callapi
 		//response.Status = "failed"
 		response.RetCode = 0 //官方api审核异步的 审核中默认返回失败,但其实信息发送成功了
 		response.Status = "ok"
+		response.Data.AuditID = TrackAudit(err, PendingAudit{GuildID: guildID})
 	} else {
 		response.Message = ""
 		response.RetCode = 0
@@ -498,11 +522,57 @@ func SendGuildPrivateResponse(client callapi.Client, err error, message *callapi
 	return string(jsonResponse), nil
 }
 
+// 解析段出错时记录在foundItems中的key 有错误时整条信息不发送,回执为失败
+const segmentErrorKey = "segment_error"
+
+// addSegmentError 记录解析段时的错误
+func addSegmentError(foundItems map[string][]string, err error) {
+	foundItems[segmentErrorKey] = append(foundItems[segmentErrorKey], err.Error())
+}
+
+// takeSegmentError 取出解析段时的第一个错误
+func takeSegmentError(foundItems map[string][]string) error {
+	errs := foundItems[segmentErrorKey]
+	delete(foundItems, segmentErrorKey)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(errs[0])
+}
+
+// sendSegmentFailed 有段无法生成时回复失败
+func sendSegmentFailed(client callapi.Client, message callapi.ActionMessage, err error) (string, error) {
+	mylog.Printf("信息中有无法生成的段,不发送: %v", err)
+	return sendFailedResponse(client, message, err.Error())
+}
+
+// sendFailedResponse 未发送信息时的失败回执
+func sendFailedResponse(client callapi.Client, message callapi.ActionMessage, text string) (string, error) {
+	response := ServerResponse{}
+	response.Message = text
+	response.RetCode = 100
+	response.Status = "failed"
+	response.Echo = message.Echo
+
+	outputMap := structToMap(response)
+	jsonResponse, err := json.Marshal(outputMap)
+	if err != nil {
+		return "", err
+	}
+	if err := client.SendMessage(outputMap); err != nil {
+		mylog.Printf("Error sending message via client: %v", err)
+		return "", err
+	}
+	return string(jsonResponse), nil
+}
+
 // 信息处理函数
 func parseMessageContent(paramsMessage callapi.ParamsContent, message callapi.ActionMessage, client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI) (string, map[string][]string) {
 	messageText := ""
 
 	foundItems := make(map[string][]string)
+	// 下面的switch中message指段,按钮路由需要原信息
+	action := message
 
 	switch message := paramsMessage.Message.(type) {
 	case string:
@@ -614,7 +684,9 @@ func parseMessageContent(paramsMessage callapi.ParamsContent, message callapi.Ac
 
 			case "markdown":
 				mdContent, ok := segmentMap["data"].(map[string]interface{})["data"]
-				if ok {
+				if encoded, isTemplate := markdownTemplateSegment(segmentMap["data"].(map[string]interface{})); !ok && isTemplate {
+					foundItems["markdown"] = append(foundItems["markdown"], encoded)
+				} else if ok {
 					var mdContentEncoded string
 					if mdContentMap, isMap := mdContent.(map[string]interface{}); isMap {
 						mdContentBytes, err := json.Marshal(mdContentMap)
@@ -653,6 +725,28 @@ func parseMessageContent(paramsMessage callapi.ParamsContent, message callapi.Ac
 					mylog.Printf("Error: markdown segment data is nil.")
 				}
 
+			case "keyboard":
+				if kbData, ok := segmentMap["data"].(map[string]interface{}); ok {
+					if encoded, err := keyboardSegment(kbData, action, client); err != nil {
+						addSegmentError(foundItems, err)
+					} else {
+						foundItems["keyboard"] = append(foundItems["keyboard"], encoded)
+					}
+				} else {
+					mylog.Printf("Error: keyboard segment data is nil.")
+				}
+
+			case "text2img":
+				if t2iData, ok := segmentMap["data"].(map[string]interface{}); ok {
+					if encoded, err := text2imgSegment(t2iData); err != nil {
+						addSegmentError(foundItems, err)
+					} else {
+						foundItems["base64_image"] = append(foundItems["base64_image"], encoded)
+					}
+				} else {
+					mylog.Printf("Error: text2img segment data is nil.")
+				}
+
 			default:
 				mylog.Printf("Unhandled segment type: %s", segmentType)
 			}
@@ -746,7 +840,9 @@ func parseMessageContent(paramsMessage callapi.ParamsContent, message callapi.Ac
 
 		case "markdown":
 			mdContent, ok := message["data"].(map[string]interface{})["data"]
-			if ok {
+			if encoded, isTemplate := markdownTemplateSegment(message["data"].(map[string]interface{})); !ok && isTemplate {
+				foundItems["markdown"] = append(foundItems["markdown"], encoded)
+			} else if ok {
 				var mdContentEncoded string
 				if mdContentMap, isMap := mdContent.(map[string]interface{}); isMap {
 					mdContentBytes, err := json.Marshal(mdContentMap)
@@ -780,6 +876,28 @@ func parseMessageContent(paramsMessage callapi.ParamsContent, message callapi.Ac
 				mylog.Printf("Error: markdown segment data is nil.")
 			}
 
+		case "keyboard":
+			if kbData, ok := message["data"].(map[string]interface{}); ok {
+				if encoded, err := keyboardSegment(kbData, action, client); err != nil {
+					addSegmentError(foundItems, err)
+				} else {
+					foundItems["keyboard"] = append(foundItems["keyboard"], encoded)
+				}
+			} else {
+				mylog.Printf("Error: keyboard segment data is nil.")
+			}
+
+		case "text2img":
+			if t2iData, ok := message["data"].(map[string]interface{}); ok {
+				if encoded, err := text2imgSegment(t2iData); err != nil {
+					addSegmentError(foundItems, err)
+				} else {
+					foundItems["base64_image"] = append(foundItems["base64_image"], encoded)
+				}
+			} else {
+				mylog.Printf("Error: text2img segment data is nil.")
+			}
+
 		default:
 			mylog.Printf("Unhandled message type: %s", messageType)
 		}
@@ -840,6 +958,32 @@ func parseMessageContent(paramsMessage callapi.ParamsContent, message callapi.Ac
 			{"url_videos", httpsUrlVideoPattern},
 		}
 
+		// 具名md模板
+		for _, match := range mdTemplatePattern.FindAllStringSubmatch(messageText, -1) {
+			if encoded, ok := markdownTemplateCQ(match[1]); ok {
+				foundItems["markdown"] = append(foundItems["markdown"], encoded)
+			}
+		}
+		messageText = mdTemplatePattern.ReplaceAllString(messageText, "")
+		// 按钮
+		for _, match := range keyboardPattern.FindAllStringSubmatch(messageText, -1) {
+			if encoded, err := keyboardCQ(match[1], match[2], action, client); err != nil {
+				addSegmentError(foundItems, err)
+			} else {
+				foundItems["keyboard"] = append(foundItems["keyboard"], encoded)
+			}
+		}
+		messageText = keyboardPattern.ReplaceAllString(messageText, "")
+		// 文字转图片
+		for _, match := range text2imgPattern.FindAllStringSubmatch(messageText, -1) {
+			if encoded, err := text2imgCQ(match[1]); err != nil {
+				addSegmentError(foundItems, err)
+			} else {
+				foundItems["base64_image"] = append(foundItems["base64_image"], encoded)
+			}
+		}
+		messageText = text2imgPattern.ReplaceAllString(messageText, "")
+
 		for _, pattern := range patterns {
 			matches := pattern.pattern.FindAllStringSubmatch(messageText, -1)
 			for _, match := range matches {
@@ -852,9 +996,17 @@ func parseMessageContent(paramsMessage callapi.ParamsContent, message callapi.Ac
 		}
 	}
 
+	// 超长或含有链接的文本转为图片
+	if !text2imgSkipActions[message.Action] {
+		messageText = autoText2img(messageText, foundItems)
+	}
+
 	//最后再处理Url
 	messageText = transformMessageTextUrl(messageText, message, client, api, apiv2)
 
+	// 按钮随markdown发送
+	messageText = attachKeyboard(messageText, foundItems)
+
 	// for key, items := range foundItems {
 	// 	fmt.Printf("Key: %s, Items: %v\n", key, items)
 	// }
@@ -1142,11 +1294,8 @@ func RevertTransformedText(data interface{}, msgtype string, api openapi.OpenAPI
 		if !bypass {
 			// 获取白名单数组
 			whitePrefixes := config.GetWhitePrefixs()
-			// 加锁以安全地读取 TemporaryCommands
-			idmap.MutexT.Lock()
-			temporaryCommands := make([]string, len(idmap.TemporaryCommands))
-			copy(temporaryCommands, idmap.TemporaryCommands)
-			idmap.MutexT.Unlock()
+			// 有效的一次性指令码
+			temporaryCommands := idmap.ActiveOneTimeCodes()
 
 			// 合并白名单和临时指令
 			allPrefixes := append(whitePrefixes, temporaryCommands...)
@@ -1254,10 +1403,7 @@ func RevertTransformedText(data interface{}, msgtype string, api openapi.OpenAPI
 		// 如果vgid不在白名单例外数组中，则应用白名单过滤
 		if !bypass {
 			allPrefixes := matchedPrefix.WhiteList
-			idmap.MutexT.Lock()
-			temporaryCommands := make([]string, len(idmap.TemporaryCommands))
-			copy(temporaryCommands, idmap.TemporaryCommands)
-			idmap.MutexT.Unlock()
+			temporaryCommands := idmap.ActiveOneTimeCodes()
 
 			// 合并虚拟前缀的白名单和临时指令
 			allPrefixes = append(allPrefixes, temporaryCommands...)
@@ -1349,6 +1495,10 @@ func RevertTransformedText(data interface{}, msgtype string, api openapi.OpenAPI
 
 			imageCQ := "[CQ:image,file=" + md5name + ".image,subType=0,url=" + url + "]"
 			messageText += imageCQ
+		} else if isVoiceAttachment(attachment) {
+			// 处理语音附件
+			file, url := voiceRecordData(attachment)
+			messageText += "[CQ:record,file=" + file + ",url=" + url + "]"
 		}
 	}
 	//mylog.Printf("6[%v]", messageText)
@@ -1392,6 +1542,13 @@ func ConvertToSegmentedMessage(data interface{}) []map[string]interface{} {
 		msg = (*dto.Message)(v)
 	case *dto.WSC2CMessageData:
 		msg = (*dto.Message)(v)
+	case *dto.WSThreadData:
+		// 帖子内容为富文本
+		segments, _, err := ParseForumContent(v.ThreadInfo.Content)
+		if err != nil {
+			mylog.Printf("Error parseContent Forum: %v", err)
+		}
+		return segments
 	default:
 		mylog.Printf("类型断言出错类型断言出错类型断言出错类型断言出错\n")
 		return nil
@@ -1403,8 +1560,20 @@ func ConvertToSegmentedMessage(data interface{}) []map[string]interface{} {
 	}
 	var messageSegments []map[string]interface{}
 
-	// 处理Attachments字段来构建图片消息
+	// 处理Attachments字段来构建图片和语音消息
 	for _, attachment := range msg.Attachments {
+		if isVoiceAttachment(attachment) {
+			file, url := voiceRecordData(attachment)
+			recordSegment := map[string]interface{}{
+				"type": "record",
+				"data": map[string]interface{}{
+					"file": file,
+					"url":  url,
+				},
+			}
+			messageSegments = append(messageSegments, recordSegment)
+			continue
+		}
 		imageFileMD5 := attachment.FileName
 		for _, ext := range []string{"{", "}", ".png", ".jpg", ".gif", "-"} {
 			imageFileMD5 = strings.ReplaceAll(imageFileMD5, ext, "")
@@ -1522,7 +1691,7 @@ func ConvertToInt64(value interface{}) (int64, error) {
 
 // 排列MessageSegments
 func sortMessageSegments(segments []map[string]interface{}) []map[string]interface{} {
-	var atSegments, textSegments, imageSegments []map[string]interface{}
+	var atSegments, textSegments, imageSegments, recordSegments []map[string]interface{}
 
 	for _, segment := range segments {
 		switch segment["type"] {
@@ -1532,11 +1701,13 @@ func sortMessageSegments(segments []map[string]interface{}) []map[string]interfa
 			textSegments = append(textSegments, segment)
 		case "image":
 			imageSegments = append(imageSegments, segment)
+		case "record":
+			recordSegments = append(recordSegments, segment)
 		}
 	}
 
 	// 按照指定的顺序合并这些切片
-	return append(append(atSegments, textSegments...), imageSegments...)
+	return append(append(append(atSegments, textSegments...), imageSegments...), recordSegments...)
 }
 
 // SendMessage 发送消息根据不同的类型
@@ -1632,9 +1803,11 @@ func parseMDData(mdData []byte) (*dto.Markdown, *keyboard.MessageKeyboard, error
 	// 定义一个用于解析 JSON 的临时结构体
 	var temp struct {
 		Markdown struct {
-			CustomTemplateID *string               `json:"custom_template_id,omitempty"`
-			Params           []*dto.MarkdownParams `json:"params,omitempty"`
-			Content          string                `json:"content,omitempty"`
+			CustomTemplateID *string                `json:"custom_template_id,omitempty"`
+			Params           []*dto.MarkdownParams  `json:"params,omitempty"`
+			Content          string                 `json:"content,omitempty"`
+			Template         string                 `json:"template,omitempty"`
+			Vars             map[string]interface{} `json:"vars,omitempty"`
 		} `json:"markdown,omitempty"`
 		Keyboard struct {
 			ID      string                   `json:"id,omitempty"`
@@ -1650,7 +1823,15 @@ func parseMDData(mdData []byte) (*dto.Markdown, *keyboard.MessageKeyboard, error
 
 	// 处理 Markdown
 	var md *dto.Markdown
-	if temp.Markdown.CustomTemplateID != nil {
+	var templateKeyboardID string
+	if temp.Markdown.Template != "" {
+		// 处理具名模板 Markdown
+		var err error
+		md, templateKeyboardID, err = markdown.Build(temp.Markdown.Template, temp.Markdown.Vars)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if temp.Markdown.CustomTemplateID != nil {
 		// 处理模板 Markdown
 		md = &dto.Markdown{
 			CustomTemplateID: *temp.Markdown.CustomTemplateID,
@@ -1682,6 +1863,18 @@ func parseMDData(mdData []byte) (*dto.Markdown, *keyboard.MessageKeyboard, error
 		kb = &keyboard.MessageKeyboard{
 			ID: temp.Keyboard.ID,
 		}
+	} else if templateKeyboardID != "" {
+		// 具名模板绑定的按钮
+		kb = &keyboard.MessageKeyboard{
+			ID: templateKeyboardID,
+		}
+	}
+
+	// 在本地按平台规则校验,避免只得到平台的错误码
+	if md != nil && config.GetMarkdownValidate() {
+		if err := markdown.Validate(md); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	return md, kb, nil
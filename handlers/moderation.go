@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/moderation"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+)
+
+// 审核时下载url图片的最大大小
+const maxModerationImageSize = 10 * 1024 * 1024
+
+var moderationHttpClient = &http.Client{Timeout: 10 * time.Second}
+
+// moderateOutgoing 发送前审核文本和图片
+// 返回处理后的文本和媒体,blocked不为nil时整条信息不发送
+func moderateOutgoing(messageText string, foundItems map[string][]string, messageType string, targetID interface{}) (string, map[string][]string, *moderation.Decision) {
+	if !moderation.Enabled() {
+		return messageText, foundItems, nil
+	}
+	ctx := context.Background()
+	scene := moderation.Scene{MessageType: messageType, TargetID: fmt.Sprint(targetID)}
+
+	d := moderation.CheckText(ctx, messageText, scene)
+	if d.Action == moderation.ActionBlock {
+		return "", nil, &d
+	}
+	if d.Action != moderation.ActionPass {
+		messageText = d.Replacement
+	}
+
+	result := make(map[string][]string, len(foundItems))
+	for key, items := range foundItems {
+		if !isModeratedImageKey(key) {
+			result[key] = append(result[key], items...)
+			continue
+		}
+		for _, item := range items {
+			imageURL, data := moderationImageSource(key, item)
+			d := moderation.CheckImage(ctx, imageURL, data, scene)
+			switch d.Action {
+			case moderation.ActionPass:
+				result[key] = append(result[key], item)
+			case moderation.ActionBlock:
+				return "", nil, &d
+			case moderation.ActionBlur:
+				blurred, err := blurModeratedImage(imageURL, data)
+				if err != nil {
+					// 无法模糊时宁可去掉图片
+					mylog.Printf("模糊图片失败,已移除该图片: %v", err)
+					continue
+				}
+				result["base64_image"] = append(result["base64_image"], base64.StdEncoding.EncodeToString(blurred))
+			case moderation.ActionReplace:
+				// 没有替换图片时直接去掉
+				switch {
+				case strings.HasPrefix(d.Replacement, "http://"):
+					result["url_image"] = append(result["url_image"], strings.TrimPrefix(d.Replacement, "http://"))
+				case strings.HasPrefix(d.Replacement, "https://"):
+					result["url_images"] = append(result["url_images"], strings.TrimPrefix(d.Replacement, "https://"))
+				}
+			}
+		}
+	}
+	return messageText, result, nil
+}
+
+// isModeratedImageKey foundItems中需要审核的图片类型
+func isModeratedImageKey(key string) bool {
+	switch key {
+	case "base64_image", "url_image", "url_images", "local_image":
+		return true
+	}
+	return false
+}
+
+// moderationImageSource 还原图片的url或数据 url图片只传url,由审核方自行获取
+func moderationImageSource(key, item string) (string, []byte) {
+	switch key {
+	case "base64_image":
+		data, err := base64.StdEncoding.DecodeString(item)
+		if err != nil {
+			mylog.Printf("审核时解码base64图片失败: %v", err)
+		}
+		return "", data
+	case "url_image":
+		return "http://" + item, nil
+	case "url_images":
+		return "https://" + item, nil
+	case "local_image":
+		data, err := os.ReadFile(item)
+		if err != nil {
+			mylog.Printf("审核时读取本地图片失败: %v", err)
+		}
+		return "", data
+	}
+	return "", nil
+}
+
+// blurModeratedImage 模糊图片 url图片先下载
+func blurModeratedImage(imageURL string, data []byte) ([]byte, error) {
+	if data == nil && imageURL != "" {
+		resp, err := moderationHttpClient.Get(imageURL)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("download image failed, status: %d", resp.StatusCode)
+		}
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxModerationImageSize))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return moderation.BlurImage(data)
+}
+
+// sendModerationBlocked 信息被审核拦截时向应用端返回失败回执
+func sendModerationBlocked(client callapi.Client, message callapi.ActionMessage, d *moderation.Decision) (string, error) {
+	mylog.Printf("信息被%s审核拦截: %s", d.Provider, d.Reason)
+	return sendFailedResponse(client, message, "blocked by moderation: "+d.Reason)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"strconv"
 
 	"github.com/hoshinonyaruko/gensokyo/callapi"
 	"github.com/hoshinonyaruko/gensokyo/config"
@@ -28,10 +29,14 @@ func init() {
 
 func HandlePutInteraction(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
 
-	// 解析 ActionMessage 中的 Echo 字段获取 interactionID
-	interactionID, ok := message.Echo.(string)
-	if !ok {
-		return "", fmt.Errorf("echo is not a string")
+	// 优先使用interaction_id参数,兼容从 ActionMessage 中的 Echo 字段获取 interactionID
+	interactionID := paramString(message.Params.InteractionID)
+	if interactionID == "" {
+		echoID, ok := message.Echo.(string)
+		if !ok {
+			return "", fmt.Errorf("interaction_id is required")
+		}
+		interactionID = echoID
 	}
 
 	// 检查字符串是否仅包含数字 将数字形式的interactionID转换为真实的形式
@@ -58,9 +63,13 @@ func HandlePutInteraction(client callapi.Client, api openapi.OpenAPI, apiv2 open
 		}
 	}
 
-	// 根据 PostType 解析出 code 的值
+	// 根据 code 参数或 PostType 解析出 code 的值
+	postType := message.PostType
+	if message.Params.Code != nil {
+		postType = strconv.Itoa(*message.Params.Code)
+	}
 	var code int
-	switch message.PostType {
+	switch postType {
 	case "0":
 		code = 0 // 成功
 	case "1":
@@ -75,7 +84,7 @@ func HandlePutInteraction(client callapi.Client, api openapi.OpenAPI, apiv2 open
 		code = 5 // 仅管理员操作
 	default:
 		// 如果 PostType 不在预期范围内，可以设置一个默认值或返回错误
-		return "", fmt.Errorf("invalid post type: %s", message.PostType)
+		return "", fmt.Errorf("invalid code: %s", postType)
 	}
 
 	// 构造请求体，包括 code
@@ -32,6 +32,10 @@ func init() {
 }
 
 func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	// 超长文本分段发送
+	if retmsg, ok, err := sendSplit(client, api, apiv2, message, HandleSendGroupMsg); ok {
+		return retmsg, err
+	}
 	// 使用 message.Echo 作为key来获取消息类型
 	var msgType string
 	if echoStr, ok := message.Echo.(string); ok {
@@ -136,12 +140,21 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 	case "group":
 		// 解析消息内容
 		messageText, foundItems := parseMessageContent(message.Params, message, client, api, apiv2)
+		// 无法生成的段 整条信息不发送
+		if err := takeSegmentError(foundItems); err != nil {
+			return sendSegmentFailed(client, message, err)
+		}
+		// 发送前审核
+		messageText, foundItems, blocked := moderateOutgoing(messageText, foundItems, "group", message.Params.GroupID)
+		if blocked != nil {
+			return sendModerationBlocked(client, message, blocked)
+		}
 		var SSM bool
-		// 使用 echo 获取消息ID
-		var messageID string
+		// 使用 echo 获取消息ID 快速操作优先被动回复触发它的信息
+		messageID := replyMessageID(message)
 		// EventID
 		var eventID string
-		if config.GetLazyMessageId() {
+		if messageID == "" && config.GetLazyMessageId() {
 			//由于实现了Params的自定义unmarshell 所以可以类型安全的断言为string
 			messageID = echo.GetLazyMessagesId(message.Params.GroupID.(string))
 			mylog.Printf("GetLazyMessagesId: %v", messageID)
@@ -387,8 +400,12 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 			if !config.GetNoRetMsg() {
 				if config.GetThreadsRetMsg() {
 					if !config.GetStringOb11() {
+						expectAsyncReceipt(client)
+
 						go SendResponse(client, err, &message, resp, api, apiv2)
 					} else {
+						expectAsyncReceipt(client)
+
 						go SendResponseSB(client, err, &message, resp, api, apiv2)
 					}
 				} else {
@@ -459,8 +476,12 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 				//发送成功回执
 				if config.GetThreadsRetMsg() {
 					if !config.GetStringOb11() {
+						expectAsyncReceipt(client)
+
 						go SendResponse(client, err, &message, resp, api, apiv2)
 					} else {
+						expectAsyncReceipt(client)
+
 						go SendResponseSB(client, err, &message, resp, api, apiv2)
 					}
 
@@ -547,8 +568,12 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 							//发送成功回执
 							if config.GetThreadsRetMsg() {
 								if !config.GetStringOb11() {
+									expectAsyncReceipt(client)
+
 									go SendResponse(client, err, &message, resp, api, apiv2)
 								} else {
+									expectAsyncReceipt(client)
+
 									go SendResponseSB(client, err, &message, resp, api, apiv2)
 								}
 
@@ -654,8 +679,12 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 					//发送成功回执
 					if config.GetThreadsRetMsg() {
 						if !config.GetStringOb11() {
+							expectAsyncReceipt(client)
+
 							go SendResponse(client, err, &message, resp, api, apiv2)
 						} else {
+							expectAsyncReceipt(client)
+
 							go SendResponseSB(client, err, &message, resp, api, apiv2)
 						}
 
@@ -863,7 +892,7 @@ func generateGroupMessage(id string, eventid string, foundItems map[string][]str
 		if !silk.IsAMRorSILK(RecordData) {
 			mt, ok := silk.CheckAudio(bytes.NewReader(RecordData))
 			if !ok {
-				mylog.Errorf("voice type error: " + mt)
+				mylog.Errorf("voice type error: %s", mt)
 				return nil
 			}
 			RecordData = silk.EncoderSilk(RecordData)
@@ -1082,7 +1111,7 @@ func generateGroupMessage(id string, eventid string, foundItems map[string][]str
 			if !silk.IsAMRorSILK(fileRecordData) {
 				mt, ok := silk.CheckAudio(bytes.NewReader(fileRecordData))
 				if !ok {
-					mylog.Errorf("voice type error: " + mt)
+					mylog.Errorf("voice type error: %s", mt)
 					return nil
 				}
 				fileRecordData = silk.EncoderSilk(fileRecordData)
@@ -1149,7 +1178,7 @@ func generateGroupMessage(id string, eventid string, foundItems map[string][]str
 		if !silk.IsAMRorSILK(recordData) {
 			mt, ok := silk.CheckAudio(bytes.NewReader(recordData))
 			if !ok {
-				mylog.Errorf("voice type error: " + mt)
+				mylog.Errorf("voice type error: %s", mt)
 				return nil
 			}
 			recordData = silk.EncoderSilk(recordData)
@@ -1210,7 +1239,7 @@ func generateGroupMessage(id string, eventid string, foundItems map[string][]str
 		if !silk.IsAMRorSILK(recordData) {
 			mt, ok := silk.CheckAudio(bytes.NewReader(recordData))
 			if !ok {
-				mylog.Errorf("voice type error: " + mt)
+				mylog.Errorf("voice type error: %s", mt)
 				return nil
 			}
 			recordData = silk.EncoderSilk(recordData)
@@ -1467,7 +1496,7 @@ func generatePrivateMessage(id string, eventid string, foundItems map[string][]s
 		if !silk.IsAMRorSILK(RecordData) {
 			mt, ok := silk.CheckAudio(bytes.NewReader(RecordData))
 			if !ok {
-				mylog.Errorf("voice type error: " + mt)
+				mylog.Errorf("voice type error: %s", mt)
 				return nil
 			}
 			RecordData = silk.EncoderSilk(RecordData)
@@ -1686,7 +1715,7 @@ func generatePrivateMessage(id string, eventid string, foundItems map[string][]s
 			if !silk.IsAMRorSILK(fileRecordData) {
 				mt, ok := silk.CheckAudio(bytes.NewReader(fileRecordData))
 				if !ok {
-					mylog.Errorf("voice type error: " + mt)
+					mylog.Errorf("voice type error: %s", mt)
 					return nil
 				}
 				fileRecordData = silk.EncoderSilk(fileRecordData)
@@ -1753,7 +1782,7 @@ func generatePrivateMessage(id string, eventid string, foundItems map[string][]s
 		if !silk.IsAMRorSILK(recordData) {
 			mt, ok := silk.CheckAudio(bytes.NewReader(recordData))
 			if !ok {
-				mylog.Errorf("voice type error: " + mt)
+				mylog.Errorf("voice type error: %s", mt)
 				return nil
 			}
 			recordData = silk.EncoderSilk(recordData)
@@ -1814,7 +1843,7 @@ func generatePrivateMessage(id string, eventid string, foundItems map[string][]s
 		if !silk.IsAMRorSILK(recordData) {
 			mt, ok := silk.CheckAudio(bytes.NewReader(recordData))
 			if !ok {
-				mylog.Errorf("voice type error: " + mt)
+				mylog.Errorf("voice type error: %s", mt)
 				return nil
 			}
 			recordData = silk.EncoderSilk(recordData)
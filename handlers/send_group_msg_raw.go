@@ -120,6 +120,15 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 	case "group":
 		// 解析消息内容
 		messageText, foundItems := parseMessageContent(message.Params, message, client, api, apiv2)
+		// 无法生成的段 整条信息不发送
+		if err := takeSegmentError(foundItems); err != nil {
+			return sendSegmentFailed(client, message, err)
+		}
+		// 发送前审核
+		messageText, foundItems, blocked := moderateOutgoing(messageText, foundItems, "group", message.Params.GroupID)
+		if blocked != nil {
+			return sendModerationBlocked(client, message, blocked)
+		}
 		var SSM bool
 
 		var originalGroupID, originalUserID string
@@ -300,6 +309,8 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 			if !config.GetNoRetMsg() {
 				// 发送成功回执
 				if config.GetThreadsRetMsg() {
+					expectAsyncReceipt(client)
+
 					go SendResponse(client, err, &message, resp, api, apiv2)
 				} else {
 					retmsg, _ = SendResponse(client, err, &message, resp, api, apiv2)
@@ -341,6 +352,8 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 			if !config.GetNoRetMsg() {
 				//发送成功回执
 				if config.GetThreadsRetMsg() {
+					expectAsyncReceipt(client)
+
 					go SendResponse(client, err, &message, resp, api, apiv2)
 				} else {
 					retmsg, _ = SendResponse(client, err, &message, resp, api, apiv2)
@@ -385,6 +398,8 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 						if !config.GetNoRetMsg() {
 							//发送成功回执
 							if config.GetThreadsRetMsg() {
+								expectAsyncReceipt(client)
+
 								go SendResponse(client, err, &message, resp, api, apiv2)
 							} else {
 								//发送成功回执
@@ -454,6 +469,8 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 				if !config.GetNoRetMsg() {
 					//发送成功回执
 					if config.GetThreadsRetMsg() {
+						expectAsyncReceipt(client)
+
 						go SendResponse(client, err, &message, resp, api, apiv2)
 					} else {
 						//发送成功回执
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+func init() {
+	callapi.RegisterHandler("_send_group_notice", SendGroupNotice)
+	callapi.RegisterHandler("_del_group_notice", DelGroupNotice)
+}
+
+// SendGroupNotice 发布频道公告
+// 传入content时先在子频道发出公告内容,传入message_id时将已有的信息设为公告,返回的notice_id即公告信息的message_id
+func SendGroupNotice(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	var channelID, msgID string
+	var err error
+	if paramString(message.Params.MessageID) != "" {
+		channelID, msgID, err = resolveGuildMessage(api, message.Params, message.Params.MessageID)
+	} else if message.Params.Content == "" {
+		err = errors.New("content or message_id is required")
+	} else {
+		var target guildTarget
+		target, err = requireChannel(api, message.Params)
+		if err == nil {
+			var msg *dto.Message
+			msg, err = api.PostMessage(context.TODO(), target.ChannelID, &dto.MessageToCreate{Content: message.Params.Content})
+			if err == nil {
+				channelID, msgID = target.ChannelID, msg.ID
+				// 公告信息同样可以撤回
+				idmap.StoreMessageScope(msgID, idmap.MessageScope{Type: idmap.ScopeGuild, TargetID: channelID, BotSent: true})
+			}
+		}
+	}
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	target, err := requireGuild(api, callapi.ParamsContent{ChannelID: channelID, GuildID: message.Params.GuildID})
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	_, err = api.CreateGuildAnnounces(context.TODO(), target.GuildID, &dto.GuildAnnouncesToCreate{ChannelID: channelID, MessageID: msgID})
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	return sendActionResponse(client, message, map[string]interface{}{"notice_id": virtualMessageID(msgID)}, nil)
+}
+
+// DelGroupNotice 删除频道公告 notice_id为all时清空全部公告
+func DelGroupNotice(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireGuild(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	noticeID := paramString(message.Params.NoticeID)
+	if noticeID == "all" {
+		err = api.CleanGuildAnnounces(context.TODO(), target.GuildID)
+		return sendActionResponse(client, message, nil, err)
+	}
+	msgID := resolveMessageID(noticeID)
+	if msgID == "" {
+		return sendActionResponse(client, message, nil, errors.New("notice_id not found"))
+	}
+	err = api.DeleteGuildAnnounces(context.TODO(), target.GuildID, msgID)
+	return sendActionResponse(client, message, nil, err)
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/hoshinonyaruko/gensokyo/callapi"
 	"github.com/hoshinonyaruko/gensokyo/config"
@@ -86,22 +88,40 @@ func HandleSendGuildChannelForum(client callapi.Client, api openapi.OpenAPI, api
 	case "forum":
 		params := message.Params
 		messageText, foundItems := parseMessageContent(params, message, client, api, apiv2)
+		// 无法生成的段 整条信息不发送
+		if err := takeSegmentError(foundItems); err != nil {
+			return sendSegmentFailed(client, message, err)
+		}
+		// 发送前审核
+		messageText, foundItems, blocked := moderateOutgoing(messageText, foundItems, "forum", params.ChannelID)
+		if blocked != nil {
+			return sendModerationBlocked(client, message, blocked)
+		}
 
-		channelID := params.ChannelID
-		// 使用 echo 获取消息ID
+		// channel_id为真实id,也可以传入论坛子频道对应的group_id
+		target, err := requireChannel(api, params)
+		if err != nil {
+			return sendActionResponse(client, message, nil, err)
+		}
 
 		mylog.Println("频道发帖子messageText:", messageText)
 
 		Forum, err := GenerateForumMessage(foundItems, messageText, apiv2)
 		if err != nil {
 			mylog.Printf("组合帖子信息失败: %v", err)
+			return sendActionResponse(client, message, nil, err)
 		}
-		if _, err = api.PostFourm(context.TODO(), channelID.(string), Forum); err != nil {
+		if params.Title != "" {
+			Forum.Title = params.Title
+		}
+		result, err := api.PostFourm(context.TODO(), target.ChannelID, Forum)
+		if err != nil {
 			mylog.Printf("发送帖子信息失败: %v", err)
+			return sendActionResponse(client, message, nil, err)
 		}
 
-		//发送成功回执
-		retmsg, _ = SendResponse(client, err, &message, nil, api, apiv2)
+		//发帖需要审核,task_id与forum_audit通知中的一致
+		retmsg, _ = sendActionResponse(client, message, map[string]interface{}{"task_id": result.TaskId, "create_time": result.CreateTime}, nil)
 
 	default:
 		mylog.Printf("2Unknown message type: %s", msgType)
@@ -187,6 +207,7 @@ func HandleSendGuildChannelForum(client callapi.Client, api openapi.OpenAPI, api
 // }
 
 // GenerateForumMessage 生成帖子消息
+// 每行文本为一个段落,文本中的链接转为链接元素,每张图片单独一个段落
 func GenerateForumMessage(foundItems map[string][]string, messageText string, apiv2 openapi.OpenAPI) (*dto.FourmToCreate, error) {
 	var forum dto.FourmToCreate
 
@@ -194,68 +215,47 @@ func GenerateForumMessage(foundItems map[string][]string, messageText string, ap
 	title := config.GetBotForumTitle()
 	forum.Title = title
 
-	// 初始化富文本内容结构
-	var richText struct {
-		Paragraphs []struct {
-			Elems []interface{} `json:"elems"`
-		} `json:"paragraphs"`
-	}
+	var richText dto.ForumRichText
 
-	// 使用xurls正则表达式查找所有的URL
-	foundURLs := xurls.Relaxed.FindAllString(messageText, -1)
-
-	// 移除文本中的URL
-	messageText = xurls.Relaxed.ReplaceAllStringFunc(messageText, func(originalURL string) string {
-		return ""
-	})
-
-	// 处理文本消息，除了URL
-	if messageText != "" {
-		richText.Paragraphs = append(richText.Paragraphs, struct {
-			Elems []interface{} `json:"elems"`
-		}{
-			Elems: []interface{}{
-				map[string]interface{}{
-					"text": map[string]interface{}{
-						"text": messageText,
-					},
-					"type": 1,
-				},
-			},
-		})
-	}
-
-	// 为每个URL创建ELEM_TYPE_URL元素
-	for _, url := range foundURLs {
-		richText.Paragraphs[0].Elems = append(richText.Paragraphs[0].Elems, map[string]interface{}{
-			"url": map[string]interface{}{
-				"url":  url,
-				"desc": "点我跳转",
-			},
-			"type": 4,
-		})
-	}
-
-	if len(richText.Paragraphs) == 0 {
-		// 初始化一个空段落
-		richText.Paragraphs = append(richText.Paragraphs, struct {
-			Elems []interface{} "json:\"elems\""
-		}{})
+	for _, line := range strings.Split(messageText, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var paragraph dto.ForumParagraph
+		// 使用xurls正则表达式查找所有的URL,URL之间的文本为文本元素
+		last := 0
+		for _, loc := range xurls.Relaxed.FindAllStringIndex(line, -1) {
+			paragraph.Elems = appendForumText(paragraph.Elems, line[last:loc[0]])
+			link := dto.ForumLinkElement{Type: 4}
+			link.LinkInfo.URL = line[loc[0]:loc[1]]
+			link.LinkInfo.Desc = "点我跳转"
+			paragraph.Elems = append(paragraph.Elems, link)
+			last = loc[1]
+		}
+		paragraph.Elems = appendForumText(paragraph.Elems, line[last:])
+		richText.Paragraphs = append(richText.Paragraphs, paragraph)
 	}
 
 	// 处理图片链接
+	var imageURLs []string
 	for _, url := range foundItems["url_image"] {
-		richText.Paragraphs[0].Elems = append(richText.Paragraphs[0].Elems, map[string]interface{}{
-			"image": map[string]interface{}{
-				"third_url":     url,
-				"width_percent": 1.0, // 设置图片宽度比例为1.0
-			},
-			"type": 2,
-		})
+		imageURLs = append(imageURLs, "http://"+url)
+	}
+	for _, url := range foundItems["url_images"] {
+		imageURLs = append(imageURLs, "https://"+url)
 	}
 
-	// 处理base64图片
-	for _, base64Image := range foundItems["base64_image"] {
+	// 处理base64图片与本地图片 上传后使用图床地址
+	base64Images := foundItems["base64_image"]
+	for _, path := range foundItems["local_image"] {
+		imageData, err := os.ReadFile(path)
+		if err != nil {
+			mylog.Printf("Error reading the image from path %s: %v", path, err)
+			continue
+		}
+		base64Images = append(base64Images, base64.StdEncoding.EncodeToString(imageData))
+	}
+	for _, base64Image := range base64Images {
 		fileImageData, err := base64.StdEncoding.DecodeString(base64Image)
 		if err != nil {
 			mylog.Printf("failed to decode base64 image: %v", err)
@@ -271,13 +271,18 @@ func GenerateForumMessage(foundItems map[string][]string, messageText string, ap
 			mylog.Printf("failed to upload base64 image: %v", err)
 			return nil, fmt.Errorf("failed to upload base64 image: %v", err)
 		}
-		richText.Paragraphs[0].Elems = append(richText.Paragraphs[0].Elems, map[string]interface{}{
-			"image": map[string]interface{}{
-				"third_url":     imageURL,
-				"width_percent": 1.0, // 设置图片宽度比例为1.0
-			},
-			"type": 2,
-		})
+		imageURLs = append(imageURLs, imageURL)
+	}
+
+	for _, url := range imageURLs {
+		image := dto.ForumImageElement{Type: 2}
+		image.ImageInfo.ThirdURL = url
+		image.ImageInfo.WidthPercent = 1.0 // 设置图片宽度比例为1.0
+		richText.Paragraphs = append(richText.Paragraphs, dto.ForumParagraph{Elems: []dto.ForumContentElement{image}})
+	}
+
+	if len(richText.Paragraphs) == 0 {
+		return nil, fmt.Errorf("no valid content found")
 	}
 
 	// 将富文本内容结构转换为JSON字符串
@@ -292,3 +297,13 @@ func GenerateForumMessage(foundItems map[string][]string, messageText string, ap
 
 	return &forum, nil
 }
+
+// appendForumText 添加非空的文本元素
+func appendForumText(elems []dto.ForumContentElement, text string) []dto.ForumContentElement {
+	if strings.TrimSpace(text) == "" {
+		return elems
+	}
+	elem := dto.ForumTextElement{Type: 1}
+	elem.TextInfo.Text = text
+	return append(elems, elem)
+}
@@ -90,11 +90,20 @@ func HandleSendGuildChannelMsg(client callapi.Client, api openapi.OpenAPI, apiv2
 	case "guild":
 		params := message.Params
 		messageText, foundItems := parseMessageContent(params, message, client, api, apiv2)
+		// 无法生成的段 整条信息不发送
+		if err := takeSegmentError(foundItems); err != nil {
+			return sendSegmentFailed(client, message, err)
+		}
+		// 发送前审核
+		messageText, foundItems, blocked := moderateOutgoing(messageText, foundItems, "guild", params.ChannelID)
+		if blocked != nil {
+			return sendModerationBlocked(client, message, blocked)
+		}
 
 		channelID := params.ChannelID
-		// 使用 echo 获取消息ID
-		var messageID string
-		if config.GetLazyMessageId() {
+		// 使用 echo 获取消息ID 快速操作优先被动回复触发它的信息
+		messageID := replyMessageID(message)
+		if messageID == "" && config.GetLazyMessageId() {
 			//由于实现了Params的自定义unmarshell 所以可以类型安全的断言为string
 			messageID = echo.GetLazyMessagesId(channelID.(string))
 			mylog.Printf("GetLazyMessagesId: %v", messageID)
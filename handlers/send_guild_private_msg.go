@@ -28,6 +28,15 @@ import (
 func HandleSendGuildChannelPrivateMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage, optionalGuildID *string, optionalChannelID *string) (string, error) {
 	params := message.Params
 	messageText, foundItems := parseMessageContent(params, message, client, api, apiv2)
+	// 无法生成的段 整条信息不发送
+	if err := takeSegmentError(foundItems); err != nil {
+		return sendSegmentFailed(client, message, err)
+	}
+	// 发送前审核
+	messageText, foundItems, blocked := moderateOutgoing(messageText, foundItems, "guild_private", params.UserID)
+	if blocked != nil {
+		return sendModerationBlocked(client, message, blocked)
+	}
 
 	var guildID, channelID string
 	var err error
@@ -50,9 +59,9 @@ func HandleSendGuildChannelPrivateMsg(client callapi.Client, api openapi.OpenAPI
 		channelID = *optionalChannelID
 	}
 
-	// 使用 echo 获取消息ID
-	var messageID string
-	if config.GetLazyMessageId() {
+	// 使用 echo 获取消息ID 快速操作优先被动回复触发它的信息
+	messageID := replyMessageID(message)
+	if messageID == "" && config.GetLazyMessageId() {
 		//由于实现了Params的自定义unmarshell 所以可以类型安全的断言为string
 		messageID = echo.GetLazyMessagesId(RawUserID)
 		mylog.Printf("GetLazyMessagesId: %v", messageID)
@@ -235,10 +244,10 @@ func HandleSendGuildChannelPrivateMsg(client callapi.Client, api openapi.OpenAPI
 				if resp, err = api.PostDirectMessageMultipart(context.TODO(), dm, reply, compressedData); err != nil {
 					mylog.Printf("使用multipart发送 %s 信息失败: %v message_id %v", key, err, messageID)
 				}
-				retmsg, _ = SendGuildResponse(client, err, &message, resp)
+				retmsg, _ = SendGuildPrivateResponse(client, err, &message, resp, guildID)
 			} else {
 				// 处理非 Base64 图片的逻辑
-				if _, err = api.PostDirectMessage(context.TODO(), dm, reply); err != nil {
+				if resp, err = api.PostDirectMessage(context.TODO(), dm, reply); err != nil {
 					mylog.Printf("发送 %s 信息失败: %v", key, err)
 				}
 				retmsg, _ = SendGuildPrivateResponse(client, err, &message, resp, guildID)
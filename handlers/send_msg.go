@@ -358,3 +358,35 @@ func GetMessageIDByUseridAndGroupid(appID string, userID interface{}, groupID in
 	mylog.Printf("GetMessageIDByUseridAndGroupid_key:%v", key)
 	return echo.GetMsgIDByKey(key)
 }
+
+// replyMessageID 快速操作的回复返回被动回复使用的真实msg_id 其他调用不受params中message_id影响
+func replyMessageID(message callapi.ActionMessage) string {
+	if !message.QuickReply {
+		return ""
+	}
+	id, ok := message.Params.MessageID.(string)
+	if !ok {
+		return ""
+	}
+	return resolveMessageID(id)
+}
+
+// resolveMessageID 还原事件中的message_id 数字为缓存中的行号,其他(频道原生事件)本身就是真实msg_id
+func resolveMessageID(id string) string {
+	if id == "" || id == "0" {
+		return ""
+	}
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return id
+	}
+	if config.GetMemoryMsgid() {
+		realMsgID, _ := echo.GetCacheIDFromMemoryByRowID(id)
+		return realMsgID
+	}
+	realMsgID, err := idmap.RetrieveRowByCachev2(id)
+	if err != nil {
+		mylog.Printf("error retrieving real MessageID: %v", err)
+		return ""
+	}
+	return realMsgID
+}
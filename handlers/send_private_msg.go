@@ -21,6 +21,10 @@ func init() {
 }
 
 func HandleSendPrivateMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	// 超长文本分段发送
+	if retmsg, ok, err := sendSplit(client, api, apiv2, message, HandleSendPrivateMsg); ok {
+		return retmsg, err
+	}
 	// 使用 message.Echo 作为key来获取消息类型
 	var msgType string
 	var retmsg string
@@ -140,12 +144,21 @@ func HandleSendPrivateMsg(client callapi.Client, api openapi.OpenAPI, apiv2 open
 
 		// 解析消息内容
 		messageText, foundItems := parseMessageContent(message.Params, message, client, api, apiv2)
+		// 无法生成的段 整条信息不发送
+		if err := takeSegmentError(foundItems); err != nil {
+			return sendSegmentFailed(client, message, err)
+		}
+		// 发送前审核
+		messageText, foundItems, blocked := moderateOutgoing(messageText, foundItems, "private", message.Params.UserID)
+		if blocked != nil {
+			return sendModerationBlocked(client, message, blocked)
+		}
 
-		// 使用 echo 获取消息ID
-		var messageID string
+		// 使用 echo 获取消息ID 快速操作优先被动回复触发它的信息
+		messageID := replyMessageID(message)
 		// EventID
 		var eventID string
-		if config.GetLazyMessageId() {
+		if messageID == "" && config.GetLazyMessageId() {
 			//由于实现了Params的自定义unmarshell 所以可以类型安全的断言为string
 			messageID = echo.GetLazyMessagesId(UserID)
 			mylog.Printf("GetLazyMessagesId: %v", messageID)
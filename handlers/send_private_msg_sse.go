@@ -114,6 +114,13 @@ func HandleSendPrivateMsgSSE(client callapi.Client, api openapi.OpenAPI, apiv2 o
 	// 输出反序列化后的对象，确认是否成功转换
 	fmt.Printf("Recovered InterfaceBody: %+v\n", messageBody)
 
+	// 发送前审核 流式信息逐段审核文本
+	content, _, blocked := moderateOutgoing(messageBody.Content, nil, "private", message.Params.UserID)
+	if blocked != nil {
+		return sendModerationBlocked(client, message, blocked)
+	}
+	messageBody.Content = content
+
 	// 使用 echo 获取消息ID
 	var messageID string
 
@@ -121,10 +128,10 @@ func HandleSendPrivateMsgSSE(client callapi.Client, api openapi.OpenAPI, apiv2 o
 	if messageID == "" {
 		if config.GetStringOb11() {
 			messageID = GetMessageIDByUseridOrGroupidSP(config.GetAppIDStr(), UserID)
-			mylog.Errorf("通过GetMessageIDByUserid函数获取的message_id:" + messageID)
+			mylog.Errorf("通过GetMessageIDByUserid函数获取的message_id:%s", messageID)
 		} else {
 			messageID = GetMessageIDByUseridOrGroupid(config.GetAppIDStr(), UserID)
-			mylog.Errorf("通过GetMessageIDByUserid函数获取的message_id:" + messageID)
+			mylog.Errorf("通过GetMessageIDByUserid函数获取的message_id:%s", messageID)
 		}
 
 	}
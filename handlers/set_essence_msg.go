@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// EssenceMessage 精华消息 频道接口只返回消息id
+type EssenceMessage struct {
+	MessageID     int64  `json:"message_id"`
+	RealMessageID string `json:"real_message_id,omitempty"` //真实msg_id
+}
+
+func init() {
+	callapi.RegisterHandler("set_essence_msg", SetEssenceMsg)
+	callapi.RegisterHandler("delete_essence_msg", DeleteEssenceMsg)
+	callapi.RegisterHandler("get_essence_msg_list", GetEssenceMsgList)
+}
+
+// SetEssenceMsg 将子频道中的信息设为精华
+func SetEssenceMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	channelID, msgID, err := resolveGuildMessage(api, message.Params, message.Params.MessageID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	_, err = api.AddPins(context.TODO(), channelID, msgID)
+	return sendActionResponse(client, message, nil, err)
+}
+
+// DeleteEssenceMsg 移出精华信息
+func DeleteEssenceMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	channelID, msgID, err := resolveGuildMessage(api, message.Params, message.Params.MessageID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	err = api.DeletePins(context.TODO(), channelID, msgID)
+	return sendActionResponse(client, message, nil, err)
+}
+
+// GetEssenceMsgList 获取子频道的精华信息
+func GetEssenceMsgList(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireChannel(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	pins, err := api.GetPins(context.TODO(), target.ChannelID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	list := make([]EssenceMessage, 0, len(pins.MessageIDs))
+	for _, msgID := range pins.MessageIDs {
+		essence := EssenceMessage{MessageID: virtualMessageID(msgID)}
+		//增强配置
+		if !config.GetNativeOb11() {
+			essence.RealMessageID = msgID
+		}
+		list = append(list, essence)
+	}
+	return sendActionResponse(client, message, list, nil)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/echo"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+func init() {
+	callapi.RegisterHandler("set_group_add_request", SetGroupAddRequest)
+}
+
+// SetGroupAddRequest 处理机器人被邀请入群的请求
+// 平台没有拒绝入群的接口,同意时发送自我介绍,拒绝时只记录结果,不影响群的主动推送状态
+func SetGroupAddRequest(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	var err error
+	// onebot中approve缺省为同意
+	approve := message.Params.Approve == nil || *message.Params.Approve
+
+	var req idmap.GroupRequest
+	if message.Params.Flag == "" {
+		err = errors.New("flag is required")
+	} else {
+		req, err = idmap.ResolveGroupRequest(message.Params.Flag, approve, message.Params.Reason)
+	}
+	if err == nil {
+		if approve {
+			mylog.Printf("同意入群请求[%v]群[%v]", req.Flag, req.GroupID)
+			SendSelfIntroduce(api, apiv2, req)
+		} else {
+			mylog.Printf("拒绝入群请求[%v]群[%v]理由[%v]", req.Flag, req.GroupID, req.Reason)
+		}
+	}
+
+	var response GetStatusResponse
+	response.Echo = message.Echo
+	if err != nil {
+		mylog.Printf("处理入群请求失败: %v", err)
+		response.Message = err.Error()
+		response.RetCode = 100
+		response.Status = "failed"
+	} else {
+		response.Message = ""
+		response.RetCode = 0
+		response.Status = "ok"
+	}
+
+	outputMap := structToMap(response)
+
+	mylog.Printf("set_group_add_request: %+v\n", outputMap)
+
+	err = client.SendMessage(outputMap)
+	if err != nil {
+		mylog.Printf("Error sending message via client: %v", err)
+	}
+	//把结果从struct转换为json
+	result, err := json.Marshal(response)
+	if err != nil {
+		mylog.Printf("Error marshaling data: %v", err)
+		return "", nil
+	}
+	return string(result), nil
+}
+
+// 入群事件的event_id可用于被动回复的时间
+const introEventTTL = 5 * time.Minute
+
+// SendSelfIntroduce 入群请求被同意后 随机发送一条配置的自我介绍
+func SendSelfIntroduce(api openapi.OpenAPI, apiv2 openapi.OpenAPI, req idmap.GroupRequest) {
+	var validIntros []string
+	for _, intro := range config.GetSelfIntroduce() {
+		if intro != "" {
+			validIntros = append(validIntros, intro)
+		}
+	}
+	if len(validIntros) == 0 {
+		return
+	}
+	selectedIntro := validIntros[rand.Intn(len(validIntros))]
+
+	// 手动同意时入群事件可能已超过被动回复的时效 不再使用它的event_id,改为主动发送
+	if req.EventID != "" && time.Since(time.Unix(req.Time, 0)) > introEventTTL {
+		appID := config.GetAppIDStr()
+		if echo.GetEventIDByKey(appID+"_"+strconv.FormatInt(req.GroupID, 10)) == req.EventID {
+			echo.AddEvnetID(appID, req.GroupID, "")
+		}
+		mylog.Printf("入群事件[%v]已超过被动回复时效,自我介绍改为主动发送", req.EventID)
+	}
+
+	message := callapi.ActionMessage{
+		Action: "send_group_msg_group",
+		Params: callapi.ParamsContent{
+			GroupID: strconv.FormatInt(req.GroupID, 10),
+			UserID:  strconv.FormatInt(req.UserID, 10),
+			Message: selectedIntro,
+		},
+	}
+	// 自我介绍不需要回执 使用不回发的client
+	if _, err := HandleSendGroupMsg(&captureClient{}, api, apiv2, message); err != nil {
+		mylog.Printf("自我介绍发送失败%v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+func init() {
+	callapi.RegisterHandler("set_group_kick", SetGroupKick)
+}
+
+// SetGroupKick 将成员移出频道 reject_add_request为true时同时加入黑名单
+// group_id可以是子频道或频道对应的虚拟群号,也可以直接传入guild_id
+func SetGroupKick(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	target, err := requireGuild(api, message.Params)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	realUserID, err := resolveGuildUser(message.Params.UserID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	err = api.DeleteGuildMember(context.TODO(), target.GuildID, realUserID, dto.WithAddBlackList(message.Params.RejectAddRequest))
+	return sendActionResponse(client, message, nil, err)
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+func init() {
+	callapi.RegisterHandler("set_msg_emoji_like", SetMsgEmojiLike)
+}
+
+// SetMsgEmojiLike 对子频道信息表态 set为false时取消表态
+// emoji_type为1时是系统表情,2时是emoji,默认为系统表情
+func SetMsgEmojiLike(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	channelID, msgID, err := resolveGuildMessage(api, message.Params, message.Params.MessageID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	emoji := dto.Emoji{ID: paramString(message.Params.EmojiID), Type: message.Params.EmojiType}
+	if emoji.ID == "" {
+		return sendActionResponse(client, message, nil, errors.New("emoji_id is required"))
+	}
+	if emoji.Type == 0 {
+		emoji.Type = 1
+	}
+	if paramSet(message.Params) {
+		err = api.CreateMessageReaction(context.TODO(), channelID, msgID, emoji)
+	} else {
+		err = api.DeleteOwnMessageReaction(context.TODO(), channelID, msgID, emoji)
+	}
+	return sendActionResponse(client, message, nil, err)
+}
@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/echo"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/markdown"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/text2img"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// 超长文本分段发送 在段落、换行、句子处断开,cq码与非文本段不会被拆开
+// 各段使用原信息的echo依次交给发送handler,因此共用msg_id,msg_seq依次递增
+
+// split_overflow的取值
+const (
+	splitOverflowTruncate = "truncate"
+	splitOverflowButton   = "button"
+	splitOverflowImage    = "image"
+)
+
+// 下一页按钮的data前缀 点击由gsk处理,不上报应用端
+const pageButtonPrefix = "gsk_page:"
+
+// 下一页保留的时间
+const pageTTL = 30 * time.Minute
+
+var cqCodePattern = regexp.MustCompile(`\[CQ:[^\]]*\]`)
+
+// 句子结束的位置 在其后断开
+var sentenceEnds = []string{"。", "！", "？", "!", "?", "；", ";", "…", ". "}
+
+// 含有这些段的信息整体发送
+var unsplittableTypes = map[string]bool{"markdown": true, "keyboard": true, "node": true}
+
+// splitToken 文本或不可拆分的段
+type splitToken struct {
+	text    string
+	atomic  interface{} // 非文本段 字符串形式时为cq码
+	isToken bool
+}
+
+type pageEntry struct {
+	scope   string // group 或 group_private
+	target  string // 真实的群或用户openid
+	parts   []interface{}
+	expires time.Time
+}
+
+var (
+	pages   = make(map[string]*pageEntry)
+	pagesMu sync.Mutex
+)
+
+// sendSplit 文本超过split_length时分段发送,返回false时按原样发送
+func sendSplit(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage, send callapi.HandlerFunc) (string, bool, error) {
+	limit := config.GetSplitLength()
+	if limit <= 0 {
+		return "", false, nil
+	}
+	parts := splitMessage(message.Params.Message, limit)
+	if len(parts) <= 1 {
+		return "", false, nil
+	}
+
+	maxParts := config.GetSplitMaxParts()
+	if len(parts) > maxParts {
+		switch config.GetSplitOverflow() {
+		case splitOverflowTruncate:
+			mylog.Printf("信息分为%d段,超过split_max_parts,丢弃后%d段", len(parts), len(parts)-maxParts)
+			parts = parts[:maxParts]
+		case splitOverflowButton:
+			parts = pageOverflow(message, parts, maxParts)
+		case splitOverflowImage:
+			parts = imageOverflow(parts, maxParts)
+		}
+	}
+	mylog.Printf("超长信息分为%d段发送", len(parts))
+	retmsg, err := sendParts(client, api, apiv2, message, parts, send)
+	return retmsg, true, err
+}
+
+// sendParts 按顺序发送各段 有一段失败时不再发送后面的段,避免对话中间缺一段
+// 回执只发一次:失败时为失败的回执,否则为最后一段的回执
+func sendParts(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage, parts []interface{}, send callapi.HandlerFunc) (string, error) {
+	var response map[string]interface{}
+	for i, part := range parts {
+		capture := &captureClient{}
+		partMessage := message
+		partMessage.Params.Message = part
+		_, err := send(capture, api, apiv2, partMessage)
+		if err == nil {
+			// 开启threads_ret_msg时回执在协程中生成 等待它再发送下一段
+			response, err = capture.wait()
+		}
+		if err == nil {
+			if status, _ := response["status"].(string); status == "failed" {
+				err = fmt.Errorf("%v", response["message"])
+			}
+		}
+		if err != nil {
+			mylog.Printf("分段发送第%d段失败,不再发送后%d段: %v", i+1, len(parts)-i-1, err)
+			err = fmt.Errorf("第%d/%d段发送失败: %v", i+1, len(parts), err)
+			retmsg, _ := sendFailedResponse(client, message, err.Error())
+			return retmsg, err
+		}
+	}
+	// 开启no_ret_msg时没有回执
+	if response == nil {
+		return "", nil
+	}
+	if err := client.SendMessage(response); err != nil {
+		mylog.Printf("Error sending message via client: %v", err)
+	}
+	result, _ := json.Marshal(response)
+	return string(result), nil
+}
+
+// splitMessage 把cq码字符串或段数组按字数分段 不需要分段时返回nil
+func splitMessage(msg interface{}, limit int) []interface{} {
+	var tokens []splitToken
+	arrayForm := false
+	switch m := msg.(type) {
+	case string:
+		last := 0
+		for _, loc := range cqCodePattern.FindAllStringIndex(m, -1) {
+			if loc[0] > last {
+				tokens = append(tokens, splitToken{text: m[last:loc[0]]})
+			}
+			code := m[loc[0]:loc[1]]
+			if unsplittableTypes[cqType(code)] {
+				return nil
+			}
+			tokens = append(tokens, splitToken{atomic: code, isToken: true})
+			last = loc[1]
+		}
+		if last < len(m) {
+			tokens = append(tokens, splitToken{text: m[last:]})
+		}
+	case []interface{}:
+		arrayForm = true
+		for _, seg := range m {
+			segMap, ok := seg.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			segType, _ := segMap["type"].(string)
+			if unsplittableTypes[segType] {
+				return nil
+			}
+			if segType == "text" {
+				if data, ok := segMap["data"].(map[string]interface{}); ok {
+					if text, ok := data["text"].(string); ok {
+						tokens = append(tokens, splitToken{text: text})
+						continue
+					}
+				}
+			}
+			tokens = append(tokens, splitToken{atomic: seg, isToken: true})
+		}
+	default:
+		return nil
+	}
+
+	total := 0
+	for _, t := range tokens {
+		total += utf8.RuneCountInString(t.text)
+	}
+	if total <= limit {
+		return nil
+	}
+
+	var parts [][]splitToken
+	var cur []splitToken
+	used := 0
+	closePart := func() {
+		if len(cur) > 0 {
+			parts = append(parts, cur)
+		}
+		cur = nil
+		used = 0
+	}
+	for _, t := range tokens {
+		if t.isToken {
+			cur = append(cur, t)
+			continue
+		}
+		text := t.text
+		for text != "" {
+			n := utf8.RuneCountInString(text)
+			if n <= limit-used {
+				cur = append(cur, splitToken{text: text})
+				used += n
+				break
+			}
+			head, tail, natural := splitText(text, limit-used)
+			if !natural && used > 0 {
+				// 当前段剩余的空间找不到断点 从新的一段开始
+				closePart()
+				continue
+			}
+			if head != "" {
+				cur = append(cur, splitToken{text: head})
+			}
+			closePart()
+			text = tail
+		}
+	}
+	closePart()
+
+	result := make([]interface{}, 0, len(parts))
+	for _, p := range parts {
+		if arrayForm {
+			result = append(result, joinSegments(p))
+		} else {
+			result = append(result, joinCQ(p))
+		}
+	}
+	return result
+}
+
+// splitText 在limit字以内找最靠后的断点 优先段落,其次换行、句子、空格
+// natural为false表示没有合适的断点,在limit处硬切
+func splitText(text string, limit int) (head, tail string, natural bool) {
+	runes := []rune(text)
+	if limit <= 0 {
+		return "", text, false
+	}
+	if len(runes) <= limit {
+		return text, "", true
+	}
+	window := string(runes[:limit])
+	// 断点不能太靠前,否则段数过多
+	min := len(string(runes[:limit/2]))
+	cut := -1
+	for _, seps := range [][]string{{"\n\n", "\r\n\r\n"}, {"\n"}, sentenceEnds, {" ", "\t"}} {
+		for _, sep := range seps {
+			if i := strings.LastIndex(window, sep); i >= min && i+len(sep) > cut {
+				cut = i + len(sep)
+			}
+		}
+		if cut > 0 {
+			break
+		}
+	}
+	if cut <= 0 {
+		return window, string(runes[limit:]), false
+	}
+	head = strings.TrimRight(text[:cut], " \t\r\n")
+	tail = strings.TrimLeft(text[cut:], " \t\r\n")
+	return head, tail, true
+}
+
+func cqType(code string) string {
+	t := strings.TrimPrefix(code, "[CQ:")
+	if i := strings.IndexAny(t, ",]"); i >= 0 {
+		t = t[:i]
+	}
+	return t
+}
+
+func joinCQ(tokens []splitToken) string {
+	var sb strings.Builder
+	for _, t := range tokens {
+		if t.isToken {
+			sb.WriteString(t.atomic.(string))
+		} else {
+			sb.WriteString(t.text)
+		}
+	}
+	return sb.String()
+}
+
+func joinSegments(tokens []splitToken) []interface{} {
+	segs := make([]interface{}, 0, len(tokens))
+	for _, t := range tokens {
+		if t.isToken {
+			segs = append(segs, t.atomic)
+		} else {
+			segs = append(segs, map[string]interface{}{"type": "text", "data": map[string]interface{}{"text": t.text}})
+		}
+	}
+	return segs
+}
+
+// pageOverflow 超出的段保存为下一页,最后一段附上下一页按钮
+func pageOverflow(message callapi.ActionMessage, parts []interface{}, maxParts int) []interface{} {
+	scope, target := pageTarget(message)
+	if scope == "" {
+		mylog.Printf("信息分为%d段,当前场景不支持下一页按钮,全部发送", len(parts))
+		return parts
+	}
+	key, err := newRandomID()
+	if err != nil {
+		mylog.Printf("Error generating page key: %v", err)
+		return parts
+	}
+	rest := parts[maxParts:]
+	pagesMu.Lock()
+	now := time.Now()
+	for k, p := range pages {
+		if now.After(p.expires) {
+			delete(pages, k)
+		}
+	}
+	pages[key] = &pageEntry{scope: scope, target: target, parts: rest, expires: now.Add(pageTTL)}
+	pagesMu.Unlock()
+
+	kb, err := json.Marshal(pageKeyboard(key, len(rest)))
+	if err != nil {
+		mylog.Printf("Error marshaling page keyboard: %v", err)
+		return parts[:maxParts]
+	}
+	data := "base64://" + base64.StdEncoding.EncodeToString(kb)
+	parts = parts[:maxParts]
+	last := parts[maxParts-1]
+	switch p := last.(type) {
+	case string:
+		parts[maxParts-1] = p + "[CQ:keyboard,data=" + data + "]"
+	case []interface{}:
+		parts[maxParts-1] = append(p, map[string]interface{}{"type": "keyboard", "data": map[string]interface{}{"data": data}})
+	}
+	mylog.Printf("信息分为%d段,后%d段改为下一页按钮", maxParts+len(rest), len(rest))
+	return parts
+}
+
+// imageOverflow 多余的段渲染为一张图片,随最后一段发送
+func imageOverflow(parts []interface{}, maxParts int) []interface{} {
+	total, all := len(parts), parts
+	var texts []string
+	for _, part := range parts[maxParts:] {
+		if text := pageText(part); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	parts = parts[:maxParts]
+	if len(texts) == 0 {
+		return parts
+	}
+	encoded, err := text2img.RenderBase64(strings.Join(texts, "\n"), text2img.Options{})
+	if err != nil {
+		mylog.Printf("渲染多余的段失败,全部分段发送: %v", err)
+		return all
+	}
+	file := "base64://" + encoded
+	switch p := parts[maxParts-1].(type) {
+	case string:
+		parts[maxParts-1] = p + "[CQ:image,file=" + file + "]"
+	case []interface{}:
+		parts[maxParts-1] = append(p, map[string]interface{}{"type": "image", "data": map[string]interface{}{"file": file}})
+	}
+	mylog.Printf("信息分为%d段,后%d段渲染为图片", total, total-maxParts)
+	return parts
+}
+
+// pageTarget 下一页按钮只在群和单聊中使用
+func pageTarget(message callapi.ActionMessage) (string, string) {
+	groupID := paramString(message.Params.GroupID)
+	userID := paramString(message.Params.UserID)
+	if groupID != "" && groupID != "0" {
+		if len(groupID) == 32 {
+			return "group", groupID
+		}
+		if realID, err := idmap.RetrieveRowByIDv2(groupID); err == nil {
+			return "group", realID
+		}
+		return "", ""
+	}
+	if userID != "" && userID != "0" && isC2CTarget(userID, "") {
+		if realID, err := realPrivateUserID(userID); err == nil {
+			return "group_private", realID
+		}
+	}
+	return "", ""
+}
+
+func pageKeyboard(key string, remaining int) map[string]interface{} {
+	return map[string]interface{}{
+		"rows": [][]map[string]interface{}{{{
+			"label": fmt.Sprintf("下一页(剩余%d页)", remaining),
+			"type":  "callback",
+			"data":  pageButtonPrefix + key,
+			"style": 1,
+		}}},
+	}
+}
+
+// IsPageButton 是否为分段发送的下一页按钮
+func IsPageButton(data string) bool {
+	return strings.HasPrefix(data, pageButtonPrefix)
+}
+
+// SendNextPage 下一页按钮被点击 以回调事件的event_id被动回复下一页
+// 下一页只发送文本,剩余页数大于1时继续附上按钮
+func SendNextPage(apiv2 openapi.OpenAPI, data *dto.WSInteractionData) error {
+	key := strings.TrimPrefix(data.Data.Resolved.ButtonData, pageButtonPrefix)
+	pagesMu.Lock()
+	entry, ok := pages[key]
+	if ok {
+		delete(pages, key)
+	}
+	pagesMu.Unlock()
+	if !ok || time.Now().After(entry.expires) {
+		mylog.Printf("下一页 %s 不存在或已过期", key)
+		return nil
+	}
+
+	text := pageText(entry.parts[0])
+	moderationType, moderationTarget := "group", data.GroupOpenID
+	if entry.scope != "group" {
+		moderationType, moderationTarget = "private", data.UserOpenID
+	}
+	text, _, blocked := moderateOutgoing(text, nil, moderationType, moderationTarget)
+	if blocked != nil {
+		mylog.Printf("下一页被%s审核拦截: %s", blocked.Provider, blocked.Reason)
+		return nil
+	}
+	msgseq := echo.GetMappingSeq(data.EventID)
+	echo.AddMappingSeq(data.EventID, msgseq+1)
+	msg := &dto.MessageToCreate{
+		Content: text,
+		EventID: data.EventID,
+		MsgSeq:  msgseq + 1,
+		MsgType: 0,
+	}
+	if rest := entry.parts[1:]; len(rest) > 0 {
+		next, err := newRandomID()
+		if err == nil {
+			pagesMu.Lock()
+			pages[next] = &pageEntry{scope: entry.scope, target: entry.target, parts: rest, expires: time.Now().Add(pageTTL)}
+			pagesMu.Unlock()
+			kb, _ := json.Marshal(pageKeyboard(next, len(rest)))
+			if k, err := markdown.ParseKeyboard(kb); err == nil {
+				msg.MsgType = 2
+				msg.Content = "markdown"
+				msg.Markdown = &dto.Markdown{Content: text}
+				msg.Keyboard = k
+			}
+		}
+	}
+	msg.Timestamp = time.Now().Unix()
+
+	var err error
+	if entry.scope == "group" {
+		_, err = apiv2.PostGroupMessage(context.TODO(), entry.target, msg)
+	} else {
+		_, err = apiv2.PostC2CMessage(context.TODO(), entry.target, msg)
+	}
+	if err != nil {
+		mylog.Printf("发送下一页失败: %v", err)
+	}
+	return err
+}
+
+// pageText 下一页的文本 cq码与图片等媒体段不发送
+func pageText(part interface{}) string {
+	var text string
+	switch p := part.(type) {
+	case string:
+		text = p
+	case []interface{}:
+		var sb strings.Builder
+		for _, seg := range p {
+			segMap, _ := seg.(map[string]interface{})
+			if segType, _ := segMap["type"].(string); segType != "text" {
+				continue
+			}
+			data, _ := segMap["data"].(map[string]interface{})
+			s, _ := data["text"].(string)
+			sb.WriteString(s)
+		}
+		text = sb.String()
+	}
+	text = cqCodePattern.ReplaceAllString(text, "")
+	return strings.TrimSpace(text)
+}
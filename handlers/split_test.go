@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+func TestSplitTextBreakpoints(t *testing.T) {
+	cases := []struct {
+		name, text string
+		limit      int
+		head, tail string
+		natural    bool
+	}{
+		{"fits", "短文本", 10, "短文本", "", true},
+		{"paragraph", "第一段内容\n\n第二段内容很长", 12, "第一段内容", "第二段内容很长", true},
+		{"newline", "第一行内容\n第二行内容很长", 10, "第一行内容", "第二行内容很长", true},
+		{"sentence", "这是第一句。这是第二句很长", 10, "这是第一句。", "这是第二句很长", true},
+		{"space", "hello world again", 12, "hello world", "again", true},
+		{"hard", "一二三四五六七八九十", 4, "一二三四", "五六七八九十", false},
+		// 断点太靠前时硬切
+		{"too early", "一。二三四五六七八九", 8, "一。二三四五六七", "八九", false},
+		{"no room", "abc", 0, "", "abc", false},
+	}
+	for _, c := range cases {
+		head, tail, natural := splitText(c.text, c.limit)
+		if head != c.head || tail != c.tail || natural != c.natural {
+			t.Errorf("%s: splitText = (%q, %q, %v), want (%q, %q, %v)", c.name, head, tail, natural, c.head, c.tail, c.natural)
+		}
+	}
+}
+
+func TestSplitMessageString(t *testing.T) {
+	if parts := splitMessage("不需要分段", 10); parts != nil {
+		t.Fatalf("short message split into %v", parts)
+	}
+	msg := strings.Repeat("一二三四五。", 4) + "[CQ:image,file=a.png]" + strings.Repeat("六七八九十。", 4)
+	parts := splitMessage(msg, 15)
+	if len(parts) < 3 {
+		t.Fatalf("parts = %v", parts)
+	}
+	var joined strings.Builder
+	for _, p := range parts {
+		s := p.(string)
+		text := cqCodePattern.ReplaceAllString(s, "")
+		if n := utf8.RuneCountInString(text); n > 15 {
+			t.Errorf("part %q has %d runes", s, n)
+		}
+		joined.WriteString(s)
+	}
+	// cq码不会被拆开,内容不丢失
+	if got := joined.String(); got != msg {
+		t.Fatalf("joined parts = %q, want %q", got, msg)
+	}
+}
+
+func TestSplitMessageUnsplittable(t *testing.T) {
+	long := strings.Repeat("字", 50)
+	if parts := splitMessage(long+"[CQ:markdown,data=x]", 10); parts != nil {
+		t.Fatalf("markdown message split into %v", parts)
+	}
+	segs := []interface{}{
+		map[string]interface{}{"type": "text", "data": map[string]interface{}{"text": long}},
+		map[string]interface{}{"type": "keyboard", "data": map[string]interface{}{"id": "1"}},
+	}
+	if parts := splitMessage(segs, 10); parts != nil {
+		t.Fatalf("keyboard message split into %v", parts)
+	}
+	if parts := splitMessage(42, 10); parts != nil {
+		t.Fatalf("unknown message type split into %v", parts)
+	}
+}
+
+func TestSplitMessageSegments(t *testing.T) {
+	image := map[string]interface{}{"type": "image", "data": map[string]interface{}{"file": "a.png"}}
+	segs := []interface{}{
+		map[string]interface{}{"type": "text", "data": map[string]interface{}{"text": "第一句话。第二句话。"}},
+		image,
+		map[string]interface{}{"type": "text", "data": map[string]interface{}{"text": "第三句话。"}},
+	}
+	parts := splitMessage(segs, 6)
+	want := []interface{}{
+		[]interface{}{map[string]interface{}{"type": "text", "data": map[string]interface{}{"text": "第一句话。"}}},
+		[]interface{}{
+			map[string]interface{}{"type": "text", "data": map[string]interface{}{"text": "第二句话。"}},
+			image,
+		},
+		[]interface{}{map[string]interface{}{"type": "text", "data": map[string]interface{}{"text": "第三句话。"}}},
+	}
+	if !reflect.DeepEqual(parts, want) {
+		t.Fatalf("parts = %v, want %v", parts, want)
+	}
+}
+
+func TestPageText(t *testing.T) {
+	if got := pageText(" 文本[CQ:image,file=a.png] "); got != "文本" {
+		t.Fatalf("pageText(string) = %q", got)
+	}
+	segs := []interface{}{
+		map[string]interface{}{"type": "text", "data": map[string]interface{}{"text": "a"}},
+		map[string]interface{}{"type": "image", "data": map[string]interface{}{"file": "a.png"}},
+		map[string]interface{}{"type": "text", "data": map[string]interface{}{"text": "b"}},
+	}
+	if got := pageText(segs); got != "ab" {
+		t.Fatalf("pageText(segments) = %q", got)
+	}
+	if !IsPageButton(pageButtonPrefix+"x") || IsPageButton("other") {
+		t.Fatal("IsPageButton mismatch")
+	}
+}
+
+func TestSendPartsStopsAtFirstFailure(t *testing.T) {
+	var sent []interface{}
+	send := func(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+		sent = append(sent, message.Params.Message)
+		switch message.Params.Message {
+		case "b":
+			client.SendMessage(map[string]interface{}{"status": "failed", "message": "boom"})
+		case "c":
+			// 发送前返回 没有回执
+		default:
+			client.SendMessage(map[string]interface{}{"status": "ok"})
+		}
+		return "", nil
+	}
+
+	for _, parts := range [][]interface{}{{"a", "b", "a"}, {"a", "c", "a"}} {
+		sent = nil
+		client := &captureClient{}
+		if _, err := sendParts(client, nil, nil, callapi.ActionMessage{}, parts, send); err == nil {
+			t.Errorf("%v: expected an error", parts)
+		}
+		if len(sent) != 2 {
+			t.Errorf("%v: sent %v, want to stop after the failed part", parts, sent)
+		}
+		if status, _ := client.last()["status"].(string); status != "failed" {
+			t.Errorf("%v: response %v", parts, client.last())
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/botstats"
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/echo"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// 流式回复 应用端open_stream打开,push_stream逐段推送文本,close_stream结束
+// 单聊使用平台的流式信息,按stream_interval合并推送;群和频道不支持流式,缓存全文在结束时作为一条信息发送
+
+// 平台流式信息的状态
+const (
+	streamStateGenerating = 1  // 正文生成中
+	streamStateEnd        = 10 // 正文生成结束
+)
+
+// 等待重排的乱序分段上限
+const maxEarlyChunks = 256
+
+var (
+	ErrUnknownStream = errors.New("stream not found or already closed")
+	errStreamTarget  = errors.New("user_id or group_id is required")
+)
+
+var streamSessions sync.Map // stream_id -> *streamSession
+
+func init() {
+	callapi.RegisterHandler("open_stream", HandleOpenStream)
+	callapi.RegisterHandler("push_stream", HandlePushStream)
+	callapi.RegisterHandler("close_stream", HandleCloseStream)
+}
+
+// StreamResult close_stream的返回值
+type StreamResult struct {
+	StreamID  string `json:"stream_id"`
+	MessageID int64  `json:"message_id"`
+	Streamed  bool   `json:"streamed"` // 是否以平台流式信息发出 false为结束时一次发送
+	Length    int    `json:"length"`   // 发送的文本长度
+}
+
+type streamSession struct {
+	mu      sync.Mutex
+	sendMu  sync.Mutex // 推送在mu外进行 保证分段逐个按序发出
+	id      string
+	client  callapi.Client
+	api     openapi.OpenAPI
+	apiv2   openapi.OpenAPI
+	echo    interface{}
+	userID  string // 打开时的user_id
+	groupID string // 打开时的group_id
+
+	openID    string // 单聊的真实id 为空时缓存全文
+	msgID     string // 被动回复的msg_id
+	platID    string // 平台第一段返回的流id 后续分段需要带上 以下三项只在持有sendMu和mu时修改
+	index     int
+	messageID int64
+	pending   strings.Builder // 下次推送的文本
+	buffered  strings.Builder // 缓存模式下未发送的文本
+	length    int
+	nextSeq   int
+	early     map[int]string
+	blocked   error // 被审核拦截后不再推送
+	lastPush  time.Time
+	done      chan struct{}
+}
+
+// HandleOpenStream 打开流式回复 参数user_id或group_id 返回stream_id
+func HandleOpenStream(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	id, err := OpenStream(client, api, apiv2, message.Params, message.Echo)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	return sendActionResponse(client, message, map[string]interface{}{"stream_id": id}, nil)
+}
+
+// HandlePushStream 推送一段文本 参数stream_id text 可选seq
+func HandlePushStream(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	err := PushStream(message.Params.StreamID, streamText(message.Params), message.Params.Seq)
+	return sendActionResponse(client, message, map[string]interface{}{"stream_id": message.Params.StreamID}, err)
+}
+
+// HandleCloseStream 结束流式回复 可以同时带上最后一段text
+func HandleCloseStream(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	if text := streamText(message.Params); text != "" {
+		if err := PushStream(message.Params.StreamID, text, message.Params.Seq); err != nil {
+			return sendActionResponse(client, message, nil, err)
+		}
+	}
+	result, err := CloseStream(message.Params.StreamID)
+	if err != nil {
+		return sendActionResponse(client, message, nil, err)
+	}
+	return sendActionResponse(client, message, result, nil)
+}
+
+// streamText 分段文本可以写在text,也可以与send_msg一样写在message
+func streamText(params callapi.ParamsContent) string {
+	if params.Text != "" {
+		return params.Text
+	}
+	if s, ok := params.Message.(string); ok {
+		return s
+	}
+	return ""
+}
+
+// OpenStream 打开流式回复 单聊使用平台的流式信息,其他场景缓存全文
+func OpenStream(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, params callapi.ParamsContent, echoValue interface{}) (string, error) {
+	s := &streamSession{
+		client:   client,
+		api:      api,
+		apiv2:    apiv2,
+		echo:     echoValue,
+		userID:   paramString(params.UserID),
+		groupID:  paramString(params.GroupID),
+		early:    make(map[int]string),
+		lastPush: time.Now(),
+		done:     make(chan struct{}),
+	}
+	if s.userID == "0" {
+		s.userID = ""
+	}
+	if s.groupID == "0" {
+		s.groupID = ""
+	}
+	if s.userID == "" && s.groupID == "" {
+		return "", errStreamTarget
+	}
+
+	if isC2CTarget(s.userID, s.groupID) {
+		openID, err := realPrivateUserID(s.userID)
+		if err != nil {
+			mylog.Printf("流式回复还原user_id失败,结束时一次发送: %v", err)
+		} else {
+			s.openID = openID
+			if config.GetStringOb11() {
+				s.msgID = GetMessageIDByUseridOrGroupidSP(config.GetAppIDStr(), openID)
+			} else {
+				s.msgID = GetMessageIDByUseridOrGroupid(config.GetAppIDStr(), openID)
+			}
+		}
+	}
+
+	id, err := newRandomID()
+	if err != nil {
+		return "", err
+	}
+	s.id = id
+	streamSessions.Store(id, s)
+	go s.run()
+	mylog.Printf("打开流式回复 %s user_id:%s group_id:%s 流式:%v", id, s.userID, s.groupID, s.openID != "")
+	return id, nil
+}
+
+// PushStream 追加一段文本 seq为空时接在已收到的分段之后
+func PushStream(streamID, text string, seq *int) error {
+	s, ok := loadStream(streamID)
+	if !ok {
+		return ErrUnknownStream
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.blocked != nil {
+		return s.blocked
+	}
+	s.lastPush = time.Now()
+
+	n := s.nextSeq
+	if seq != nil {
+		n = *seq
+	}
+	if n < s.nextSeq {
+		// 重复的分段
+		return nil
+	}
+	if n > s.nextSeq {
+		if len(s.early) >= maxEarlyChunks {
+			return fmt.Errorf("too many chunks waiting for seq %d", s.nextSeq)
+		}
+		s.early[n] = text
+		return nil
+	}
+	s.append(text)
+	for {
+		next, ok := s.early[s.nextSeq]
+		if !ok {
+			break
+		}
+		delete(s.early, s.nextSeq)
+		s.append(next)
+	}
+	return nil
+}
+
+// CloseStream 推送剩余的文本并结束 缓存的全文在这里发送
+func CloseStream(streamID string) (StreamResult, error) {
+	v, ok := streamSessions.LoadAndDelete(streamID)
+	if !ok {
+		return StreamResult{}, ErrUnknownStream
+	}
+	s := v.(*streamSession)
+	close(s.done)
+
+	s.mu.Lock()
+	if len(s.early) > 0 {
+		// 缺少的分段不再等待,剩余的按序号接上
+		mylog.Printf("流式回复 %s 缺少分段 %d,已收到的%d段按序号发送", s.id, s.nextSeq, len(s.early))
+		seqs := make([]int, 0, len(s.early))
+		for n := range s.early {
+			seqs = append(seqs, n)
+		}
+		sort.Ints(seqs)
+		for _, n := range seqs {
+			s.append(s.early[n])
+		}
+		s.early = nil
+	}
+	s.mu.Unlock()
+
+	s.flush(streamStateEnd)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := StreamResult{StreamID: s.id, Length: s.length}
+	if s.index > 0 {
+		result.Streamed = true
+		result.MessageID = s.messageID
+	}
+	if s.blocked != nil {
+		return result, s.blocked
+	}
+	if s.buffered.Len() > 0 {
+		messageID, err := s.sendBuffered()
+		if err != nil {
+			return result, err
+		}
+		if result.MessageID == 0 {
+			result.MessageID = messageID
+		}
+	}
+	mylog.Printf("结束流式回复 %s 长度:%d 流式:%v", s.id, s.length, result.Streamed)
+	return result, nil
+}
+
+func loadStream(streamID string) (*streamSession, bool) {
+	v, ok := streamSessions.Load(streamID)
+	if !ok {
+		return nil, false
+	}
+	return v.(*streamSession), true
+}
+
+// isC2CTarget 只有单聊支持流式信息
+func isC2CTarget(userID, groupID string) bool {
+	if userID == "" || groupID != "" {
+		return false
+	}
+	if len(userID) == 32 {
+		return true
+	}
+	msgType := GetMessageTypeByUserid(config.GetAppIDStr(), userID)
+	if msgType == "" {
+		msgType = GetMessageTypeByUseridV2(userID)
+	}
+	// 与send_private_msg一致 未知类型按单聊处理
+	return msgType == "" || msgType == "group_private"
+}
+
+// realPrivateUserID 虚拟user_id还原为单聊的真实id
+func realPrivateUserID(userID string) (string, error) {
+	if len(userID) == 32 {
+		return userID, nil
+	}
+	if config.GetIdmapPro() {
+		_, realID, err := idmap.RetrieveRowByIDv2Pro("690426430", userID)
+		return realID, err
+	}
+	return idmap.RetrieveRowByIDv2(userID)
+}
+
+// append 收到按序的分段 流式时等待下次推送,否则缓存
+func (s *streamSession) append(text string) {
+	s.nextSeq++
+	s.length += len(text)
+	if s.openID != "" {
+		s.pending.WriteString(text)
+	} else {
+		s.buffered.WriteString(text)
+	}
+}
+
+// run 按间隔合并推送,空闲超时后自动结束
+func (s *streamSession) run() {
+	interval := time.Duration(config.GetStreamInterval()) * time.Millisecond
+	timeout := time.Duration(config.GetStreamTimeout()) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			idle := time.Since(s.lastPush) > timeout
+			s.mu.Unlock()
+			if idle {
+				mylog.Printf("流式回复 %s 超过%v没有新的分段,自动结束", s.id, timeout)
+				if _, err := CloseStream(s.id); err != nil && !errors.Is(err, ErrUnknownStream) {
+					mylog.Printf("自动结束流式回复 %s 失败: %v", s.id, err)
+				}
+				return
+			}
+			s.flush(streamStateGenerating)
+		}
+	}
+}
+
+// flush 把等待的文本作为一个流式分段推送 调用时不能持有mu,推送期间应用端可以继续push_stream
+// 推送失败时先结束已经开始的流,剩余文本改为结束时一次发送
+func (s *streamSession) flush(state int) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	s.mu.Lock()
+	openID := s.openID
+	content := s.pending.String()
+	if openID == "" || s.blocked != nil || content == "" && (state != streamStateEnd || s.index == 0) {
+		s.mu.Unlock()
+		return
+	}
+	s.pending.Reset()
+	s.mu.Unlock()
+
+	// 发送前审核 流式信息逐段审核文本
+	content, _, blocked := moderateOutgoing(content, nil, "private", s.userID)
+	if blocked != nil {
+		mylog.Printf("流式回复 %s 被%s审核拦截: %s", s.id, blocked.Provider, blocked.Reason)
+		s.mu.Lock()
+		s.blocked = errors.New("blocked by moderation: " + blocked.Reason)
+		s.mu.Unlock()
+		if s.index == 0 {
+			return
+		}
+		// 已经开始的流需要结束
+		content = ""
+		state = streamStateEnd
+	}
+
+	resp, err := s.post(openID, content, state)
+	if err != nil {
+		mylog.Errorf("流式回复 %s 推送失败,剩余文本结束时一次发送: %v", s.id, err)
+		if s.index > 0 && state != streamStateEnd {
+			// 平台的流停在生成中,先发送结束分段
+			if _, err := s.post(openID, "", streamStateEnd); err != nil {
+				mylog.Errorf("流式回复 %s 结束失败: %v", s.id, err)
+			}
+		}
+		s.mu.Lock()
+		if s.blocked == nil {
+			// 推送期间收到的分段接在失败的文本之后
+			s.buffered.WriteString(content)
+			s.buffered.WriteString(s.pending.String())
+			s.pending.Reset()
+		}
+		s.openID = ""
+		s.mu.Unlock()
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index++
+	if resp != nil && resp.Message != nil && s.platID == "" {
+		s.platID = resp.Message.ID
+		s.messageID = storeStreamMessageID(resp.Message.ID)
+		idmap.StoreMessageScope(resp.Message.ID, idmap.MessageScope{Type: idmap.ScopeGroupPrivate, TargetID: s.userID, BotSent: true})
+		botstats.RecordMessageSent()
+	}
+}
+
+// post 发出一个流式分段 调用时需持有sendMu
+func (s *streamSession) post(openID, content string, state int) (*dto.C2CMessageResponse, error) {
+	msg := &dto.MessageSSE{
+		MsgType:  2,
+		Markdown: &dto.MarkdownSSE{Content: content},
+		MsgID:    s.msgID,
+		// 与send_private_msg_sse共用计数,防止同一msg_id下的seq重复被去重
+		MsgSeq: incrementIndex(s.msgID) + 10,
+		Stream: &dto.StreamSSE{
+			State: state,
+			Index: s.index,
+			ID:    s.platID,
+		},
+	}
+	return s.apiv2.PostC2CMessageSSE(context.TODO(), openID, msg)
+}
+
+// sendBuffered 缓存的文本交给send_msg发送 与应用端直接调用send_msg效果相同
+func (s *streamSession) sendBuffered() (int64, error) {
+	handler, ok := callapi.GetHandler("send_msg")
+	if !ok {
+		return 0, errors.New("send_msg handler not registered")
+	}
+	capture := &captureClient{}
+	message := callapi.ActionMessage{
+		Action: "send_msg",
+		Params: callapi.ParamsContent{
+			UserID:  s.userID,
+			GroupID: s.groupID,
+			Message: s.buffered.String(),
+		},
+		Echo: s.echo,
+	}
+	s.buffered.Reset()
+	if _, err := handler(capture, s.api, s.apiv2, message); err != nil {
+		return 0, err
+	}
+	return capture.result()
+}
+
+// storeStreamMessageID 平台消息id转为应用端使用的message_id
+func storeStreamMessageID(id string) int64 {
+	var messageID int64
+	var err error
+	if config.GetMemoryMsgid() {
+		messageID, err = echo.StoreCacheInMemory(id)
+	} else {
+		messageID, err = idmap.StoreCachev2(id)
+	}
+	if err != nil {
+		mylog.Printf("Error storing ID: %v", err)
+	}
+	return messageID
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// sseAPI 记录流式分段 fail为true时推送失败
+type sseAPI struct {
+	openapi.OpenAPI
+	session *streamSession
+	fail    bool
+	sent    []dto.StreamSSE
+	locked  bool // 推送时是否持有session.mu
+}
+
+func (a *sseAPI) PostC2CMessageSSE(ctx context.Context, userID string, msg dto.APIMessage) (*dto.C2CMessageResponse, error) {
+	if a.session.mu.TryLock() {
+		a.session.mu.Unlock()
+	} else {
+		a.locked = true
+	}
+	a.sent = append(a.sent, *msg.(*dto.MessageSSE).Stream)
+	if a.fail && msg.(*dto.MessageSSE).Stream.State != streamStateEnd {
+		return nil, errors.New("push failed")
+	}
+	return &dto.C2CMessageResponse{}, nil
+}
+
+func newTestStream(api *sseAPI) *streamSession {
+	s := &streamSession{id: "test", apiv2: api, userID: "1", openID: "openid", msgID: "msg", early: make(map[int]string)}
+	api.session = s
+	return s
+}
+
+func TestStreamFlush(t *testing.T) {
+	api := &sseAPI{}
+	s := newTestStream(api)
+	for _, text := range []string{"a", "b"} {
+		s.append(text)
+		s.flush(streamStateGenerating)
+	}
+	// 没有新的文本时不推送
+	s.flush(streamStateGenerating)
+	s.flush(streamStateEnd)
+
+	if api.locked {
+		t.Error("pushed while holding the session lock")
+	}
+	if len(api.sent) != 3 || api.sent[2].State != streamStateEnd || api.sent[2].Index != 2 {
+		t.Errorf("unexpected frames %+v", api.sent)
+	}
+}
+
+func TestStreamFlushFailureEndsStream(t *testing.T) {
+	api := &sseAPI{}
+	s := newTestStream(api)
+	s.append("a")
+	s.flush(streamStateGenerating)
+
+	api.fail = true
+	s.append("b")
+	s.flush(streamStateGenerating)
+
+	// 失败后先以结束分段关闭平台的流
+	if len(api.sent) != 3 || api.sent[2].State != streamStateEnd || api.sent[2].Index != 1 {
+		t.Errorf("unexpected frames %+v", api.sent)
+	}
+	if s.openID != "" || s.buffered.String() != "b" {
+		t.Errorf("openID %q buffered %q", s.openID, s.buffered.String())
+	}
+	// 之后的文本缓存到结束时发送
+	s.append("c")
+	s.flush(streamStateEnd)
+	if len(api.sent) != 3 || s.buffered.String() != "bc" {
+		t.Errorf("frames %d buffered %q", len(api.sent), s.buffered.String())
+	}
+}
+
+func TestStreamFlushFirstFailure(t *testing.T) {
+	api := &sseAPI{fail: true}
+	s := newTestStream(api)
+	s.append("a")
+	s.flush(streamStateGenerating)
+	// 流还没有开始,不需要结束分段
+	if len(api.sent) != 1 || s.buffered.String() != "a" {
+		t.Errorf("frames %+v buffered %q", api.sent, s.buffered.String())
+	}
+}
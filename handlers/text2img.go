@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/markdown"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/text2img"
+	"mvdan.cc/xurls"
+)
+
+// [CQ:text2img,text=内容,markdown=true,width=800] text也可以是base64://
+var text2imgPattern = regexp.MustCompile(`\[CQ:text2img,([^\]]*)\]`)
+
+// 帖子与合并转发只使用文本,不自动转图片
+var text2imgSkipActions = map[string]bool{"send_guild_channel_forum": true, "send_group_forward_msg": true}
+
+// 自动转图片时保留在文本中的at
+var mentionPattern = regexp.MustCompile(`<@!?[^>]+>`)
+
+// text2imgSegment 把text2img段渲染为base64图片 失败时整条信息不发送
+func text2imgSegment(data map[string]interface{}) (string, error) {
+	text := paramString(data["text"])
+	if strings.HasPrefix(text, "base64://") {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(text, "base64://"))
+		if err != nil {
+			return "", fmt.Errorf("text2img: decode text: %v", err)
+		}
+		text = string(raw)
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", errors.New("text2img: text is empty")
+	}
+	opts := text2img.Options{}
+	opts.Markdown, _ = strconv.ParseBool(paramString(data["markdown"]))
+	opts.Width, _ = strconv.Atoi(paramString(data["width"]))
+
+	encoded, err := text2img.RenderBase64(text, opts)
+	if err != nil {
+		mylog.Printf("文字转图片失败: %v", err)
+		return "", err
+	}
+	return encoded, nil
+}
+
+// text2imgCQ 解析cq码形式的text2img段 参数中的逗号等需要转义
+func text2imgCQ(params string) (string, error) {
+	data := make(map[string]interface{})
+	for _, kv := range strings.Split(params, ",") {
+		if key, value, ok := strings.Cut(kv, "="); ok {
+			data[key] = cqUnescaper.Replace(value)
+		}
+	}
+	return text2imgSegment(data)
+}
+
+// autoText2img 文本超过text2img_length,或含有不在白名单中的链接时,整段文本转为图片发送
+// at保留在文本中,已经是markdown的信息不转换
+func autoText2img(messageText string, foundItems map[string][]string) string {
+	if len(foundItems["markdown"]) > 0 {
+		return messageText
+	}
+	text := strings.TrimSpace(mentionPattern.ReplaceAllString(messageText, ""))
+	if text == "" {
+		return messageText
+	}
+	reason := ""
+	if limit := config.GetText2imgLength(); limit > 0 && utf8.RuneCountInString(text) > limit {
+		reason = "文本过长"
+	} else if config.GetText2imgURL() && hasDisallowedURL(text) {
+		reason = "含有链接"
+	}
+	if reason == "" {
+		return messageText
+	}
+
+	encoded, err := text2img.RenderBase64(text, text2img.Options{})
+	if err != nil {
+		mylog.Printf("文字转图片失败,按原文发送: %v", err)
+		return messageText
+	}
+	mylog.Printf("%s,文本转为图片发送", reason)
+	foundItems["base64_image"] = append(foundItems["base64_image"], encoded)
+	return strings.Join(mentionPattern.FindAllString(messageText, -1), " ")
+}
+
+// hasDisallowedURL 文本中有不在markdown_link_whitelist中的链接
+func hasDisallowedURL(text string) bool {
+	for _, link := range xurls.Relaxed.FindAllString(text, -1) {
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+		u, err := url.Parse(link)
+		if err != nil || !markdown.LinkWhitelisted(u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
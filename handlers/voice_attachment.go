@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/silk"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// 解码后的语音与图床共用channel_temp目录
+const voiceStoreDir = "./channel_temp/"
+
+// 语音附件最大下载大小 超过时不解码
+const maxVoiceAttachmentSize = 10 * 1024 * 1024
+
+// 尚未解码的语音在record段中的file后缀 应用端用它调用get_record
+const voicePendingExt = ".record"
+
+// 语音附件的原始地址与解码后的文件保留的时间 平台的语音地址本身也有时效
+const voiceSourceTTL = 24 * time.Hour
+
+// 语音附件的原始地址保存在channel_temp中的md5.url文件里,重启后仍能解码
+const voiceSourceExt = ".url"
+
+// 清理过期语音文件的间隔
+const voiceSweepInterval = time.Hour
+
+var voiceHttpClient = &http.Client{Timeout: 10 * time.Second}
+
+// ErrVoiceTooLarge 语音附件超过maxVoiceAttachmentSize
+var ErrVoiceTooLarge = fmt.Errorf("voice attachment exceeds %d bytes", maxVoiceAttachmentSize)
+
+// voiceJob 一条语音的一次解码 同时请求的调用方等待同一个结果
+type voiceJob struct {
+	done      chan struct{}
+	localPath string
+	localURL  string
+	err       error
+}
+
+var (
+	voiceMu     sync.Mutex
+	voiceJobs   = make(map[string]*voiceJob)
+	voiceSwept  time.Time
+	voiceNameRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+)
+
+// isVoiceAttachment 判断附件是否为语音
+func isVoiceAttachment(attachment *dto.MessageAttachment) bool {
+	return attachment.ContentType == "voice" || strings.HasPrefix(attachment.ContentType, "audio/")
+}
+
+// attachmentURL 补全附件url的协议头
+func attachmentURL(attachment *dto.MessageAttachment) string {
+	if strings.HasPrefix(attachment.URL, "http://") || strings.HasPrefix(attachment.URL, "https://") {
+		return attachment.URL
+	}
+	return "http://" + attachment.URL
+}
+
+// recordDecodeFormat 解码的目标格式 未配置或不支持时为wav
+func recordDecodeFormat(format string) string {
+	if format == "mp3" {
+		return "mp3"
+	}
+	return "wav"
+}
+
+// voiceRecordData 返回语音附件对应record段的file和url
+// 开启record_decode时,已解码过的语音直接给出本地文件;否则在后台解码,不阻塞事件上报
+// 此时file为 md5.record,url为平台原始地址,应用端可以调用get_record等待解码结果
+func voiceRecordData(attachment *dto.MessageAttachment) (file string, url string) {
+	url = attachmentURL(attachment)
+	file = attachment.FileName
+	if !config.GetRecordDecode() {
+		return file, url
+	}
+
+	name := voiceName(url)
+	format := recordDecodeFormat(config.GetRecordDecodeType())
+	rememberVoiceSource(name, url)
+	if localPath, localURL, ok := decodedVoice(name, format); ok {
+		return localPath, localURL
+	}
+	go func() {
+		if _, _, err := decodeVoice(name, format); err != nil {
+			mylog.Printf("语音附件解码失败,record段保留原始地址: %v", err)
+		}
+	}()
+	return name + voicePendingExt, url
+}
+
+// voiceName 语音的文件名取url的md5,同一条语音只解码一次
+func voiceName(url string) string {
+	sum := md5.Sum([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+// voiceNameFromFile record段的file可以是md5.record或解码后的本地路径
+func voiceNameFromFile(file string) string {
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// rememberVoiceSource 保存语音的原始地址,并定期清理过期的语音文件
+func rememberVoiceSource(name, url string) {
+	path := voiceStoreDir + name + voiceSourceExt
+	if _, err := os.Stat(path); err != nil {
+		if err = os.MkdirAll(voiceStoreDir, 0755); err == nil {
+			err = os.WriteFile(path, []byte(url), 0644)
+		}
+		if err != nil {
+			mylog.Printf("保存语音地址失败: %v", err)
+		}
+	}
+
+	voiceMu.Lock()
+	now := time.Now()
+	sweep := now.Sub(voiceSwept) >= voiceSweepInterval
+	if sweep {
+		voiceSwept = now
+	}
+	voiceMu.Unlock()
+	if sweep {
+		go sweepVoiceFiles(now.Add(-voiceSourceTTL))
+	}
+}
+
+// voiceSourceURL 读取语音的原始地址 过期后不再解码
+func voiceSourceURL(name string) (string, bool) {
+	path := voiceStoreDir + name + voiceSourceExt
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > voiceSourceTTL {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return "", false
+	}
+	return string(data), true
+}
+
+// sweepVoiceFiles 删除before之前保存的语音地址和对应的解码文件
+// 只按md5.url找语音文件,图床保存在同一目录的文件不受影响
+func sweepVoiceFiles(before time.Time) {
+	entries, err := os.ReadDir(voiceStoreDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), voiceSourceExt)
+		if name == entry.Name() || !voiceNameRe.MatchString(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(before) {
+			continue
+		}
+		for _, ext := range []string{".wav", ".mp3", voiceSourceExt} {
+			if err := os.Remove(voiceStoreDir + name + ext); err != nil && !os.IsNotExist(err) {
+				mylog.Printf("清理过期语音失败: %v", err)
+			}
+		}
+	}
+}
+
+// decodedVoice 已经解码保存的语音 mp3没有ffmpeg时会退回wav
+func decodedVoice(name, format string) (string, string, bool) {
+	for _, ext := range []string{format, "wav"} {
+		fileName := name + "." + ext
+		if _, err := os.Stat(voiceStoreDir + fileName); err == nil {
+			return absVoicePath(fileName), config.ComposeChannelTempURL(fileName), true
+		}
+	}
+	return "", "", false
+}
+
+// decodeVoice 解码name对应的语音并等待结果 同一条语音同时只解码一次
+func decodeVoice(name, format string) (string, string, error) {
+	if localPath, localURL, ok := decodedVoice(name, format); ok {
+		return localPath, localURL, nil
+	}
+
+	key := name + "." + format
+	url, known := voiceSourceURL(name)
+	voiceMu.Lock()
+	job, running := voiceJobs[key]
+	if !running && known {
+		job = &voiceJob{done: make(chan struct{})}
+		voiceJobs[key] = job
+	}
+	voiceMu.Unlock()
+
+	if !running {
+		if !known {
+			return "", "", errors.New("unknown or expired record file " + name)
+		}
+		job.localPath, job.localURL, job.err = decodeVoiceAttachment(name, url, format)
+		close(job.done)
+		// 失败时允许下次重试
+		voiceMu.Lock()
+		delete(voiceJobs, key)
+		voiceMu.Unlock()
+	}
+	<-job.done
+	return job.localPath, job.localURL, job.err
+}
+
+// decodeVoiceAttachment 下载语音附件并解码,保存到本地媒体目录
+func decodeVoiceAttachment(name, url, format string) (string, string, error) {
+	resp, err := voiceHttpClient.Get(url)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("download voice failed, status: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxVoiceAttachmentSize {
+		return "", "", ErrVoiceTooLarge
+	}
+	// 多读一个字节判断是否超过上限 截断的语音无法解码
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxVoiceAttachmentSize+1))
+	if err != nil {
+		return "", "", err
+	}
+	if len(data) > maxVoiceAttachmentSize {
+		return "", "", ErrVoiceTooLarge
+	}
+
+	decoded, ext, err := silk.DecodeVoice(data, format)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err = os.MkdirAll(voiceStoreDir, 0755); err != nil {
+		return "", "", err
+	}
+	fileName := name + "." + ext
+	if err = os.WriteFile(voiceStoreDir+fileName, decoded, 0644); err != nil {
+		return "", "", err
+	}
+
+	return absVoicePath(fileName), config.ComposeChannelTempURL(fileName), nil
+}
+
+// absVoicePath 返回本地文件的绝对路径,应用端与gsk同机时可直接读取
+func absVoicePath(fileName string) string {
+	p, err := filepath.Abs(voiceStoreDir + fileName)
+	if err != nil {
+		return voiceStoreDir + fileName
+	}
+	return p
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVoiceAttachmentTooLarge(t *testing.T) {
+	chunked := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := strings.Repeat("a", maxVoiceAttachmentSize+1)
+		if chunked {
+			// 没有Content-Length时按读到的长度判断
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	for _, chunked = range []bool{false, true} {
+		if _, _, err := decodeVoiceAttachment("large", server.URL, "wav"); err != ErrVoiceTooLarge {
+			t.Fatalf("chunked=%v: err = %v, want %v", chunked, err, ErrVoiceTooLarge)
+		}
+	}
+}
+
+func TestDecodeVoiceUnknownFile(t *testing.T) {
+	if _, _, err := decodeVoice(voiceName("http://never.seen/a.silk"), "wav"); err == nil {
+		t.Fatal("expected error for unknown record file")
+	}
+}
+
+func TestVoiceNames(t *testing.T) {
+	name := voiceName("http://example.com/a.silk")
+	for _, file := range []string{name + voicePendingExt, "/data/channel_temp/" + name + ".wav", name} {
+		if got := voiceNameFromFile(file); got != name {
+			t.Errorf("voiceNameFromFile(%q) = %s, want %s", file, got, name)
+		}
+	}
+	for format, want := range map[string]string{"": "wav", "wav": "wav", "mp3": "mp3", "flac": "wav"} {
+		if got := recordDecodeFormat(format); got != want {
+			t.Errorf("recordDecodeFormat(%q) = %s, want %s", format, got, want)
+		}
+	}
+}
+
+func TestVoiceSourcePersisted(t *testing.T) {
+	t.Chdir(t.TempDir())
+	url := "http://example.com/b.silk"
+	name := voiceName(url)
+	rememberVoiceSource(name, url)
+	if got, ok := voiceSourceURL(name); !ok || got != url {
+		t.Fatalf("voiceSourceURL = %q %v, want %q", got, ok, url)
+	}
+
+	// 图床的文件与未过期的语音不清理
+	other := voiceName("http://example.com/c.silk")
+	for _, file := range []string{name + ".wav", other + ".wav", other + voiceSourceExt} {
+		if err := os.WriteFile(voiceStoreDir+file, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * voiceSourceTTL)
+	for _, file := range []string{name + voiceSourceExt, name + ".wav", other + ".wav"} {
+		os.Chtimes(voiceStoreDir+file, old, old)
+	}
+	if _, ok := voiceSourceURL(name); ok {
+		t.Error("expired source still resolved")
+	}
+	sweepVoiceFiles(time.Now().Add(-voiceSourceTTL))
+	for file, want := range map[string]bool{name + voiceSourceExt: false, name + ".wav": false, other + ".wav": true, other + voiceSourceExt: true} {
+		if _, err := os.Stat(voiceStoreDir + file); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", file, err == nil, want)
+		}
+	}
+}
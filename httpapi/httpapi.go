@@ -71,6 +71,10 @@ func CombinedMiddleware(api openapi.OpenAPI, apiV2 openapi.OpenAPI) gin.HandlerF
 			handleGetFriendList(c, api, apiV2)
 			return
 		}
+		if c.Request.URL.Path == "/stream" {
+			handleStream(c, api, apiV2)
+			return
+		}
 		if c.Request.URL.Path == "/put_interaction" {
 			handlePutInteraction(c, api, apiV2)
 			return
@@ -618,8 +622,10 @@ func handleGetFriendList(c *gin.Context, api openapi.OpenAPI, apiV2 openapi.Open
 // handlePutInteraction 处理put_interaction的请求
 func handlePutInteraction(c *gin.Context, api openapi.OpenAPI, apiV2 openapi.OpenAPI) {
 	var req struct {
-		Echo     string `json:"echo" form:"echo"`           // Echo值用于标识interaction
-		PostType string `json:"post_type" form:"post_type"` // PostType用于设置code参数
+		Echo          string `json:"echo" form:"echo"`                     // Echo值用于标识interaction
+		PostType      string `json:"post_type" form:"post_type"`           // PostType用于设置code参数
+		InteractionID string `json:"interaction_id" form:"interaction_id"` // 回调通知中的interaction_id
+		Code          *int   `json:"code" form:"code"`                     // 回应结果 优先于post_type
 	}
 
 	// 根据请求方法解析参数
@@ -642,6 +648,10 @@ func handlePutInteraction(c *gin.Context, api openapi.OpenAPI, apiV2 openapi.Ope
 		Action:   "put_interaction",
 		Echo:     req.Echo,
 		PostType: req.PostType,
+		Params: callapi.ParamsContent{
+			InteractionID: req.InteractionID,
+			Code:          req.Code,
+		},
 	}
 
 	// 调用处理函数
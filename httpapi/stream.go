@@ -0,0 +1,109 @@
+package httpapi
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/handlers"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// handleStream 一个长连接请求完成一次流式回复 user_id或group_id写在url参数中
+// 请求体边生成边发送(chunked),每次读到的内容作为一段推送,请求体结束时结束流式回复
+// Content-Type为text/event-stream时按sse解析,每个事件的data为一段
+func handleStream(c *gin.Context, api openapi.OpenAPI, apiV2 openapi.OpenAPI) {
+	if c.Request.Method != http.MethodPost {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "POST only"})
+		return
+	}
+	params := callapi.ParamsContent{
+		UserID:  c.Query("user_id"),
+		GroupID: c.Query("group_id"),
+	}
+	streamID, err := handlers.OpenStream(&HttpAPIClient{}, api, apiV2, params, c.Query("echo"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if strings.HasPrefix(c.GetHeader("Content-Type"), "text/event-stream") {
+		err = pushEvents(streamID, c.Request.Body)
+	} else {
+		err = pushChunks(streamID, c.Request.Body)
+	}
+	if err != nil {
+		mylog.Printf("流式回复 %s 读取请求失败: %v", streamID, err)
+	}
+
+	result, closeErr := handlers.CloseStream(streamID)
+	if closeErr != nil {
+		c.JSON(http.StatusOK, gin.H{"status": "failed", "retcode": 100, "message": closeErr.Error(), "data": result})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "retcode": 0, "data": result})
+}
+
+// pushChunks 每次读到的内容推送一段 不完整的utf8字符留到下一段
+func pushChunks(streamID string, body io.Reader) error {
+	buf := make([]byte, 4096)
+	var rest []byte
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			data := append(rest, buf[:n]...)
+			cut := len(data)
+			for cut > 0 && cut > len(data)-utf8.UTFMax && !utf8.Valid(data[:cut]) {
+				cut--
+			}
+			if cut == 0 {
+				cut = len(data)
+			}
+			if pushErr := handlers.PushStream(streamID, string(data[:cut]), nil); pushErr != nil {
+				return pushErr
+			}
+			rest = append([]byte(nil), data[cut:]...)
+		}
+		if err == io.EOF {
+			if len(rest) > 0 {
+				return handlers.PushStream(streamID, string(rest), nil)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// pushEvents 按sse解析请求体 同一事件的多行data以换行连接
+func pushEvents(streamID string, body io.Reader) error {
+	scanner := bufio.NewScanner(body)
+	var event []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(event) > 0 {
+				if err := handlers.PushStream(streamID, strings.Join(event, "\n"), nil); err != nil {
+					return err
+				}
+				event = nil
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "data:") {
+			event = append(event, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if len(event) > 0 {
+		if err := handlers.PushStream(streamID, strings.Join(event, "\n"), nil); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,572 @@
+package idmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"go.etcd.io/bbolt"
+)
+
+var ErrMappingConflict = errors.New("virtual value already mapped")
+
+// Mapping ids中的一条映射 idmaps-pro的值为 群:用户
+type Mapping struct {
+	RealID    string `json:"real_id"`
+	VirtualID string `json:"virtual_id"`
+	Pro       bool   `json:"pro,omitempty"`
+}
+
+// Orphan 缺少对应反向键或正反向不一致的条目
+type Orphan struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// ListMappings 列出本地ids中的全部映射 query不为空时只返回真实值或虚拟值包含query的映射
+func ListMappings(query string, limit int) ([]Mapping, error) {
+	var mappings []Mapping
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(BucketName)).ForEach(func(k, v []byte) error {
+			m, ok := parseMapping(k, v)
+			if !ok {
+				return nil
+			}
+			if query != "" && !strings.Contains(m.RealID, query) && !strings.Contains(m.VirtualID, query) {
+				return nil
+			}
+			mappings = append(mappings, m)
+			if limit > 0 && len(mappings) >= limit {
+				return errStopIteration
+			}
+			return nil
+		})
+	})
+	if err == errStopIteration {
+		err = nil
+	}
+	return mappings, err
+}
+
+var errStopIteration = errors.New("stop iteration")
+
+// parseMapping 从反向键解析映射 正向键与计数器返回false
+func parseMapping(k, v []byte) (Mapping, bool) {
+	key := string(k)
+	if strings.HasPrefix(key, "row-") {
+		return Mapping{RealID: string(v), VirtualID: strings.TrimPrefix(key, "row-")}, true
+	}
+	if !bytes.Contains(k, []byte(":")) || !bytes.Contains(v, []byte(":")) {
+		return Mapping{}, false
+	}
+	// idmaps-pro 正反向键都是a:b,虚拟值为两段数字 真实值同为数字时取较短的一侧作为虚拟值
+	if isVirtualPair(key) && (!isVirtualPair(string(v)) || len(key) > len(v)) {
+		return Mapping{}, false
+	}
+	if !isVirtualPair(string(v)) {
+		return Mapping{}, false
+	}
+	return Mapping{RealID: key, VirtualID: string(v), Pro: true}, true
+}
+
+func isVirtualPair(s string) bool {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return false
+	}
+	for _, p := range parts {
+		if _, err := strconv.ParseInt(p, 10, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// LookupMapping 按真实值或虚拟值精确查找映射
+func LookupMapping(id string) ([]Mapping, error) {
+	var mappings []Mapping
+	err := db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		if v := b.Get([]byte("row-" + id)); v != nil {
+			mappings = append(mappings, Mapping{RealID: string(v), VirtualID: id})
+		}
+		v := b.Get([]byte(id))
+		switch {
+		case v == nil:
+		case strings.Contains(id, ":"):
+			// idmaps-pro的键为a:b,值是字符串,恰好8个字符时也不能按虚拟值解析
+			if m, ok := parseMapping([]byte(id), v); ok {
+				mappings = append(mappings, m)
+			} else if m, ok := parseMapping(v, []byte(id)); ok {
+				mappings = append(mappings, m)
+			}
+		case len(v) == 8:
+			mappings = append(mappings, Mapping{RealID: id, VirtualID: strconv.FormatUint(binary.BigEndian.Uint64(v), 10)})
+		}
+		return nil
+	})
+	return mappings, err
+}
+
+// RebindVirtualValue 修改虚拟值 新虚拟值已被使用时返回ErrMappingConflict
+func RebindVirtualValue(oldValue, newValue int64) error {
+	if newValue <= 0 {
+		return fmt.Errorf("invalid virtual value: %d", newValue)
+	}
+	if _, _, err := RetrieveRealValuev2(oldValue); err != nil {
+		return fmt.Errorf("virtual value %d not found: %v", oldValue, err)
+	}
+	if _, realID, err := RetrieveRealValuev2(newValue); err == nil && realID != "" {
+		return fmt.Errorf("%w: %d -> %s", ErrMappingConflict, newValue, realID)
+	}
+	return UpdateVirtualValuev2(oldValue, newValue)
+}
+
+// RebindVirtualValuePro 修改idmaps-pro的群与用户虚拟值 新组合已被使用时返回ErrMappingConflict
+func RebindVirtualValuePro(oldGroup, newGroup, oldUser, newUser int64) error {
+	if newGroup <= 0 || newUser <= 0 {
+		return fmt.Errorf("invalid virtual value: %d:%d", newGroup, newUser)
+	}
+	if _, _, err := RetrieveRealValuesv2Pro(oldGroup, oldUser); err != nil {
+		return fmt.Errorf("virtual value %d:%d not found: %v", oldGroup, oldUser, err)
+	}
+	if g, u, err := RetrieveRealValuesv2Pro(newGroup, newUser); err == nil && (g != "" || u != "") {
+		return fmt.Errorf("%w: %d:%d -> %s:%s", ErrMappingConflict, newGroup, newUser, g, u)
+	}
+	return UpdateVirtualValuev2Pro(oldGroup, newGroup, oldUser, newUser)
+}
+
+// FindOrphans 查找正反向键不一致的条目
+func FindOrphans() ([]Orphan, error) {
+	var orphans []Orphan
+	err := db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		return b.ForEach(func(k, v []byte) error {
+			if reason := orphanReason(tx, b, k, v); reason != "" {
+				orphans = append(orphans, Orphan{Key: string(k), Value: displayValue(v), Reason: reason})
+			}
+			return nil
+		})
+	})
+	return orphans, err
+}
+
+// RemoveOrphans 删除缺少对应键的条目 返回删除数量和保留的数量
+// 对应键指向其他条目,或条目本身被其他条目指向时,无法判断哪一侧正确,只报告不删除,需要用rebind手动处理
+func RemoveOrphans() (removed, kept int, err error) {
+	err = db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		var candidates [][]byte
+		referenced := make(map[string]bool)
+		kept = 0
+		b.ForEach(func(k, v []byte) error {
+			referenced[referencedKey(k, v)] = true
+			switch orphanReason(tx, b, k, v) {
+			case "":
+			case orphanMissingForward, orphanMissingReverse:
+				candidates = append(candidates, append([]byte(nil), k...))
+			default:
+				kept++
+			}
+			return nil
+		})
+		var keys [][]byte
+		for _, k := range candidates {
+			if referenced[string(k)] {
+				kept++
+				continue
+			}
+			keys = append(keys, k)
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(keys)
+		return nil
+	})
+	return removed, kept, err
+}
+
+// referencedKey 条目的值所指向的键
+func referencedKey(k, v []byte) string {
+	if len(v) == 8 && !bytes.Contains(k, []byte(":")) && !strings.HasPrefix(string(k), "row-") {
+		return "row-" + strconv.FormatUint(binary.BigEndian.Uint64(v), 10)
+	}
+	return string(v)
+}
+
+// 条目异常的原因
+const (
+	orphanMissingForward   = "missing forward key"
+	orphanMissingReverse   = "missing reverse key"
+	orphanForwardElsewhere = "forward key points elsewhere"
+	orphanReverseElsewhere = "reverse key points elsewhere"
+)
+
+// orphanReason 返回条目异常的原因 正常时为空
+func orphanReason(tx *bbolt.Tx, b *bbolt.Bucket, k, v []byte) string {
+	key := string(k)
+	switch {
+	case key == CounterKey:
+		return ""
+	case strings.HasPrefix(key, "row-") && isMigratedRow(tx, b, key, v):
+		// 迁移生成的新虚拟值 正向键仍指向旧虚拟值
+		return ""
+	case strings.HasPrefix(key, "row-"):
+		forward := b.Get(v)
+		if forward == nil {
+			return orphanMissingForward
+		}
+		if len(forward) != 8 || "row-"+strconv.FormatUint(binary.BigEndian.Uint64(forward), 10) != key {
+			return orphanForwardElsewhere
+		}
+	case bytes.Contains(k, []byte(":")) && bytes.Contains(v, []byte(":")):
+		reverse := b.Get(v)
+		if reverse == nil {
+			return orphanMissingReverse
+		}
+		if !bytes.Equal(reverse, k) {
+			return orphanReverseElsewhere
+		}
+	case len(v) == 8:
+		reverse := b.Get([]byte("row-" + strconv.FormatUint(binary.BigEndian.Uint64(v), 10)))
+		if reverse == nil {
+			return orphanMissingReverse
+		}
+		if !bytes.Equal(reverse, k) {
+			return orphanReverseElsewhere
+		}
+	}
+	return ""
+}
+
+// isMigratedRow 反向键是否为迁移生成的新虚拟值
+func isMigratedRow(tx *bbolt.Tx, b *bbolt.Bucket, key string, v []byte) bool {
+	forward := b.Get(v)
+	if len(forward) != 8 {
+		return false
+	}
+	oldRow := strconv.FormatUint(binary.BigEndian.Uint64(forward), 10)
+	return string(tx.Bucket([]byte(AliasBucket)).Get([]byte(oldRow))) == strings.TrimPrefix(key, "row-")
+}
+
+func displayValue(v []byte) string {
+	if len(v) == 8 && !bytes.Contains(v, []byte(":")) {
+		return strconv.FormatUint(binary.BigEndian.Uint64(v), 10)
+	}
+	return string(v)
+}
+
+// ExportMappings 导出全部映射 format为json或csv
+func ExportMappings(w io.Writer, format string) error {
+	mappings, err := ListMappings("", 0)
+	if err != nil {
+		return err
+	}
+	if format == "csv" {
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"real_id", "virtual_id", "pro"})
+		for _, m := range mappings {
+			cw.Write([]string{m.RealID, m.VirtualID, strconv.FormatBool(m.Pro)})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(mappings)
+}
+
+// ImportMappings 导入映射 已存在且一致的跳过 与现有映射冲突的计入conflicts不写入
+func ImportMappings(r io.Reader, format string) (imported, conflicts int, err error) {
+	var mappings []Mapping
+	if format == "csv" {
+		records, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			return 0, 0, err
+		}
+		for i, rec := range records {
+			if len(rec) < 2 || (i == 0 && rec[0] == "real_id") {
+				continue
+			}
+			m := Mapping{RealID: rec[0], VirtualID: rec[1]}
+			if len(rec) > 2 {
+				m.Pro, _ = strconv.ParseBool(rec[2])
+			}
+			mappings = append(mappings, m)
+		}
+	} else if err := json.NewDecoder(r).Decode(&mappings); err != nil {
+		return 0, 0, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		for _, m := range mappings {
+			ok, err := importMapping(b, m)
+			if err != nil {
+				return err
+			}
+			if ok {
+				imported++
+			} else {
+				conflicts++
+			}
+		}
+		return nil
+	})
+	return imported, conflicts, err
+}
+
+// importMapping 写入一条映射 与现有映射冲突时返回false
+func importMapping(b *bbolt.Bucket, m Mapping) (bool, error) {
+	if m.RealID == "" || m.VirtualID == "" {
+		return false, nil
+	}
+	if m.Pro {
+		if !isVirtualPair(m.VirtualID) {
+			return false, nil
+		}
+		forward, reverse := b.Get([]byte(m.RealID)), b.Get([]byte(m.VirtualID))
+		if (forward != nil && string(forward) != m.VirtualID) || (reverse != nil && string(reverse) != m.RealID) {
+			return false, nil
+		}
+		if err := b.Put([]byte(m.RealID), []byte(m.VirtualID)); err != nil {
+			return false, err
+		}
+		return true, b.Put([]byte(m.VirtualID), []byte(m.RealID))
+	}
+
+	virtual, err := strconv.ParseUint(m.VirtualID, 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	rowKey := []byte("row-" + m.VirtualID)
+	if reverse := b.Get(rowKey); reverse != nil && string(reverse) != m.RealID {
+		return false, nil
+	}
+	if forward := b.Get([]byte(m.RealID)); forward != nil && (len(forward) != 8 || binary.BigEndian.Uint64(forward) != virtual) {
+		return false, nil
+	}
+	rowBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(rowBytes, virtual)
+	if err := b.Put([]byte(m.RealID), rowBytes); err != nil {
+		return false, err
+	}
+	// 递增模式下计数器需要越过导入的虚拟值
+	if !config.GetHashIDValue() {
+		if current := b.Get([]byte(CounterKey)); current == nil || binary.BigEndian.Uint64(current) < virtual {
+			if err := b.Put([]byte(CounterKey), rowBytes); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, b.Put(rowKey, []byte(m.RealID))
+}
+
+// RunAdminCommand 命令行管理idmap 用法见adminUsage
+func RunAdminCommand(cmd string, args []string, out io.Writer) error {
+	switch cmd {
+	case "search":
+		query := ""
+		if len(args) > 0 {
+			query = args[0]
+		}
+		mappings, err := ListMappings(query, 0)
+		if err != nil {
+			return err
+		}
+		for _, m := range mappings {
+			fmt.Fprintf(out, "%s\t%s\n", m.VirtualID, m.RealID)
+		}
+		fmt.Fprintf(out, "共%d条\n", len(mappings))
+	case "subkeys":
+		if len(args) != 1 {
+			return errors.New(adminUsage)
+		}
+		keys, err := FindSubKeysByIdPro(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, strings.Join(keys, "\n"))
+	case "rebind":
+		values := make([]int64, len(args))
+		for i, a := range args {
+			v, err := strconv.ParseInt(a, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid virtual value %s", a)
+			}
+			values[i] = v
+		}
+		var err error
+		switch len(values) {
+		case 2:
+			err = RebindVirtualValue(values[0], values[1])
+		case 4:
+			err = RebindVirtualValuePro(values[0], values[1], values[2], values[3])
+		default:
+			return errors.New(adminUsage)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "rebind完成")
+	case "orphans":
+		if len(args) > 0 && args[0] == "fix" {
+			removed, kept, err := RemoveOrphans()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "已删除%d条缺少对应键的条目\n", removed)
+			if kept > 0 {
+				fmt.Fprintf(out, "%d条异常条目涉及其他映射,未删除,请用orphans查看后rebind\n", kept)
+			}
+			return nil
+		}
+		orphans, err := FindOrphans()
+		if err != nil {
+			return err
+		}
+		for _, o := range orphans {
+			fmt.Fprintf(out, "%s\t%s\t%s\n", o.Key, o.Value, o.Reason)
+		}
+		fmt.Fprintf(out, "共%d条异常条目\n", len(orphans))
+	case "export", "import":
+		if len(args) != 1 {
+			return errors.New(adminUsage)
+		}
+		format := "json"
+		if strings.HasSuffix(strings.ToLower(args[0]), ".csv") {
+			format = "csv"
+		}
+		if cmd == "export" {
+			f, err := os.Create(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return ExportMappings(f, format)
+		}
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		imported, conflicts, err := ImportMappings(f, format)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "导入%d条,冲突跳过%d条\n", imported, conflicts)
+	case "collisions":
+		recorded, err := ListHashCollisions()
+		if err != nil {
+			return err
+		}
+		scanned, nonHash, err := ScanHashCollisions()
+		if err != nil {
+			return err
+		}
+		for _, c := range recorded {
+			fmt.Fprintf(out, "记录\t%s\t%d\t第%d次探测\t%v\n", c.ID, c.Row, c.Probe, c.CollidedWith)
+		}
+		for _, c := range scanned {
+			fmt.Fprintf(out, "扫描\t%s\t%d\t第%d次探测\t%v\n", c.ID, c.Row, c.Probe, c.CollidedWith)
+		}
+		fmt.Fprintf(out, "记录%d条,扫描到%d条,非哈希生成的映射%d条\n", len(recorded), len(scanned), nonHash)
+	case "migrate":
+		if len(args) == 0 {
+			return errors.New(adminUsage)
+		}
+		apply := len(args) > 1 && args[1] == "apply"
+		report, err := MigrateIDs(args[0], apply)
+		if err != nil {
+			return err
+		}
+		if !apply {
+			for _, c := range report.Changes {
+				fmt.Fprintf(out, "%s\t%d\n", c.RealID, c.Old)
+			}
+			fmt.Fprintf(out, "预计迁移%d条,跳过%d条,确认后追加apply执行,请先备份idmap.db\n", report.Migrated, report.Skipped)
+			fmt.Fprintf(out, "迁移后事件中仍上报旧虚拟值,新虚拟值在调用api时同样可以还原,之后出现的id按新方式生成\n")
+			return nil
+		}
+		for _, c := range report.Changes {
+			fmt.Fprintf(out, "%s\t%d -> %d\n", c.RealID, c.Old, c.New)
+		}
+		fmt.Fprintf(out, "已迁移%d条,跳过%d条,新虚拟值别名%d条 事件中仍上报旧虚拟值\n", report.Migrated, report.Skipped, report.Aliases)
+		if (args[0] == "hash") != config.GetHashIDValue() {
+			fmt.Fprintf(out, "请同步修改config.yml中的hash_id\n")
+		}
+	case "role":
+		return runRoleCommand(args, out)
+	default:
+		return errors.New(adminUsage)
+	}
+	return nil
+}
+
+// runRoleCommand 命令行管理角色 没有owner时可以在这里指定第一个owner scope省略时为global
+func runRoleCommand(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(adminUsage)
+	}
+	scope := func(n int) string {
+		if len(args) > n {
+			return args[n]
+		}
+		return RoleScopeGlobal
+	}
+	switch {
+	case args[0] == "list" && len(args) <= 2:
+		listScope := ""
+		if len(args) == 2 {
+			listScope = args[1]
+		}
+		entries, err := ListRoles(listScope)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			fmt.Fprintf(out, "%s\t%s\t%s\n", e.Scope, e.UserID, e.Role)
+		}
+		fmt.Fprintf(out, "共%d条\n", len(entries))
+	case args[0] == "set" && (len(args) == 3 || len(args) == 4):
+		entry, err := SetRole(scope(3), args[1], args[2])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "已将%s在%s的角色设为%s\n", entry.UserID, entry.Scope, entry.Role)
+	case args[0] == "del" && (len(args) == 2 || len(args) == 3):
+		if err := RemoveRole(scope(2), args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "已移除%s在%s的角色\n", args[1], scope(2))
+	default:
+		return errors.New(adminUsage)
+	}
+	return nil
+}
+
+const adminUsage = `用法: gensokyo -idmap <命令> [参数]
+  search [关键字]              按真实值或虚拟值搜索映射
+  subkeys <id>                 列出idmaps-pro中id下的全部子键
+  rebind <旧值> <新值>          修改虚拟值
+  rebind <旧群> <新群> <旧用户> <新用户>  修改idmaps-pro虚拟值
+  orphans [fix]                查找正反向不一致的条目 fix删除缺少对应键的条目
+  export <文件.json|文件.csv>   导出映射
+  import <文件.json|文件.csv>   导入映射,与现有映射冲突的条目会被跳过
+  collisions                   查看哈希虚拟值的碰撞记录
+  role list [作用域]             列出角色 省略作用域时列出全部
+  role set <用户id> <角色> [作用域]  分配角色 作用域为global或群/频道id,省略时为global
+  role del <用户id> [作用域]      移除角色
+  migrate <hash|increment> [apply]  按新方式生成虚拟值别名,事件中仍上报旧虚拟值`
@@ -0,0 +1,140 @@
+package idmap
+
+import (
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+// putRaw 直接写入一个键值
+func putRaw(t *testing.T, k, v string) {
+	t.Helper()
+	err := db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(BucketName)).Put([]byte(k), []byte(v))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func hasRaw(t *testing.T, k string) bool {
+	t.Helper()
+	var found bool
+	db.View(func(tx *bbolt.Tx) error {
+		found = tx.Bucket([]byte(BucketName)).Get([]byte(k)) != nil
+		return nil
+	})
+	return found
+}
+
+func TestLookupMappingProValue(t *testing.T) {
+	openTestDB(t)
+	putRow(t, "REALUSER", 123456)
+	// idmaps-pro的虚拟值恰好8个字符
+	putRaw(t, "GROUPA:USERA", "1234:567")
+	putRaw(t, "1234:567", "GROUPA:USERA")
+
+	mappings, err := LookupMapping("GROUPA:USERA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mappings) != 1 || mappings[0].VirtualID != "1234:567" || !mappings[0].Pro {
+		t.Errorf("pro real id: %+v", mappings)
+	}
+	mappings, _ = LookupMapping("1234:567")
+	if len(mappings) != 1 || mappings[0].RealID != "GROUPA:USERA" {
+		t.Errorf("pro virtual id: %+v", mappings)
+	}
+	mappings, _ = LookupMapping("REALUSER")
+	if len(mappings) != 1 || mappings[0].VirtualID != "123456" {
+		t.Errorf("real id: %+v", mappings)
+	}
+	mappings, _ = LookupMapping("123456")
+	if len(mappings) != 1 || mappings[0].RealID != "REALUSER" {
+		t.Errorf("virtual id: %+v", mappings)
+	}
+}
+
+func TestRemoveOrphansKeepsConflicts(t *testing.T) {
+	openTestDB(t)
+	putRow(t, "GOOD", 1)
+	// 缺少反向键
+	putRow(t, "NOREVERSE", 2)
+	err := db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(BucketName)).Delete([]byte("row-2"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 缺少正向键
+	putRaw(t, "row-3", "NOFORWARD")
+	// 反向键指向其他条目 无法判断哪一侧正确
+	putRow(t, "OTHER", 4)
+	putRaw(t, "CONFLICT", string([]byte{0, 0, 0, 0, 0, 0, 0, 4}))
+	putRaw(t, "A:B", "5:6")
+	putRaw(t, "5:6", "C:D")
+	// 只有一侧的idmaps-pro条目
+	putRaw(t, "E:F", "7:8")
+
+	orphans, err := FindOrphans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 6 {
+		t.Errorf("found %d orphans: %+v", len(orphans), orphans)
+	}
+
+	removed, kept, err := RemoveOrphans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 5:6缺少反向键C:D,但被A:B指向,同样保留
+	if removed != 3 || kept != 3 {
+		t.Errorf("removed %d kept %d, want 3 and 3", removed, kept)
+	}
+	for _, k := range []string{"NOREVERSE", "row-3", "E:F"} {
+		if hasRaw(t, k) {
+			t.Errorf("%s should be removed", k)
+		}
+	}
+	for _, k := range []string{"GOOD", "row-1", "OTHER", "row-4", "CONFLICT", "A:B", "5:6"} {
+		if !hasRaw(t, k) {
+			t.Errorf("%s should be kept", k)
+		}
+	}
+}
+
+func TestRoleCommandBootstrapsOwner(t *testing.T) {
+	openTestDB(t)
+	invalidateRoleCache()
+	defer invalidateRoleCache()
+	if HasOwners() {
+		t.Fatal("empty database should have no owner")
+	}
+
+	var out strings.Builder
+	if err := RunAdminCommand("role", []string{"set", "REALUSER", "owner"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !HasOwners() || ResolveRole("GROUPA", RoleMember, "REALUSER") != RoleOwner {
+		t.Errorf("owner not assigned: %s", out.String())
+	}
+	if err := RunAdminCommand("role", []string{"set", "OTHER", "admin", "GROUPA"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := RunAdminCommand("role", []string{"list"}, &out); err != nil || !strings.Contains(out.String(), "共2条") {
+		t.Errorf("list: %q %v", out.String(), err)
+	}
+
+	if err := RunAdminCommand("role", []string{"del", "REALUSER"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if HasOwners() {
+		t.Error("owner not removed")
+	}
+	if err := RunAdminCommand("role", []string{"set", "REALUSER"}, &out); err == nil {
+		t.Error("expected usage error")
+	}
+}
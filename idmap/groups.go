@@ -0,0 +1,180 @@
+package idmap
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// 入群请求的处理状态
+const (
+	GroupRequestPending  = "pending"
+	GroupRequestApproved = "approved"
+	GroupRequestRejected = "rejected"
+)
+
+// 未处理的入群请求保存时间
+const groupRequestTTL = 7 * 24 * time.Hour
+
+var (
+	ErrGroupRequestNotFound = errors.New("group request not found")
+	ErrGroupRequestHandled  = errors.New("group request already handled")
+)
+
+// JoinedGroup 机器人所在的群 由入群退群和主动推送开关事件维护
+type JoinedGroup struct {
+	GroupOpenID   string `json:"group_openid"`
+	GroupID       int64  `json:"group_id"`
+	InviterOpenID string `json:"inviter_openid"`
+	JoinTime      int64  `json:"join_time"`
+	PushEnabled   bool   `json:"push_enabled"` // 群内是否允许机器人主动推送
+}
+
+// GroupRequest 机器人被邀请入群时产生的请求,应用端通过flag处理
+type GroupRequest struct {
+	Flag        string `json:"flag"`
+	GroupOpenID string `json:"group_openid"`
+	GroupID     int64  `json:"group_id"`
+	UserOpenID  string `json:"user_openid"`
+	UserID      int64  `json:"user_id"`
+	EventID     string `json:"event_id"`
+	Time        int64  `json:"time"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// StoreJoinedGroup 记录机器人加入的群
+func StoreJoinedGroup(group JoinedGroup) error {
+	return putJSON(GroupsBucket, group.GroupOpenID, group)
+}
+
+// RemoveJoinedGroup 机器人退群后移除
+func RemoveJoinedGroup(groupOpenID string) error {
+	knownGroups.Delete(groupOpenID)
+	return db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(GroupsBucket)).Delete([]byte(groupOpenID))
+	})
+}
+
+// GetJoinedGroup 按真实群id获取
+func GetJoinedGroup(groupOpenID string) (JoinedGroup, bool) {
+	var group JoinedGroup
+	ok := getJSON(GroupsBucket, groupOpenID, &group)
+	return group, ok
+}
+
+// ListJoinedGroups 按加入时间排序返回所有已加入的群
+func ListJoinedGroups() ([]JoinedGroup, error) {
+	var groups []JoinedGroup
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(GroupsBucket)).ForEach(func(k, v []byte) error {
+			var group JoinedGroup
+			if json.Unmarshal(v, &group) == nil {
+				groups = append(groups, group)
+			}
+			return nil
+		})
+	})
+	sort.Slice(groups, func(i, j int) bool { return groups[i].JoinTime < groups[j].JoinTime })
+	return groups, err
+}
+
+// SetGroupPushEnabled 更新群的主动推送开关,未记录过的群会一并记录
+func SetGroupPushEnabled(groupOpenID string, groupID int64, enabled bool) error {
+	group, ok := GetJoinedGroup(groupOpenID)
+	if !ok {
+		group = JoinedGroup{
+			GroupOpenID: groupOpenID,
+			JoinTime:    time.Now().Unix(),
+		}
+	}
+	group.GroupID = groupID
+	group.PushEnabled = enabled
+	return StoreJoinedGroup(group)
+}
+
+// StoreGroupRequest 保存待处理的入群请求 顺带清理过期请求
+func StoreGroupRequest(req GroupRequest) error {
+	if req.Status == "" {
+		req.Status = GroupRequestPending
+	}
+	expired := time.Now().Add(-groupRequestTTL).Unix()
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(GroupReqBucket))
+		var keys [][]byte
+		b.ForEach(func(k, v []byte) error {
+			var old GroupRequest
+			if json.Unmarshal(v, &old) != nil || old.Time < expired {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return b.Put([]byte(req.Flag), data)
+	})
+}
+
+// RetrieveGroupRequest 根据flag取回入群请求
+func RetrieveGroupRequest(flag string) (GroupRequest, bool) {
+	var req GroupRequest
+	ok := getJSON(GroupReqBucket, flag, &req)
+	return req, ok
+}
+
+// ResolveGroupRequest 处理入群请求,每个请求只能处理一次
+func ResolveGroupRequest(flag string, approve bool, reason string) (GroupRequest, error) {
+	var req GroupRequest
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(GroupReqBucket))
+		v := b.Get([]byte(flag))
+		if v == nil || json.Unmarshal(v, &req) != nil {
+			return ErrGroupRequestNotFound
+		}
+		if req.Status != GroupRequestPending {
+			return ErrGroupRequestHandled
+		}
+		req.Status = GroupRequestRejected
+		if approve {
+			req.Status = GroupRequestApproved
+		}
+		req.Reason = reason
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(flag), data)
+	})
+	return req, err
+}
+
+func putJSON(bucket, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Put([]byte(key), data)
+	})
+}
+
+func getJSON(bucket, key string, value interface{}) bool {
+	var data []byte
+	db.View(func(tx *bbolt.Tx) error {
+		if v := tx.Bucket([]byte(bucket)).Get([]byte(key)); v != nil {
+			data = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return data != nil && json.Unmarshal(data, value) == nil
+}
@@ -0,0 +1,349 @@
+package idmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"go.etcd.io/bbolt"
+)
+
+// 哈希虚拟值的探测次数 前10次与旧版本一致,依次取9到18位数字
+const hashProbeLimit = 32
+
+// HashCollision 分配哈希虚拟值时发生的碰撞 Probe为最终使用的探测序号
+type HashCollision struct {
+	Bucket       string   `json:"bucket"`
+	ID           string   `json:"id"`
+	Row          int64    `json:"row"`
+	Probe        int      `json:"probe"`
+	CollidedWith []string `json:"collided_with,omitempty"`
+	Time         int64    `json:"time"`
+}
+
+// MigrationReport 虚拟值迁移结果
+// 已有的id在事件中仍上报旧虚拟值,应用端保存的id不需要修改;新虚拟值作为别名,调用api时同样可以还原
+// 迁移后才出现的id按新的方式生成
+type MigrationReport struct {
+	Target   string        `json:"target"`
+	Migrated int           `json:"migrated"`
+	Skipped  int           `json:"skipped"`
+	Aliases  int           `json:"aliases"`
+	Applied  bool          `json:"applied"`
+	Changes  []MigratedRow `json:"changes,omitempty"`
+}
+
+// MigratedRow 一个id迁移前后的虚拟值 预览时New为0
+type MigratedRow struct {
+	RealID string `json:"real_id"`
+	Old    int64  `json:"old"`
+	New    int64  `json:"new"`
+}
+
+// hashCandidate 第probe次探测的候选虚拟值
+func hashCandidate(id string, probe int) (int64, error) {
+	if probe < 10 {
+		return GenerateRowID(id, 9+probe)
+	}
+	// 18位仍碰撞时对id加盐继续探测
+	return GenerateRowID(id+"#"+strconv.Itoa(probe), 18)
+}
+
+// hashProbe 返回row在id探测序列中的位置 不在序列中时返回-1
+func hashProbe(id string, row int64) int {
+	for probe := 0; probe < hashProbeLimit; probe++ {
+		if candidate, err := hashCandidate(id, probe); err == nil && candidate == row {
+			return probe
+		}
+	}
+	return -1
+}
+
+// allocateHashRow 按探测序列为id找到未被其他id占用的虚拟值 需在写事务中调用
+// 发生碰撞时记录到collisions
+func allocateHashRow(tx *bbolt.Tx, b *bbolt.Bucket, bucketName, id string) (int64, error) {
+	var collided []string
+	for probe := 0; probe < hashProbeLimit; probe++ {
+		row, err := hashCandidate(id, probe)
+		if err != nil {
+			return 0, err
+		}
+		owner := b.Get([]byte(fmt.Sprintf("row-%d", row)))
+		if owner != nil && string(owner) != id {
+			collided = append(collided, string(owner))
+			continue
+		}
+		if probe > 0 {
+			record := HashCollision{
+				Bucket:       bucketName,
+				ID:           id,
+				Row:          row,
+				Probe:        probe,
+				CollidedWith: collided,
+				Time:         time.Now().Unix(),
+			}
+			data, err := json.Marshal(record)
+			if err != nil {
+				return 0, err
+			}
+			if err := tx.Bucket([]byte(CollisionBucket)).Put([]byte(bucketName+"/"+id), data); err != nil {
+				return 0, err
+			}
+			mylog.Printf("虚拟值碰撞: %s 与 %v 冲突,第%d次探测使用 %d", id, collided, probe, row)
+		}
+		return row, nil
+	}
+	return 0, fmt.Errorf("unable to find a unique row ID for %s after %d probes", id, hashProbeLimit)
+}
+
+// storeHashRow 为idmaps-pro中新出现的id分配哈希虚拟值并补全正反向键
+func storeHashRow(tx *bbolt.Tx, b *bbolt.Bucket, bucketName, id string) (int64, error) {
+	row, err := allocateHashRow(tx, b, bucketName, id)
+	if err != nil {
+		return 0, err
+	}
+	return row, fillHashKeys(b, id, row)
+}
+
+// proHashRow idmaps-pro中id的虚拟值
+// 已有的id沿用旧版本不检查碰撞的9位哈希,保证同一个群的新老成员得到相同的群虚拟值
+// 只有新出现的id按探测序列分配,碰撞时使用的备用值记录在collisions中
+func proHashRow(tx *bbolt.Tx, b *bbolt.Bucket, id string) (int64, error) {
+	if row, ok := recordedHashRow(tx, BucketName, id); ok {
+		return row, nil
+	}
+	if b.Get([]byte(id)) != nil || hasSubKeys(b, id) {
+		row, err := GenerateRowID(id, 9)
+		if err != nil {
+			return 0, err
+		}
+		return row, fillHashKeys(b, id, row)
+	}
+	return storeHashRow(tx, b, BucketName, id)
+}
+
+// fillHashKeys 补全单个id的正反向键 参数不全时可以按单个id还原 已被其他id占用的反向键不覆盖
+func fillHashKeys(b *bbolt.Bucket, id string, row int64) error {
+	rowKey := []byte(fmt.Sprintf("row-%d", row))
+	if b.Get(rowKey) == nil {
+		if err := b.Put(rowKey, []byte(id)); err != nil {
+			return err
+		}
+	}
+	if b.Get([]byte(id)) == nil {
+		rowBytes := make([]byte, 8)
+		binary.BigEndian.PutUint64(rowBytes, uint64(row))
+		if err := b.Put([]byte(id), rowBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordedHashRow 分配时因碰撞使用了备用值的id
+func recordedHashRow(tx *bbolt.Tx, bucketName, id string) (int64, bool) {
+	data := tx.Bucket([]byte(CollisionBucket)).Get([]byte(bucketName + "/" + id))
+	if data == nil {
+		return 0, false
+	}
+	var record HashCollision
+	if err := json.Unmarshal(data, &record); err != nil {
+		return 0, false
+	}
+	return record.Row, true
+}
+
+// hasSubKeys idmaps-pro中是否已有以id为群的复合键
+func hasSubKeys(b *bbolt.Bucket, id string) bool {
+	prefix := []byte(id + ":")
+	k, _ := b.Cursor().Seek(prefix)
+	return k != nil && bytes.HasPrefix(k, prefix)
+}
+
+// ListHashCollisions 列出分配时记录的碰撞
+func ListHashCollisions() ([]HashCollision, error) {
+	var records []HashCollision
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(CollisionBucket)).ForEach(func(k, v []byte) error {
+			var record HashCollision
+			if json.Unmarshal(v, &record) == nil {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+	return records, err
+}
+
+// ScanHashCollisions 扫描ids中不在首次探测位置的哈希虚拟值,即历史上发生过碰撞的映射
+// nonHash为不属于哈希探测序列的映射数量 如递增模式生成或手动bind的值
+func ScanHashCollisions() (collisions []HashCollision, nonHash int, err error) {
+	err = db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		return b.ForEach(func(k, v []byte) error {
+			if len(v) != 8 || bytes.Contains(k, []byte(":")) || strings.HasPrefix(string(k), "row-") || string(k) == CounterKey {
+				return nil
+			}
+			id, row := string(k), int64(binary.BigEndian.Uint64(v))
+			probe := hashProbe(id, row)
+			if probe < 0 {
+				nonHash++
+				return nil
+			}
+			if probe == 0 {
+				return nil
+			}
+			record := HashCollision{Bucket: BucketName, ID: id, Row: row, Probe: probe}
+			for p := 0; p < probe; p++ {
+				candidate, _ := hashCandidate(id, p)
+				if owner := b.Get([]byte(fmt.Sprintf("row-%d", candidate))); owner != nil {
+					record.CollidedWith = append(record.CollidedWith, string(owner))
+				}
+			}
+			collisions = append(collisions, record)
+			return nil
+		})
+	})
+	return collisions, nonHash, err
+}
+
+// ReportHashCollisions 服务启动时在后台扫描并输出碰撞情况
+func ReportHashCollisions() {
+	if !config.GetHashIDValue() {
+		return
+	}
+	collisions, _, err := ScanHashCollisions()
+	if err != nil {
+		mylog.Printf("扫描虚拟值碰撞失败: %v", err)
+		return
+	}
+	if len(collisions) > 0 {
+		mylog.Printf("idmap中有%d个虚拟值因哈希碰撞使用了备用值,可使用 -idmap collisions 查看", len(collisions))
+	}
+}
+
+// MigrateIDs 为非pro映射按target(hash或increment)方式生成新虚拟值
+// 正向键与旧反向键不变,事件中仍上报旧虚拟值;新虚拟值写入反向键,别名记录旧值到新值的对应
+// 已迁移过的id跳过 apply为false时只统计不写入
+func MigrateIDs(target string, apply bool) (MigrationReport, error) {
+	report := MigrationReport{Target: target, Applied: apply}
+	if target != "hash" && target != "increment" {
+		return report, fmt.Errorf("unknown migration target %s", target)
+	}
+	run := db.View
+	if apply {
+		run = db.Update
+	}
+	err := run(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		aliases := tx.Bucket([]byte(AliasBucket))
+		configs := tx.Bucket([]byte(ConfigBucket))
+
+		// 先收集再写入 避免边遍历边修改
+		type entry struct {
+			id  string
+			row int64
+		}
+		var entries []entry
+		b.ForEach(func(k, v []byte) error {
+			if len(v) != 8 || bytes.Contains(k, []byte(":")) || strings.HasPrefix(string(k), "row-") || string(k) == CounterKey {
+				return nil
+			}
+			entries = append(entries, entry{string(k), int64(binary.BigEndian.Uint64(v))})
+			return nil
+		})
+
+		var counter int64
+		if current := b.Get([]byte(CounterKey)); current != nil {
+			counter = int64(binary.BigEndian.Uint64(current))
+		}
+		for _, e := range entries {
+			oldRow := strconv.FormatInt(e.row, 10)
+			if aliases.Get([]byte(oldRow)) != nil {
+				report.Skipped++
+				continue
+			}
+			if target == "hash" && hashProbe(e.id, e.row) >= 0 {
+				report.Skipped++
+				continue
+			}
+			if target == "increment" && hashProbe(e.id, e.row) < 0 {
+				report.Skipped++
+				continue
+			}
+			report.Migrated++
+			if !apply {
+				report.Changes = append(report.Changes, MigratedRow{RealID: e.id, Old: e.row})
+				continue
+			}
+
+			var newRow int64
+			if target == "hash" {
+				row, err := allocateHashRow(tx, b, BucketName, e.id)
+				if err != nil {
+					return err
+				}
+				newRow = row
+			} else {
+				counter++
+				for b.Get([]byte(fmt.Sprintf("row-%d", counter))) != nil {
+					counter++
+				}
+				newRow = counter
+			}
+			// 正向键仍指向旧虚拟值 新虚拟值只写反向键
+			if err := b.Put([]byte(fmt.Sprintf("row-%d", newRow)), []byte(e.id)); err != nil {
+				return err
+			}
+			if err := aliases.Put([]byte(oldRow), []byte(strconv.FormatInt(newRow, 10))); err != nil {
+				return err
+			}
+			report.Aliases++
+			report.Changes = append(report.Changes, MigratedRow{RealID: e.id, Old: e.row, New: newRow})
+			// 以虚拟值为section的配置复制到新虚拟值
+			if err := copyConfigSection(configs, oldRow, strconv.FormatInt(newRow, 10)); err != nil {
+				return err
+			}
+		}
+		if apply && target == "increment" {
+			rowBytes := make([]byte, 8)
+			binary.BigEndian.PutUint64(rowBytes, uint64(counter))
+			return b.Put([]byte(CounterKey), rowBytes)
+		}
+		return nil
+	})
+	return report, err
+}
+
+// copyConfigSection 复制section下的全部配置
+func copyConfigSection(b *bbolt.Bucket, from, to string) error {
+	prefix := []byte(from + ":")
+	var keys, values [][]byte
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		keys = append(keys, append([]byte(to+":"), k[len(prefix):]...))
+		values = append(values, append([]byte(nil), v...))
+	}
+	for i := range keys {
+		if err := b.Put(keys[i], values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsAliasRow 虚拟值是否已迁移并有对应的新虚拟值
+func IsAliasRow(row string) bool {
+	var alias bool
+	db.View(func(tx *bbolt.Tx) error {
+		alias = tx.Bucket([]byte(AliasBucket)).Get([]byte(row)) != nil
+		return nil
+	})
+	return alias
+}
@@ -0,0 +1,244 @@
+package idmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+// openTestDB 在临时目录中打开数据库并替换包内的db
+func openTestDB(t *testing.T) {
+	t.Helper()
+	testDB, err := bbolt.Open(filepath.Join(t.TempDir(), "idmap.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = testDB.Update(func(tx *bbolt.Tx) error {
+		for _, name := range []string{BucketName, ConfigBucket, CollisionBucket, AliasBucket, MsgScopeBucket, RolesBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := db
+	db = testDB
+	t.Cleanup(func() {
+		db = old
+		testDB.Close()
+	})
+}
+
+// putRow 写入单个id的正反向键
+func putRow(t *testing.T, id string, row int64) {
+	t.Helper()
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		rowBytes := make([]byte, 8)
+		binary.BigEndian.PutUint64(rowBytes, uint64(row))
+		if err := b.Put([]byte(id), rowBytes); err != nil {
+			return err
+		}
+		return b.Put([]byte(fmt.Sprintf("row-%d", row)), []byte(id))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustCandidate(t *testing.T, id string, probe int) int64 {
+	t.Helper()
+	row, err := hashCandidate(id, probe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return row
+}
+
+func TestHashCandidateMatchesLegacy(t *testing.T) {
+	for probe := 0; probe < 10; probe++ {
+		legacy, _ := GenerateRowID("group-1", 9+probe)
+		if got := mustCandidate(t, "group-1", probe); got != legacy {
+			t.Fatalf("probe %d = %d, want %d", probe, got, legacy)
+		}
+	}
+	row := mustCandidate(t, "group-1", 12)
+	if hashProbe("group-1", row) != 12 {
+		t.Fatalf("hashProbe(%d) = %d, want 12", row, hashProbe("group-1", row))
+	}
+	if hashProbe("group-1", 1) != -1 {
+		t.Fatal("increment row should not be in the probe sequence")
+	}
+}
+
+func TestAllocateHashRowProbes(t *testing.T) {
+	openTestDB(t)
+	putRow(t, "other", mustCandidate(t, "new", 0))
+
+	var row int64
+	err := db.Update(func(tx *bbolt.Tx) (err error) {
+		row, err = storeHashRow(tx, tx.Bucket([]byte(BucketName)), BucketName, "new")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustCandidate(t, "new", 1); row != want {
+		t.Fatalf("row = %d, want %d", row, want)
+	}
+	records, err := ListHashCollisions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != "new" || records[0].Probe != 1 || records[0].CollidedWith[0] != "other" {
+		t.Fatalf("collisions = %+v", records)
+	}
+	scanned, _, err := ScanHashCollisions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scanned) != 1 || scanned[0].Row != row {
+		t.Fatalf("scanned = %+v", scanned)
+	}
+}
+
+func TestStoreIDProKeepsLegacyRow(t *testing.T) {
+	openTestDB(t)
+	legacy := mustCandidate(t, "group", 0)
+	// 旧版本写入的群 群的9位哈希已被其他id占用
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		member := mustCandidate(t, "user-1", 0)
+		if err := b.Put([]byte("group:user-1"), []byte(fmt.Sprintf("%d:%d", legacy, member))); err != nil {
+			return err
+		}
+		return b.Put([]byte(fmt.Sprintf("%d:%d", legacy, member)), []byte("group:user-1"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	putRow(t, "other", legacy)
+
+	row, _, err := StoreIDPro("group", "user-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row != legacy {
+		t.Fatalf("existing group row = %d, want legacy %d", row, legacy)
+	}
+}
+
+func TestStoreIDProProbesNewID(t *testing.T) {
+	openTestDB(t)
+	putRow(t, "other", mustCandidate(t, "group", 0))
+
+	first, _, err := StoreIDPro("group", "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustCandidate(t, "group", 1); first != want {
+		t.Fatalf("new group row = %d, want %d", first, want)
+	}
+	// 同一个群的其他成员得到相同的群虚拟值
+	second, _, err := StoreIDPro("group", "user-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Fatalf("second member row = %d, want %d", second, first)
+	}
+}
+
+func TestMigrateIDs(t *testing.T) {
+	openTestDB(t)
+	putRow(t, "increment-id", 1)
+	hashed := mustCandidate(t, "hash-id", 0)
+	putRow(t, "hash-id", hashed)
+	err := db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(ConfigBucket)).Put([]byte("1:nick"), []byte("n"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MigrateIDs("unknown", false); err == nil {
+		t.Fatal("expected error for unknown target")
+	}
+
+	preview, err := MigrateIDs("hash", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Migrated != 1 || preview.Skipped != 1 || preview.Aliases != 0 {
+		t.Fatalf("preview = %+v", preview)
+	}
+	if len(preview.Changes) != 1 || preview.Changes[0].RealID != "increment-id" || preview.Changes[0].Old != 1 || preview.Changes[0].New != 0 {
+		t.Fatalf("preview changes = %+v", preview.Changes)
+	}
+	if _, v, _ := RetrieveVirtualValuev2("increment-id"); v != "1" {
+		t.Fatalf("preview wrote forward key: %s", v)
+	}
+
+	report, err := MigrateIDs("hash", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRow := mustCandidate(t, "increment-id", 0)
+	if report.Migrated != 1 || report.Aliases != 1 || len(report.Changes) != 1 || report.Changes[0].New != newRow {
+		t.Fatalf("report = %+v", report)
+	}
+
+	err = db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		// 正向键不变 事件中仍上报旧虚拟值
+		if v := b.Get([]byte("increment-id")); binary.BigEndian.Uint64(v) != 1 {
+			t.Errorf("forward key = %d, want 1", binary.BigEndian.Uint64(v))
+		}
+		if v := b.Get([]byte(fmt.Sprintf("row-%d", newRow))); string(v) != "increment-id" {
+			t.Errorf("new reverse key = %q", v)
+		}
+		if v := b.Get([]byte("row-1")); string(v) != "increment-id" {
+			t.Errorf("old reverse key = %q", v)
+		}
+		if v := tx.Bucket([]byte(AliasBucket)).Get([]byte("1")); string(v) != strconv.FormatInt(newRow, 10) {
+			t.Errorf("alias = %q", v)
+		}
+		if v := tx.Bucket([]byte(ConfigBucket)).Get([]byte(strconv.FormatInt(newRow, 10) + ":nick")); string(v) != "n" {
+			t.Errorf("config section not copied: %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsAliasRow("1") {
+		t.Fatal("old row should be reported as migrated")
+	}
+	if _, v, _ := RetrieveVirtualValuev2("increment-id"); v != "1" {
+		t.Errorf("reported virtual value = %s, want 1", v)
+	}
+	for _, row := range []string{"1", strconv.FormatInt(newRow, 10)} {
+		if id, err := RetrieveRowByIDv2(row); err != nil || id != "increment-id" {
+			t.Errorf("RetrieveRowByIDv2(%s) = %q, %v", row, id, err)
+		}
+	}
+	if orphans, err := FindOrphans(); err != nil || len(orphans) != 0 {
+		t.Errorf("migration left orphans: %+v %v", orphans, err)
+	}
+
+	// 再次迁移时已迁移和已是哈希值的映射全部跳过
+	again, err := MigrateIDs("hash", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Migrated != 0 || again.Skipped != 2 {
+		t.Fatalf("second migration = %+v", again)
+	}
+}
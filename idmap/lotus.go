@@ -0,0 +1,58 @@
+package idmap
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hoshinonyaruko/gensokyo/lotus"
+	"go.etcd.io/bbolt"
+)
+
+// LotusStore 在主gsk的idmap数据库中保存从gsk凭据
+type LotusStore struct{}
+
+func (LotusStore) LoadLotusSecondaries() ([]lotus.Secondary, error) {
+	var list []lotus.Secondary
+	err := db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(LotusBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", LotusBucket)
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var s lotus.Secondary
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			list = append(list, s)
+			return nil
+		})
+	})
+	return list, err
+}
+
+func (LotusStore) SaveLotusSecondary(s lotus.Secondary) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(LotusBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", LotusBucket)
+		}
+		return b.Put([]byte(s.ID), data)
+	})
+}
+
+func (LotusStore) DeleteLotusSecondary(id string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(LotusBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", LotusBucket)
+		}
+		if b.Get([]byte(id)) == nil {
+			return lotus.ErrUnknownSecondary
+		}
+		return b.Delete([]byte(id))
+	})
+}
@@ -0,0 +1,59 @@
+package idmap
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hoshinonyaruko/gensokyo/markdown"
+	"github.com/hoshinonyaruko/gensokyo/structs"
+	"go.etcd.io/bbolt"
+)
+
+// MarkdownStore 在idmap数据库中保存webui添加的md模板
+type MarkdownStore struct{}
+
+func (MarkdownStore) LoadMarkdownTemplates() ([]structs.MarkdownTemplate, error) {
+	var list []structs.MarkdownTemplate
+	err := db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(MarkdownBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", MarkdownBucket)
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var t structs.MarkdownTemplate
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			list = append(list, t)
+			return nil
+		})
+	})
+	return list, err
+}
+
+func (MarkdownStore) SaveMarkdownTemplate(t structs.MarkdownTemplate) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(MarkdownBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", MarkdownBucket)
+		}
+		return b.Put([]byte(t.Name), data)
+	})
+}
+
+func (MarkdownStore) DeleteMarkdownTemplate(name string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(MarkdownBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", MarkdownBucket)
+		}
+		if b.Get([]byte(name)) == nil {
+			return markdown.ErrUnknownTemplate
+		}
+		return b.Delete([]byte(name))
+	})
+}
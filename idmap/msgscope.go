@@ -0,0 +1,168 @@
+package idmap
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"go.etcd.io/bbolt"
+)
+
+// 信息来源的保存时间,超过后无法只凭message_id撤回
+const msgScopeTTL = 3 * 24 * time.Hour
+
+// 每写入这么多条清理一次过期记录
+const msgScopeCleanupEvery = 1000
+
+// 信息来源先缓存在内存中,每隔这么久合并为一次写事务,避免每条信息都写一次数据库
+const msgScopeFlushInterval = time.Second
+
+// 信息来源类型,与real_message_type一致
+const (
+	ScopeGroup        = "group"
+	ScopeGroupPrivate = "group_private"
+	ScopeGuild        = "guild"
+	ScopeGuildPrivate = "guild_private"
+)
+
+// MessageScope 缓存message_id时一并记录的信息来源,撤回时据此选择接口
+type MessageScope struct {
+	Type     string `json:"type"`      // group group_private guild guild_private
+	TargetID string `json:"target_id"` // 真实的群id 用户id 子频道id 频道私信为guild_id
+	BotSent  bool   `json:"bot_sent"`  // 是否为机器人发出的信息
+	Time     int64  `json:"time"`
+}
+
+var (
+	memoryScopes   = make(map[string]MessageScope)
+	memoryScopesMu sync.Mutex
+	scopeWrites    int64
+
+	// 等待写入数据库的信息来源
+	pendingScopes   = make(map[string][]byte)
+	pendingScopesMu sync.Mutex
+	flushScopesOnce sync.Once
+)
+
+// StoreMessageScope 记录真实msg_id的来源 开启memory_msgid时只保存在内存中
+// 否则先放入待写入队列,由后台每隔msgScopeFlushInterval批量写入数据库
+func StoreMessageScope(msgID string, scope MessageScope) {
+	if msgID == "" {
+		return
+	}
+	scope.Time = time.Now().Unix()
+	cleanup := atomic.AddInt64(&scopeWrites, 1)%msgScopeCleanupEvery == 0
+
+	if config.GetMemoryMsgid() {
+		memoryScopesMu.Lock()
+		memoryScopes[msgID] = scope
+		if cleanup {
+			expired := time.Now().Add(-msgScopeTTL).Unix()
+			for k, v := range memoryScopes {
+				if v.Time < expired {
+					delete(memoryScopes, k)
+				}
+			}
+		}
+		memoryScopesMu.Unlock()
+		return
+	}
+
+	data, err := json.Marshal(scope)
+	if err != nil {
+		return
+	}
+	pendingScopesMu.Lock()
+	pendingScopes[msgID] = data
+	pendingScopesMu.Unlock()
+	flushScopesOnce.Do(func() {
+		go func() {
+			for range time.Tick(msgScopeFlushInterval) {
+				flushMessageScopes()
+			}
+		}()
+	})
+	if cleanup {
+		go cleanupMessageScopes()
+	}
+}
+
+// RetrieveMessageScope 根据真实msg_id取回信息来源
+func RetrieveMessageScope(msgID string) (MessageScope, bool) {
+	var scope MessageScope
+	if config.GetMemoryMsgid() {
+		memoryScopesMu.Lock()
+		defer memoryScopesMu.Unlock()
+		scope, ok := memoryScopes[msgID]
+		return scope, ok
+	}
+
+	pendingScopesMu.Lock()
+	data := pendingScopes[msgID]
+	pendingScopesMu.Unlock()
+	if data == nil {
+		db.View(func(tx *bbolt.Tx) error {
+			if v := tx.Bucket([]byte(MsgScopeBucket)).Get([]byte(msgID)); v != nil {
+				data = append([]byte(nil), v...)
+			}
+			return nil
+		})
+	}
+	if data == nil || json.Unmarshal(data, &scope) != nil {
+		return scope, false
+	}
+	return scope, true
+}
+
+// flushMessageScopes 把待写入的信息来源在一个写事务中写入数据库
+func flushMessageScopes() {
+	pendingScopesMu.Lock()
+	if len(pendingScopes) == 0 {
+		pendingScopesMu.Unlock()
+		return
+	}
+	batch := pendingScopes
+	pendingScopes = make(map[string][]byte)
+	pendingScopesMu.Unlock()
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(MsgScopeBucket))
+		for msgID, data := range batch {
+			if err := b.Put([]byte(msgID), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		mylog.Printf("Error storing message scopes: %v", err)
+	}
+}
+
+// cleanupMessageScopes 删除过期的信息来源
+func cleanupMessageScopes() {
+	expired := time.Now().Add(-msgScopeTTL).Unix()
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(MsgScopeBucket))
+		var keys [][]byte
+		b.ForEach(func(k, v []byte) error {
+			var scope MessageScope
+			if json.Unmarshal(v, &scope) != nil || scope.Time < expired {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		mylog.Printf("Error cleaning message scopes: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package idmap
+
+import (
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+// storedScope 直接读取数据库中的信息来源
+func storedScope(t *testing.T, msgID string) []byte {
+	t.Helper()
+	var data []byte
+	db.View(func(tx *bbolt.Tx) error {
+		if v := tx.Bucket([]byte(MsgScopeBucket)).Get([]byte(msgID)); v != nil {
+			data = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return data
+}
+
+func TestMessageScopeBatched(t *testing.T) {
+	openTestDB(t)
+
+	StoreMessageScope("msg1", MessageScope{Type: ScopeGroup, TargetID: "group1"})
+	StoreMessageScope("msg2", MessageScope{Type: ScopeGuild, TargetID: "channel1", BotSent: true})
+	StoreMessageScope("", MessageScope{Type: ScopeGroup})
+
+	// 写入数据库之前也能取回
+	if storedScope(t, "msg1") != nil {
+		t.Fatal("scope written to the database before the flush")
+	}
+	scope, ok := RetrieveMessageScope("msg2")
+	if !ok || scope.Type != ScopeGuild || scope.TargetID != "channel1" || !scope.BotSent || scope.Time == 0 {
+		t.Fatalf("pending scope = %+v, %v", scope, ok)
+	}
+
+	flushMessageScopes()
+	if storedScope(t, "msg1") == nil || storedScope(t, "msg2") == nil {
+		t.Fatal("scopes not written by the flush")
+	}
+	pendingScopesMu.Lock()
+	pending := len(pendingScopes)
+	pendingScopesMu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d scopes still pending after the flush", pending)
+	}
+	scope, ok = RetrieveMessageScope("msg1")
+	if !ok || scope.Type != ScopeGroup || scope.TargetID != "group1" {
+		t.Errorf("stored scope = %+v, %v", scope, ok)
+	}
+	if _, ok := RetrieveMessageScope("missing"); ok {
+		t.Error("unknown message id should not have a scope")
+	}
+}
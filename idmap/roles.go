@@ -0,0 +1,246 @@
+package idmap
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"go.etcd.io/bbolt"
+)
+
+// 内置角色 其余名称视为自定义角色,权限等同member
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// RoleScopeGlobal 全局角色的作用域 其余作用域为真实群/频道id
+const RoleScopeGlobal = "global"
+
+// 一次性指令码有效期
+const oneTimeCodeTTL = 5 * time.Minute
+
+var (
+	ErrInvalidRole  = errors.New("invalid role name")
+	ErrInvalidScope = errors.New("invalid role scope or user")
+)
+
+// RoleEntry 为用户在某个作用域内分配的角色
+type RoleEntry struct {
+	Scope  string `json:"scope"`
+	UserID string `json:"user_id"`
+	Role   string `json:"role"`
+	Time   int64  `json:"time"`
+}
+
+var (
+	roleCache   map[string]string // scope + "/" + user_id -> role
+	roleCacheMu sync.RWMutex
+
+	oneTimeCodes   = make(map[string]time.Time)
+	oneTimeCodesMu sync.Mutex
+)
+
+// NormalizeRoleID 将数字形式的虚拟id还原为真实id,无法还原时原样返回
+func NormalizeRoleID(id string) string {
+	id = strings.TrimSpace(id)
+	if id == "" || id == RoleScopeGlobal {
+		return id
+	}
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return id
+	}
+	if realID, err := RetrieveRowByIDv2(id); err == nil && realID != "" {
+		return realID
+	}
+	return id
+}
+
+// SetRole 为用户分配角色 scope为global或群/频道id
+func SetRole(scope, userID, role string) (RoleEntry, error) {
+	role = strings.ToLower(strings.TrimSpace(role))
+	if role == "" || len(role) > 32 || strings.ContainsAny(role, "/ \t\n") {
+		return RoleEntry{}, ErrInvalidRole
+	}
+	entry := RoleEntry{
+		Scope:  NormalizeRoleID(scope),
+		UserID: NormalizeRoleID(userID),
+		Role:   role,
+		Time:   time.Now().Unix(),
+	}
+	if entry.Scope == "" || entry.UserID == "" || strings.Contains(entry.Scope, "/") {
+		return RoleEntry{}, ErrInvalidScope
+	}
+	if err := putJSON(RolesBucket, entry.Scope+"/"+entry.UserID, entry); err != nil {
+		return RoleEntry{}, err
+	}
+	invalidateRoleCache()
+	return entry, nil
+}
+
+// RemoveRole 移除用户在作用域内的角色
+func RemoveRole(scope, userID string) error {
+	key := NormalizeRoleID(scope) + "/" + NormalizeRoleID(userID)
+	err := db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(RolesBucket)).Delete([]byte(key))
+	})
+	invalidateRoleCache()
+	return err
+}
+
+// ListRoles 列出作用域内的角色 scope为空时列出全部
+func ListRoles(scope string) ([]RoleEntry, error) {
+	if scope != "" {
+		scope = NormalizeRoleID(scope)
+	}
+	var entries []RoleEntry
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(RolesBucket)).ForEach(func(k, v []byte) error {
+			var entry RoleEntry
+			if json.Unmarshal(v, &entry) == nil && (scope == "" || entry.Scope == scope) {
+				entries = append(entries, entry)
+			}
+			return nil
+		})
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Scope != entries[j].Scope {
+			return entries[i].Scope < entries[j].Scope
+		}
+		return entries[i].UserID < entries[j].UserID
+	})
+	return entries, err
+}
+
+// ResolveRole 获取用户角色 群内角色优先于全局角色,master_id视为全局owner,都没有时返回fallback
+// userIDs可同时传入真实id和虚拟id
+func ResolveRole(scope, fallback string, userIDs ...string) string {
+	roles := loadRoleCache()
+	for _, s := range []string{scope, RoleScopeGlobal} {
+		if s == "" {
+			continue
+		}
+		for _, id := range userIDs {
+			if role, ok := roles[s+"/"+id]; ok && id != "" {
+				return role
+			}
+		}
+	}
+	for _, master := range config.GetMasterID() {
+		for _, id := range userIDs {
+			if id != "" && id == master {
+				return RoleOwner
+			}
+		}
+	}
+	return fallback
+}
+
+// HasOwners 是否配置了任何owner 均未配置时框架指令对所有人开放
+func HasOwners() bool {
+	if len(config.GetMasterID()) > 0 {
+		return true
+	}
+	for _, role := range loadRoleCache() {
+		if role == RoleOwner {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleLevel 角色的权限等级 自定义角色与member相同
+func RoleLevel(role string) int {
+	switch role {
+	case RoleOwner:
+		return 2
+	case RoleAdmin:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func loadRoleCache() map[string]string {
+	roleCacheMu.RLock()
+	roles := roleCache
+	roleCacheMu.RUnlock()
+	if roles != nil {
+		return roles
+	}
+
+	roles = make(map[string]string)
+	db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(RolesBucket)).ForEach(func(k, v []byte) error {
+			var entry RoleEntry
+			if json.Unmarshal(v, &entry) == nil {
+				roles[string(k)] = entry.Role
+			}
+			return nil
+		})
+	})
+	roleCacheMu.Lock()
+	roleCache = roles
+	roleCacheMu.Unlock()
+	return roles
+}
+
+func invalidateRoleCache() {
+	roleCacheMu.Lock()
+	roleCache = nil
+	roleCacheMu.Unlock()
+}
+
+// IssueOneTimeCode 生成一次性指令码 只输出到日志,使用一次或过期后失效
+func IssueOneTimeCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf))
+
+	oneTimeCodesMu.Lock()
+	defer oneTimeCodesMu.Unlock()
+	now := time.Now()
+	for c, expire := range oneTimeCodes {
+		if now.After(expire) {
+			delete(oneTimeCodes, c)
+		}
+	}
+	oneTimeCodes[code] = now.Add(oneTimeCodeTTL)
+	return code, nil
+}
+
+// ConsumeOneTimeCode 校验并作废一次性指令码
+func ConsumeOneTimeCode(code string) bool {
+	oneTimeCodesMu.Lock()
+	defer oneTimeCodesMu.Unlock()
+	expire, ok := oneTimeCodes[code]
+	if !ok {
+		return false
+	}
+	delete(oneTimeCodes, code)
+	return time.Now().Before(expire)
+}
+
+// ActiveOneTimeCodes 当前有效的一次性指令码 用于放行白名单
+func ActiveOneTimeCodes() []string {
+	oneTimeCodesMu.Lock()
+	defer oneTimeCodesMu.Unlock()
+	now := time.Now()
+	codes := make([]string, 0, len(oneTimeCodes))
+	for code, expire := range oneTimeCodes {
+		if now.Before(expire) {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
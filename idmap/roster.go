@@ -0,0 +1,260 @@
+package idmap
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"go.etcd.io/bbolt"
+)
+
+// 群成员活跃记录写入间隔 群消息量大时合并写入
+const rosterFlushInterval = 10 * time.Second
+
+// RosterMember 从群消息中观察到的群成员 QQ群接口不提供成员列表
+type RosterMember struct {
+	GroupOpenID  string `json:"group_openid"`
+	UserOpenID   string `json:"user_openid"`
+	GroupID      int64  `json:"group_id"`
+	UserID       int64  `json:"user_id"`
+	Nickname     string `json:"nickname,omitempty"`
+	FirstSeen    int64  `json:"first_seen"`
+	LastSeen     int64  `json:"last_seen"`
+	MessageCount int64  `json:"message_count"`
+}
+
+var (
+	pendingRoster   = make(map[string]*RosterMember) // group_openid + "/" + user_openid
+	pendingRosterMu sync.Mutex
+	rosterOnce      sync.Once
+	knownGroups     sync.Map // group_openid -> 已记录的群号
+)
+
+// RecordGroupActivity 记录群成员发言 写入会延迟合并
+func RecordGroupActivity(groupOpenID, userOpenID string, groupID, userID int64, nickname string) {
+	if groupOpenID == "" || userOpenID == "" {
+		return
+	}
+	rosterOnce.Do(func() {
+		go func() {
+			for range time.Tick(rosterFlushInterval) {
+				flushRoster()
+			}
+		}()
+	})
+
+	now := time.Now().Unix()
+	key := groupOpenID + "/" + userOpenID
+	pendingRosterMu.Lock()
+	defer pendingRosterMu.Unlock()
+	m, ok := pendingRoster[key]
+	if !ok {
+		m = &RosterMember{
+			GroupOpenID: groupOpenID,
+			UserOpenID:  userOpenID,
+			FirstSeen:   now,
+		}
+		pendingRoster[key] = m
+	}
+	if groupID != 0 {
+		m.GroupID = groupID
+	}
+	if userID != 0 {
+		m.UserID = userID
+	}
+	if nickname != "" {
+		m.Nickname = nickname
+	}
+	m.LastSeen = now
+	m.MessageCount++
+}
+
+// flushRoster 把内存中的增量合并进数据库
+func flushRoster() {
+	pendingRosterMu.Lock()
+	pending := pendingRoster
+	pendingRoster = make(map[string]*RosterMember)
+	pendingRosterMu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		root := tx.Bucket([]byte(RosterBucket))
+		for _, delta := range pending {
+			b, err := root.CreateBucketIfNotExists([]byte(delta.GroupOpenID))
+			if err != nil {
+				return err
+			}
+			member := *delta
+			if v := b.Get([]byte(delta.UserOpenID)); v != nil {
+				var old RosterMember
+				if json.Unmarshal(v, &old) == nil {
+					member.FirstSeen = old.FirstSeen
+					member.MessageCount += old.MessageCount
+					if member.Nickname == "" {
+						member.Nickname = old.Nickname
+					}
+					if member.GroupID == 0 {
+						member.GroupID = old.GroupID
+					}
+					if member.UserID == 0 {
+						member.UserID = old.UserID
+					}
+				}
+			}
+			data, err := json.Marshal(member)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(member.UserOpenID), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		mylog.Printf("Error flushing group roster: %v", err)
+	}
+}
+
+// ListRosterMembers 获取群内观察到的全部成员 按最后发言时间倒序
+func ListRosterMembers(groupOpenID string) ([]RosterMember, error) {
+	flushRoster()
+	var members []RosterMember
+	err := db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(RosterBucket)).Bucket([]byte(groupOpenID))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var member RosterMember
+			if json.Unmarshal(v, &member) == nil {
+				members = append(members, member)
+			}
+			return nil
+		})
+	})
+	sort.Slice(members, func(i, j int) bool { return members[i].LastSeen > members[j].LastSeen })
+	return members, err
+}
+
+// GetRosterMember 获取单个群成员的记录
+func GetRosterMember(groupOpenID, userOpenID string) (RosterMember, bool) {
+	flushRoster()
+	var member RosterMember
+	var data []byte
+	db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(RosterBucket)).Bucket([]byte(groupOpenID))
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(userOpenID)); v != nil {
+			data = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if data == nil || json.Unmarshal(data, &member) != nil {
+		return member, false
+	}
+	return member, true
+}
+
+// ListActiveMembers 获取since之后发过言的成员 limit为0时不限制数量
+func ListActiveMembers(groupOpenID string, since int64, limit int) ([]RosterMember, error) {
+	members, err := ListRosterMembers(groupOpenID)
+	if err != nil {
+		return nil, err
+	}
+	var active []RosterMember
+	for _, member := range members {
+		if member.LastSeen < since {
+			break
+		}
+		active = append(active, member)
+		if limit > 0 && len(active) >= limit {
+			break
+		}
+	}
+	return active, nil
+}
+
+// CountRosterMembers 获取群内观察到的成员数量
+func CountRosterMembers(groupOpenID string) int {
+	flushRoster()
+	count := 0
+	db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket([]byte(RosterBucket)).Bucket([]byte(groupOpenID)); b != nil {
+			count = b.Stats().KeyN
+		}
+		return nil
+	})
+	return count
+}
+
+// RemoveRosterGroup 机器人退群后清除该群的成员记录
+func RemoveRosterGroup(groupOpenID string) error {
+	flushRoster()
+	return db.Update(func(tx *bbolt.Tx) error {
+		err := tx.Bucket([]byte(RosterBucket)).DeleteBucket([]byte(groupOpenID))
+		if err == bbolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// ResolveJoinedGroup 根据应用端传入的群号找到真实群id 兼容数字群号与idmap-pro
+func ResolveJoinedGroup(groupID string) (JoinedGroup, bool) {
+	if group, ok := GetJoinedGroup(groupID); ok {
+		return group, true
+	}
+	groups, err := ListJoinedGroups()
+	if err == nil {
+		for _, group := range groups {
+			if group.GroupID != 0 && strconv.FormatInt(group.GroupID, 10) == groupID {
+				return group, true
+			}
+		}
+	}
+	if _, err := strconv.ParseInt(groupID, 10, 64); err != nil {
+		// 非数字群号本身就是真实id
+		return JoinedGroup{GroupOpenID: groupID}, true
+	}
+	// 通过idmap还原
+	if realID, err := RetrieveRowByIDv2(groupID); err == nil && realID != "" {
+		if group, ok := GetJoinedGroup(realID); ok {
+			return group, true
+		}
+		return JoinedGroup{GroupOpenID: realID}, true
+	}
+	return JoinedGroup{}, false
+}
+
+// EnsureJoinedGroup 在群内收到信息时补全已加入的群
+func EnsureJoinedGroup(groupOpenID string, groupID int64) {
+	if known, ok := knownGroups.Load(groupOpenID); ok && (known.(int64) == groupID || groupID == 0) {
+		return
+	}
+	group, ok := GetJoinedGroup(groupOpenID)
+	knownGroups.Store(groupOpenID, groupID)
+	if ok && (group.GroupID == groupID || groupID == 0) {
+		return
+	}
+	if !ok {
+		group = JoinedGroup{
+			GroupOpenID: groupOpenID,
+			JoinTime:    time.Now().Unix(),
+			PushEnabled: true,
+		}
+	}
+	if groupID != 0 {
+		group.GroupID = groupID
+	}
+	if err := StoreJoinedGroup(group); err != nil {
+		mylog.Printf("Error storing joined group: %v", err)
+	}
+}
@@ -15,10 +15,11 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/hoshinonyaruko/gensokyo/backup"
 	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/lotus"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
 	proto "github.com/hoshinonyaruko/gensokyo/proto"
 	"github.com/hoshinonyaruko/gensokyo/structs"
@@ -29,19 +30,21 @@ var (
 	GrpcClient proto.IDMapServiceClient // 全局的 gRPC 客户端
 )
 
-var (
-	// 用于存储临时指令的全局变量
-	TemporaryCommands []string
-	// 用于保证线程安全的互斥锁
-	MutexT sync.Mutex
-)
-
 const (
 	DBName          = "idmap.db"
 	BucketName      = "ids"
 	CacheBucketName = "cache"
 	ConfigBucket    = "config"
 	UserInfoBucket  = "UserInfo"
+	LotusBucket     = "lotus"
+	MsgScopeBucket  = "msgscope"
+	GroupsBucket    = "groups"
+	GroupReqBucket  = "grouprequests"
+	RosterBucket    = "roster"
+	RolesBucket     = "roles"
+	CollisionBucket = "collisions"
+	AliasBucket     = "aliases"
+	MarkdownBucket  = "markdown"
 	CounterKey      = "currentRow"
 )
 
@@ -56,6 +59,7 @@ func InitializeDB() {
 	if err != nil {
 		log.Fatalf("Error opening DB: %v", err)
 	}
+	backup.Register(DBName, db)
 
 	// 在数据库中创建必要的buckets
 	err = db.Update(func(tx *bbolt.Tx) error {
@@ -75,6 +79,40 @@ func InitializeDB() {
 		if _, err := tx.CreateBucketIfNotExists([]byte(CacheBucketName)); err != nil {
 			return err
 		}
+		// 创建储存lotus从gsk凭据的Bucket
+		if _, err := tx.CreateBucketIfNotExists([]byte(LotusBucket)); err != nil {
+			return err
+		}
+		// 创建储存信息来源的Bucket
+		if _, err := tx.CreateBucketIfNotExists([]byte(MsgScopeBucket)); err != nil {
+			return err
+		}
+		// 创建储存已加入群与入群请求的Bucket
+		if _, err := tx.CreateBucketIfNotExists([]byte(GroupsBucket)); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists([]byte(GroupReqBucket)); err != nil {
+			return err
+		}
+		// 创建储存群成员活跃记录的Bucket
+		if _, err := tx.CreateBucketIfNotExists([]byte(RosterBucket)); err != nil {
+			return err
+		}
+		// 创建存储角色的Bucket
+		if _, err := tx.CreateBucketIfNotExists([]byte(RolesBucket)); err != nil {
+			return err
+		}
+		// 创建储存哈希碰撞记录与迁移别名的Bucket
+		if _, err := tx.CreateBucketIfNotExists([]byte(CollisionBucket)); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists([]byte(AliasBucket)); err != nil {
+			return err
+		}
+		// 创建储存webui添加的md模板的Bucket
+		if _, err := tx.CreateBucketIfNotExists([]byte(MarkdownBucket)); err != nil {
+			return err
+		}
 		return nil
 	})
 
@@ -89,7 +127,7 @@ func DeleteBucket(bucketName string) {
 		// 获取指定的bucket
 		bucket := tx.Bucket([]byte(bucketName))
 		if bucket == nil {
-			mylog.Printf(bucketName + "表不存在.")
+			mylog.Printf("%s表不存在.", bucketName)
 			return nil // 如果bucket不存在，直接返回nil
 		}
 
@@ -106,7 +144,7 @@ func DeleteBucket(bucketName string) {
 	if err != nil {
 		log.Fatalf("Error clearing bucket %s: %v", bucketName, err)
 	} else {
-		mylog.Printf(bucketName + "清理成功.请手动运行-compaction")
+		mylog.Printf("%s清理成功.请手动运行-compaction", bucketName)
 	}
 }
 
@@ -213,6 +251,9 @@ func Compaction(sourceDBPath, targetDBPath string) error {
 }
 
 func CloseDB() {
+	// 写入还在内存中的信息来源
+	flushMessageScopes()
+	backup.Unregister(DBName)
 	db.Close()
 }
 
@@ -299,24 +340,11 @@ func StoreID(id string) (int64, error) {
 				newRow = int64(currentRow) + 1
 			}
 		} else {
-			// 生成新的行号
+			// 按探测序列生成不与其他id重复的行号
 			var err error
-			maxDigits := 18 // int64的位数上限-1
-			for digits := 9; digits <= maxDigits; digits++ {
-				newRow, err = GenerateRowID(id, digits)
-				if err != nil {
-					return err
-				}
-				// 检查新生成的行号是否重复
-				rowKey := fmt.Sprintf("row-%d", newRow)
-				if b.Get([]byte(rowKey)) == nil {
-					// 找到了一个唯一的行号，可以跳出循环
-					break
-				}
-				// 如果到达了最大尝试次数还没有找到唯一的行号，则返回错误
-				if digits == maxDigits {
-					return fmt.Errorf("unable to find a unique row ID after %d attempts", maxDigits-8)
-				}
+			newRow, err = allocateHashRow(tx, b, BucketName, id)
+			if err != nil {
+				return err
 			}
 		}
 
@@ -362,24 +390,11 @@ func StoreCache(id string) (int64, error) {
 				newRow = int64(currentRow) + 1
 			}
 		} else {
-			// 生成新的行号
+			// 按探测序列生成不与其他id重复的行号
 			var err error
-			maxDigits := 18 // int64的位数上限-1
-			for digits := 9; digits <= maxDigits; digits++ {
-				newRow, err = GenerateRowID(id, digits)
-				if err != nil {
-					return err
-				}
-				// 检查新生成的行号是否重复
-				rowKey := fmt.Sprintf("row-%d", newRow)
-				if b.Get([]byte(rowKey)) == nil {
-					// 找到了一个唯一的行号，可以跳出循环
-					break
-				}
-				// 如果到达了最大尝试次数还没有找到唯一的行号，则返回错误
-				if digits == maxDigits {
-					return fmt.Errorf("unable to find a unique row ID after %d attempts", maxDigits-8)
-				}
+			newRow, err = allocateHashRow(tx, b, CacheBucketName, id)
+			if err != nil {
+				return err
 			}
 		}
 
@@ -407,32 +422,15 @@ func SimplifiedStoreID(id string) (int64, error) {
 	err := db.Update(func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte(BucketName))
 
-		// 生成新的行号
+		// 生成新的行号 已属于该id的行号直接复用
 		var err error
-		newRow, err = GenerateRowID(id, 9)
+		newRow, err = allocateHashRow(tx, b, BucketName, id)
 		if err != nil {
 			return err
 		}
 
-		// 检查新生成的行号是否重复
-		rowKey := fmt.Sprintf("row-%d", newRow)
-		if b.Get([]byte(rowKey)) != nil {
-			// 如果行号重复，使用10位数字生成行号
-			newRow, err = GenerateRowID(id, 10)
-			if err != nil {
-				return err
-			}
-			rowKey = fmt.Sprintf("row-%d", newRow)
-			// 再次检查重复性，如果还是重复，则返回错误
-			if b.Get([]byte(rowKey)) != nil {
-				return fmt.Errorf("unable to find a unique row ID 195")
-			}
-		}
-
 		// 只写入反向键
-		b.Put([]byte(rowKey), []byte(id))
-
-		return nil
+		return b.Put([]byte(fmt.Sprintf("row-%d", newRow)), []byte(id))
 	})
 
 	return newRow, err
@@ -462,7 +460,7 @@ func SimplifiedStoreIDv2(id string) (int64, error) {
 
 		// 构建请求URL
 		url := fmt.Sprintf("%s://%s:%s/getid?type=13&id=%s", protocol, serverDir, portValue, id)
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return 0, fmt.Errorf("failed to send request: %v", err)
 		}
@@ -508,13 +506,13 @@ func StoreIDPro(id string, subid string) (int64, int64, error) {
 			return nil
 		}
 
-		// 生成新的ID和SubID
-		newRowID, err = GenerateRowID(id, 9) // 使用GenerateRowID来生成
+		// 生成新的ID和SubID 同时写入单独的正反向键,只有新出现的id在碰撞时按探测序列顺延
+		newRowID, err = proHashRow(tx, b, id)
 		if err != nil {
 			return err
 		}
 
-		newSubRowID, err = GenerateRowID(subid, 9) // 同样的方法生成SubID
+		newSubRowID, err = proHashRow(tx, b, subid)
 		if err != nil {
 			return err
 		}
@@ -559,7 +557,7 @@ func StoreIDv2(id string) (int64, error) {
 
 		// 构建请求URL
 		url := fmt.Sprintf("%s://%s:%s/getid?type=1&id=%s", protocol, serverDir, portValue, id)
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return 0, fmt.Errorf("failed to send request: %v", err)
 		}
@@ -609,7 +607,7 @@ func StoreCachev2(id string) (int64, error) {
 
 		// 构建请求URL
 		url := fmt.Sprintf("%s://%s:%s/getid?type=16&id=%s", protocol, serverDir, portValue, id)
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return 0, fmt.Errorf("failed to send request: %v", err)
 		}
@@ -659,7 +657,7 @@ func StoreIDv2Pro(id string, subid string) (int64, int64, error) {
 
 		// 构建请求URL
 		url := fmt.Sprintf("%s://%s:%s/getid?type=8&id=%s&subid=%s", protocol, serverDir, portValue, id, subid)
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return 0, 0, fmt.Errorf("failed to send request: %v", err)
 		}
@@ -752,7 +750,7 @@ func RetrieveRowByIDv2Pro(newRowID string, newSubRowID string) (string, string,
 
 		// 构建请求URL
 		url := fmt.Sprintf("%s://%s:%s/getid?type=9&id=%s&subid=%s", protocol, serverDir, portValue, newRowID, newSubRowID)
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return "", "", fmt.Errorf("failed to send request: %v", err)
 		}
@@ -834,7 +832,7 @@ func RetrieveRowByIDv2(rowid string) (string, error) {
 
 		// 构建请求URL
 		url := fmt.Sprintf("%s://%s:%s/getid?type=2&id=%s", protocol, serverDir, portValue, rowid)
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return "", fmt.Errorf("failed to send request: %v", err)
 		}
@@ -883,7 +881,7 @@ func RetrieveRowByCachev2(rowid string) (string, error) {
 
 		// 构建请求URL
 		url := fmt.Sprintf("%s://%s:%s/getid?type=17&id=%s", protocol, serverDir, portValue, rowid)
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return "", fmt.Errorf("failed to send request: %v", err)
 		}
@@ -961,7 +959,7 @@ func WriteConfigv2(sectionName, keyName, value string) error {
 		params.Add("value", value)
 		url := baseURL + "?" + params.Encode()
 
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return fmt.Errorf("failed to send request: %v", err)
 		}
@@ -1047,7 +1045,7 @@ func DeleteConfigv2(sectionName, keyName string) error {
 		params.Add("subtype", keyName)
 		url := baseURL + "?" + params.Encode()
 
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return fmt.Errorf("failed to send request: %v", err)
 		}
@@ -1095,7 +1093,7 @@ func ReadConfigv2(sectionName, keyName string) (string, error) {
 		params.Add("subtype", keyName)
 		url := baseURL + "?" + params.Encode()
 
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return "", fmt.Errorf("failed to send request: %v", err)
 		}
@@ -1240,7 +1238,7 @@ func UpdateVirtualValuev2(oldRowValue, newRowValue int64) error {
 			protocol = "https"
 		}
 		url := fmt.Sprintf("%s://%s:%s/getid?type=5&oldRowValue=%d&newRowValue=%d", protocol, serverDir, portValue, oldRowValue, newRowValue)
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return fmt.Errorf("failed to send request: %v", err)
 		}
@@ -1276,7 +1274,7 @@ func RetrieveRealValuev2(virtualValue int64) (string, string, error) {
 			protocol = "https"
 		}
 		url := fmt.Sprintf("%s://%s:%s/getid?type=6&virtualValue=%d", protocol, serverDir, portValue, virtualValue)
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return "", "", fmt.Errorf("failed to send request: %v", err)
 		}
@@ -1326,7 +1324,7 @@ func RetrieveVirtualValuev2(realValue string) (string, string, error) {
 
 		// 构建请求URL
 		url := fmt.Sprintf("%s://%s:%s/getid?type=7&id=%s", protocol, serverDir, portValue, realValue)
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return "", "", fmt.Errorf("failed to send request: %v", err)
 		}
@@ -1380,7 +1378,7 @@ func RetrieveVirtualValuev2Pro(realValue string, realValueSub string) (string, s
 
 		// 构建请求URL
 		url := fmt.Sprintf("%s://%s:%s/getid?type=9&id=%s&subid=%s", protocol, serverDir, portValue, realValue, realValueSub)
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return "", "", fmt.Errorf("failed to send request: %v", err)
 		}
@@ -1505,7 +1503,7 @@ func RetrieveRealValuesv2Pro(virtualValue int64, virtualValueSub int64) (string,
 
 		// 构建请求URL
 		url := fmt.Sprintf("%s://%s:%s/getrealvalues?type=11&id=%d&subid=%d", protocol, serverDir, portValue, virtualValue, virtualValueSub)
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return "", "", fmt.Errorf("failed to send request: %v", err)
 		}
@@ -1600,7 +1598,7 @@ func UpdateVirtualValuev2Pro(oldVirtualValue1, newVirtualValue1, oldVirtualValue
 		url := fmt.Sprintf("%s://%s:%s/getid?type=12&oldVirtualValue1=%d&newVirtualValue1=%d&oldVirtualValue2=%d&newVirtualValue2=%d",
 			protocol, serverDir, portValue, oldVirtualValue1, newVirtualValue1, oldVirtualValue2, newVirtualValue2)
 
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return fmt.Errorf("failed to send request: %v", err)
 		}
@@ -1701,7 +1699,7 @@ func FindSubKeysByIdPro(id string) ([]string, error) {
 
 		// 构建请求URL
 		url := fmt.Sprintf("%s://%s:%s/getid?type=14&id=%s", protocol, serverDir, portValue, id)
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return nil, fmt.Errorf("failed to send request: %v", err)
 		}
@@ -2,18 +2,17 @@ package images
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"net/http"
 	"net/url"
-	"strings"
 	"sync"
 
 	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/lotus"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
 	"github.com/hoshinonyaruko/gensokyo/oss"
 	"github.com/tencent-connect/botgo/dto"
@@ -128,18 +127,18 @@ func UploadBase64ImageToServer(base64Image string, apiv2 openapi.OpenAPI) (strin
 		}
 		return downloadURL, width, height, nil
 	}
-	extraPicAuditingType := config.GetOssType()
-	switch extraPicAuditingType {
-	case 0:
-		picURL, err = originalUploadBehavior(base64Image)
-	case 1:
-		picURL, err = oss.UploadAndAuditImage(base64Image) // 腾讯
-	case 2:
-		picURL, err = oss.UploadAndAuditImageB(base64Image) // 百度
-	case 3:
-		picURL, err = oss.UploadAndAuditImageA(base64Image) // 阿里
-	default:
-		return "", 0, 0, errors.New("invalid extraPicAuditingType")
+	// 0使用gensokyo图床(或lotus),其余交给oss包中对应的存储后端,审核作为单独的步骤
+	if config.GetOssType() == oss.TypeServer {
+		picURL, err = oss.UploadToServer(base64Image, "uploadpic", "base64Image")
+		if err == nil {
+			err = oss.AuditImage(oss.TypeServer, picURL)
+		}
+	} else {
+		var data []byte
+		data, err = base64.StdEncoding.DecodeString(base64Image)
+		if err == nil {
+			picURL, err = oss.UploadImage(data)
+		}
 	}
 	if err != nil {
 		return "", 0, 0, err
@@ -155,60 +154,15 @@ func UploadBase64ImageToServer(base64Image string, apiv2 openapi.OpenAPI) (strin
 
 // 将base64语音通过lotus转换成url
 func UploadBase64RecordToServer(base64Record string) (string, error) {
-	extraPicAuditingType := config.GetOssType()
-
-	// 根据不同的extraPicAuditingType值来调整函数行为
-	switch extraPicAuditingType {
-	case 0:
+	if config.GetOssType() == oss.TypeServer {
 		// 原有的函数行为
-		return originalUploadBehaviorRecord(base64Record)
-	case 1:
-		return oss.UploadAndAuditRecord(base64Record) //腾讯
-	case 2:
-		return oss.UploadAndAuditRecord(base64Record) //百度
-	case 3:
-		return oss.UploadAndAuditRecord(base64Record) //阿里
-	default:
-		return "", errors.New("invalid extraPicAuditingType")
-	}
-}
-
-func originalUploadBehavior(base64Image string) (string, error) {
-	// 原有的UploadBase64ImageToServer函数的实现
-	protocol := "http"
-	serverPort := config.GetPortValue()
-	if serverPort == "443" ||config.GetForceSsl(){
-		protocol = "https"
-	}
-
-	// 如果lotus为真
-	if config.GetLotusValue() && !config.GetLotusWithoutUploadPic() {
-		serverDir := config.GetServer_dir()
-		url := fmt.Sprintf("%s://%s:%s/uploadpic", protocol, serverDir, serverPort)
-
-		resp, err := postImageToServer(base64Image, url)
-		if err != nil {
-			return "", err
-		}
-		return resp, nil
-	}
-
-	serverDir := config.GetServer_dir()
-	if serverPort == "443" ||config.GetForceSsl(){
-		protocol = "http"
-		serverPort = config.GetHttpPortAfterSsl()
+		return oss.UploadToServer(base64Record, "uploadrecord", "base64Record")
 	}
-
-	if isPublicAddress(serverDir) {
-		url := fmt.Sprintf("%s://127.0.0.1:%s/uploadpic", protocol, serverPort)
-
-		resp, err := postImageToServer(base64Image, url)
-		if err != nil {
-			return "", err
-		}
-		return resp, nil
+	data, err := base64.StdEncoding.DecodeString(base64Record)
+	if err != nil {
+		return "", err
 	}
-	return "", errors.New("local server uses a private address; image upload failed")
+	return oss.UploadRecord(data)
 }
 
 func UploadBehaviorV3(base64Image string) (string, int, int, error) {
@@ -256,77 +210,6 @@ func UploadBehaviorV3(base64Image string) (string, int, int, error) {
 	}
 }
 
-// 将base64语音通过lotus转换成url
-func originalUploadBehaviorRecord(base64Image string) (string, error) {
-	// 根据serverPort确定协议
-	protocol := "http"
-	serverPort := config.GetPortValue()
-	if serverPort == "443" ||config.GetForceSsl(){
-		protocol = "https"
-	}
-
-	if config.GetLotusValue() && !config.GetLotusWithoutUploadPic() {
-		serverDir := config.GetServer_dir()
-		url := fmt.Sprintf("%s://%s:%s/uploadrecord", protocol, serverDir, serverPort)
-
-		resp, err := postRecordToServer(base64Image, url)
-		if err != nil {
-			return "", err
-		}
-		return resp, nil
-	}
-
-	serverDir := config.GetServer_dir()
-	// 当端口是443时，使用HTTP和444端口
-	if serverPort == "443" ||config.GetForceSsl(){
-		protocol = "http"
-		serverPort = config.GetHttpPortAfterSsl()
-	}
-
-	if isPublicAddress(serverDir) {
-		url := fmt.Sprintf("%s://127.0.0.1:%s/uploadrecord", protocol, serverPort)
-
-		resp, err := postRecordToServer(base64Image, url)
-		if err != nil {
-			return "", err
-		}
-		return resp, nil
-	}
-	return "", errors.New("local server uses a private address; image record failed")
-}
-
-// 请求图床api(图床就是lolus为false的gensokyo)
-func postImageToServer(base64Image, targetURL string) (string, error) {
-	data := url.Values{}
-	data.Set("base64Image", base64Image) // 修改字段名以与服务器匹配
-
-	resp, err := http.PostForm(targetURL, data)
-	if err != nil {
-		return "", fmt.Errorf("failed to send request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("error response from server: %s", resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %v", err)
-	}
-
-	var responseMap map[string]interface{}
-	if err := json.Unmarshal(body, &responseMap); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %v", err)
-	}
-
-	if value, ok := responseMap["url"]; ok {
-		return fmt.Sprintf("%v", value), nil
-	}
-
-	return "", fmt.Errorf("URL not found in response")
-}
-
 // 请求图床api(图床就是lolus为false的gensokyo)
 func postImageToServerV3(base64Image, targetURL string) (string, int, int, error) {
 	data := url.Values{}
@@ -334,7 +217,7 @@ func postImageToServerV3(base64Image, targetURL string) (string, int, int, error
 	data.Set("base64Image", base64Image) // 修改字段名以与服务器匹配
 	data.Set("channelID", channelID)     // 修改字段名以与服务器匹配
 
-	resp, err := http.PostForm(targetURL, data)
+	resp, err := lotus.PostForm(targetURL, data)
 	if err != nil {
 		return "", 0, 0, fmt.Errorf("failed to send request: %v", err)
 	}
@@ -366,47 +249,3 @@ func postImageToServerV3(base64Image, targetURL string) (string, int, int, error
 
 	return url, int(width), int(height), nil
 }
-
-// 请求语音床api(图床就是lolus为false的gensokyo)
-func postRecordToServer(base64Image, targetURL string) (string, error) {
-	data := url.Values{}
-	data.Set("base64Record", base64Image) // 修改字段名以与服务器匹配
-
-	resp, err := http.PostForm(targetURL, data)
-	if err != nil {
-		return "", fmt.Errorf("failed to send request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("error response from server: %s", resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %v", err)
-	}
-
-	var responseMap map[string]interface{}
-	if err := json.Unmarshal(body, &responseMap); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %v", err)
-	}
-
-	if value, ok := responseMap["url"]; ok {
-		return fmt.Sprintf("%v", value), nil
-	}
-
-	return "", fmt.Errorf("URL not found in response")
-}
-
-// 判断是否公网ip 填写域名也会被认为是公网,但需要用户自己确保域名正确解析到gensokyo所在的ip地址
-func isPublicAddress(addr string) bool {
-	if strings.Contains(addr, "localhost") || strings.HasPrefix(addr, "127.") || strings.HasPrefix(addr, "192.168.") {
-		return false
-	}
-	if net.ParseIP(addr) != nil {
-		return true
-	}
-	// If it's not a recognized IP address format, consider it a domain name (public).
-	return true
-}
@@ -0,0 +1,132 @@
+package lotus
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+)
+
+var (
+	clientOnce sync.Once
+	httpClient *http.Client
+)
+
+// loadCertPool 读取CA证书
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return pool, nil
+}
+
+// ClientTLSConfig 从gsk连接主gsk时使用的TLS配置,开启lotus_mtls时出示客户端证书
+func ClientTLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if ca := config.GetLotusTlsCa(); ca != "" {
+		pool, err := loadCertPool(ca)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if config.GetLotusMtls() {
+		cert, err := tls.LoadX509KeyPair(config.GetLotusTlsCert(), config.GetLotusTlsKey())
+		if err != nil {
+			return nil, fmt.Errorf("load lotus client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// CheckConfig 启动时检查lotus配置 主gsk开启lotus_mtls但没有CA时所有从gsk的请求都会被拒绝
+func CheckConfig() error {
+	if config.GetLotusMtls() && !config.GetLotusValue() && config.GetLotusTlsCa() == "" {
+		return fmt.Errorf("lotus_mtls需要设置lotus_tls_ca以校验从gsk的客户端证书")
+	}
+	return nil
+}
+
+// ServerTLSConfig 主gsk http服务的TLS配置 开启lotus_mtls时校验客户端证书
+// 使用VerifyClientCertIfGiven,不影响webhook和应用端的普通https访问,lotus接口在中间件中要求证书
+func ServerTLSConfig() (*tls.Config, error) {
+	if !config.GetLotusMtls() || config.GetLotusTlsCa() == "" {
+		return nil, nil
+	}
+	pool, err := loadCertPool(config.GetLotusTlsCa())
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
+// HTTPClient 从gsk访问主gsk使用的http客户端
+func HTTPClient() *http.Client {
+	clientOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		tlsConfig, err := ClientTLSConfig()
+		if err != nil {
+			mylog.Errorf("lotus TLS配置错误,使用默认配置: %v", err)
+		} else {
+			transport.TLSClientConfig = tlsConfig
+		}
+		httpClient = &http.Client{Transport: transport, Timeout: 30 * time.Second}
+	})
+	return httpClient
+}
+
+// Get 发送签名的GET请求
+func Get(target string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	SignRequest(req, nil)
+	return HTTPClient().Do(req)
+}
+
+// PostForm 发送签名的表单请求
+func PostForm(target string, data url.Values) (*http.Response, error) {
+	body := data.Encode()
+	req, err := http.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	SignRequest(req, []byte(body))
+	return HTTPClient().Do(req)
+}
+
+// ReadBody 读取请求体并放回,供校验签名后继续处理
+func ReadBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
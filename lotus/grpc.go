@@ -0,0 +1,150 @@
+package lotus
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// grpc调用的签名内容 method为GRPC,path为方法名,body为确定性序列化的请求
+const grpcMethod = "GRPC"
+
+// marshalRequest 序列化请求用于签名 两端使用相同的proto定义,确定性序列化结果一致
+func marshalRequest(req interface{}) ([]byte, error) {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("lotus: unsupported grpc request %T", req)
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(m)
+}
+
+// signedContext 在调用的metadata中加入签名
+func signedContext(ctx context.Context, fullMethod string, req interface{}) (context.Context, error) {
+	id, secret := credential()
+	if secret == "" {
+		return ctx, nil
+	}
+	body, err := marshalRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := newNonce()
+	return metadata.AppendToOutgoingContext(ctx,
+		strings.ToLower(HeaderID), id,
+		strings.ToLower(HeaderTimestamp), timestamp,
+		strings.ToLower(HeaderNonce), nonce,
+		strings.ToLower(HeaderSignature), signature(secret, grpcMethod, fullMethod, "", timestamp, nonce, body),
+	), nil
+}
+
+// unarySignInterceptor 从gsk为每次grpc调用签名
+func unarySignInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, err := signedContext(ctx, method, req)
+	if err != nil {
+		return err
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// DialOptions 从gsk连接主gsk grpc的选项
+func DialOptions() ([]grpc.DialOption, error) {
+	if !config.GetLotusGrpcTls() {
+		return []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithUnaryInterceptor(unarySignInterceptor),
+		}, nil
+	}
+	tlsConfig, err := ClientTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ServerName = config.GetServer_dir()
+	return []grpc.DialOption{
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		grpc.WithUnaryInterceptor(unarySignInterceptor),
+	}, nil
+}
+
+// ServerOptions 主gsk grpc服务的选项 开启lotus_grpc_tls时使用TLS,开启lotus_mtls时要求客户端证书
+func ServerOptions() ([]grpc.ServerOption, error) {
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(unaryAuthInterceptor)}
+	if !config.GetLotusGrpcTls() {
+		if config.GetLotusMtls() {
+			mylog.Println("lotus_mtls需要同时开启lotus_grpc_tls才会对grpc生效")
+		}
+		return opts, nil
+	}
+
+	certPath, keyPath := config.GetLotusTlsCert(), config.GetLotusTlsKey()
+	if certPath == "" || keyPath == "" {
+		certPath, keyPath = config.GetCrtPath(), config.GetKeyPath()
+	}
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if config.GetLotusMtls() {
+		pool, err := loadCertPool(config.GetLotusTlsCa())
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return append(opts, grpc.Creds(credentials.NewTLS(tlsConfig))), nil
+}
+
+// unaryAuthInterceptor 校验grpc调用的签名
+func unaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	addr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+	if !AuthRequired() {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if v := md.Get(strings.ToLower(key)); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	body, err := marshalRequest(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	id, err := verify(get(HeaderID), get(HeaderTimestamp), get(HeaderNonce), get(HeaderSignature),
+		grpcMethod, info.FullMethod, "", body)
+	if err != nil {
+		mylog.Printf("拒绝lotus grpc请求 %s %s: %v", addr, info.FullMethod, err)
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	MarkSeen(id, hostOf(addr), "grpc")
+	return handler(ctx, req)
+}
+
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
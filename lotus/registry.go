@@ -0,0 +1,236 @@
+package lotus
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+)
+
+// 超过这个时间没有请求的从gsk视为已断开
+const connectedWindow = 2 * time.Minute
+
+var (
+	ErrUnknownSecondary = errors.New("lotus: unknown secondary")
+	ErrRevoked          = errors.New("lotus: credential revoked")
+	ErrInvalidID        = errors.New("lotus: id must be 1-32 letters, digits, - or _")
+	ErrExists           = errors.New("lotus: secondary already exists")
+)
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// Secondary 主gsk为从gsk签发的凭据
+type Secondary struct {
+	ID        string `json:"id"`
+	Secret    string `json:"secret,omitempty"`
+	Revoked   bool   `json:"revoked"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Status 从gsk的凭据和连接状态,供webui展示
+type Status struct {
+	ID        string `json:"id"`
+	Revoked   bool   `json:"revoked"`
+	CreatedAt int64  `json:"created_at"`
+	LastSeen  int64  `json:"last_seen"`
+	LastAddr  string `json:"last_addr"`
+	Via       string `json:"via"`
+	Requests  int64  `json:"requests"`
+	Connected bool   `json:"connected"`
+}
+
+// Store 凭据的持久化,由idmap提供
+type Store interface {
+	LoadLotusSecondaries() ([]Secondary, error)
+	SaveLotusSecondary(s Secondary) error
+	DeleteLotusSecondary(id string) error
+}
+
+type activity struct {
+	lastSeen time.Time
+	lastAddr string
+	via      string
+	requests int64
+}
+
+var (
+	store      Store
+	storeMu    sync.RWMutex
+	activities = make(map[string]*activity)
+	activityMu sync.Mutex
+)
+
+// SetStore 设置凭据存储
+func SetStore(s Store) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	store = s
+}
+
+func loadSecondaries() ([]Secondary, error) {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	if store == nil {
+		return nil, nil
+	}
+	return store.LoadLotusSecondaries()
+}
+
+// secretOf 查找凭据对应的密钥 default凭据使用lotus_password
+func secretOf(id string) (string, error) {
+	if id == LocalID {
+		return localSecret, nil
+	}
+	if id == DefaultID {
+		if password := config.GetLotusPassword(); password != "" {
+			return password, nil
+		}
+		return "", ErrUnknownSecondary
+	}
+	list, err := loadSecondaries()
+	if err != nil {
+		return "", err
+	}
+	for _, s := range list {
+		if s.ID == id {
+			if s.Revoked {
+				return "", ErrRevoked
+			}
+			return s.Secret, nil
+		}
+	}
+	return "", ErrUnknownSecondary
+}
+
+// AuthRequired 配置了lotus_password、签发过凭据或开启了mTLS时,主gsk要求从gsk鉴权
+func AuthRequired() bool {
+	if config.GetLotusPassword() != "" || config.GetLotusMtls() {
+		return true
+	}
+	list, _ := loadSecondaries()
+	return len(list) > 0
+}
+
+// CreateSecondary 签发新凭据,返回值中的密钥只在此时可见
+func CreateSecondary(id string) (Secondary, error) {
+	if !validID.MatchString(id) || id == DefaultID || id == LocalID {
+		return Secondary{}, ErrInvalidID
+	}
+	list, err := loadSecondaries()
+	if err != nil {
+		return Secondary{}, err
+	}
+	for _, s := range list {
+		if s.ID == id {
+			return Secondary{}, ErrExists
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Secondary{}, err
+	}
+	s := Secondary{ID: id, Secret: hex.EncodeToString(b), CreatedAt: time.Now().Unix()}
+
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	if store == nil {
+		return Secondary{}, errors.New("lotus: credential store is not initialized")
+	}
+	if err := store.SaveLotusSecondary(s); err != nil {
+		return Secondary{}, err
+	}
+	return s, nil
+}
+
+// SetRevoked 吊销或恢复凭据,吊销后该从gsk的请求立即被拒绝
+func SetRevoked(id string, revoked bool) error {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	if store == nil {
+		return ErrUnknownSecondary
+	}
+	list, err := store.LoadLotusSecondaries()
+	if err != nil {
+		return err
+	}
+	for _, s := range list {
+		if s.ID == id {
+			s.Revoked = revoked
+			return store.SaveLotusSecondary(s)
+		}
+	}
+	return ErrUnknownSecondary
+}
+
+// DeleteSecondary 删除凭据
+func DeleteSecondary(id string) error {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	if store == nil {
+		return ErrUnknownSecondary
+	}
+	activityMu.Lock()
+	delete(activities, id)
+	activityMu.Unlock()
+	return store.DeleteLotusSecondary(id)
+}
+
+// MarkSeen 记录从gsk的请求
+func MarkSeen(id, addr, via string) {
+	if id == LocalID {
+		return
+	}
+	activityMu.Lock()
+	defer activityMu.Unlock()
+	a, ok := activities[id]
+	if !ok {
+		a = &activity{}
+		activities[id] = a
+	}
+	a.lastSeen = time.Now()
+	a.lastAddr = addr
+	a.via = via
+	a.requests++
+}
+
+// ListSecondaries 列出全部凭据和连接状态,default凭据在被使用过后出现
+func ListSecondaries() ([]Status, error) {
+	list, err := loadSecondaries()
+	if err != nil {
+		return nil, err
+	}
+
+	activityMu.Lock()
+	defer activityMu.Unlock()
+
+	now := time.Now()
+	fill := func(st *Status) {
+		if a, ok := activities[st.ID]; ok {
+			st.LastSeen = a.lastSeen.Unix()
+			st.LastAddr = a.lastAddr
+			st.Via = a.via
+			st.Requests = a.requests
+			st.Connected = !st.Revoked && now.Sub(a.lastSeen) < connectedWindow
+		}
+	}
+
+	result := make([]Status, 0, len(list)+1)
+	for _, s := range list {
+		st := Status{ID: s.ID, Revoked: s.Revoked, CreatedAt: s.CreatedAt}
+		fill(&st)
+		result = append(result, st)
+	}
+	if _, ok := activities[DefaultID]; ok {
+		st := Status{ID: DefaultID}
+		fill(&st)
+		result = append(result, st)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
@@ -0,0 +1,163 @@
+// lotus主从连接的鉴权 从gsk使用HMAC签名请求,主gsk校验签名、时间戳和随机数
+package lotus
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+)
+
+// 签名使用的请求头,grpc使用同名的小写metadata
+const (
+	HeaderID        = "X-Lotus-Id"
+	HeaderTimestamp = "X-Lotus-Timestamp"
+	HeaderNonce     = "X-Lotus-Nonce"
+	HeaderSignature = "X-Lotus-Signature"
+)
+
+// DefaultID 未设置lotus_id时使用的凭据,密钥为lotus_password
+const DefaultID = "default"
+
+// LocalID 主gsk请求自身接口(如lotus为false时的图床上传)使用的凭据,密钥每次启动随机生成
+const LocalID = "local"
+
+// 允许的时间误差,随机数在这段时间内不能重复
+const maxClockSkew = 5 * time.Minute
+
+var (
+	ErrMissingSignature = errors.New("lotus: missing signature")
+	ErrExpired          = errors.New("lotus: timestamp out of range")
+	ErrReplayed         = errors.New("lotus: nonce already used")
+	ErrBadSignature     = errors.New("lotus: signature mismatch")
+)
+
+var localSecret = newNonce() + newNonce()
+
+// 已使用的随机数
+var (
+	nonces   = make(map[string]time.Time)
+	noncesMu sync.Mutex
+)
+
+// credential 从gsk使用的凭据
+func credential() (string, string) {
+	if !config.GetLotusValue() {
+		return LocalID, localSecret
+	}
+	if id := config.GetLotusID(); id != "" {
+		return id, config.GetLotusSecret()
+	}
+	return DefaultID, config.GetLotusPassword()
+}
+
+// signature 计算签名 method path query时间戳随机数和body的sha256依次以换行拼接
+func signature(secret, method, path, query, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + path + "\n" + query + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest 为发往主gsk的请求添加签名头,body为请求体原文
+// 没有配置密钥时不签名,与未开启鉴权的主gsk保持兼容
+func SignRequest(req *http.Request, body []byte) {
+	id, secret := credential()
+	if secret == "" {
+		return
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := newNonce()
+	req.Header.Set(HeaderID, id)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, signature(secret, req.Method, req.URL.Path, req.URL.RawQuery, timestamp, nonce, body))
+}
+
+// VerifyRequest 校验请求签名,返回从gsk的凭据id
+func VerifyRequest(r *http.Request, body []byte) (string, error) {
+	return verify(r.Header.Get(HeaderID), r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderNonce), r.Header.Get(HeaderSignature),
+		r.Method, r.URL.Path, r.URL.RawQuery, body)
+}
+
+func verify(id, timestamp, nonce, sig, method, path, query string, body []byte) (string, error) {
+	if id == "" || timestamp == "" || nonce == "" || sig == "" {
+		return "", ErrMissingSignature
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", ErrExpired
+	}
+	now := time.Now()
+	if d := now.Sub(time.Unix(ts, 0)); d > maxClockSkew || d < -maxClockSkew {
+		return "", ErrExpired
+	}
+
+	secret, err := secretOf(id)
+	if err != nil {
+		return "", err
+	}
+	expected := signature(secret, method, path, query, timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return "", ErrBadSignature
+	}
+
+	// 签名正确后再登记随机数,避免伪造请求占满缓存
+	if !useNonce(id+":"+nonce, now) {
+		return "", ErrReplayed
+	}
+	return id, nil
+}
+
+// useNonce 登记随机数,重复时返回false
+func useNonce(key string, now time.Time) bool {
+	noncesMu.Lock()
+	defer noncesMu.Unlock()
+	if _, ok := nonces[key]; ok {
+		return false
+	}
+	// 清理过期的随机数
+	if len(nonces) > 1024 {
+		for k, t := range nonces {
+			if now.Sub(t) > 2*maxClockSkew {
+				delete(nonces, k)
+			}
+		}
+	}
+	nonces[key] = now
+	return true
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand不可用时退化为时间戳,仍然有时间窗口保护
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// LegacyToken 旧版短链接接口使用的token,为lotus_password的md5
+// 只在开启lotus_legacy_token时使用,没有设置密码时为空
+func LegacyToken() string {
+	password := config.GetLotusPassword()
+	if !config.GetLotusLegacyToken() || password == "" {
+		return ""
+	}
+	sum := md5.Sum([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyLegacyToken 校验未签名请求中的旧版token
+func VerifyLegacyToken(token string) bool {
+	expected := LegacyToken()
+	return expected != "" && hmac.Equal([]byte(expected), []byte(token))
+}
@@ -0,0 +1,127 @@
+package lotus
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/proto"
+	"google.golang.org/grpc/metadata"
+)
+
+// 未加载配置时使用local凭据签名,便于在测试中校验
+
+func newSignedRequest(t *testing.T, body string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1/url?x=1", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SignRequest(req, []byte(body))
+	return req
+}
+
+func TestSignVerify(t *testing.T) {
+	req := newSignedRequest(t, "url=https://example.com")
+	id, err := VerifyRequest(req, []byte("url=https://example.com"))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if id != LocalID {
+		t.Fatalf("id = %q, want %q", id, LocalID)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	req := newSignedRequest(t, "url=https://example.com")
+	if _, err := VerifyRequest(req, []byte("url=https://evil.example")); err != ErrBadSignature {
+		t.Fatalf("tampered body: err = %v, want %v", err, ErrBadSignature)
+	}
+
+	req = newSignedRequest(t, "")
+	req.URL.RawQuery = "x=2"
+	if _, err := VerifyRequest(req, nil); err != ErrBadSignature {
+		t.Fatalf("tampered query: err = %v, want %v", err, ErrBadSignature)
+	}
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	req := newSignedRequest(t, "a=1")
+	if _, err := VerifyRequest(req, []byte("a=1")); err != nil {
+		t.Fatalf("first verify: %v", err)
+	}
+	if _, err := VerifyRequest(req, []byte("a=1")); err != ErrReplayed {
+		t.Fatalf("replay: err = %v, want %v", err, ErrReplayed)
+	}
+}
+
+func TestVerifyRejectsExpired(t *testing.T) {
+	for _, d := range []time.Duration{-maxClockSkew - time.Minute, maxClockSkew + time.Minute} {
+		ts := strconv.FormatInt(time.Now().Add(d).Unix(), 10)
+		nonce := newNonce()
+		sig := signature(localSecret, http.MethodGet, "/getid", "", ts, nonce, nil)
+		if _, err := verify(LocalID, ts, nonce, sig, http.MethodGet, "/getid", "", nil); err != ErrExpired {
+			t.Fatalf("offset %v: err = %v, want %v", d, err, ErrExpired)
+		}
+	}
+}
+
+func TestVerifyRejectsMissingAndUnknown(t *testing.T) {
+	if _, err := verify("", "", "", "", http.MethodGet, "/getid", "", nil); err != ErrMissingSignature {
+		t.Fatalf("missing: err = %v, want %v", err, ErrMissingSignature)
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	if _, err := verify("nobody", ts, newNonce(), "00", http.MethodGet, "/getid", "", nil); err != ErrUnknownSecondary {
+		t.Fatalf("unknown id: err = %v, want %v", err, ErrUnknownSecondary)
+	}
+}
+
+func TestGRPCSignatureCoversRequest(t *testing.T) {
+	const method = "/proto.IDMapService/StoreIDV2"
+	req := &proto.StoreIDRequest{IdOrRow: "real-id"}
+	ctx, err := signedContext(context.Background(), method, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	get := func(key string) string {
+		if v := md.Get(strings.ToLower(key)); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	check := func(r *proto.StoreIDRequest) error {
+		body, err := marshalRequest(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = verify(get(HeaderID), get(HeaderTimestamp), get(HeaderNonce), get(HeaderSignature), grpcMethod, method, "", body)
+		return err
+	}
+
+	// 换一个请求体的重放不能通过签名校验
+	if err := check(&proto.StoreIDRequest{IdOrRow: "other-id"}); err != ErrBadSignature {
+		t.Fatalf("different payload: err = %v, want %v", err, ErrBadSignature)
+	}
+	if err := check(req); err != nil {
+		t.Fatalf("original payload: %v", err)
+	}
+}
+
+func TestMarshalRequestDeterministic(t *testing.T) {
+	a, err := marshalRequest(&proto.StoreIDRequest{IdOrRow: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := marshalRequest(&proto.StoreIDRequest{IdOrRow: "x"})
+	if !bytes.Equal(a, b) {
+		t.Fatal("marshal is not deterministic")
+	}
+	if _, err := marshalRequest("not a proto"); err == nil {
+		t.Fatal("expected error for non-proto request")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -23,12 +24,15 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/hoshinonyaruko/gensokyo/Processor"
 	"github.com/hoshinonyaruko/gensokyo/acnode"
+	"github.com/hoshinonyaruko/gensokyo/backup"
 	"github.com/hoshinonyaruko/gensokyo/botstats"
 	"github.com/hoshinonyaruko/gensokyo/config"
 	"github.com/hoshinonyaruko/gensokyo/echo"
 	"github.com/hoshinonyaruko/gensokyo/handlers"
 	"github.com/hoshinonyaruko/gensokyo/httpapi"
 	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/lotus"
+	"github.com/hoshinonyaruko/gensokyo/markdown"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
 	"github.com/hoshinonyaruko/gensokyo/server"
 	"github.com/hoshinonyaruko/gensokyo/sys"
@@ -61,6 +65,9 @@ func main() {
 	delcache := flag.Bool("del_cache", false, "delete cache bucket, it is safe")
 	compaction := flag.Bool("compaction", false, "compaction for apply db changes.")
 	m := flag.Bool("m", false, "Maintenance mode")
+	idmapCmd := flag.String("idmap", "", "idmap admin: search|subkeys|rebind|orphans|export|import|collisions|role|migrate, args follow flags. stop gensokyo first.")
+	backupNow := flag.Bool("backup", false, "backup all databases to db_backup_dir and exit. stop gensokyo first.")
+	restore := flag.String("restore", "", "verify and restore databases from a backup in db_backup_dir, e.g. 20240101-120000. stop gensokyo first.")
 
 	// 解析命令行参数到定义的标志。
 	flag.Parse()
@@ -112,6 +119,11 @@ func main() {
 		log.Fatalf("error: %v", err)
 	}
 
+	// 在打开数据库之前恢复webui中选择的备份
+	if err := backup.ApplyPending(); err != nil {
+		log.Printf("恢复备份失败: %v", err)
+	}
+
 	// 配置热重载
 	go setupConfigWatcher("config.yml")
 
@@ -130,6 +142,40 @@ func main() {
 	mylog.SetLogLevel(logLevel)
 	botgo.SetLogger(loggerAdapter)
 
+	if *idmapCmd != "" {
+		// 命令行管理idmap 不需要登录 执行后退出
+		log.Println("正在打开idmap.db,如长时间无响应请先关闭正在运行的gensokyo")
+		idmap.InitializeDB()
+		err := idmap.RunAdminCommand(*idmapCmd, flag.Args(), os.Stdout)
+		idmap.CloseDB()
+		if err != nil {
+			log.Fatalf("idmap: %v", err)
+		}
+		return
+	}
+
+	if *backupNow {
+		// 命令行备份 只读打开全部数据库后备份并退出
+		manifest, err := backup.SnapshotFiles([]string{idmap.DBName, botstats.DBName, webui.DBName, url.DBName})
+		if err != nil {
+			log.Fatalf("backup: %v", err)
+		}
+		for _, file := range manifest.Files {
+			log.Printf("%s\t%d\t%s", file.Name, file.Size, file.SHA256)
+		}
+		log.Printf("已备份到%s", filepath.Join(backup.Dir(), manifest.Name))
+		return
+	}
+
+	if *restore != "" {
+		// 命令行恢复 数据库此时都未打开
+		if err := backup.Restore(*restore); err != nil {
+			log.Fatalf("restore: %v", err)
+		}
+		log.Printf("已从%s恢复,原数据库文件保留为.before-restore", *restore)
+		return
+	}
+
 	if *m {
 		// 维护模式
 		conf.Settings.WsAddress = []string{"ws://127.0.0.1:50000"}
@@ -139,6 +185,8 @@ func main() {
 	// 创建webui数据库
 	webui.InitializeDB()
 	defer webui.CloseDB()
+	// 创建短链接数据库
+	url.InitializeDB()
 
 	if conf.Settings.AppID == 12345 {
 		// 输出天蓝色文本
@@ -210,12 +258,24 @@ func main() {
 		if !nologin {
 			//创建idmap服务器 数据库
 			idmap.InitializeDB()
+			//后台检查历史哈希碰撞
+			go idmap.ReportHashCollisions()
+			//lotus从gsk凭据保存在idmap数据库
+			lotus.SetStore(idmap.LotusStore{})
+			if err := lotus.CheckConfig(); err != nil {
+				log.Fatalf("lotus配置错误: %v", err)
+			}
+			//webui添加的md模板也保存在idmap数据库
+			markdown.SetStore(idmap.MarkdownStore{})
 			//创建botstats数据库
 			botstats.InitializeDB()
 
 			//关闭时候释放数据库
 			defer idmap.CloseDB()
 			defer botstats.CloseDB()
+			//定时热备份数据库
+			backup.Start()
+			defer backup.Stop()
 
 			if *delids {
 				mylog.Printf("开始删除ids\n")
@@ -411,14 +471,18 @@ func main() {
 		hr.Use(gin.Recovery())
 	}
 	if !conf.Settings.LotusGrpc {
-		r.GET("/getid", server.GetIDHandler)
+		r.GET("/getid", server.LotusAuth(), server.GetIDHandler)
 	} else {
 		if conf.Settings.Lotus {
 			// 根据配置决定是否初始化 gRPC 客户端
 			if config.GetLotusGrpc() {
 				serverDir := config.GetServer_dir()
 				port := conf.Settings.LotusGrpcPort
-				conn, err := grpc.NewClient(serverDir+":"+strconv.Itoa(port), grpc.WithInsecure())
+				dialOptions, err := lotus.DialOptions()
+				if err != nil {
+					panic(fmt.Sprintf("failed to load lotus TLS config: %v", err))
+				}
+				conn, err := grpc.NewClient(serverDir+":"+strconv.Itoa(port), dialOptions...)
 				if err != nil {
 					panic(fmt.Sprintf("failed to connect to gRPC server: %v", err))
 				} else {
@@ -435,7 +499,11 @@ func main() {
 				log.Fatalf("failed to listen: %v", err)
 			}
 
-			grpcServer := grpc.NewServer()
+			serverOptions, err := lotus.ServerOptions()
+			if err != nil {
+				log.Fatalf("failed to load lotus TLS config: %v", err)
+			}
+			grpcServer := grpc.NewServer(serverOptions...)
 
 			// 注册 gRPC 服务
 			proto.RegisterIDMapServiceServer(grpcServer, &idmap.Server{})
@@ -453,10 +521,10 @@ func main() {
 	go webhookHandler.ListenAndProcessMessages()
 
 	r.GET("/updateport", server.HandleIpupdate)
-	r.POST("/uploadpic", server.UploadBase64ImageHandler(rateLimiter))
+	r.POST("/uploadpic", server.LotusAuth(), server.UploadBase64ImageHandler(rateLimiter))
 	r.POST("/uploadpicv2", server.UploadBase64ImageHandlerV2(rateLimiter, apiV2))
 	r.POST("/uploadpicv3", server.UploadBase64ImageHandlerV3(rateLimiter, api))
-	r.POST("/uploadrecord", server.UploadBase64RecordHandler(rateLimiter))
+	r.POST("/uploadrecord", server.LotusAuth(), server.UploadBase64RecordHandler(rateLimiter))
 	// 使用 CreateHandleValidation，传入 WebhookHandler 实例
 	server.InitPrivateKey(conf.Settings.ClientSecret)
 	r.POST("/"+conf.Settings.WebhookPath, server.CreateHandleValidationSafe(webhookHandler))
@@ -501,7 +569,7 @@ func main() {
 			}
 		}
 	}
-	r.POST("/url", url.CreateShortURLHandler)
+	r.POST("/url", server.LotusAuth(), url.CreateShortURLHandler)
 	r.GET("/url/:shortURL", url.RedirectFromShortURLHandler)
 	if config.GetIdentifyFile() {
 		appIDStr := config.GetAppIDStr()
@@ -552,6 +620,12 @@ func main() {
 				log.Fatalf("crt or key path is missing for HTTPS")
 				return
 			}
+			// 开启lotus_mtls时校验从gsk的客户端证书
+			tlsConfig, err := lotus.ServerTLSConfig()
+			if err != nil {
+				log.Fatalf("failed to load lotus TLS config: %v", err)
+			}
+			httpServer.TLSConfig = tlsConfig
 			if err := httpServer.ListenAndServeTLS(crtPath, keyPath); err != nil && err != http.ErrServerClosed {
 				log.Fatalf("listen (HTTPS): %s\n", err)
 			}
@@ -685,7 +759,7 @@ func ATMessageEventHandler() event.ATMessageEventHandler {
 // GuildEventHandler 处理频道事件
 func GuildEventHandler() event.GuildEventHandler {
 	return func(event *dto.WSPayload, data *dto.WSGuildData) error {
-		log.Println(data)
+		go p.ProcessGuildEvent(event.Type, data)
 		return nil
 	}
 }
@@ -693,7 +767,7 @@ func GuildEventHandler() event.GuildEventHandler {
 // ChannelEventHandler 处理子频道事件
 func ChannelEventHandler() event.ChannelEventHandler {
 	return func(event *dto.WSPayload, data *dto.WSChannelData) error {
-		log.Println(data)
+		go p.ProcessChannelEvent(event.Type, data)
 		return nil
 	}
 }
@@ -701,7 +775,47 @@ func ChannelEventHandler() event.ChannelEventHandler {
 // MemberEventHandler 处理成员变更事件
 func MemberEventHandler() event.GuildMemberEventHandler {
 	return func(event *dto.WSPayload, data *dto.WSGuildMemberData) error {
-		log.Println(data)
+		go p.ProcessMemberEvent(event.Type, data)
+		return nil
+	}
+}
+
+// MessageDeleteEventHandler 处理私域频道信息撤回事件
+func MessageDeleteEventHandler() event.MessageDeleteEventHandler {
+	return func(event *dto.WSPayload, data *dto.WSMessageDeleteData) error {
+		go p.ProcessMessageDelete(event.Type, (*dto.MessageDelete)(data))
+		return nil
+	}
+}
+
+// PublicMessageDeleteEventHandler 处理公域频道信息撤回事件
+func PublicMessageDeleteEventHandler() event.PublicMessageDeleteEventHandler {
+	return func(event *dto.WSPayload, data *dto.WSPublicMessageDeleteData) error {
+		go p.ProcessMessageDelete(event.Type, (*dto.MessageDelete)(data))
+		return nil
+	}
+}
+
+// DirectMessageDeleteEventHandler 处理频道私信撤回事件
+func DirectMessageDeleteEventHandler() event.DirectMessageDeleteEventHandler {
+	return func(event *dto.WSPayload, data *dto.WSDirectMessageDeleteData) error {
+		go p.ProcessMessageDelete(event.Type, (*dto.MessageDelete)(data))
+		return nil
+	}
+}
+
+// MessageReactionEventHandler 处理表情表态事件
+func MessageReactionEventHandler() event.MessageReactionEventHandler {
+	return func(event *dto.WSPayload, data *dto.WSMessageReactionData) error {
+		go p.ProcessMessageReaction(event.Type, data)
+		return nil
+	}
+}
+
+// MessageAuditEventHandler 处理信息审核结果事件
+func MessageAuditEventHandler() event.MessageAuditEventHandler {
+	return func(event *dto.WSPayload, data *dto.WSMessageAuditData) error {
+		go p.ProcessMessageAudit(event.Type, data)
 		return nil
 	}
 }
@@ -749,7 +863,51 @@ func InteractionHandler() event.InteractionEventHandler {
 func ThreadEventHandler() event.ThreadEventHandler {
 	return func(event *dto.WSPayload, data *dto.WSThreadData) error {
 		mylog.Printf("收到帖子事件:%v", data)
-		go p.ProcessThreadMessage(data)
+		if event.Type == dto.EventForumThreadCreate {
+			go p.ProcessThreadMessage(data)
+		} else {
+			go p.ProcessThreadEvent(event.Type, data)
+		}
+		return nil
+	}
+}
+
+// AudioEventHandler 处理音频播放与上下麦事件
+func AudioEventHandler() event.AudioEventHandler {
+	return func(event *dto.WSPayload, data *dto.WSAudioData) error {
+		go p.ProcessAudioEvent(event.Type, data)
+		return nil
+	}
+}
+
+// AudioLiveChannelMemberEventHandler 处理音视频、直播子频道成员进出事件
+func AudioLiveChannelMemberEventHandler() event.AudioLiveChannelMemberEventHandler {
+	return func(event *dto.WSPayload, data *dto.WSAudioLiveChannelMemberData) error {
+		go p.ProcessAudioMemberEvent(event.Type, data)
+		return nil
+	}
+}
+
+// PostEventHandler 处理帖子评论事件
+func PostEventHandler() event.PostEventHandler {
+	return func(event *dto.WSPayload, data *dto.WSPostData) error {
+		go p.ProcessPostEvent(event.Type, data)
+		return nil
+	}
+}
+
+// ReplyEventHandler 处理评论回复事件
+func ReplyEventHandler() event.ReplyEventHandler {
+	return func(event *dto.WSPayload, data *dto.WSReplyData) error {
+		go p.ProcessReplyEvent(event.Type, data)
+		return nil
+	}
+}
+
+// ForumAuditEventHandler 处理发帖审核结果
+func ForumAuditEventHandler() event.ForumAuditEventHandler {
+	return func(event *dto.WSPayload, data *dto.WSForumAuditData) error {
+		go p.ProcessForumAudit(data)
 		return nil
 	}
 }
@@ -848,6 +1006,16 @@ func getHandlerByName(handlerName string) (interface{}, bool) {
 		return InteractionHandler(), true
 	case "ThreadEventHandler": //发帖事件
 		return ThreadEventHandler(), true
+	case "PostEventHandler": //帖子评论事件
+		return PostEventHandler(), true
+	case "ReplyEventHandler": //评论回复事件
+		return ReplyEventHandler(), true
+	case "ForumAuditEventHandler": //发帖审核结果
+		return ForumAuditEventHandler(), true
+	case "AudioEventHandler": //音频播放与上下麦
+		return AudioEventHandler(), true
+	case "AudioLiveChannelMemberEventHandler": //音视频、直播子频道成员进出
+		return AudioLiveChannelMemberEventHandler(), true
 	case "GroupATMessageEventHandler": //群at信息
 		return GroupATMessageEventHandler(), true
 	case "C2CMessageEventHandler": //群私聊
@@ -860,6 +1028,16 @@ func getHandlerByName(handlerName string) (interface{}, bool) {
 		return GroupMsgRejectHandler(), true
 	case "GroupMsgReceiveHandler": //群请求开启机器人主动推送
 		return GroupMsgReceiveHandler(), true
+	case "MessageDeleteEventHandler": //私域频道信息撤回
+		return MessageDeleteEventHandler(), true
+	case "PublicMessageDeleteEventHandler": //公域频道信息撤回
+		return PublicMessageDeleteEventHandler(), true
+	case "DirectMessageDeleteEventHandler": //频道私信撤回
+		return DirectMessageDeleteEventHandler(), true
+	case "MessageReactionEventHandler": //表情表态
+		return MessageReactionEventHandler(), true
+	case "MessageAuditEventHandler": //信息审核结果
+		return MessageAuditEventHandler(), true
 	default:
 		log.Printf("Unknown handler: %s\n", handlerName)
 		return nil, false
@@ -0,0 +1,100 @@
+package markdown
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hoshinonyaruko/gensokyo/structs"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// Build 用应用端给出的变量填充具名模板,得到md和模板绑定的按钮id
+// 填写了template_id的模板生成模板md,否则把变量填入content生成原生md
+func Build(name string, vars map[string]interface{}) (*dto.Markdown, string, error) {
+	t, err := Lookup(name)
+	if err != nil {
+		if errors.Is(err, ErrUnknownTemplate) {
+			return nil, "", fmt.Errorf("%w: %s", err, name)
+		}
+		return nil, "", err
+	}
+	values := make(map[string][]string, len(vars))
+	for key, v := range vars {
+		values[key] = toValues(v)
+	}
+	if err := checkVars(t, values); err != nil {
+		return nil, "", err
+	}
+
+	if t.TemplateID == "" {
+		return &dto.Markdown{Content: fill(t.Content, values)}, t.KeyboardID, nil
+	}
+	md := &dto.Markdown{CustomTemplateID: t.TemplateID}
+	for _, key := range declaredParams(t) {
+		md.Params = append(md.Params, &dto.MarkdownParams{Key: key, Values: values[key]})
+	}
+	return md, t.KeyboardID, nil
+}
+
+// checkVars 变量需要与模板的参数一一对应
+func checkVars(t structs.MarkdownTemplate, values map[string][]string) error {
+	var problems []string
+	known := make(map[string]bool)
+	for _, key := range declaredParams(t) {
+		known[key] = true
+		if _, ok := values[key]; !ok {
+			problems = append(problems, fmt.Sprintf("template %s needs variable %s", t.Name, key))
+		}
+	}
+	for key := range values {
+		if !known[key] {
+			problems = append(problems, fmt.Sprintf("template %s has no variable %s", t.Name, key))
+		}
+	}
+	return problemsError(problems)
+}
+
+// fill 把变量填入{{.key}} 多个值直接相连,没有给出的变量保持原样
+func fill(content string, values map[string][]string) string {
+	return placeholderRE.ReplaceAllStringFunc(content, func(m string) string {
+		key := placeholderRE.FindStringSubmatch(m)[1]
+		if v, ok := values[key]; ok {
+			return strings.Join(v, "")
+		}
+		return m
+	})
+}
+
+// paramValues 模板参数转换为变量表
+func paramValues(params []*dto.MarkdownParams) map[string][]string {
+	values := make(map[string][]string, len(params))
+	for _, p := range params {
+		if p != nil {
+			values[p.Key] = p.Values
+		}
+	}
+	return values
+}
+
+// toValues 变量可以是字符串、数字或它们的数组
+func toValues(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return []string{""}
+	case string:
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, toValues(item)...)
+		}
+		return values
+	case []string:
+		return v
+	}
+	return []string{fmt.Sprint(v)}
+}
@@ -0,0 +1,290 @@
+package markdown
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/tencent-connect/botgo/dto/keyboard"
+)
+
+// 平台对自定义按钮的限制
+const (
+	maxKeyboardRows = 5
+	maxRowButtons   = 5
+)
+
+// 未填写时按钮在旧版客户端上的提示
+const defaultUnsupportTips = "请升级新版手机QQ"
+
+var actionTypes = map[string]uint32{
+	"url":      uint32(keyboard.ActionTypeURL),
+	"callback": uint32(keyboard.ActionTypeCallback),
+	"command":  uint32(keyboard.ActionTypeAtBot),
+}
+
+var permissionTypes = map[string]uint32{
+	"users":   uint32(keyboard.PermissionTypeSpecifyUserIDs),
+	"manager": uint32(keyboard.PermissionTypManager),
+	"all":     uint32(keyboard.PermissionTypAll),
+	"roles":   uint32(keyboard.PermissionTypSpecifyRoleIDs),
+}
+
+// KeyboardSpec keyboard段的data id为按钮模板id,rows为自定义按钮
+// rows的每一行可以是按钮数组,也可以与dto/keyboard一致写作{"buttons":[...]}
+type KeyboardSpec struct {
+	ID      string            `json:"id,omitempty"`
+	Rows    []json.RawMessage `json:"rows,omitempty"`
+	Content *struct {
+		Rows []json.RawMessage `json:"rows,omitempty"`
+	} `json:"content,omitempty"`
+}
+
+// ButtonSpec 按钮 可以用扁平的字段,也可以直接给出dto/keyboard的render_data和action
+type ButtonSpec struct {
+	ID                   string          `json:"id,omitempty"`
+	Label                string          `json:"label,omitempty"`
+	VisitedLabel         string          `json:"visited_label,omitempty"`
+	Style                int             `json:"style,omitempty"`
+	Type                 json.RawMessage `json:"type,omitempty"` // url callback command 或 0 1 2
+	Data                 string          `json:"data,omitempty"`
+	Enter                bool            `json:"enter,omitempty"`
+	Reply                bool            `json:"reply,omitempty"`
+	Anchor               int             `json:"anchor,omitempty"`
+	ClickLimit           uint32          `json:"click_limit,omitempty"`
+	UnsupportTips        string          `json:"unsupport_tips,omitempty"`
+	AtBotShowChannelList bool            `json:"at_bot_show_channel_list,omitempty"`
+	Permission           *PermissionSpec `json:"permission,omitempty"`
+
+	RenderData *keyboard.RenderData `json:"render_data,omitempty"`
+	Action     *keyboard.Action     `json:"action,omitempty"`
+}
+
+// PermissionSpec 按钮权限 type为all manager users roles 或 0-3
+type PermissionSpec struct {
+	Type           json.RawMessage `json:"type,omitempty"`
+	UserIDs        []string        `json:"user_ids,omitempty"`
+	RoleIDs        []string        `json:"role_ids,omitempty"`
+	SpecifyUserIDs []string        `json:"specify_user_ids,omitempty"`
+	SpecifyRoleIDs []string        `json:"specify_role_ids,omitempty"`
+}
+
+// ParseKeyboard 解析keyboard段的data,得到按钮并按平台规则校验
+func ParseKeyboard(data []byte) (*keyboard.MessageKeyboard, error) {
+	var spec KeyboardSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("keyboard: %v", err)
+	}
+	rows := spec.Rows
+	if spec.Content != nil && len(rows) == 0 {
+		rows = spec.Content.Rows
+	}
+	kb := &keyboard.MessageKeyboard{ID: spec.ID}
+	var problems []string
+	if len(rows) > 0 {
+		kb.Content = &keyboard.CustomKeyboard{}
+		for i, raw := range rows {
+			buttons, err := parseRow(raw)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("row %d: %v", i+1, err))
+				continue
+			}
+			row := &keyboard.Row{}
+			for j, b := range buttons {
+				button, err := b.build()
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("button %d-%d: %v", i+1, j+1, err))
+					continue
+				}
+				row.Buttons = append(row.Buttons, button)
+			}
+			kb.Content.Rows = append(kb.Content.Rows, row)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, problemsError(problems)
+	}
+	if err := ValidateKeyboard(kb); err != nil {
+		return nil, err
+	}
+	return kb, nil
+}
+
+func parseRow(raw json.RawMessage) ([]ButtonSpec, error) {
+	var buttons []ButtonSpec
+	if err := json.Unmarshal(raw, &buttons); err == nil {
+		return buttons, nil
+	}
+	var row struct {
+		Buttons []ButtonSpec `json:"buttons"`
+	}
+	if err := json.Unmarshal(raw, &row); err != nil {
+		return nil, err
+	}
+	return row.Buttons, nil
+}
+
+// build 转换为dto/keyboard的按钮 直接给出action时原样使用
+func (b ButtonSpec) build() (*keyboard.Button, error) {
+	button := &keyboard.Button{ID: b.ID, RenderData: b.RenderData, Action: b.Action}
+	if button.RenderData == nil {
+		button.RenderData = &keyboard.RenderData{
+			Label:        b.Label,
+			VisitedLabel: b.VisitedLabel,
+			Style:        b.Style,
+		}
+		if button.RenderData.VisitedLabel == "" {
+			button.RenderData.VisitedLabel = b.Label
+		}
+	}
+	if button.Action != nil {
+		return button, nil
+	}
+
+	actionType, err := enumValue(b.Type, actionTypes, uint32(keyboard.ActionTypeAtBot))
+	if err != nil {
+		return nil, fmt.Errorf("type %v", err)
+	}
+	button.Action = &keyboard.Action{
+		Type:                 keyboard.ActionType(actionType),
+		Permission:           &keyboard.Permission{Type: keyboard.PermissionTypAll},
+		ClickLimit:           b.ClickLimit,
+		Data:                 b.Data,
+		AtBotShowChannelList: b.AtBotShowChannelList,
+		UnsupportTips:        b.UnsupportTips,
+		AnChor:               b.Anchor,
+		Enter:                b.Enter,
+		Reply:                b.Reply,
+	}
+	if button.Action.UnsupportTips == "" {
+		button.Action.UnsupportTips = defaultUnsupportTips
+	}
+	if b.Permission != nil {
+		permissionType, err := enumValue(b.Permission.Type, permissionTypes, uint32(keyboard.PermissionTypAll))
+		if err != nil {
+			return nil, fmt.Errorf("permission type %v", err)
+		}
+		button.Action.Permission = &keyboard.Permission{
+			Type:           keyboard.PermissionType(permissionType),
+			SpecifyUserIDs: append(b.Permission.UserIDs, b.Permission.SpecifyUserIDs...),
+			SpecifyRoleIDs: append(b.Permission.RoleIDs, b.Permission.SpecifyRoleIDs...),
+		}
+	}
+	return button, nil
+}
+
+// enumValue 枚举字段可以写名称或数字 为空时取默认值
+func enumValue(raw json.RawMessage, names map[string]uint32, def uint32) (uint32, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return def, nil
+	}
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		if v, ok := names[name]; ok {
+			return v, nil
+		}
+		if n, err := strconv.ParseUint(name, 10, 32); err == nil {
+			return uint32(n), nil
+		}
+		return def, fmt.Errorf("%q is not one of %v", name, enumNames(names))
+	}
+	var n uint32
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return def, fmt.Errorf("%s is not a name or number", raw)
+	}
+	return n, nil
+}
+
+func enumNames(names map[string]uint32) []string {
+	list := make([]string, len(names))
+	for name, v := range names {
+		if int(v) < len(list) {
+			list[v] = name
+		}
+	}
+	return list
+}
+
+// ValidateKeyboard 按平台的按钮规则校验 返回*ValidationError
+func ValidateKeyboard(kb *keyboard.MessageKeyboard) error {
+	if kb == nil || (kb.ID == "" && (kb.Content == nil || len(kb.Content.Rows) == 0)) {
+		return problemsError([]string{"keyboard id or rows is required"})
+	}
+	if kb.Content == nil {
+		return nil
+	}
+	var problems []string
+	if kb.ID != "" {
+		problems = append(problems, "keyboard id and rows can not be used together")
+	}
+	if len(kb.Content.Rows) > maxKeyboardRows {
+		problems = append(problems, fmt.Sprintf("keyboard has %d rows, at most %d", len(kb.Content.Rows), maxKeyboardRows))
+	}
+	ids := make(map[string]bool)
+	for i, row := range kb.Content.Rows {
+		if row == nil || len(row.Buttons) == 0 {
+			problems = append(problems, fmt.Sprintf("row %d has no buttons", i+1))
+			continue
+		}
+		if len(row.Buttons) > maxRowButtons {
+			problems = append(problems, fmt.Sprintf("row %d has %d buttons, at most %d", i+1, len(row.Buttons), maxRowButtons))
+		}
+		for j, button := range row.Buttons {
+			where := fmt.Sprintf("button %d-%d", i+1, j+1)
+			if button.ID != "" {
+				if ids[button.ID] {
+					problems = append(problems, fmt.Sprintf("%s: id %s is used twice", where, button.ID))
+				}
+				ids[button.ID] = true
+			}
+			problems = append(problems, checkButton(where, button)...)
+		}
+	}
+	return problemsError(problems)
+}
+
+func checkButton(where string, button *keyboard.Button) []string {
+	var problems []string
+	if button.RenderData == nil || button.RenderData.Label == "" {
+		problems = append(problems, where+": label is required")
+	}
+	action := button.Action
+	if action == nil {
+		return append(problems, where+": action is required")
+	}
+	if action.Data == "" {
+		problems = append(problems, where+": data is required")
+	}
+	switch action.Type {
+	case keyboard.ActionTypeURL:
+		u, err := url.Parse(action.Data)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			problems = append(problems, fmt.Sprintf("%s: url button data %q must be an http or https url", where, action.Data))
+		} else if !linkAllowed(u.Hostname()) {
+			problems = append(problems, fmt.Sprintf("%s: url host %s is not in markdown_link_whitelist", where, u.Hostname()))
+		}
+	case keyboard.ActionTypeCallback, keyboard.ActionTypeAtBot:
+	default:
+		problems = append(problems, fmt.Sprintf("%s: unknown action type %d", where, action.Type))
+	}
+	if action.Type != keyboard.ActionTypeAtBot && (action.Enter || action.Reply || action.AnChor != 0) {
+		problems = append(problems, where+": enter, reply and anchor only work on command buttons")
+	}
+	if p := action.Permission; p != nil {
+		switch p.Type {
+		case keyboard.PermissionTypeSpecifyUserIDs:
+			if len(p.SpecifyUserIDs) == 0 {
+				problems = append(problems, where+": permission users needs user_ids")
+			}
+		case keyboard.PermissionTypSpecifyRoleIDs:
+			if len(p.SpecifyRoleIDs) == 0 {
+				problems = append(problems, where+": permission roles needs role_ids")
+			}
+		case keyboard.PermissionTypManager, keyboard.PermissionTypAll:
+		default:
+			problems = append(problems, fmt.Sprintf("%s: unknown permission type %d", where, p.Type))
+		}
+	}
+	return problems
+}
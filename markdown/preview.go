@@ -0,0 +1,145 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// PreviewResult 预览结果 Problems为空表示本地校验通过
+type PreviewResult struct {
+	Markdown string   `json:"markdown"`
+	HTML     string   `json:"html"`
+	Problems []string `json:"problems"`
+}
+
+var (
+	headingRE = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	boldRE    = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	italicRE  = regexp.MustCompile(`\*(.+?)\*`)
+	strikeRE  = regexp.MustCompile(`~~(.+?)~~`)
+	ruleRE    = regexp.MustCompile(`^(\*{3,}|-{3,}|_{3,})$`)
+	listRE    = regexp.MustCompile(`^[-*+]\s+(.*)$`)
+)
+
+// Preview 校验md并渲染出预览
+func Preview(md *dto.Markdown) PreviewResult {
+	text := Render(md)
+	return PreviewResult{
+		Markdown: text,
+		HTML:     HTML(text),
+		Problems: Problems(Validate(md)),
+	}
+}
+
+// Render 得到md最终显示的文本
+// 模板md需要具名模板中写了content才能还原,否则逐行列出参数
+func Render(md *dto.Markdown) string {
+	if md == nil {
+		return ""
+	}
+	if md.CustomTemplateID == "" && md.TemplateID == 0 {
+		return md.Content
+	}
+	if t, ok := lookupByTemplateID(md.CustomTemplateID); ok && t.Content != "" {
+		return fill(t.Content, paramValues(md.Params))
+	}
+	var lines []string
+	for _, p := range md.Params {
+		if p != nil {
+			lines = append(lines, fmt.Sprintf("%s: %s", p.Key, strings.Join(p.Values, "")))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// HTML 把md文本渲染为html 只覆盖平台支持的常用语法
+func HTML(text string) string {
+	// 平台中\r与\n均为换行
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var b strings.Builder
+	inList := false
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		item := listRE.FindStringSubmatch(trimmed)
+		if item == nil && inList {
+			b.WriteString("</ul>")
+			inList = false
+		}
+		switch {
+		case item != nil:
+			if !inList {
+				b.WriteString("<ul>")
+				inList = true
+			}
+			b.WriteString("<li>" + inlineHTML(item[1]) + "</li>")
+		case ruleRE.MatchString(trimmed):
+			b.WriteString("<hr>")
+		case headingRE.MatchString(trimmed):
+			m := headingRE.FindStringSubmatch(trimmed)
+			fmt.Fprintf(&b, "<h%d>%s</h%d>", len(m[1]), inlineHTML(m[2]), len(m[1]))
+		case strings.HasPrefix(trimmed, ">"):
+			b.WriteString("<blockquote>" + inlineHTML(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))) + "</blockquote>")
+		default:
+			b.WriteString(inlineHTML(line) + "<br>")
+		}
+	}
+	if inList {
+		b.WriteString("</ul>")
+	}
+	return b.String()
+}
+
+// inlineHTML 渲染一行中的图片、链接和强调 其余文本转义
+func inlineHTML(line string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range linkRE.FindAllStringSubmatchIndex(line, -1) {
+		b.WriteString(emphasisHTML(line[last:loc[0]]))
+		isImage := line[loc[2]:loc[3]] == "!"
+		text, target := line[loc[4]:loc[5]], line[loc[6]:loc[7]]
+		if !safeURL(target, isImage) {
+			b.WriteString(html.EscapeString(line[loc[0]:loc[1]]))
+		} else if isImage {
+			attrs := ""
+			if size := imageSizeRE.FindStringSubmatch(text); size != nil {
+				attrs = fmt.Sprintf(` width="%s" height="%s"`, size[1], size[2])
+			}
+			fmt.Fprintf(&b, `<img src="%s" alt="%s"%s>`, html.EscapeString(target), html.EscapeString(text), attrs)
+		} else {
+			fmt.Fprintf(&b, `<a href="%s">%s</a>`, html.EscapeString(target), emphasisHTML(text))
+		}
+		last = loc[1]
+	}
+	b.WriteString(emphasisHTML(line[last:]))
+	return b.String()
+}
+
+func emphasisHTML(s string) string {
+	s = html.EscapeString(s)
+	s = boldRE.ReplaceAllString(s, "<b>$1</b>")
+	s = italicRE.ReplaceAllString(s, "<i>$1</i>")
+	s = strikeRE.ReplaceAllString(s, "<s>$1</s>")
+	return s
+}
+
+// safeURL 预览中只输出http地址和指令链接
+func safeURL(target string, isImage bool) bool {
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return true
+	case "mqqapi":
+		return !isImage
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package markdown
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/structs"
+)
+
+var (
+	ErrUnknownTemplate = errors.New("markdown: unknown template")
+	ErrInvalidName     = errors.New("markdown: name must be 1-32 letters, digits, - or _")
+	ErrConfigTemplate  = errors.New("markdown: template is defined in config, edit config.yml instead")
+	ErrNoStore         = errors.New("markdown: template store is not available")
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// 模板中的变量 与平台模板一致写作{{.key}}
+var placeholderRE = regexp.MustCompile(`\{\{\.?([A-Za-z0-9_]+)\}\}`)
+
+// 来源
+const (
+	SourceConfig = "config"
+	SourceWebUI  = "webui"
+)
+
+// Entry 模板及其来源,供webui展示
+type Entry struct {
+	structs.MarkdownTemplate
+	Source string `json:"source"`
+}
+
+// Store webui中添加的模板的持久化,由idmap提供
+type Store interface {
+	LoadMarkdownTemplates() ([]structs.MarkdownTemplate, error)
+	SaveMarkdownTemplate(t structs.MarkdownTemplate) error
+	DeleteMarkdownTemplate(name string) error
+}
+
+var (
+	store   Store
+	storeMu sync.RWMutex
+)
+
+// SetStore 设置模板存储
+func SetStore(s Store) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	store = s
+}
+
+func loadStored() ([]structs.MarkdownTemplate, error) {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	if store == nil {
+		return nil, nil
+	}
+	return store.LoadMarkdownTemplates()
+}
+
+// List 列出全部模板 配置文件中的同名模板优先
+func List() ([]Entry, error) {
+	var list []Entry
+	seen := make(map[string]bool)
+	for _, t := range config.GetMarkdownTemplates() {
+		if seen[t.Name] {
+			continue
+		}
+		seen[t.Name] = true
+		list = append(list, Entry{MarkdownTemplate: t, Source: SourceConfig})
+	}
+	stored, err := loadStored()
+	if err != nil {
+		return list, err
+	}
+	for _, t := range stored {
+		if seen[t.Name] {
+			continue
+		}
+		seen[t.Name] = true
+		list = append(list, Entry{MarkdownTemplate: t, Source: SourceWebUI})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Lookup 按名称查找模板
+func Lookup(name string) (structs.MarkdownTemplate, error) {
+	list, err := List()
+	for _, e := range list {
+		if e.Name == name {
+			return e.MarkdownTemplate, nil
+		}
+	}
+	if err != nil {
+		return structs.MarkdownTemplate{}, err
+	}
+	return structs.MarkdownTemplate{}, ErrUnknownTemplate
+}
+
+// lookupByTemplateID 按平台模板id查找具名模板,用于校验直接传入custom_template_id的信息
+func lookupByTemplateID(id string) (structs.MarkdownTemplate, bool) {
+	if id == "" {
+		return structs.MarkdownTemplate{}, false
+	}
+	list, _ := List()
+	for _, e := range list {
+		if e.TemplateID == id {
+			return e.MarkdownTemplate, true
+		}
+	}
+	return structs.MarkdownTemplate{}, false
+}
+
+// Save 添加或修改webui中的模板 保存前校验模板本身
+func Save(t structs.MarkdownTemplate) error {
+	if !validName.MatchString(t.Name) {
+		return ErrInvalidName
+	}
+	for _, c := range config.GetMarkdownTemplates() {
+		if c.Name == t.Name {
+			return ErrConfigTemplate
+		}
+	}
+	if err := CheckTemplate(t); err != nil {
+		return err
+	}
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	if store == nil {
+		return ErrNoStore
+	}
+	return store.SaveMarkdownTemplate(t)
+}
+
+// Delete 删除webui中的模板
+func Delete(name string) error {
+	for _, c := range config.GetMarkdownTemplates() {
+		if c.Name == name {
+			return ErrConfigTemplate
+		}
+	}
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	if store == nil {
+		return ErrNoStore
+	}
+	return store.DeleteMarkdownTemplate(name)
+}
+
+// placeholders 按出现顺序列出content中的变量 不重复
+func placeholders(content string) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, m := range placeholderRE.FindAllStringSubmatch(content, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			keys = append(keys, m[1])
+		}
+	}
+	return keys
+}
+
+// declaredParams 模板的变量 未声明params时取content中出现的变量
+func declaredParams(t structs.MarkdownTemplate) []string {
+	if len(t.Params) > 0 {
+		return t.Params
+	}
+	return placeholders(t.Content)
+}
@@ -0,0 +1,239 @@
+package markdown
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/structs"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+var (
+	// ![描述 #宽px #高px](地址) 与 [文字](地址)
+	linkRE = regexp.MustCompile(`(!?)\[([^\]]*)\]\(([^)\s]*)\)`)
+	// 图片描述中的宽高
+	imageSizeRE = regexp.MustCompile(`#(\d+)px\s+#(\d+)px`)
+	// 参数名
+	placeholderKeyRE = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// ValidationError 本地校验发现的全部问题
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "markdown: " + strings.Join(e.Problems, "; ")
+}
+
+// Problems 取出校验错误中的问题列表,其他错误原样返回
+func Problems(err error) []string {
+	if err == nil {
+		return nil
+	}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return verr.Problems
+	}
+	return []string{err.Error()}
+}
+
+func problemsError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: problems}
+}
+
+// Validate 按平台的md规则校验 返回*ValidationError
+// 图片需要在描述中写明宽高,链接需要在白名单中,模板参数需要与具名模板声明的一致
+func Validate(md *dto.Markdown) error {
+	if md == nil || (md.CustomTemplateID == "" && md.TemplateID == 0 && md.Content == "") {
+		return problemsError([]string{"markdown content or custom_template_id is required"})
+	}
+	// 原生markdown
+	if md.CustomTemplateID == "" && md.TemplateID == 0 {
+		return problemsError(checkContent(md.Content))
+	}
+
+	problems := checkParams(md.Params)
+	if t, ok := lookupByTemplateID(md.CustomTemplateID); ok {
+		problems = append(problems, checkDeclared(t, md.Params)...)
+		if t.Content != "" {
+			problems = append(problems, checkContent(fill(t.Content, paramValues(md.Params)))...)
+		}
+	} else {
+		for _, p := range md.Params {
+			for _, v := range p.Values {
+				problems = append(problems, checkContent(v)...)
+			}
+		}
+	}
+	return problemsError(problems)
+}
+
+// CheckTemplate 校验模板定义本身
+func CheckTemplate(t structs.MarkdownTemplate) error {
+	var problems []string
+	if t.TemplateID == "" && t.Content == "" {
+		problems = append(problems, "template_id or content is required")
+	}
+	seen := make(map[string]bool)
+	for _, key := range t.Params {
+		if !placeholderKeyRE.MatchString(key) {
+			problems = append(problems, fmt.Sprintf("param %q must be letters, digits or _", key))
+		}
+		if seen[key] {
+			problems = append(problems, fmt.Sprintf("param %q is declared twice", key))
+		}
+		seen[key] = true
+	}
+	// 声明了params时 content中的变量都需要声明
+	if len(t.Params) > 0 {
+		for _, key := range placeholders(t.Content) {
+			if !seen[key] {
+				problems = append(problems, fmt.Sprintf("content uses {{.%s}} which is not in params", key))
+			}
+		}
+	}
+	return problemsError(problems)
+}
+
+// checkParams 参数键不能重复 值不能为空 平台会拒绝空值
+func checkParams(params []*dto.MarkdownParams) []string {
+	var problems []string
+	seen := make(map[string]bool)
+	for i, p := range params {
+		if p == nil || p.Key == "" {
+			problems = append(problems, fmt.Sprintf("param #%d has no key", i+1))
+			continue
+		}
+		if seen[p.Key] {
+			problems = append(problems, fmt.Sprintf("param %s is given twice", p.Key))
+		}
+		seen[p.Key] = true
+		if len(p.Values) == 0 {
+			problems = append(problems, fmt.Sprintf("param %s has no value", p.Key))
+		}
+		for _, v := range p.Values {
+			if v == "" {
+				problems = append(problems, fmt.Sprintf("param %s has an empty value, use a space instead", p.Key))
+				break
+			}
+		}
+	}
+	return problems
+}
+
+// checkDeclared 参数需要与具名模板声明的参数一致
+func checkDeclared(t structs.MarkdownTemplate, params []*dto.MarkdownParams) []string {
+	declared := declaredParams(t)
+	if len(declared) == 0 {
+		return nil
+	}
+	var problems []string
+	given := make(map[string]bool)
+	for _, p := range params {
+		if p != nil {
+			given[p.Key] = true
+		}
+	}
+	known := make(map[string]bool)
+	for _, key := range declared {
+		known[key] = true
+		if !given[key] {
+			problems = append(problems, fmt.Sprintf("template %s needs param %s", t.Name, key))
+		}
+	}
+	for _, p := range params {
+		if p != nil && p.Key != "" && !known[p.Key] {
+			problems = append(problems, fmt.Sprintf("template %s has no param %s", t.Name, p.Key))
+		}
+	}
+	if len(params) != len(declared) && len(problems) == 0 {
+		problems = append(problems, fmt.Sprintf("template %s takes %d params, got %d", t.Name, len(declared), len(params)))
+	}
+	return problems
+}
+
+// checkContent 校验md文本中的图片和链接
+func checkContent(content string) []string {
+	var problems []string
+	for _, m := range linkRE.FindAllStringSubmatch(content, -1) {
+		isImage, text, target := m[1] == "!", m[2], m[3]
+		if isImage {
+			problems = append(problems, checkImage(text, target)...)
+		} else if p := checkLink(target); p != "" {
+			problems = append(problems, p)
+		}
+	}
+	return problems
+}
+
+// checkImage 图片需要http地址,并在描述中写明宽高 如![图片 #200px #100px](url)
+func checkImage(alt, target string) []string {
+	var problems []string
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("image %q must be an http or https url", target))
+	}
+	size := imageSizeRE.FindStringSubmatch(alt)
+	if size == nil {
+		problems = append(problems, fmt.Sprintf("image %q needs its size in the text, like ![img #200px #100px](url)", target))
+		return problems
+	}
+	width, _ := strconv.Atoi(size[1])
+	height, _ := strconv.Atoi(size[2])
+	if width <= 0 || height <= 0 {
+		problems = append(problems, fmt.Sprintf("image %q has an invalid size %dx%d", target, width, height))
+	}
+	return problems
+}
+
+// checkLink 指令链接不受限制,http链接需要在白名单中
+func checkLink(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Sprintf("link %q is not a valid url", target)
+	}
+	switch u.Scheme {
+	case "mqqapi":
+		return ""
+	case "http", "https":
+	default:
+		return fmt.Sprintf("link %q must be http, https or mqqapi", target)
+	}
+	if !linkAllowed(u.Hostname()) {
+		return fmt.Sprintf("link host %s is not in markdown_link_whitelist", u.Hostname())
+	}
+	return ""
+}
+
+// linkAllowed 白名单为空时不限制,域名同时匹配其子域名
+func linkAllowed(host string) bool {
+	whitelist := config.GetMarkdownLinkWhitelist()
+	if len(whitelist) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, domain := range whitelist {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "."))
+		if domain == "" {
+			continue
+		}
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// LinkWhitelisted 域名是否在markdown_link_whitelist中 白名单为空时返回false
+func LinkWhitelisted(host string) bool {
+	return len(config.GetMarkdownLinkWhitelist()) > 0 && linkAllowed(host)
+}
@@ -0,0 +1,231 @@
+package markdown
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/structs"
+	"github.com/hoshinonyaruko/gensokyo/template"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// loadTestConfig 以默认配置模板加载一份临时配置 overrides按键替换模板中的值
+func loadTestConfig(t *testing.T, overrides map[string]string) {
+	t.Helper()
+	data := template.ConfigTemplate
+	for key, value := range overrides {
+		re := regexp.MustCompile(`(?m)^  ` + key + `\s*:.*$`)
+		if !re.MatchString(data) {
+			t.Fatalf("config key %s not in template", key)
+		}
+		data = re.ReplaceAllLiteralString(data, "  "+key+" : "+value)
+	}
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.LoadConfig(path, false); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+}
+
+// memStore 内存中的模板存储
+type memStore map[string]structs.MarkdownTemplate
+
+func (s memStore) LoadMarkdownTemplates() ([]structs.MarkdownTemplate, error) {
+	var list []structs.MarkdownTemplate
+	for _, t := range s {
+		list = append(list, t)
+	}
+	return list, nil
+}
+
+func (s memStore) SaveMarkdownTemplate(t structs.MarkdownTemplate) error {
+	s[t.Name] = t
+	return nil
+}
+
+func (s memStore) DeleteMarkdownTemplate(name string) error {
+	delete(s, name)
+	return nil
+}
+
+func params(kv ...string) []*dto.MarkdownParams {
+	var list []*dto.MarkdownParams
+	for i := 0; i+1 < len(kv); i += 2 {
+		list = append(list, &dto.MarkdownParams{Key: kv[i], Values: []string{kv[i+1]}})
+	}
+	return list
+}
+
+// hasProblem 是否有包含want的问题
+func hasProblem(err error, want string) bool {
+	for _, p := range Problems(err) {
+		if strings.Contains(p, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateContent(t *testing.T) {
+	loadTestConfig(t, map[string]string{"markdown_link_whitelist": `["example.com"]`})
+	SetStore(nil)
+
+	cases := []struct {
+		content string
+		problem string // 为空表示校验通过
+	}{
+		{"# 标题\n正文", ""},
+		{"![图 #200px #100px](https://example.com/a.png)", ""},
+		{"![图](https://example.com/a.png)", "needs its size"},
+		{"![图 #0px #100px](https://example.com/a.png)", "invalid size"},
+		{"![图 #200px #100px](/a.png)", "must be an http or https url"},
+		{"[链接](https://example.com/x)", ""},
+		{"[子域名](https://www.example.com/x)", ""},
+		{"[链接](https://evil.com/x)", "not in markdown_link_whitelist"},
+		{"[仿冒](https://notexample.com/x)", "not in markdown_link_whitelist"},
+		{"[指令](mqqapi://aio/inlinecmd?command=hi)", ""},
+		{"[脚本](javascript:alert)", "must be http, https or mqqapi"},
+	}
+	for _, c := range cases {
+		err := Validate(&dto.Markdown{Content: c.content})
+		if c.problem == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", c.content, err)
+			}
+			continue
+		}
+		var verr *ValidationError
+		if !errors.As(err, &verr) || !hasProblem(err, c.problem) {
+			t.Errorf("%q: got %v, want a problem containing %q", c.content, err, c.problem)
+		}
+	}
+
+	// 一次报告全部问题
+	err := Validate(&dto.Markdown{Content: "![a](https://example.com/a.png) [b](https://evil.com)"})
+	if len(Problems(err)) != 2 {
+		t.Errorf("got problems %q", Problems(err))
+	}
+	if err := Validate(&dto.Markdown{}); !hasProblem(err, "required") {
+		t.Errorf("empty markdown: %v", err)
+	}
+}
+
+func TestValidateEmptyWhitelist(t *testing.T) {
+	loadTestConfig(t, map[string]string{"markdown_link_whitelist": "[]"})
+	if err := Validate(&dto.Markdown{Content: "[链接](https://anything.example/x)"}); err != nil {
+		t.Errorf("empty whitelist should allow any link: %v", err)
+	}
+	if LinkWhitelisted("anything.example") {
+		t.Error("LinkWhitelisted should be false with an empty whitelist")
+	}
+}
+
+func TestValidateTemplateParams(t *testing.T) {
+	loadTestConfig(t, map[string]string{"markdown_link_whitelist": `["example.com"]`})
+	SetStore(memStore{"weather": {
+		Name:       "weather",
+		TemplateID: "102_1",
+		Params:     []string{"city", "img"},
+		Content:    "# {{.city}}\r![天气 #100px #100px]({{.img}})",
+	}})
+	defer SetStore(nil)
+
+	ok := &dto.Markdown{CustomTemplateID: "102_1", Params: params("city", "北京", "img", "https://example.com/sun.png")}
+	if err := Validate(ok); err != nil {
+		t.Errorf("valid template params: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		params  []*dto.MarkdownParams
+		problem string
+	}{
+		{"missing", params("city", "北京"), "needs param img"},
+		{"unknown", params("city", "北京", "img", "https://example.com/a.png", "wind", "3"), "has no param wind"},
+		{"duplicate", params("city", "北京", "city", "上海", "img", "https://example.com/a.png"), "given twice"},
+		{"empty value", params("city", "", "img", "https://example.com/a.png"), "empty value"},
+		{"filled content", params("city", "北京", "img", "ftp://example.com/a.png"), "must be an http or https url"},
+	}
+	for _, c := range cases {
+		err := Validate(&dto.Markdown{CustomTemplateID: "102_1", Params: c.params})
+		if !hasProblem(err, c.problem) {
+			t.Errorf("%s: got %q, want a problem containing %q", c.name, Problems(err), c.problem)
+		}
+	}
+
+	// 不认识的模板id只校验参数值中的链接
+	err := Validate(&dto.Markdown{CustomTemplateID: "999", Params: params("any", "[x](https://evil.com)")})
+	if !hasProblem(err, "not in markdown_link_whitelist") {
+		t.Errorf("unknown template id: %q", Problems(err))
+	}
+	if err := Validate(&dto.Markdown{CustomTemplateID: "999", Params: params("any", "text")}); err != nil {
+		t.Errorf("unknown template id with plain values: %v", err)
+	}
+}
+
+func TestCheckTemplate(t *testing.T) {
+	cases := []struct {
+		name     string
+		template structs.MarkdownTemplate
+		problems []string
+	}{
+		{"native", structs.MarkdownTemplate{Content: "# {{.title}}"}, nil},
+		{"platform", structs.MarkdownTemplate{TemplateID: "102_1", Params: []string{"a", "b"}}, nil},
+		{"declared", structs.MarkdownTemplate{Content: "{{.a}}{{b}}", Params: []string{"a", "b"}}, nil},
+		{"empty", structs.MarkdownTemplate{}, []string{"template_id or content is required"}},
+		{"bad key", structs.MarkdownTemplate{TemplateID: "1", Params: []string{"a-b"}}, []string{`param "a-b" must be`}},
+		{"twice", structs.MarkdownTemplate{TemplateID: "1", Params: []string{"a", "a"}}, []string{`param "a" is declared twice`}},
+		{"undeclared", structs.MarkdownTemplate{Content: "{{.a}}{{.c}}", Params: []string{"a"}}, []string{"{{.c}} which is not in params"}},
+	}
+	for _, c := range cases {
+		err := CheckTemplate(c.template)
+		if len(Problems(err)) != len(c.problems) {
+			t.Errorf("%s: got %q, want %q", c.name, Problems(err), c.problems)
+			continue
+		}
+		for _, want := range c.problems {
+			if !hasProblem(err, want) {
+				t.Errorf("%s: got %q, want a problem containing %q", c.name, Problems(err), want)
+			}
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	loadTestConfig(t, nil)
+	SetStore(memStore{
+		"native":  {Name: "native", Content: "# {{.title}}\r{{.body}}", KeyboardID: "kb_1"},
+		"weather": {Name: "weather", TemplateID: "102_1", Params: []string{"city", "temp"}},
+	})
+	defer SetStore(nil)
+
+	md, keyboardID, err := Build("native", map[string]interface{}{"title": "标题", "body": []interface{}{"a", 1.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Content != "# 标题\ra1.5" || keyboardID != "kb_1" {
+		t.Errorf("native: %q %q", md.Content, keyboardID)
+	}
+
+	md, _, err = Build("weather", map[string]interface{}{"temp": "20", "city": "北京"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.CustomTemplateID != "102_1" || len(md.Params) != 2 || md.Params[0].Key != "city" || md.Params[1].Values[0] != "20" {
+		t.Errorf("weather: %+v", md)
+	}
+
+	if _, _, err := Build("weather", map[string]interface{}{"city": "北京", "wind": "3"}); !hasProblem(err, "needs variable temp") || !hasProblem(err, "has no variable wind") {
+		t.Errorf("wrong variables: %v", err)
+	}
+	if _, _, err := Build("missing", nil); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("unknown template: %v", err)
+	}
+}
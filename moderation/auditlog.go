@@ -0,0 +1,86 @@
+package moderation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+)
+
+// 审核日志中文本最多保留的字数
+const auditLogTextLimit = 200
+
+var auditLogMu sync.Mutex
+
+// auditLogEntry 审核日志中的一行
+type auditLogEntry struct {
+	Time     string `json:"time"`
+	Kind     string `json:"kind"`
+	Content  string `json:"content"`
+	Provider string `json:"provider"`
+	Action   string `json:"action"`
+	Reason   string `json:"reason,omitempty"`
+	Scene
+}
+
+// writeAuditLog 以json行的形式追加写入审核日志 通过的决定只在moderation_log_pass时记录
+func writeAuditLog(c *Content, d Decision) {
+	if d.Action == ActionPass && !config.GetModerationLogPass() {
+		return
+	}
+	name := config.GetModerationLog()
+	if name == "" {
+		name = "moderation.log"
+	}
+
+	entry := auditLogEntry{
+		Time:     time.Now().Format("2006-01-02T15:04:05"),
+		Kind:     c.Kind,
+		Content:  summarize(c),
+		Provider: d.Provider,
+		Action:   d.Action,
+		Reason:   d.Reason,
+		Scene:    c.Scene,
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		mylog.Printf("序列化审核日志失败: %v", err)
+		return
+	}
+
+	auditLogMu.Lock()
+	defer auditLogMu.Unlock()
+	if err := os.MkdirAll(mylog.LogPath(), 0755); err != nil {
+		mylog.Printf("创建日志文件夹失败: %v", err)
+		return
+	}
+	file, err := os.OpenFile(filepath.Join(mylog.LogPath(), name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		mylog.Printf("打开审核日志失败: %v", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		mylog.Printf("写入审核日志失败: %v", err)
+	}
+}
+
+// summarize 日志只记录文本摘要和图片地址,不记录图片数据
+func summarize(c *Content) string {
+	if c.Kind == KindImage {
+		if c.ImageURL != "" {
+			return c.ImageURL
+		}
+		return fmt.Sprintf("base64 image (%d bytes)", len(c.ImageData))
+	}
+	r := []rune(c.Text)
+	if len(r) > auditLogTextLimit {
+		return string(r[:auditLogTextLimit]) + "..."
+	}
+	return c.Text
+}
@@ -0,0 +1,97 @@
+package moderation
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+
+	// 注册解码器
+	_ "image/gif"
+	_ "image/png"
+)
+
+// 模糊半径相对图片短边的比例,保证大图也能模糊到不可辨认
+const blurRadiusRatio = 40
+
+// BlurImage 对图片做三次盒式模糊(近似高斯模糊),输出jpeg
+func BlurImage(data []byte) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := src.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(img, img.Bounds(), src, bounds.Min, draw.Src)
+
+	short := bounds.Dx()
+	if bounds.Dy() < short {
+		short = bounds.Dy()
+	}
+	radius := short / blurRadiusRatio
+	if radius < 2 {
+		radius = 2
+	}
+	for i := 0; i < 3; i++ {
+		boxBlur(img, radius, true)
+		boxBlur(img, radius, false)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// boxBlur 水平或垂直方向的滑动窗口均值
+func boxBlur(img *image.RGBA, radius int, horizontal bool) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	lines, length := h, w
+	if !horizontal {
+		lines, length = w, h
+	}
+	offset := func(line, i int) int {
+		if horizontal {
+			return line*img.Stride + i*4
+		}
+		return i*img.Stride + line*4
+	}
+
+	buf := make([]uint8, length*4)
+	for line := 0; line < lines; line++ {
+		var sum [4]int
+		count := 0
+		// 初始化窗口 [-radius, radius]
+		for i := 0; i <= radius && i < length; i++ {
+			o := offset(line, i)
+			for c := 0; c < 4; c++ {
+				sum[c] += int(img.Pix[o+c])
+			}
+			count++
+		}
+		for i := 0; i < length; i++ {
+			for c := 0; c < 4; c++ {
+				buf[i*4+c] = uint8(sum[c] / count)
+			}
+			if add := i + radius + 1; add < length {
+				o := offset(line, add)
+				for c := 0; c < 4; c++ {
+					sum[c] += int(img.Pix[o+c])
+				}
+				count++
+			}
+			if remove := i - radius; remove >= 0 {
+				o := offset(line, remove)
+				for c := 0; c < 4; c++ {
+					sum[c] -= int(img.Pix[o+c])
+				}
+				count--
+			}
+		}
+		for i := 0; i < length; i++ {
+			o := offset(line, i)
+			copy(img.Pix[o:o+4], buf[i*4:i*4+4])
+		}
+	}
+}
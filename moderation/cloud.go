@@ -0,0 +1,42 @@
+package moderation
+
+import (
+	"context"
+	"path"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/oss"
+)
+
+// cloudProvider 复用oss包的云审核(oss_audit t_audit b_audit a_audit)审核url图片
+// base64图片在上传到存储时已经审核过,这里不重复审核
+type cloudProvider struct{}
+
+func (cloudProvider) Name() string {
+	return "cloud"
+}
+
+func (cloudProvider) Check(ctx context.Context, c *Content) (Decision, error) {
+	if c.Kind != KindImage || c.ImageURL == "" {
+		return Decision{Action: ActionPass}, nil
+	}
+	auditor, err := oss.NewAuditor(config.GetOssType())
+	if err != nil {
+		return Decision{}, err
+	}
+	if auditor == nil {
+		return Decision{Action: ActionPass}, nil
+	}
+	pass, err := auditor.AuditImage(ctx, c.ImageURL, path.Base(c.ImageURL))
+	if err != nil {
+		return Decision{}, err
+	}
+	if pass {
+		return Decision{Action: ActionPass}, nil
+	}
+	action := config.GetModerationImageAction()
+	if action == "" {
+		action = ActionBlock
+	}
+	return Decision{Action: action, Reason: "cloud audit rejected"}, nil
+}
@@ -0,0 +1,146 @@
+// 发送前审核 对机器人发出的文本和图片按顺序执行各审核方,并记录审核日志
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+)
+
+// 审核动作
+const (
+	ActionPass    = "pass"
+	ActionBlock   = "block"
+	ActionBlur    = "blur"
+	ActionReplace = "replace"
+)
+
+// 审核内容类型
+const (
+	KindText  = "text"
+	KindImage = "image"
+)
+
+// Scene 发送场景,写入审核日志并传给回调审核方
+type Scene struct {
+	MessageType string `json:"message_type"` // group private guild guild_private forum
+	TargetID    string `json:"target_id"`
+}
+
+// Content 待审核的内容 图片可能只有url或只有数据
+type Content struct {
+	Kind      string
+	Text      string
+	ImageURL  string
+	ImageData []byte
+	Scene     Scene
+}
+
+// Decision 审核结果 文本的Replacement为处理后的完整文本,图片的为替换图片url
+type Decision struct {
+	Action      string `json:"action"`
+	Reason      string `json:"reason,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	Provider    string `json:"provider,omitempty"`
+}
+
+// Provider 审核方
+type Provider interface {
+	Name() string
+	Check(ctx context.Context, c *Content) (Decision, error)
+}
+
+// 已知的审核方,名称对应moderation_providers
+var providerFactories = map[string]func() Provider{
+	"rules":   func() Provider { return rulesProvider{} },
+	"webhook": func() Provider { return webhookProvider{} },
+	"cloud":   func() Provider { return cloudProvider{} },
+}
+
+// Enabled 是否启用发送前审核
+func Enabled() bool {
+	return config.GetModerationEnable()
+}
+
+// providers 按配置顺序返回审核方
+func providers() []Provider {
+	var list []Provider
+	for _, name := range config.GetModerationProviders() {
+		name = strings.TrimSpace(name)
+		factory, ok := providerFactories[name]
+		if !ok {
+			if name != "" {
+				mylog.Printf("未知的审核方: %s", name)
+			}
+			continue
+		}
+		list = append(list, factory())
+	}
+	return list
+}
+
+// CheckText 按顺序审核文本 block立即返回,blur和replace会把处理后的文本交给下一个审核方
+func CheckText(ctx context.Context, text string, scene Scene) Decision {
+	result := Decision{Action: ActionPass}
+	if strings.TrimSpace(text) == "" {
+		return result
+	}
+	current := text
+	for _, p := range providers() {
+		c := &Content{Kind: KindText, Text: current, Scene: scene}
+		d := check(ctx, p, c)
+		switch d.Action {
+		case ActionBlock:
+			return d
+		case ActionBlur, ActionReplace:
+			if d.Replacement == "" && d.Action == ActionReplace {
+				d.Replacement = config.GetModerationReplaceText()
+			}
+			current = d.Replacement
+			result = d
+		}
+	}
+	result.Replacement = current
+	return result
+}
+
+// CheckImage 按顺序审核图片 第一个非pass的结果生效
+func CheckImage(ctx context.Context, imageURL string, data []byte, scene Scene) Decision {
+	for _, p := range providers() {
+		c := &Content{Kind: KindImage, ImageURL: imageURL, ImageData: data, Scene: scene}
+		d := check(ctx, p, c)
+		if d.Action != ActionPass {
+			if d.Action == ActionReplace && d.Replacement == "" {
+				d.Replacement = config.GetModerationReplaceImage()
+			}
+			return d
+		}
+	}
+	return Decision{Action: ActionPass}
+}
+
+// check 执行单个审核方,出错时按moderation_fail_action处理,结果写入审核日志
+func check(ctx context.Context, p Provider, c *Content) Decision {
+	d, err := p.Check(ctx, c)
+	if err != nil {
+		mylog.Printf("审核方%s出错: %v", p.Name(), err)
+		d = Decision{Action: ActionPass, Reason: fmt.Sprintf("provider error: %v", err)}
+		if config.GetModerationFailAction() == ActionBlock {
+			d.Action = ActionBlock
+		}
+	}
+	switch d.Action {
+	case ActionPass, ActionBlock, ActionBlur, ActionReplace:
+	case "":
+		d.Action = ActionPass
+	default:
+		mylog.Printf("审核方%s返回未知动作%s,按block处理", p.Name(), d.Action)
+		d.Action = ActionBlock
+	}
+	d.Provider = p.Name()
+	writeAuditLog(c, d)
+	return d
+}
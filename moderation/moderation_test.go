@@ -0,0 +1,225 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/template"
+)
+
+// loadTestConfig 以默认配置模板加载一份临时配置 overrides按键替换模板中的值
+func loadTestConfig(t *testing.T, overrides map[string]string) {
+	t.Helper()
+	data := template.ConfigTemplate
+	for key, value := range overrides {
+		re := regexp.MustCompile(`(?m)^  ` + key + `\s*:.*$`)
+		if !re.MatchString(data) {
+			t.Fatalf("config key %s not in template", key)
+		}
+		data = re.ReplaceAllLiteralString(data, "  "+key+" : "+value)
+	}
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.LoadConfig(path, false); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+}
+
+func TestRulesProvider(t *testing.T) {
+	loadTestConfig(t, map[string]string{
+		"moderation_replace_text": `"[已屏蔽]"`,
+		"moderation_rules": `[{pattern: "赌博", action: "block"}, {pattern: "\\d{11}", regex: true, action: "blur"}, ` +
+			`{pattern: "广告", action: "replace"}, {pattern: "土豆", action: "replace", replacement: "马铃薯"}, ` +
+			`{pattern: "bad.example", type: "image", action: "replace", replacement: "https://ok.example/a.png"}]`,
+	})
+
+	cases := []struct {
+		name        string
+		content     Content
+		action      string
+		replacement string
+	}{
+		{"pass", Content{Kind: KindText, Text: "你好"}, ActionPass, ""},
+		{"block", Content{Kind: KindText, Text: "来赌博吗"}, ActionBlock, ""},
+		{"regex blur", Content{Kind: KindText, Text: "电话13800138000"}, ActionBlur, "电话***********"},
+		{"default replacement", Content{Kind: KindText, Text: "这是广告"}, ActionReplace, "这是[已屏蔽]"},
+		{"replacement", Content{Kind: KindText, Text: "吃土豆"}, ActionReplace, "吃马铃薯"},
+		{"text rule skips image", Content{Kind: KindImage, ImageURL: "https://x.example/赌博.png"}, ActionPass, ""},
+		{"image rule", Content{Kind: KindImage, ImageURL: "https://bad.example/a.png"}, ActionReplace, "https://ok.example/a.png"},
+		{"image rule skips text", Content{Kind: KindText, Text: "bad.example"}, ActionPass, ""},
+	}
+	for _, c := range cases {
+		d, err := rulesProvider{}.Check(context.Background(), &c.content)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if d.Action != c.action || d.Replacement != c.replacement {
+			t.Errorf("%s: got %s %q, want %s %q", c.name, d.Action, d.Replacement, c.action, c.replacement)
+		}
+	}
+}
+
+func TestRulesProviderChainsRewrites(t *testing.T) {
+	loadTestConfig(t, map[string]string{
+		"moderation_rules": `[{pattern: "土豆", action: "replace", replacement: "马铃薯"}, {pattern: "\\d{4}", regex: true, action: "blur"}]`,
+	})
+	d, err := rulesProvider{}.Check(context.Background(), &Content{Kind: KindText, Text: "土豆1234个"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Replacement != "马铃薯****个" {
+		t.Errorf("got %q", d.Replacement)
+	}
+}
+
+func TestRulesProviderInvalidRegex(t *testing.T) {
+	loadTestConfig(t, map[string]string{"moderation_rules": `[{pattern: "(", regex: true, action: "block"}]`})
+	if _, err := (rulesProvider{}).Check(context.Background(), &Content{Kind: KindText, Text: "a"}); err == nil {
+		t.Error("expected an error for an invalid regex")
+	}
+}
+
+// webhookConfig 指向url的回调审核配置
+func webhookConfig(url string, timeout, failAction string) map[string]string {
+	return map[string]string{
+		"moderation_webhook":         `"` + url + `"`,
+		"moderation_webhook_token":   `"secret"`,
+		"moderation_webhook_timeout": timeout,
+		"moderation_fail_action":     `"` + failAction + `"`,
+	}
+}
+
+func TestWebhookProvider(t *testing.T) {
+	var got webhookRequest
+	var auth string
+	reply := `{"action":"replace","reason":"ad","replacement":"***"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Write([]byte(reply))
+	}))
+	defer srv.Close()
+	loadTestConfig(t, webhookConfig(srv.URL, "3000", "pass"))
+
+	scene := Scene{MessageType: "group", TargetID: "123"}
+	d, err := webhookProvider{}.Check(context.Background(), &Content{Kind: KindText, Text: "买买买", Scene: scene})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Action != ActionReplace || d.Replacement != "***" || d.Reason != "ad" {
+		t.Errorf("unexpected decision %+v", d)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("authorization = %q", auth)
+	}
+	if got.Type != KindText || got.Text != "买买买" || got.Scene != scene {
+		t.Errorf("unexpected request %+v", got)
+	}
+
+	// 没有url的图片以base64传给回调
+	reply = `{"action":"block"}`
+	d, err = webhookProvider{}.Check(context.Background(), &Content{Kind: KindImage, ImageData: []byte("png")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Action != ActionBlock || got.ImageBase64 != "cG5n" {
+		t.Errorf("decision %+v, image_base64 %q", d, got.ImageBase64)
+	}
+
+	// 回调只给出blur时由本地打码
+	reply = `{"action":"blur"}`
+	d, err = webhookProvider{}.Check(context.Background(), &Content{Kind: KindText, Text: "秘密"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Replacement != "**" {
+		t.Errorf("blur replacement = %q", d.Replacement)
+	}
+}
+
+func TestWebhookProviderErrors(t *testing.T) {
+	status := http.StatusOK
+	body := "not json"
+	delay := time.Duration(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	loadTestConfig(t, webhookConfig(srv.URL, "100", "pass"))
+	c := &Content{Kind: KindText, Text: "hello"}
+	if _, err := (webhookProvider{}).Check(context.Background(), c); err == nil {
+		t.Error("expected an error for an invalid response")
+	}
+	status = http.StatusInternalServerError
+	if _, err := (webhookProvider{}).Check(context.Background(), c); err == nil {
+		t.Error("expected an error for a non-200 status")
+	}
+	status, delay = http.StatusOK, 300*time.Millisecond
+	if _, err := (webhookProvider{}).Check(context.Background(), c); err == nil {
+		t.Error("expected a timeout")
+	}
+
+	// 出错时按moderation_fail_action处理
+	loadTestConfig(t, webhookConfig(srv.URL, "100", "block"))
+	if d := check(context.Background(), webhookProvider{}, c); d.Action != ActionBlock || d.Provider != "webhook" {
+		t.Errorf("fail_action block: got %+v", d)
+	}
+	loadTestConfig(t, webhookConfig(srv.URL, "100", "pass"))
+	if d := check(context.Background(), webhookProvider{}, c); d.Action != ActionPass {
+		t.Errorf("fail_action pass: got %+v", d)
+	}
+}
+
+func TestWebhookProviderUnconfigured(t *testing.T) {
+	loadTestConfig(t, map[string]string{"moderation_webhook": `""`})
+	d, err := webhookProvider{}.Check(context.Background(), &Content{Kind: KindText, Text: "hello"})
+	if err != nil || d.Action != ActionPass {
+		t.Errorf("got %+v, %v", d, err)
+	}
+}
+
+func TestAuditLogSkipsPass(t *testing.T) {
+	name := "moderation_test.log"
+	path := filepath.Join(mylog.LogPath(), name)
+	os.Remove(path)
+	defer os.Remove(path)
+
+	readLog := func() string {
+		data, _ := os.ReadFile(path)
+		return string(data)
+	}
+	c := &Content{Kind: KindText, Text: "hello"}
+
+	loadTestConfig(t, map[string]string{"moderation_log": `"` + name + `"`})
+	writeAuditLog(c, Decision{Action: ActionPass, Provider: "rules"})
+	if log := readLog(); log != "" {
+		t.Errorf("pass decision logged: %q", log)
+	}
+	writeAuditLog(c, Decision{Action: ActionBlock, Provider: "rules"})
+	if log := readLog(); strings.Count(log, "\n") != 1 || !strings.Contains(log, `"action":"block"`) {
+		t.Errorf("block decision not logged: %q", log)
+	}
+
+	loadTestConfig(t, map[string]string{"moderation_log": `"` + name + `"`, "moderation_log_pass": "true"})
+	writeAuditLog(c, Decision{Action: ActionPass, Provider: "rules"})
+	if log := readLog(); strings.Count(log, "\n") != 2 {
+		t.Errorf("pass decision not logged with moderation_log_pass: %q", log)
+	}
+}
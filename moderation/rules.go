@@ -0,0 +1,100 @@
+package moderation
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/structs"
+)
+
+// 正则规则的编译缓存,配置热重载后按pattern重新编译
+var (
+	regexCache   = make(map[string]*regexp.Regexp)
+	regexCacheMu sync.Mutex
+)
+
+// rulesProvider 本地规则审核 文本按关键词或正则匹配,图片匹配url
+type rulesProvider struct{}
+
+func (rulesProvider) Name() string {
+	return "rules"
+}
+
+func (rulesProvider) Check(ctx context.Context, c *Content) (Decision, error) {
+	text := c.Text
+	if c.Kind == KindImage {
+		text = c.ImageURL
+	}
+	if text == "" {
+		return Decision{Action: ActionPass}, nil
+	}
+
+	result := Decision{Action: ActionPass}
+	for _, rule := range config.GetModerationRules() {
+		kind := rule.Type
+		if kind == "" {
+			kind = KindText
+		}
+		if kind != c.Kind || rule.Pattern == "" {
+			continue
+		}
+		re, err := ruleRegexp(rule)
+		if err != nil {
+			return Decision{}, err
+		}
+		if !re.MatchString(text) {
+			continue
+		}
+
+		reason := "rule: " + rule.Pattern
+		switch rule.Action {
+		case ActionBlock, "":
+			return Decision{Action: ActionBlock, Reason: reason}, nil
+		case ActionBlur:
+			if c.Kind == KindImage {
+				return Decision{Action: ActionBlur, Reason: reason}, nil
+			}
+			text = re.ReplaceAllStringFunc(text, maskText)
+		case ActionReplace:
+			if c.Kind == KindImage {
+				return Decision{Action: ActionReplace, Reason: reason, Replacement: rule.Replacement}, nil
+			}
+			replacement := rule.Replacement
+			if replacement == "" {
+				replacement = config.GetModerationReplaceText()
+			}
+			text = re.ReplaceAllLiteralString(text, replacement)
+		default:
+			return Decision{Action: ActionBlock, Reason: reason + " (unknown action " + rule.Action + ")"}, nil
+		}
+		result = Decision{Action: rule.Action, Reason: reason, Replacement: text}
+	}
+	return result, nil
+}
+
+// ruleRegexp 关键词规则按字面量转义为正则
+func ruleRegexp(rule structs.ModerationRule) (*regexp.Regexp, error) {
+	pattern := rule.Pattern
+	if !rule.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	regexCacheMu.Lock()
+	defer regexCacheMu.Unlock()
+	if re, ok := regexCache[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache[pattern] = re
+	return re, nil
+}
+
+// maskText 将命中的文本逐字替换为*
+func maskText(s string) string {
+	return strings.Repeat("*", len([]rune(s)))
+}
@@ -0,0 +1,83 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+)
+
+// webhookRequest 回调审核的请求体
+type webhookRequest struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	ImageBase64 string `json:"image_base64,omitempty"`
+	Scene
+}
+
+// webhookProvider http回调审核,由外部服务返回审核动作
+type webhookProvider struct{}
+
+func (webhookProvider) Name() string {
+	return "webhook"
+}
+
+func (webhookProvider) Check(ctx context.Context, c *Content) (Decision, error) {
+	target := config.GetModerationWebhook()
+	if target == "" {
+		return Decision{Action: ActionPass}, nil
+	}
+
+	body := webhookRequest{Type: c.Kind, Text: c.Text, ImageURL: c.ImageURL, Scene: c.Scene}
+	// 有url时只传url,避免请求体过大
+	if c.Kind == KindImage && c.ImageURL == "" && len(c.ImageData) > 0 {
+		body.ImageBase64 = base64.StdEncoding.EncodeToString(c.ImageData)
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	timeout := time.Duration(config.GetModerationWebhookTimeout()) * time.Millisecond
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return Decision{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := config.GetModerationWebhookToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Decision{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("moderation webhook returned %s", resp.Status)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Decision{}, err
+	}
+	var d Decision
+	if err := json.Unmarshal(raw, &d); err != nil {
+		return Decision{}, fmt.Errorf("invalid moderation webhook response: %v", err)
+	}
+	// 回调对文本blur未给出结果时由本地打码
+	if c.Kind == KindText && d.Action == ActionBlur && d.Replacement == "" {
+		d.Replacement = maskText(c.Text)
+	}
+	return d, nil
+}
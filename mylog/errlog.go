@@ -49,3 +49,8 @@ func ErrInterfaceToFile(level, message interface{}) {
 		fmt.Println("Error writing to log file:", err)
 	}
 }
+
+// LogPath 返回日志文件夹路径,供需要独立日志文件的模块使用
+func LogPath() string {
+	return logPath
+}
@@ -1,11 +1,10 @@
 package oss
 
 import (
-	"crypto/md5"
-	"encoding/base64"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"os"
 	"sync"
 
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/green"
@@ -28,128 +27,86 @@ func initaliyunClient() {
 }
 
 // 初始化Green客户端
-func initGreenClient() *green.Client {
-	client, err := green.NewClientWithAccessKey(config.GetRegionID(), config.GetAliyunAccessKeyId(), config.GetAliyunAccessKeySecret())
-	if err != nil {
-		panic(err) // 或者处理错误
-	}
-	return client
+func initGreenClient() (*green.Client, error) {
+	return green.NewClientWithAccessKey(config.GetRegionID(), config.GetAliyunAccessKeyId(), config.GetAliyunAccessKeySecret())
 }
 
-// 上传并审核
-func UploadAndAuditImageA(base64Data string) (string, error) {
-	initaliyunClient()
-
-	// Decode base64 data
-	decodedData, err := base64.StdEncoding.DecodeString(base64Data)
-	if err != nil {
-		return "", err
-	}
-
-	// Create a temporary file to save decoded data
-	tmpFile, err := os.CreateTemp("", "upload-*.jpg")
-	if err != nil {
-		return "", err
-	}
-	defer tmpFile.Close()
-
-	if _, err = tmpFile.Write(decodedData); err != nil {
-		return "", err
-	}
+// aliyunStore 阿里云oss存储桶
+type aliyunStore struct {
+	bucket *oss.Bucket
+}
 
-	// 计算解码数据的 MD5
-	h := md5.New()
-	if _, err := h.Write(decodedData); err != nil {
-		return "", err
+func newAliyunStore() (aliyunStore, error) {
+	initaliyunClient()
+	if aliyunclient == nil {
+		return aliyunStore{}, fmt.Errorf("aliyun oss client is not initialized, check a_OSS_EndPoint and keys")
 	}
-	md5Hash := fmt.Sprintf("%x", h.Sum(nil))
-
-	// 使用 MD5 值作为对象键
-	objectKey := md5Hash + ".jpg"
-	// 上传文件到 OSS
 	bucket, err := aliyunclient.Bucket(config.GetAliyunBucketName())
 	if err != nil {
-		return "", err
+		return aliyunStore{}, err
 	}
+	return aliyunStore{bucket: bucket}, nil
+}
 
-	err = bucket.PutObjectFromFile(objectKey, tmpFile.Name())
+func (s aliyunStore) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	err := s.bucket.PutObject(key, bytes.NewReader(data), oss.ContentType(contentType), oss.WithContext(ctx))
 	if err != nil {
 		return "", err
 	}
-
-	if config.GetAliyunAudit() {
-		// 图片审核
-		greenClient := initGreenClient()
-		auditResult, err := auditImage(greenClient, objectKey)
-		if err != nil {
-			return "", err
-		}
-		if !auditResult {
-			return "", fmt.Errorf("image failed to pass audit")
-		}
-	}
-
-	// 图片正常，返回图片 URL
-	imageURL := "https://" + config.GetAliyunBucketName() + ".oss-" + config.GetRegionID() + ".aliyuncs.com/" + objectKey
-	return imageURL, nil
+	return "https://" + config.GetAliyunBucketName() + ".oss-" + config.GetRegionID() + ".aliyuncs.com/" + key, nil
 }
 
-// 上传语音
-func UploadAndAuditRecordA(base64Data string) (string, error) {
-	initaliyunClient()
+// aliyunAuditor 阿里云内容安全图片审核
+// 图片在阿里云oss中时按oss://桶名/对象键指定,不要求桶可公网访问;其他存储使用图片url
+type aliyunAuditor struct {
+	ossURI bool
+}
 
-	// Decode base64 data
-	decodedData, err := base64.StdEncoding.DecodeString(base64Data)
-	if err != nil {
-		return "", err
-	}
+func newAliyunAuditor(ossURI bool) aliyunAuditor {
+	return aliyunAuditor{ossURI: ossURI}
+}
 
-	// Create a temporary file to save decoded data
-	tmpFile, err := os.CreateTemp("", "upload-*.amr")
+func (a aliyunAuditor) AuditImage(ctx context.Context, imageURL string, key string) (bool, error) {
+	greenClient, err := initGreenClient()
 	if err != nil {
-		return "", err
+		return false, err
 	}
-	defer tmpFile.Close()
-
-	if _, err = tmpFile.Write(decodedData); err != nil {
-		return "", err
+	if a.ossURI {
+		imageURL = aliyunOSSURI(key)
 	}
+	return auditImage(greenClient, imageURL)
+}
 
-	// 计算解码数据的 MD5
-	h := md5.New()
-	if _, err := h.Write(decodedData); err != nil {
-		return "", err
-	}
-	md5Hash := fmt.Sprintf("%x", h.Sum(nil))
+// aliyunOSSURI 使用oss://协议指定图片
+func aliyunOSSURI(key string) string {
+	return "oss://" + config.GetAliyunBucketName() + "/" + key
+}
 
-	// 使用 MD5 值作为对象键
-	objectKey := md5Hash + ".amr"
-	// 上传文件到 OSS
-	bucket, err := aliyunclient.Bucket(config.GetAliyunBucketName())
+// 上传并审核
+func UploadAndAuditImageA(base64Data string) (string, error) {
+	data, err := decodeBase64(base64Data)
 	if err != nil {
 		return "", err
 	}
+	return UploadImageTo(TypeAliyun, data)
+}
 
-	err = bucket.PutObjectFromFile(objectKey, tmpFile.Name())
+// 上传语音
+func UploadAndAuditRecordA(base64Data string) (string, error) {
+	data, err := decodeBase64(base64Data)
 	if err != nil {
 		return "", err
 	}
-
-	// 图片正常，返回语音 URL
-	imageURL := "https://" + config.GetAliyunBucketName() + ".oss-" + config.GetRegionID() + ".aliyuncs.com/" + objectKey
-	return imageURL, nil
+	return UploadRecordTo(TypeAliyun, data)
 }
 
-// auditImage 审核图片
-func auditImage(client *green.Client, objectKey string) (bool, error) {
+// auditImage 审核图片 imageURL为oss://地址或可公网访问的url
+func auditImage(client *green.Client, imageURL string) (bool, error) {
 	// 构造审核请求
 	request := green.CreateImageSyncScanRequest()
 	request.Method = "POST"
 	request.AcceptFormat = "JSON"
 
-	bucketName := config.GetAppIDStr()                  // OSS桶名
-	imageURL := "oss://" + bucketName + "/" + objectKey // 使用oss://协议指定图片
-
 	task := map[string]interface{}{
 		"dataId": uuid.New().String(),
 		"url":    imageURL,
@@ -1,23 +1,14 @@
 package oss
 
 import (
-	"crypto/md5"
-	"encoding/base64"
-	"encoding/hex"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
-	"net"
-	"net/http"
-	"net/url"
-	"os"
-	"path/filepath"
-	"strings"
 	"sync"
 
 	"github.com/Baidu-AIP/golang-sdk/aip/censor"
 	"github.com/baidubce/bce-sdk-go/services/bos"
+	"github.com/baidubce/bce-sdk-go/services/bos/api"
 	"github.com/hoshinonyaruko/gensokyo/config"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
 )
@@ -75,225 +66,65 @@ type AuditResponse struct {
 	} `json:"data"`
 }
 
-// UploadAndAuditImageB 上传并根据配置审核图片
-func UploadAndAuditImageB(base64Data string) (string, error) {
-	initClientB()
-
-	// 解码base64数据
-	decodedData, err := base64.StdEncoding.DecodeString(base64Data)
-	if err != nil {
-		return "", err
-	}
-
-	// 根据配置获取审核模式
-	auditMode := config.GetBaiduAudit()
-
-	// 根据审核模式进行操作
-	switch auditMode {
-	case 0:
-		// 审核模式0: 仅上传图片
-		return uploadImageBOS(decodedData)
-	case 1:
-		// 审核模式1: 使用BOS上传并审核图片
-		imageURL, err := uploadImageBOS(decodedData)
-		if err != nil {
-			return "", err
-		}
-		return auditUsingBOS(imageURL)
-	case 2:
-		// 审核模式2: 使用原始上传逻辑并审核图片
-		imageURL, err := originalUploadBehavior(base64Data)
-		if err != nil {
-			return "", err
-		}
-		if !AuditImageContentAIP(imageURL) {
-			return "", fmt.Errorf("image failed the audit")
-		}
-		return imageURL, nil
-	default:
-		return "", fmt.Errorf("invalid audit mode")
-	}
-}
+// baiduStore 百度云bos存储桶
+type baiduStore struct{}
 
-// UploadAndAuditRecordB 上传语音
-func UploadAndAuditRecordB(base64Data string) (string, error) {
+func newBaiduStore() (baiduStore, error) {
 	initClientB()
-
-	// 解码base64数据
-	decodedData, err := base64.StdEncoding.DecodeString(base64Data)
-	if err != nil {
-		return "", err
-	}
-
-	return uploadRecordBOS(decodedData)
-
-}
-
-func originalUploadBehavior(base64Image string) (string, error) {
-	// 原有的UploadBase64ImageToServer函数的实现
-	protocol := "http"
-	serverPort := config.GetPortValue()
-	if serverPort == "443" ||config.GetForceSsl(){
-		protocol = "https"
-	}
-
-	if config.GetLotusValue() {
-		serverDir := config.GetServer_dir()
-		url := fmt.Sprintf("%s://%s:%s/uploadpic", protocol, serverDir, serverPort)
-
-		resp, err := postImageToServer(base64Image, url)
-		if err != nil {
-			return "", err
-		}
-		return resp, nil
-	}
-
-	serverDir := config.GetServer_dir()
-	if serverPort == "443" ||config.GetForceSsl(){
-		protocol = "http"
-		serverPort = config.GetHttpPortAfterSsl()
+	if clientBos == nil {
+		return baiduStore{}, fmt.Errorf("BOS client is not initialized, check b_BCE_AK and b_BCE_SK")
 	}
-
-	if isPublicAddress(serverDir) {
-		url := fmt.Sprintf("%s://127.0.0.1:%s/uploadpic", protocol, serverPort)
-
-		resp, err := postImageToServer(base64Image, url)
-		if err != nil {
-			return "", err
-		}
-		return resp, nil
-	}
-	return "", errors.New("local server uses a private address; image upload failed")
+	return baiduStore{}, nil
 }
 
-// 判断是否公网ip 填写域名也会被认为是公网,但需要用户自己确保域名正确解析到gensokyo所在的ip地址
-func isPublicAddress(addr string) bool {
-	if strings.Contains(addr, "localhost") || strings.HasPrefix(addr, "127.") || strings.HasPrefix(addr, "192.168.") {
-		return false
-	}
-	if net.ParseIP(addr) != nil {
-		return true
-	}
-	// If it's not a recognized IP address format, consider it a domain name (public).
-	return true
-}
-
-// 请求图床api(图床就是lolus为false的gensokyo)
-func postImageToServer(base64Image, targetURL string) (string, error) {
-	data := url.Values{}
-	data.Set("base64Image", base64Image) // 修改字段名以与服务器匹配
-
-	resp, err := http.PostForm(targetURL, data)
-	if err != nil {
-		return "", fmt.Errorf("failed to send request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("error response from server: %s", resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %v", err)
-	}
-
-	var responseMap map[string]interface{}
-	if err := json.Unmarshal(body, &responseMap); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %v", err)
-	}
-
-	if value, ok := responseMap["url"]; ok {
-		return fmt.Sprintf("%v", value), nil
-	}
-
-	return "", fmt.Errorf("URL not found in response")
-}
-
-// uploadImageBOS 使用BOS进行图片上传
-func uploadImageBOS(data []byte) (string, error) {
-	// 计算MD5以用作文件名
-	md5Hash := md5.New()
-	md5Hash.Write(data)
-	md5String := hex.EncodeToString(md5Hash.Sum(nil))
-
-	// 创建临时文件
-	picname := fmt.Sprintf("qqbot-upload-%s-*.jpg", md5String)
-	tmpFile, err := os.CreateTemp("", picname)
-	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %v", err)
-	}
-	defer func() {
-		tmpFile.Close()
-		os.Remove(tmpFile.Name()) // 清理临时文件
-	}()
-
-	// 写入数据到临时文件
-	if _, err = tmpFile.Write(data); err != nil {
-		return "", fmt.Errorf("failed to write to temp file: %v", err)
-	}
-
-	// 确保数据写入磁盘
-	if err = tmpFile.Sync(); err != nil {
-		return "", fmt.Errorf("failed to sync temp file: %v", err)
-	}
-
-	// 获取临时文件的实际文件名
-	actualFileName := filepath.Base(tmpFile.Name())
-
-	// 上传到BOS
+func (baiduStore) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
 	bucketDomain := config.GetBaiduBOSBucketName() //bucket的域名
 	appid := config.GetAppIDStr()
-	_, err = clientBos.PutObjectFromFile(appid, actualFileName, tmpFile.Name(), nil)
-	if err != nil {
+	args := &api.PutObjectArgs{ContentType: contentType}
+	if _, err := clientBos.PutObjectFromBytes(appid, key, data, args); err != nil {
 		return "", fmt.Errorf("failed to upload to BOS: %v", err)
 	}
-
-	// 返回图片URL
-	return fmt.Sprintf("https://%s/%s/%s", bucketDomain, appid, actualFileName), nil
+	return fmt.Sprintf("https://%s/%s/%s", bucketDomain, appid, key), nil
 }
 
-// uploadRecordBOS 使用BOS进行语音上传
-func uploadRecordBOS(data []byte) (string, error) {
-	// 计算MD5以用作文件名
-	md5Hash := md5.New()
-	md5Hash.Write(data)
-	md5String := hex.EncodeToString(md5Hash.Sum(nil))
+// baiduAuditor 百度云内容审核 AIP方式
+type baiduAuditor struct{}
 
-	// 创建临时文件
-	picname := fmt.Sprintf("qqbot-upload-%s-*.amr", md5String)
-	tmpFile, err := os.CreateTemp("", picname)
-	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %v", err)
+func newBaiduAuditor() (baiduAuditor, error) {
+	initClientB()
+	if clientBaidu == nil {
+		return baiduAuditor{}, fmt.Errorf("baidu censor client is not initialized, check b_BCE_AK and b_BCE_SK")
 	}
-	defer func() {
-		tmpFile.Close()
-		os.Remove(tmpFile.Name()) // 清理临时文件
-	}()
+	return baiduAuditor{}, nil
+}
 
-	// 写入数据到临时文件
-	if _, err = tmpFile.Write(data); err != nil {
-		return "", fmt.Errorf("failed to write to temp file: %v", err)
+func (baiduAuditor) AuditImage(ctx context.Context, imageURL string, key string) (bool, error) {
+	// b_audit为1时沿用bos上传后的审核方式
+	if config.GetBaiduAudit() == 1 {
+		if _, err := auditUsingBOS(imageURL); err != nil {
+			return false, err
+		}
+		return true, nil
 	}
+	return AuditImageContentAIP(imageURL), nil
+}
 
-	// 确保数据写入磁盘
-	if err = tmpFile.Sync(); err != nil {
-		return "", fmt.Errorf("failed to sync temp file: %v", err)
+// UploadAndAuditImageB 上传并根据配置审核图片
+func UploadAndAuditImageB(base64Data string) (string, error) {
+	data, err := decodeBase64(base64Data)
+	if err != nil {
+		return "", err
 	}
+	return UploadImageTo(TypeBaidu, data)
+}
 
-	// 获取临时文件的实际文件名
-	actualFileName := filepath.Base(tmpFile.Name())
-
-	// 上传到BOS
-	bucketDomain := config.GetBaiduBOSBucketName() //bucket的域名
-	appid := config.GetAppIDStr()
-	_, err = clientBos.PutObjectFromFile(appid, actualFileName, tmpFile.Name(), nil)
+// UploadAndAuditRecordB 上传语音
+func UploadAndAuditRecordB(base64Data string) (string, error) {
+	data, err := decodeBase64(base64Data)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload to BOS: %v", err)
+		return "", err
 	}
-
-	// 返回图片URL
-	return fmt.Sprintf("https://%s/%s/%s", bucketDomain, appid, actualFileName), nil
+	return UploadRecordTo(TypeBaidu, data)
 }
 
 // auditUsingBOS 使用BOS进行图片审核
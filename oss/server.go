@@ -0,0 +1,138 @@
+package oss
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/lotus"
+)
+
+// 本地存储与图床共用channel_temp目录,由/channel_temp路由对外提供访问
+const localStoreDir = "./channel_temp/"
+
+// localStore 直接写入本地目录,不经过http回环,适合自建环境和测试
+type localStore struct {
+	dir string
+}
+
+func (s localStore) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	if !isPublicAddress(config.GetServer_dir()) {
+		return "", errors.New("local server uses a private address; upload failed")
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", err
+	}
+	savePath := filepath.Join(s.dir, key)
+	// 以md5命名,已存在则跳过
+	if _, err := os.Stat(savePath); os.IsNotExist(err) {
+		if err := os.WriteFile(savePath, data, 0644); err != nil {
+			return "", err
+		}
+	}
+	return config.ComposeChannelTempURL(key), nil
+}
+
+// serverStore 通过gensokyo图床接口上传,百度b_audit为2时使用
+type serverStore struct{}
+
+func (serverStore) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	b64 := base64.StdEncoding.EncodeToString(data)
+	if strings.HasPrefix(contentType, "audio/") {
+		return UploadToServer(b64, "uploadrecord", "base64Record")
+	}
+	return UploadToServer(b64, "uploadpic", "base64Image")
+}
+
+// UploadToServer 通过gensokyo图床接口上传base64数据 path为uploadpic或uploadrecord,field为对应的表单字段
+func UploadToServer(base64Data, path, field string) (string, error) {
+	// 原有的UploadBase64ImageToServer函数的实现
+	protocol := "http"
+	serverPort := config.GetPortValue()
+	if serverPort == "443" || config.GetForceSsl() {
+		protocol = "https"
+	}
+
+	// 如果lotus为真
+	if config.GetLotusValue() && !config.GetLotusWithoutUploadPic() {
+		serverDir := config.GetServer_dir()
+		url := fmt.Sprintf("%s://%s:%s/%s", protocol, serverDir, serverPort, path)
+
+		resp, err := postToServer(base64Data, field, url)
+		if err != nil {
+			return "", err
+		}
+		return resp, nil
+	}
+
+	serverDir := config.GetServer_dir()
+	if serverPort == "443" || config.GetForceSsl() {
+		protocol = "http"
+		serverPort = config.GetHttpPortAfterSsl()
+	}
+
+	if isPublicAddress(serverDir) {
+		url := fmt.Sprintf("%s://127.0.0.1:%s/%s", protocol, serverPort, path)
+
+		resp, err := postToServer(base64Data, field, url)
+		if err != nil {
+			return "", err
+		}
+		return resp, nil
+	}
+	return "", errors.New("local server uses a private address; image upload failed")
+}
+
+// 判断是否公网ip 填写域名也会被认为是公网,但需要用户自己确保域名正确解析到gensokyo所在的ip地址
+func isPublicAddress(addr string) bool {
+	if strings.Contains(addr, "localhost") || strings.HasPrefix(addr, "127.") || strings.HasPrefix(addr, "192.168.") {
+		return false
+	}
+	if net.ParseIP(addr) != nil {
+		return true
+	}
+	// If it's not a recognized IP address format, consider it a domain name (public).
+	return true
+}
+
+// 请求图床api(图床就是lolus为false的gensokyo)
+func postToServer(base64Data, field, targetURL string) (string, error) {
+	data := url.Values{}
+	data.Set(field, base64Data) // 修改字段名以与服务器匹配
+
+	resp, err := lotus.PostForm(targetURL, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error response from server: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	var responseMap map[string]interface{}
+	if err := json.Unmarshal(body, &responseMap); err != nil {
+		return "", fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+
+	if value, ok := responseMap["url"]; ok {
+		return fmt.Sprintf("%v", value), nil
+	}
+
+	return "", fmt.Errorf("URL not found in response")
+}
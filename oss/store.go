@@ -0,0 +1,218 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+)
+
+// oss_type对应的存储后端
+const (
+	TypeServer  = 0 // 由server_dir port的gensokyo图床(或lotus)上传
+	TypeTencent = 1
+	TypeBaidu   = 2
+	TypeAliyun  = 3
+	TypeS3      = 4 // S3兼容存储 MinIO R2等
+	TypeLocal   = 5 // 直接写入本地channel_temp目录
+)
+
+// ErrAuditRejected 图片未通过审核
+var ErrAuditRejected = errors.New("image failed to pass audit")
+
+// ObjectStore 对象存储后端,各厂商实现同一接口
+type ObjectStore interface {
+	// Put 上传对象并返回可公开访问的url
+	Put(ctx context.Context, key string, data []byte, contentType string) (string, error)
+}
+
+// Auditor 图片审核,与存储后端分离,可以任意组合
+type Auditor interface {
+	// AuditImage 审核已上传的图片 key为对象键,返回false代表不合规
+	AuditImage(ctx context.Context, imageURL string, key string) (bool, error)
+}
+
+// NewStore 根据oss_type创建存储后端 0由images包的图床逻辑处理,不在此返回
+func NewStore(ossType int) (ObjectStore, error) {
+	switch ossType {
+	case TypeTencent:
+		return newTencentStore(), nil
+	case TypeBaidu:
+		// b_audit为2时不使用bos,沿用gensokyo图床上传
+		if config.GetBaiduAudit() == 2 {
+			return serverStore{}, nil
+		}
+		return newBaiduStore()
+	case TypeAliyun:
+		return newAliyunStore()
+	case TypeS3:
+		return newS3Store()
+	case TypeLocal:
+		return localStore{dir: localStoreDir}, nil
+	default:
+		return nil, fmt.Errorf("invalid oss_type: %d", ossType)
+	}
+}
+
+// NewAuditor 根据配置返回审核器,不需要审核时返回nil
+// oss_audit为空时沿用各厂商旧的审核开关,只对对应的oss_type生效
+func NewAuditor(ossType int) (Auditor, error) {
+	switch config.GetOssAudit() {
+	case "none":
+		return nil, nil
+	case "tencent":
+		return newTencentAuditor(), nil
+	case "baidu":
+		return newBaiduAuditor()
+	case "aliyun":
+		return newAliyunAuditor(ossType == TypeAliyun), nil
+	case "":
+	default:
+		return nil, fmt.Errorf("invalid oss_audit: %s", config.GetOssAudit())
+	}
+
+	switch {
+	case ossType == TypeTencent && config.GetTencentAudit():
+		return newTencentAuditor(), nil
+	case ossType == TypeBaidu && config.GetBaiduAudit() != 0:
+		return newBaiduAuditor()
+	case ossType == TypeAliyun && config.GetAliyunAudit():
+		return newAliyunAuditor(true), nil
+	}
+	return nil, nil
+}
+
+// UploadImage 上传图片到oss_type对应的存储,再按配置审核
+func UploadImage(data []byte) (string, error) {
+	return upload(config.GetOssType(), data, imageExt(data), true)
+}
+
+// UploadRecord 上传语音到oss_type对应的存储,语音不审核
+func UploadRecord(data []byte) (string, error) {
+	return upload(config.GetOssType(), data, recordExt(data), false)
+}
+
+// UploadImageTo 上传图片到指定类型的存储,兼容旧的按厂商上传函数
+func UploadImageTo(ossType int, data []byte) (string, error) {
+	return upload(ossType, data, imageExt(data), true)
+}
+
+// UploadRecordTo 上传语音到指定类型的存储
+func UploadRecordTo(ossType int, data []byte) (string, error) {
+	return upload(ossType, data, recordExt(data), false)
+}
+
+func upload(ossType int, data []byte, ext string, audit bool) (string, error) {
+	store, err := NewStore(ossType)
+	if err != nil {
+		return "", err
+	}
+
+	// 使用内容的md5作为对象键,相同内容只保存一份
+	sum := md5.Sum(data)
+	key := hex.EncodeToString(sum[:]) + "." + ext
+
+	ctx := context.Background()
+	objectURL, err := store.Put(ctx, key, data, contentTypeOf(ext))
+	if err != nil {
+		return "", err
+	}
+
+	if !audit {
+		return objectURL, nil
+	}
+	if err = runAudit(ctx, ossType, objectURL, key); err != nil {
+		return "", err
+	}
+	return objectURL, nil
+}
+
+// AuditImage 按配置审核已经上传的图片,供不经过ObjectStore的上传方式(oss_type 0)使用
+func AuditImage(ossType int, imageURL string) error {
+	return runAudit(context.Background(), ossType, imageURL, path.Base(imageURL))
+}
+
+func runAudit(ctx context.Context, ossType int, imageURL, key string) error {
+	auditor, err := NewAuditor(ossType)
+	if err != nil {
+		return err
+	}
+	if auditor == nil {
+		return nil
+	}
+	pass, err := auditor.AuditImage(ctx, imageURL, key)
+	if err != nil {
+		return err
+	}
+	if !pass {
+		mylog.Printf("图片未通过审核: %s", imageURL)
+		return ErrAuditRejected
+	}
+	return nil
+}
+
+// decodeBase64 兼容旧的base64入参的上传函数
+func decodeBase64(base64Data string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(base64Data)
+}
+
+// imageExt 根据内容判断图片扩展名,无法识别时按jpg处理
+func imageExt(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/png":
+		return "png"
+	case "image/gif":
+		return "gif"
+	case "image/webp":
+		return "webp"
+	case "image/bmp":
+		return "bmp"
+	default:
+		return "jpg"
+	}
+}
+
+// recordExt 根据内容判断语音扩展名,无法识别时按amr处理
+func recordExt(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("#!SILK_V3")) || bytes.HasPrefix(data, []byte("\x02#!SILK_V3")):
+		return "silk"
+	case bytes.HasPrefix(data, []byte("#!AMR")):
+		return "amr"
+	case bytes.HasPrefix(data, []byte("ID3")) || len(data) > 1 && data[0] == 0xff && data[1]&0xe0 == 0xe0:
+		return "mp3"
+	case len(data) > 11 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE")):
+		return "wav"
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return "ogg"
+	default:
+		return "amr"
+	}
+}
+
+func contentTypeOf(ext string) string {
+	switch ext {
+	case "png", "gif", "webp", "bmp":
+		return "image/" + ext
+	case "jpg":
+		return "image/jpeg"
+	case "amr":
+		return "audio/amr"
+	case "silk":
+		return "audio/silk"
+	case "mp3":
+		return "audio/mpeg"
+	case "wav", "ogg":
+		return "audio/" + ext
+	default:
+		return "application/octet-stream"
+	}
+}
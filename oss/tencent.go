@@ -1,13 +1,11 @@
 package oss
 
 import (
+	"bytes"
 	"context"
-	"crypto/md5"
-	"encoding/base64"
-	"fmt"
 	"net/http"
 	"net/url"
-	"os"
+	"strings"
 	"sync"
 
 	"github.com/hoshinonyaruko/gensokyo/config"
@@ -35,106 +33,75 @@ func initClient() {
 	})
 }
 
-// 上传并审核
-func UploadAndAuditImage(base64Data string) (string, error) {
-	initClient()
+// tencentStore 腾讯云cos存储桶
+type tencentStore struct{}
 
-	// Decode base64 data
-	decodedData, err := base64.StdEncoding.DecodeString(base64Data)
-	if err != nil {
-		return "", err
-	}
+func newTencentStore() tencentStore {
+	initClient()
+	return tencentStore{}
+}
 
-	// Create a temporary file to save decoded data
-	tmpFile, err := os.CreateTemp("", "upload-*.jpg")
-	if err != nil {
-		return "", err
+func (tencentStore) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	opt := &cos.ObjectPutOptions{
+		ObjectPutHeaderOptions: &cos.ObjectPutHeaderOptions{ContentType: contentType},
 	}
-	defer tmpFile.Close()
-
-	if _, err = tmpFile.Write(decodedData); err != nil {
+	if _, err := client.Object.Put(ctx, key, bytes.NewReader(data), opt); err != nil {
 		return "", err
 	}
+	return strings.TrimSuffix(config.GetTencentBucketURL(), "/") + "/" + key, nil
+}
 
-	// 计算解码数据的 MD5
-	h := md5.New()
-	if _, err := h.Write(decodedData); err != nil {
-		return "", err
-	}
-	md5Hash := fmt.Sprintf("%x", h.Sum(nil))
+// tencentAuditor 腾讯云数据万象图片审核
+type tencentAuditor struct{}
 
-	// 使用 MD5 值作为对象键
-	objectKey := md5Hash + ".jpg"
+func newTencentAuditor() tencentAuditor {
+	initClient()
+	return tencentAuditor{}
+}
 
-	// 上传文件到 COS
-	_, err = client.Object.PutFromFile(context.Background(), objectKey, tmpFile.Name(), nil)
+func (tencentAuditor) AuditImage(ctx context.Context, imageURL string, key string) (bool, error) {
+	var (
+		res *cos.ImageRecognitionResult
+		err error
+	)
+	// 图片在本桶内时直接按对象键审核,其他存储的图片通过detect-url审核
+	if strings.HasPrefix(imageURL, strings.TrimSuffix(config.GetTencentBucketURL(), "/")+"/") {
+		res, _, err = client.CI.ImageRecognition(ctx, key, "")
+	} else {
+		res, _, err = client.CI.ImageAuditing(ctx, "", &cos.ImageRecognitionOptions{
+			CIProcess: "sensitive-content-recognition",
+			DetectUrl: imageURL,
+		})
+	}
 	if err != nil {
-		return "", err
+		return false, err
 	}
 
-	if config.GetTencentAudit() {
-		// Call ImageRecognition
-		res, _, err := client.CI.ImageRecognition(context.Background(), objectKey, "")
-		if err != nil {
-			return "", err
-		}
+	// 使用 mylog 输出审核结果
+	mylog.Printf("Image Recognition Results: %+v\n", res)
 
-		// 使用 mylog 输出审核结果
-		mylog.Printf("Image Recognition Results: %+v\n", res)
-
-		// 检查图片审核结果
-		if res.Result != 0 {
-			// 如果图片不正常，记录日志并返回空字符串
-			mylog.Printf("Image is not normal. Result code: %d\n", res.Result)
-			return "", nil
-		}
+	// 检查图片审核结果
+	if res.Result != 0 {
+		mylog.Printf("Image is not normal. Result code: %d\n", res.Result)
+		return false, nil
 	}
-
-	// 图片正常，返回图片 URL
-	bucketURL, _ := url.Parse(config.GetTencentBucketURL()) // 确保这里的 GetTencentBucketURL 是正确的函数调用
-	imageURL := bucketURL.String() + "/" + objectKey
-	return imageURL, nil
+	return true, nil
 }
 
-// 上传语音
-func UploadAndAuditRecord(base64Data string) (string, error) {
-	initClient()
-
-	// Decode base64 data
-	decodedData, err := base64.StdEncoding.DecodeString(base64Data)
-	if err != nil {
-		return "", err
-	}
-
-	// Create a temporary file to save decoded data
-	tmpFile, err := os.CreateTemp("", "upload-*.amr")
+// 上传并审核
+func UploadAndAuditImage(base64Data string) (string, error) {
+	data, err := decodeBase64(base64Data)
 	if err != nil {
 		return "", err
 	}
-	defer tmpFile.Close()
-
-	if _, err = tmpFile.Write(decodedData); err != nil {
-		return "", err
-	}
-
-	// 计算解码数据的 MD5
-	h := md5.New()
-	if _, err := h.Write(decodedData); err != nil {
-		return "", err
-	}
-	md5Hash := fmt.Sprintf("%x", h.Sum(nil))
-
-	// 使用 MD5 值作为对象键
-	objectKey := md5Hash + ".amr"
+	return UploadImageTo(TypeTencent, data)
+}
 
-	// 上传文件到 COS
-	_, err = client.Object.PutFromFile(context.Background(), objectKey, tmpFile.Name(), nil)
+// 上传语音
+func UploadAndAuditRecord(base64Data string) (string, error) {
+	data, err := decodeBase64(base64Data)
 	if err != nil {
 		return "", err
 	}
-
-	// 语音正常，返回语音 URL
-	bucketURL, _ := url.Parse(config.GetTencentBucketURL()) // 确保这里的 GetTencentBucketURL 是正确的函数调用
-	imageURL := bucketURL.String() + "/" + objectKey
-	return imageURL, nil
+	return UploadRecordTo(TypeTencent, data)
 }
@@ -45,7 +45,7 @@ func GetIDHandler(c *gin.Context) {
 		value := c.Query("value")
 		err := idmap.WriteConfigv2(section, subtype, value)
 		if err != nil {
-			mylog.Printf(err.Error())
+			mylog.Printf("%v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/lotus"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+)
+
+// LotusAuth 校验从gsk请求的HMAC签名,开启lotus_mtls时还要求已校验的客户端证书
+// 主gsk请求自身接口时使用local凭据签名,同样经过校验
+func LotusAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !lotus.AuthRequired() {
+			c.Next()
+			return
+		}
+
+		// 自身的请求走http回环,不要求证书
+		local := c.GetHeader(lotus.HeaderID) == lotus.LocalID
+		if config.GetLotusMtls() && !local && (c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0) {
+			mylog.Printf("拒绝lotus请求 %s %s: 缺少客户端证书", c.Request.RemoteAddr, c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "client certificate required"})
+			return
+		}
+
+		body, err := lotus.ReadBody(c.Request)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+			return
+		}
+		// 未升级的从gsk不签名,只在表单中携带旧版token
+		if c.GetHeader(lotus.HeaderSignature) == "" {
+			if form, err := url.ParseQuery(string(body)); err == nil && lotus.VerifyLegacyToken(form.Get("token")) {
+				lotus.MarkSeen(lotus.DefaultID, remoteHost(c.Request.RemoteAddr), "legacy")
+				c.Next()
+				return
+			}
+		}
+		id, err := lotus.VerifyRequest(c.Request, body)
+		if err != nil {
+			mylog.Printf("拒绝lotus请求 %s %s: %v", c.Request.RemoteAddr, c.Request.URL.Path, err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		lotus.MarkSeen(id, remoteHost(c.Request.RemoteAddr), "http")
+		c.Next()
+	}
+}
+
+func remoteHost(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
@@ -13,6 +13,7 @@ import (
 	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/gensokyo/botstats"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
 	"github.com/tencent-connect/botgo/dto"
 	"github.com/tencent-connect/botgo/event"
@@ -127,8 +128,10 @@ func CreateHandleValidationSafe(wh *WebhookHandler) gin.HandlerFunc {
 				// 尝试写入队列
 				select {
 				case wh.messageQueue <- webhookPayload:
+					botstats.RecordWebhookReceived()
 					mylog.Println("Message enqueued successfully")
 				default:
+					botstats.RecordWebhookDropped()
 					log.Println("Message queue is full, dropping message")
 				}
 			}(httpBody, payload)
@@ -10,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/hoshinonyaruko/gensokyo/Processor"
+	"github.com/hoshinonyaruko/gensokyo/botstats"
 	"github.com/hoshinonyaruko/gensokyo/callapi"
 	"github.com/hoshinonyaruko/gensokyo/config"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
@@ -93,6 +94,7 @@ func wsHandler(api openapi.OpenAPI, apiV2 openapi.OpenAPI, p *Processor.Processo
 	}
 	// 将此客户端添加到Processor的WsServerClients列表中
 	p.WsServerClients = append(p.WsServerClients, client)
+	botstats.RecordForwardWsConnected()
 
 	// 获取botID
 
@@ -118,6 +120,7 @@ func wsHandler(api openapi.OpenAPI, apiV2 openapi.OpenAPI, p *Processor.Processo
 
 	// 在defer语句之前运行
 	defer func() {
+		botstats.RecordForwardWsDisconnected()
 		// 移除客户端从WsServerClients
 		for i, wsClient := range p.WsServerClients {
 			if wsClient == client {
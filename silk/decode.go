@@ -0,0 +1,299 @@
+package silk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/pion/opus"
+	"github.com/pion/opus/pkg/oggreader"
+)
+
+// ErrUnsupportedAudio 纯go解码器无法处理的音频格式,需要交给ffmpeg
+var ErrUnsupportedAudio = errors.New("unsupported audio format")
+
+// opus解码固定输出48000hz
+const opusSampleRate = 48000
+
+// 单个opus包最长120ms,48000hz双声道
+const opusMaxFrameSamples = 5760 * 2
+
+// pcmAudio 解码后的音频,samples为交错排列的16位采样
+type pcmAudio struct {
+	samples    []int16
+	sampleRate int
+	channels   int
+}
+
+// decodeAudio 根据文件头选择纯go解码器,支持wav mp3 ogg/opus
+func decodeAudio(data []byte) (*pcmAudio, error) {
+	switch {
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return decodeWav(data)
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return decodeOggOpus(data)
+	case isMP3(data):
+		return decodeMP3(data)
+	default:
+		return nil, ErrUnsupportedAudio
+	}
+}
+
+// isMP3 判断是否为mp3 带ID3标签或以帧同步字开头
+func isMP3(data []byte) bool {
+	if bytes.HasPrefix(data, []byte("ID3")) {
+		return true
+	}
+	return len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0
+}
+
+// decodeWav 解析RIFF/WAVE 支持8/16/24/32位整数pcm和32位浮点
+func decodeWav(data []byte) (*pcmAudio, error) {
+	var (
+		format        uint16
+		channels      int
+		sampleRate    int
+		bitsPerSample int
+		body          []byte
+	)
+
+	pos := 12
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		pos += 8
+		end := pos + size
+		if end > len(data) {
+			// 部分录音软件写入的data长度不准确,按实际长度截断
+			end = len(data)
+		}
+		chunk := data[pos:end]
+		switch id {
+		case "fmt ":
+			if len(chunk) < 16 {
+				return nil, fmt.Errorf("wav fmt chunk too short")
+			}
+			format = binary.LittleEndian.Uint16(chunk[0:2])
+			channels = int(binary.LittleEndian.Uint16(chunk[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(chunk[4:8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(chunk[14:16]))
+			// WAVE_FORMAT_EXTENSIBLE 实际格式在子格式GUID的前两个字节
+			if format == 0xFFFE && len(chunk) >= 26 {
+				format = binary.LittleEndian.Uint16(chunk[24:26])
+			}
+		case "data":
+			body = chunk
+		}
+		// chunk按2字节对齐
+		pos = end + size%2
+	}
+
+	if channels <= 0 || sampleRate <= 0 || body == nil {
+		return nil, fmt.Errorf("wav missing fmt or data chunk")
+	}
+
+	bytesPerSample := bitsPerSample / 8
+	if bytesPerSample == 0 {
+		return nil, ErrUnsupportedAudio
+	}
+	count := len(body) / bytesPerSample
+	samples := make([]int16, count)
+
+	switch {
+	case format == 1 && bitsPerSample == 8:
+		for i := 0; i < count; i++ {
+			samples[i] = int16(int(body[i])-128) << 8
+		}
+	case format == 1 && bitsPerSample == 16:
+		for i := 0; i < count; i++ {
+			samples[i] = int16(binary.LittleEndian.Uint16(body[i*2:]))
+		}
+	case format == 1 && bitsPerSample == 24:
+		for i := 0; i < count; i++ {
+			b := body[i*3:]
+			v := int32(b[0])<<8 | int32(b[1])<<16 | int32(b[2])<<24
+			samples[i] = int16(v >> 16)
+		}
+	case format == 1 && bitsPerSample == 32:
+		for i := 0; i < count; i++ {
+			samples[i] = int16(int32(binary.LittleEndian.Uint32(body[i*4:])) >> 16)
+		}
+	case format == 3 && bitsPerSample == 32:
+		for i := 0; i < count; i++ {
+			f := math.Float32frombits(binary.LittleEndian.Uint32(body[i*4:]))
+			samples[i] = floatToInt16(f)
+		}
+	default:
+		// alaw ulaw adpcm等交给ffmpeg
+		return nil, ErrUnsupportedAudio
+	}
+
+	// 丢弃不完整的最后一帧
+	samples = samples[:len(samples)-len(samples)%channels]
+
+	return &pcmAudio{samples: samples, sampleRate: sampleRate, channels: channels}, nil
+}
+
+// decodeMP3 使用go-mp3解码,输出固定为16位双声道
+func decodeMP3(data []byte) (*pcmAudio, error) {
+	decoder, err := mp3.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(decoder)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]int16, len(raw)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(raw[i*2:]))
+	}
+	samples = samples[:len(samples)-len(samples)%2]
+	return &pcmAudio{samples: samples, sampleRate: decoder.SampleRate(), channels: 2}, nil
+}
+
+// decodeOggOpus 解码ogg封装的opus 不支持多流(环绕声)
+func decodeOggOpus(data []byte) (*pcmAudio, error) {
+	ogg, header, err := oggreader.NewWith(bytes.NewReader(data))
+	if err != nil {
+		// 可能是ogg/vorbis等其他编码
+		return nil, ErrUnsupportedAudio
+	}
+	channels := int(header.Channels)
+	if header.ChannelMap > 1 || channels < 1 || channels > 2 {
+		return nil, ErrUnsupportedAudio
+	}
+
+	decoder, err := opus.NewDecoderWithOutput(opusSampleRate, channels)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []int16
+	out := make([]int16, opusMaxFrameSamples)
+	for {
+		packet, _, err := ogg.ParseNextPacket()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(packet, []byte("OpusTags")) {
+			continue
+		}
+		n, err := decoder.DecodeToInt16(packet, out)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, out[:n*channels]...)
+	}
+
+	// 跳过编码器延迟
+	skip := int(header.PreSkip) * channels
+	if skip > len(samples) {
+		skip = len(samples)
+	}
+	samples = samples[skip:]
+
+	return &pcmAudio{samples: samples, sampleRate: opusSampleRate, channels: channels}, nil
+}
+
+// toMono 将多声道平均混合为单声道
+func (a *pcmAudio) toMono() {
+	if a.channels == 1 {
+		return
+	}
+	frames := len(a.samples) / a.channels
+	mono := make([]int16, frames)
+	for i := 0; i < frames; i++ {
+		var sum int
+		for c := 0; c < a.channels; c++ {
+			sum += int(a.samples[i*a.channels+c])
+		}
+		mono[i] = int16(sum / a.channels)
+	}
+	a.samples = mono
+	a.channels = 1
+}
+
+// resample 将单声道音频重采样到目标采样率
+// 降采样时对每个输出点覆盖的源区间取均值作为简单低通,避免明显混叠
+func (a *pcmAudio) resample(rate int) {
+	if a.sampleRate == rate || len(a.samples) == 0 {
+		return
+	}
+	ratio := float64(a.sampleRate) / float64(rate)
+	outLen := int(float64(len(a.samples)) / ratio)
+	out := make([]int16, outLen)
+	last := len(a.samples) - 1
+
+	for i := 0; i < outLen; i++ {
+		pos := float64(i) * ratio
+		if ratio > 1 {
+			// 取以pos为中心、宽为ratio的区间 避免输出整体偏移
+			start := int(math.Ceil(pos - ratio/2))
+			end := int(math.Ceil(pos + ratio/2))
+			if start < 0 {
+				start = 0
+			}
+			if end > last+1 {
+				end = last + 1
+			}
+			var sum float64
+			for j := start; j < end; j++ {
+				sum += float64(a.samples[j])
+			}
+			out[i] = int16(sum / float64(end-start))
+			continue
+		}
+		// 升采样线性插值
+		idx := int(pos)
+		frac := pos - float64(idx)
+		next := idx + 1
+		if next > last {
+			next = last
+		}
+		v := float64(a.samples[idx])*(1-frac) + float64(a.samples[next])*frac
+		out[i] = int16(v)
+	}
+
+	a.samples = out
+	a.sampleRate = rate
+}
+
+// go-silk编码的帧长 单位毫秒
+const silkFrameMs = 20
+
+// padFrames 用静音把单声道音频补齐到ms毫秒的整数倍 go-silk会丢弃不足一帧的尾部
+func (a *pcmAudio) padFrames(ms int) {
+	frame := a.sampleRate / 1000 * ms
+	if frame <= 0 {
+		return
+	}
+	if rem := len(a.samples) % frame; rem != 0 {
+		a.samples = append(a.samples, make([]int16, frame-rem)...)
+	}
+}
+
+// pcmBytes 输出s16le格式的pcm
+func (a *pcmAudio) pcmBytes() []byte {
+	buf := make([]byte, len(a.samples)*2)
+	for i, s := range a.samples {
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(s))
+	}
+	return buf
+}
+
+func floatToInt16(f float32) int16 {
+	if f > 1 {
+		f = 1
+	} else if f < -1 {
+		f = -1
+	}
+	return int16(f * math.MaxInt16)
+}
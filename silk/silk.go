@@ -18,6 +18,7 @@ import (
 
 	"github.com/hoshinonyaruko/gensokyo/config"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
+	gosilk "github.com/wdvxdr1123/go-silk"
 )
 
 //go:embed exec/*
@@ -95,6 +96,15 @@ func EncoderSilk(data []byte) []byte {
 	return slk
 }
 
+// ErrFFmpegNotFound 当前环境没有安装ffmpeg
+var ErrFFmpegNotFound = errors.New("ffmpeg not found in PATH")
+
+// ffmpegAvailable 检查ffmpeg是否可用
+func ffmpegAvailable() bool {
+	_, err := exec.LookPath("ffmpeg")
+	return err == nil || errors.Is(err, exec.ErrDot)
+}
+
 // EncodeMP4 将给定视频文件编码为MP4
 func EncodeMP4(src string, dst string) error {
 	cmd1 := exec.Command("ffmpeg", "-i", src, "-y", "-c", "copy", "-map", "0", dst)
@@ -137,7 +147,50 @@ func createDirectoryIfNotExists(directoryPath string) error {
 }
 
 // encode 将音频编码为Silk
+// 默认使用ffmpeg+silk_codec;开启record_native_silk时wav mp3 ogg/opus先使用纯go解码+go-silk编码,其他格式回退到ffmpeg
 func encode(record []byte, tempName string) (silkWav []byte) {
+	sampleRate := config.GetRecordSampleRate() // 获取采样率
+	bitRate := config.GetRecordBitRate()       // 获取比特率
+
+	if config.GetRecordNativeSilk() {
+		var err error
+		silkWav, err = encodeNative(record, sampleRate, bitRate)
+		if err == nil {
+			return silkWav
+		}
+		if !ffmpegAvailable() {
+			mylog.Errorf("音频转码失败,纯go解码不支持该格式且未安装ffmpeg: %v", err)
+			return nil
+		}
+		mylog.Printf("纯go音频转码失败,回退到ffmpeg: %v", err)
+	} else if !ffmpegAvailable() {
+		mylog.Errorf("音频转码失败,未安装ffmpeg,可以开启record_native_silk使用纯go转码")
+		return nil
+	}
+	return encodeWithFFmpeg(record, tempName, sampleRate)
+}
+
+// encodeNative 纯go路径 解码->单声道->重采样->go-silk编码
+// 注意: 旧版曾用go-silk编码ffmpeg输出的pcm,"努力了很久,都没成功播放",因此改用silk_codec
+// 这里补齐整帧并使用tencent头,silk_test.go只验证了go-silk能解回时长相同的音频
+// go-silk对同样的输入每次启动的编码结果并不相同,客户端能否正常播放需要实测,因此只在开启record_native_silk时使用
+func encodeNative(record []byte, sampleRate, bitRate int) ([]byte, error) {
+	audio, err := decodeAudio(record)
+	if err != nil {
+		return nil, err
+	}
+	audio.toMono()
+	audio.resample(sampleRate)
+	if len(audio.samples) == 0 {
+		return nil, fmt.Errorf("empty audio")
+	}
+	audio.padFrames(silkFrameMs)
+
+	return gosilk.EncodePcmBuffToSilk(audio.pcmBytes(), sampleRate, bitRate, true)
+}
+
+// encodeWithFFmpeg 使用ffmpeg转换pcm后调用silk_codec编码
+func encodeWithFFmpeg(record []byte, tempName string, sampleRate int) (silkWav []byte) {
 	// 0. 创建缓存目录
 	err := createDirectoryIfNotExists(silkCachePath)
 	if err != nil {
@@ -153,10 +206,7 @@ func encode(record []byte, tempName string) (silkWav []byte) {
 	defer os.Remove(rawPath)
 
 	// 2.转换pcm
-	sampleRate := config.GetRecordSampleRate() // 获取采样率
-	bitRate := config.GetRecordBitRate()       // 获取比特率
 	mylog.Printf("sampleRate%v", sampleRate)
-	mylog.Printf("bitRate%v", bitRate)
 	pcmPath := path.Join(silkCachePath, tempName+".pcm")
 	cmd := exec.Command("ffmpeg", "-i", rawPath, "-f", "s16le", "-ar", strconv.Itoa(sampleRate), "-ac", "1", pcmPath)
 	if errors.Is(cmd.Err, exec.ErrDot) {
@@ -168,31 +218,9 @@ func encode(record []byte, tempName string) (silkWav []byte) {
 	}
 	defer os.Remove(pcmPath)
 
-	//todo 有大佬可以试试完善go-silk 这部分编码转换
-	//努力了很久,都没成功播放
-
-	// 3. 转silk
-	// pcm, err := os.ReadFile(pcmPath)
-	// if err != nil {
-	// 	mylog.Printf("read pcm file err")
-	// 	return nil
-	// }
-	// //silkWav, err = silk.EncodePcmBuffToSilkv2(pcm, sampleRate, bitRate, true, false, 2)
-	// silkWav, err = silk.EncodePcmBuffToSilk(pcm, sampleRate, bitRate, true)
-	// if err != nil {
-	// 	mylog.Printf("silk encode error:%v", err)
-	// 	return nil
-	// }
-
 	silkPath := path.Join(silkCachePath, tempName+".silk")
 
-	// err = os.WriteFile(silkPath, silkWav, 0o666)
-	// if err != nil {
-	// 	mylog.Printf("silk encode error2")
-	// 	return nil
-	// }
-
-	// 调用silk_codec转换为Silk
+	// 3. 调用silk_codec转换为Silk
 
 	// 获取silk_codec文件名
 	codecFileName, err := getSilkCodecPath()
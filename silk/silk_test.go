@@ -0,0 +1,248 @@
+package silk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+
+	gosilk "github.com/wdvxdr1123/go-silk"
+)
+
+// sine 生成单声道正弦波
+func sine(freq float64, rate, n int, amp float64) []int16 {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = int16(amp * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+	}
+	return samples
+}
+
+func s16le(samples []int16) []byte {
+	buf := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(s))
+	}
+	return buf
+}
+
+// wavFile 生成任意格式的wav format为1(pcm) 3(float)或0xFFFE(extensible,子格式为pcm)
+func wavFile(format uint16, channels, rate, bits int, body []byte) []byte {
+	var buf bytes.Buffer
+	fmtLen := 16
+	if format == 0xFFFE {
+		fmtLen = 40
+	}
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+8+fmtLen+8+len(body)))
+	buf.WriteString("WAVE")
+	// 未知chunk应被跳过 奇数长度按2字节对齐
+	buf.WriteString("LIST")
+	binary.Write(&buf, binary.LittleEndian, uint32(3))
+	buf.Write([]byte{1, 2, 3, 0})
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(fmtLen))
+	binary.Write(&buf, binary.LittleEndian, format)
+	binary.Write(&buf, binary.LittleEndian, uint16(channels))
+	binary.Write(&buf, binary.LittleEndian, uint32(rate))
+	binary.Write(&buf, binary.LittleEndian, uint32(rate*channels*bits/8))
+	binary.Write(&buf, binary.LittleEndian, uint16(channels*bits/8))
+	binary.Write(&buf, binary.LittleEndian, uint16(bits))
+	if format == 0xFFFE {
+		binary.Write(&buf, binary.LittleEndian, uint16(22))
+		binary.Write(&buf, binary.LittleEndian, uint16(bits))
+		binary.Write(&buf, binary.LittleEndian, uint32(0))
+		binary.Write(&buf, binary.LittleEndian, uint16(1))
+		buf.Write(make([]byte, 14))
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(body)))
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func TestDecodeWavFormats(t *testing.T) {
+	want := []int16{0, 16384, -16384, 32767, -32768, 256}
+
+	pcm8 := make([]byte, len(want))
+	pcm24 := make([]byte, len(want)*3)
+	pcm32 := make([]byte, len(want)*4)
+	float32le := make([]byte, len(want)*4)
+	for i, s := range want {
+		pcm8[i] = byte(int(s>>8) + 128)
+		v := int32(s) << 16
+		pcm24[i*3], pcm24[i*3+1], pcm24[i*3+2] = byte(v>>8), byte(v>>16), byte(v>>24)
+		binary.LittleEndian.PutUint32(pcm32[i*4:], uint32(v))
+		binary.LittleEndian.PutUint32(float32le[i*4:], math.Float32bits(float32(s)/math.MaxInt16))
+	}
+
+	cases := []struct {
+		name      string
+		data      []byte
+		tolerance int
+	}{
+		{"pcm8", wavFile(1, 1, 8000, 8, pcm8), 256},
+		{"pcm16", wavFile(1, 1, 8000, 16, s16le(want)), 0},
+		{"pcm24", wavFile(1, 1, 8000, 24, pcm24), 0},
+		{"pcm32", wavFile(1, 1, 8000, 32, pcm32), 0},
+		{"float32", wavFile(3, 1, 8000, 32, float32le), 1},
+		{"extensible", wavFile(0xFFFE, 1, 8000, 16, s16le(want)), 0},
+	}
+	for _, c := range cases {
+		audio, err := decodeAudio(c.data)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if audio.sampleRate != 8000 || audio.channels != 1 || len(audio.samples) != len(want) {
+			t.Errorf("%s: got %dhz %dch %d samples", c.name, audio.sampleRate, audio.channels, len(audio.samples))
+			continue
+		}
+		for i, s := range audio.samples {
+			if d := int(s) - int(want[i]); d > c.tolerance || d < -c.tolerance {
+				t.Errorf("%s: sample %d = %d, want %d", c.name, i, s, want[i])
+			}
+		}
+	}
+}
+
+func TestDecodeWavErrors(t *testing.T) {
+	// alaw交给ffmpeg
+	if _, err := decodeWav(wavFile(6, 1, 8000, 8, []byte{1, 2})); !errors.Is(err, ErrUnsupportedAudio) {
+		t.Errorf("alaw: %v", err)
+	}
+	if _, err := decodeWav([]byte("RIFF\x04\x00\x00\x00WAVE")); err == nil {
+		t.Error("wav without chunks should fail")
+	}
+	if _, err := decodeAudio([]byte("#!AMR\n")); !errors.Is(err, ErrUnsupportedAudio) {
+		t.Errorf("amr: %v", err)
+	}
+
+	// data长度写大了按实际长度截断,不完整的最后一帧丢弃
+	data := wavFile(1, 2, 8000, 16, s16le([]int16{1, 2, 3, 4, 5}))
+	binary.LittleEndian.PutUint32(data[len(data)-14:], 1000)
+	audio, err := decodeWav(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audio.samples) != 4 {
+		t.Errorf("got %d samples, want 4", len(audio.samples))
+	}
+}
+
+func TestToMono(t *testing.T) {
+	audio := &pcmAudio{samples: []int16{100, 300, -200, 200, 32767, 32767}, sampleRate: 8000, channels: 2}
+	audio.toMono()
+	want := []int16{200, 0, 32767}
+	if audio.channels != 1 || len(audio.samples) != len(want) {
+		t.Fatalf("got %v", audio.samples)
+	}
+	for i := range want {
+		if audio.samples[i] != want[i] {
+			t.Errorf("sample %d = %d, want %d", i, audio.samples[i], want[i])
+		}
+	}
+}
+
+func TestResample(t *testing.T) {
+	cases := []struct{ from, to int }{
+		{48000, 24000},
+		{44100, 24000},
+		{8000, 24000},
+		{24000, 24000},
+	}
+	for _, c := range cases {
+		audio := &pcmAudio{samples: sine(440, c.from, c.from, 10000), sampleRate: c.from, channels: 1}
+		audio.resample(c.to)
+		if audio.sampleRate != c.to {
+			t.Errorf("%d->%d: sample rate %d", c.from, c.to, audio.sampleRate)
+		}
+		// 一秒的音频重采样后仍是一秒
+		if d := len(audio.samples) - c.to; d > 1 || d < -1 {
+			t.Errorf("%d->%d: got %d samples", c.from, c.to, len(audio.samples))
+		}
+		// 与目标采样率下的正弦波比较 低频信号应基本不变
+		want := sine(440, c.to, len(audio.samples), 10000)
+		// 末尾的点没有下一个源采样可以插值,不比较
+		var maxDiff float64
+		for i := range want[:len(want)-2] {
+			maxDiff = math.Max(maxDiff, math.Abs(float64(audio.samples[i])-float64(want[i])))
+		}
+		if maxDiff > 300 {
+			t.Errorf("%d->%d: max difference %.0f", c.from, c.to, maxDiff)
+		}
+	}
+
+	empty := &pcmAudio{sampleRate: 48000, channels: 1}
+	empty.resample(24000)
+	if len(empty.samples) != 0 {
+		t.Error("empty audio should stay empty")
+	}
+}
+
+func TestPadFrames(t *testing.T) {
+	for _, n := range []int{1, 479, 480, 481, 960} {
+		audio := &pcmAudio{samples: make([]int16, n), sampleRate: 24000, channels: 1}
+		for i := range audio.samples {
+			audio.samples[i] = 1
+		}
+		audio.padFrames(silkFrameMs)
+		want := (n + 479) / 480 * 480
+		if len(audio.samples) != want {
+			t.Errorf("%d samples padded to %d, want %d", n, len(audio.samples), want)
+			continue
+		}
+		for i := n; i < want; i++ {
+			if audio.samples[i] != 0 {
+				t.Errorf("%d samples: padding is not silence", n)
+				break
+			}
+		}
+	}
+}
+
+// TestEncodeNativeRoundTrip 编码后用go-silk解码,应得到时长相同且不是静音的语音
+func TestEncodeNativeRoundTrip(t *testing.T) {
+	const rate = 24000
+	// 48000hz双声道 1.01秒 不是整帧
+	n := 48480
+	left := sine(440, 48000, n, 8000)
+	stereo := make([]int16, n*2)
+	for i, s := range left {
+		stereo[i*2], stereo[i*2+1] = s, s
+	}
+	silkData, err := encodeNative(wavFile(1, 2, 48000, 16, s16le(stereo)), rate, 24000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(silkData, []byte("\x02#!SILK_V3")) {
+		t.Fatalf("missing tencent silk header: %q", silkData[:10])
+	}
+	if !IsAMRorSILK(silkData) {
+		t.Error("IsAMRorSILK should accept the encoded voice")
+	}
+
+	pcm, err := gosilk.DecodeSilkBuffToPcm(silkData, rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := make([]int16, len(pcm)/2)
+	for i := range decoded {
+		decoded[i] = int16(binary.LittleEndian.Uint16(pcm[i*2:]))
+	}
+	// 1.01秒补齐到1.02秒
+	if len(decoded) != rate*102/100 {
+		t.Fatalf("decoded %d samples, want %d", len(decoded), rate*102/100)
+	}
+
+	// go-silk每次启动的编码结果并不相同,音高和幅度偶尔偏离很多(这也是纯go转码默认关闭的原因之一)
+	// 这里只检查解出的不是静音
+	var energy float64
+	for _, v := range decoded {
+		energy += float64(v) * float64(v)
+	}
+	if rms := math.Sqrt(energy / float64(len(decoded))); rms < 100 {
+		t.Errorf("decoded rms %.0f, the voice is silent", rms)
+	}
+}
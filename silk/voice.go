@@ -0,0 +1,108 @@
+package silk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+
+	gosilk "github.com/wdvxdr1123/go-silk"
+)
+
+// silk语音解码输出的采样率,qq语音基本都是24000
+const voiceDecodeSampleRate = 24000
+
+// DecodeVoice 将收到的silk/amr语音解码为通用格式,format为wav或mp3
+// 返回解码后的数据和实际的扩展名,mp3需要ffmpeg,没有ffmpeg时退回wav
+func DecodeVoice(data []byte, format string) ([]byte, string, error) {
+	var wav []byte
+	switch {
+	case bytes.HasPrefix(data, []byte(HeaderSilk)) || bytes.HasPrefix(data, []byte(HeaderSilk[1:])):
+		pcm, err := gosilk.DecodeSilkBuffToPcm(data, voiceDecodeSampleRate)
+		if err != nil {
+			return nil, "", err
+		}
+		wav = EncodeWav(pcm, voiceDecodeSampleRate, 1)
+	case bytes.HasPrefix(data, []byte(HeaderAmr)):
+		// amr没有纯go解码器
+		if !ffmpegAvailable() {
+			return nil, "", ErrFFmpegNotFound
+		}
+		ext := "wav"
+		if format == "mp3" {
+			ext = "mp3"
+		}
+		out, err := convertWithFFmpeg(data, "amr", ext)
+		if err != nil {
+			return nil, "", err
+		}
+		return out, ext, nil
+	default:
+		return nil, "", ErrUnsupportedAudio
+	}
+
+	if format != "mp3" {
+		return wav, "wav", nil
+	}
+	if !ffmpegAvailable() {
+		return wav, "wav", nil
+	}
+	out, err := convertWithFFmpeg(wav, "wav", "mp3")
+	if err != nil {
+		return wav, "wav", nil
+	}
+	return out, "mp3", nil
+}
+
+// EncodeWav 为s16le pcm加上RIFF/WAVE头
+func EncodeWav(pcm []byte, sampleRate, channels int) []byte {
+	var buf bytes.Buffer
+	blockAlign := channels * 2
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(pcm)))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(channels))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*blockAlign))
+	binary.Write(&buf, binary.LittleEndian, uint16(blockAlign))
+	binary.Write(&buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+	return buf.Bytes()
+}
+
+// convertWithFFmpeg 使用ffmpeg在缓存目录中转换格式
+func convertWithFFmpeg(data []byte, srcExt, dstExt string) ([]byte, error) {
+	if err := createDirectoryIfNotExists(silkCachePath); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(silkCachePath, "voice*."+srcExt)
+	if err != nil {
+		return nil, err
+	}
+	srcPath := tmp.Name()
+	defer os.Remove(srcPath)
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	tmp.Close()
+
+	dstPath := srcPath[:len(srcPath)-len(path.Ext(srcPath))] + "." + dstExt
+	defer os.Remove(dstPath)
+	cmd := exec.Command("ffmpeg", "-i", srcPath, "-y", dstPath)
+	if errors.Is(cmd.Err, exec.ErrDot) {
+		cmd.Err = nil
+	}
+	if err = cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg convert %s to %s failed: %v", srcExt, dstExt, err)
+	}
+	return os.ReadFile(dstPath)
+}
@@ -34,6 +34,9 @@ type Settings struct {
 	GlobalGroupMsgReceiveMessage             string `yaml:"global_group_msg_receive_message"`
 	HashID                                   bool   `yaml:"hash_id"`
 	IdmapPro                                 bool   `yaml:"idmap_pro"`
+	DBBackupInterval                         int    `yaml:"db_backup_interval"`
+	DBBackupDir                              string `yaml:"db_backup_dir"`
+	DBBackupKeep                             int    `yaml:"db_backup_keep"`
 	//gensokyo互联类
 	Server_dir            string `yaml:"server_dir"`
 	Port                  string `yaml:"port"`
@@ -44,10 +47,21 @@ type Settings struct {
 	LotusWithoutUploadPic bool   `yaml:"lotus_without_uploadpic"`
 	LotusGrpc             bool   `yaml:"lotus_grpc"`
 	LotusGrpcPort         int    `yaml:"lotus_grpc_port"`
+	LotusID               string `yaml:"lotus_id"`
+	LotusSecret           string `yaml:"lotus_secret"`
+	LotusMtls             bool   `yaml:"lotus_mtls"`
+	LotusGrpcTls          bool   `yaml:"lotus_grpc_tls"`
+	LotusTlsCa            string `yaml:"lotus_tls_ca"`
+	LotusTlsCert          string `yaml:"lotus_tls_cert"`
+	LotusTlsKey           string `yaml:"lotus_tls_key"`
+	LotusLegacyToken      bool   `yaml:"lotus_legacy_token"`
 	//增强配置
 	MasterID         []string `yaml:"master_id"`
 	RecordSampleRate int      `yaml:"record_sampleRate"`
 	RecordBitRate    int      `yaml:"record_bitRate"`
+	RecordNativeSilk bool     `yaml:"record_native_silk"`
+	RecordDecode     bool     `yaml:"record_decode"`
+	RecordDecodeType string   `yaml:"record_decode_type"`
 	CardAndNick      string   `yaml:"card_nick"`
 	AutoBind         bool     `yaml:"auto_bind"`
 	//发图相关
@@ -116,7 +130,9 @@ type Settings struct {
 	ThreadsRetMsg   bool   `yaml:"threads_ret_msg"`
 	NoRetMsg        bool   `yaml:"no_ret_msg"`
 	//增长营销类
-	SelfIntroduce []string `yaml:"self_introduce"`
+	SelfIntroduce         []string `yaml:"self_introduce"`
+	GroupAddRequestManual bool     `yaml:"group_add_request_manual"`
+	GroupNoticeStandard   bool     `yaml:"group_notice_standard"`
 	//api修改
 	GetGroupListAllGuilds    bool     `yaml:"get_g_list_all_guilds"`
 	GetGroupListGuilds       string   `yaml:"get_g_list_guilds"`
@@ -129,6 +145,9 @@ type Settings struct {
 	AutoPutInteraction       bool     `yaml:"auto_put_interaction"`
 	PutInteractionDelay      int      `yaml:"put_interaction_delay"`
 	PutInteractionExcept     []string `yaml:"put_interaction_except"`
+	InteractionRoute         bool     `yaml:"interaction_route"`
+	StreamInterval           int      `yaml:"stream_interval"`
+	StreamTimeout            int      `yaml:"stream_timeout"`
 	//onebot修改
 	TwoWayEcho       bool `yaml:"twoway_echo"`
 	Array            bool `yaml:"array"`
@@ -149,6 +168,10 @@ type Settings struct {
 	KeyBoardID       string `yaml:"keyboard_id"`
 	NativeMD         bool   `yaml:"native_md"`
 	EntersAsBlock    bool   `yaml:"enters_as_block"`
+	//MD模板与校验
+	MarkdownTemplates     []MarkdownTemplate `yaml:"markdown_templates"`
+	MarkdownValidate      bool               `yaml:"markdown_validate"`
+	MarkdownLinkWhitelist []string           `yaml:"markdown_link_whitelist"`
 	//发送行为修改
 	LazyMessageId     bool   `yaml:"lazy_message_id"`
 	RamDomSeq         bool   `yaml:"ramdom_seq"`
@@ -157,6 +180,30 @@ type Settings struct {
 	SendDelay         int    `yaml:"send_delay"`
 	EnableChangeWord  bool   `yaml:"enableChangeWord"`
 	DefaultChangeWord string `yaml:"defaultChangeWord"`
+	//超长文本分段发送
+	SplitLength   int    `yaml:"split_length"`
+	SplitMaxParts int    `yaml:"split_max_parts"`
+	SplitOverflow string `yaml:"split_overflow"`
+	//文字转图片
+	Text2imgFont     string `yaml:"text2img_font"`
+	Text2imgFontURL  string `yaml:"text2img_font_url"`
+	Text2imgWidth    int    `yaml:"text2img_width"`
+	Text2imgFontSize int    `yaml:"text2img_font_size"`
+	Text2imgLength   int    `yaml:"text2img_length"`
+	Text2imgURL      bool   `yaml:"text2img_url"`
+	//发送前审核
+	ModerationEnable         bool             `yaml:"moderation_enable"`
+	ModerationProviders      []string         `yaml:"moderation_providers"`
+	ModerationRules          []ModerationRule `yaml:"moderation_rules"`
+	ModerationWebhook        string           `yaml:"moderation_webhook"`
+	ModerationWebhookToken   string           `yaml:"moderation_webhook_token"`
+	ModerationWebhookTimeout int              `yaml:"moderation_webhook_timeout"`
+	ModerationFailAction     string           `yaml:"moderation_fail_action"`
+	ModerationImageAction    string           `yaml:"moderation_image_action"`
+	ModerationReplaceText    string           `yaml:"moderation_replace_text"`
+	ModerationReplaceImage   string           `yaml:"moderation_replace_image"`
+	ModerationLog            string           `yaml:"moderation_log"`
+	ModerationLogPass        bool             `yaml:"moderation_log_pass"`
 	//错误临时修复类
 	Fix11300          bool `yaml:"fix_11300"`
 	HttpOnlyBot       bool `yaml:"http_only_bot"`
@@ -166,6 +213,13 @@ type Settings struct {
 	MePrefix     string   `yaml:"me_prefix"`
 	UnlockPrefix string   `yaml:"unlock_prefix"`
 	LinkPrefix   string   `yaml:"link_prefix"`
+	RolePrefix   string   `yaml:"role_prefix"`
+	DisabledCommands []string `yaml:"disabled_commands"`
+	HelpPrefix        string `yaml:"help_prefix"`
+	PingPrefix        string `yaml:"ping_prefix"`
+	StatusPrefix      string `yaml:"status_prefix"`
+	WhoisPrefix       string `yaml:"whois_prefix"`
+	InterceptCommands bool   `yaml:"intercept_commands"`
 	AutoLink     bool     `yaml:"auto_link"`
 	MusicPrefix  string   `yaml:"music_prefix"`
 	LinkBots     []string `yaml:"link_bots"`
@@ -199,6 +253,32 @@ type Settings struct {
 	AliyunAccessKeySecret string `yaml:"a_OSS_AccessKeySecret"`
 	AliyunBucketName      string `yaml:"a_OSS_BucketName"`
 	AliyunAudit           bool   `yaml:"a_audit"`
+	//S3兼容存储
+	S3Endpoint  string `yaml:"s3_endpoint"`
+	S3Region    string `yaml:"s3_region"`
+	S3Bucket    string `yaml:"s3_bucket"`
+	S3AccessKey string `yaml:"s3_access_key"`
+	S3SecretKey string `yaml:"s3_secret_key"`
+	S3PathStyle bool   `yaml:"s3_path_style"`
+	S3PublicURL string `yaml:"s3_public_url"`
+	//审核
+	OssAudit string `yaml:"oss_audit"`
+}
+
+type ModerationRule struct {
+	Pattern     string `yaml:"pattern"`
+	Regex       bool   `yaml:"regex"`
+	Type        string `yaml:"type"`
+	Action      string `yaml:"action"`
+	Replacement string `yaml:"replacement"`
+}
+
+type MarkdownTemplate struct {
+	Name       string   `yaml:"name" json:"name"`
+	TemplateID string   `yaml:"template_id" json:"template_id"`
+	Content    string   `yaml:"content" json:"content"`
+	Params     []string `yaml:"params" json:"params"`
+	KeyboardID string   `yaml:"keyboard_id" json:"keyboard_id"`
 }
 
 type VisualPrefixConfig struct {
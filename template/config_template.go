@@ -26,14 +26,24 @@ settings:
     - "DirectMessageHandler"                         # 私域频道私信(dms)
     # - "ReadyHandler"                               # 连接成功
     # - "ErrorNotifyHandler"                         # 连接关闭
-    # - "GuildEventHandler"                          # 频道事件
-    # - "MemberEventHandler"                         # 频道成员新增
-    # - "ChannelEventHandler"                        # 频道事件
+    # - "GuildEventHandler"                          # 频道事件 上报guild_created guild_updated guild_destroyed通知
+    # - "MemberEventHandler"                         # 频道成员变动 上报guild_member_increase guild_member_decrease guild_member_updated通知(成员属于频道而非子频道,global_channel_to_group时也不转为群通知)
+    # - "ChannelEventHandler"                        # 子频道事件 上报channel_created channel_updated channel_destroyed通知
     # - "CreateMessageHandler"                       # 频道不at信息 私域机器人需要开启 公域机器人开启会连接失败
     # - "InteractionHandler"                         # 添加频道互动回应 卡片按钮data回调事件
     # - "GroupATMessageEventHandler"                 # 群at信息 仅频道机器人时候需要注释
     # - "C2CMessageEventHandler"                     # 群私聊 仅频道机器人时候需要注释
-    # - "ThreadEventHandler"                         # 频道发帖事件 仅频道私域机器人可用
+    # - "ThreadEventHandler"                         # 频道发帖事件 仅频道私域机器人可用 修改和删除上报forum_thread_updated forum_thread_deleted
+    # - "PostEventHandler"                           # 帖子评论事件 上报forum_post_created forum_post_deleted 仅频道私域机器人可用
+    # - "ReplyEventHandler"                          # 评论回复事件 上报forum_reply_created forum_reply_deleted 仅频道私域机器人可用
+    # - "ForumAuditEventHandler"                     # 发帖审核结果 上报forum_audit,task_id与发帖时返回的一致
+    # - "AudioEventHandler"                          # 音频事件 上报audio_started audio_finished audio_on_mic audio_off_mic 仅音频机器人可用
+    # - "AudioLiveChannelMemberEventHandler"         # 音视频、直播子频道成员进出 上报audio_channel_member
+    # - "MessageDeleteEventHandler"                  # 私域频道信息撤回 上报group_recall或guild_channel_recall
+    # - "PublicMessageDeleteEventHandler"            # 公域频道信息撤回 上报group_recall或guild_channel_recall
+    # - "DirectMessageDeleteEventHandler"            # 频道私信撤回 上报friend_recall
+    # - "MessageReactionEventHandler"                # 频道表情表态 上报message_reactions_updated
+    # - "MessageAuditEventHandler"                   # 信息审核结果 上报message_audit,audit_id与发送时返回的一致
 
   #转换类
   global_channel_to_group: true                      # 是否将频道转换成群 默认true
@@ -45,27 +55,41 @@ settings:
   global_group_msg_receive_message : "机器人主动消息被开启" # 建议设置为无规则复杂随机内容,避免用户指令内容碰撞. 自行添加 intent - GroupMsgReceiveHandler
   hash_id : true                                    # 使用hash来进行idmaps转换,可以让user_id不是123开始的递增值
   idmap_pro : false                                  # 需开启hash_id配合,高级id转换增强,可以多个真实值bind到同一个虚拟值,对于每个用户,每个群\私聊\判断私聊\频道,都会产生新的虚拟值,但可以多次bind,bind到同一个数字.数据库负担会变大.
+  db_backup_interval : 0                             # 数据库热备份间隔(分钟),0为不自动备份.备份idmap.db botstats.db gensokyo.db cookie.db,也可在webui手动备份和恢复
+  db_backup_dir : "backups"                          # 备份保存目录,每次备份为一个带manifest.json校验和的子目录
+  db_backup_keep : 7                                 # 保留最近几次备份,超出的自动删除
 
   #Gensokyo互联类
   server_dir: "<YOUR_SERVER_DIR>"                    # Lotus地址.不带http头的域名或ip,提供图片上传服务的服务器(图床)需要带端口号. 如果需要发base64图,需为公网ip,且开放对应端口
   port: "15630"                                      # Lotus端口.idmaps和图床对外开放的端口号,若要连接到另一个gensokyo,也是链接端口
   backup_port : "5200"                               # 当totus为ture时,port值不再是本地webui的端口,使用lotus_Port来访问webui
-  lotus: false                                       # lotus特性默认为false,当为true时,将会连接到另一个lotus为false的gensokyo。使用它提供的图床和idmaps服务(场景:同一个机器人在不同服务器运行,或内网需要发送base64图)。如果需要发送base64图片,需要设置正确的公网server_dir和开放对应的port, lotus鉴权 设置后,从gsk需要保持相同密码来访问主gsk
+  lotus: false                                       # lotus特性默认为false,当为true时,将会连接到另一个lotus为false的gensokyo。使用它提供的图床和idmaps服务(场景:同一个机器人在不同服务器运行,或内网需要发送base64图)。如果需要发送base64图片,需要设置正确的公网server_dir和开放对应的port, lotus鉴权 设置后,从gsk需要保持相同密码来访问主gsk(也可以在主gsk的webui为每个从gsk创建独立凭据,见lotus_id)
   lotus_password : "" 
   lotus_without_idmaps: false       #lotus只通过url,图片上传,语音,不通过id转换,在本地当前gsk维护idmaps转换.
   lotus_without_uploadpic : false   #lotus只转换id,不进行图片上传.
   lotus_grpc : false                #实验特性,使用grpc进行lotus连接.提高性能.
   lotus_grpc_port : 50051           #grpc的端口,连接与被连接需保持一致.并且在防火墙放通此端口.
+  lotus_id : ""                     #从gsk使用的凭据id,在主gsk的webui中创建,留空时使用default凭据(密钥为lotus_password)
+  lotus_secret : ""                 #从gsk使用的凭据密钥,只在创建时显示一次.请求使用HMAC签名(时间戳+随机数),密钥本身不会在网络上传输
+  lotus_mtls : false                #双向TLS 主gsk要求从gsk出示lotus_tls_ca签发的客户端证书(http需port为443或force_ssl,grpc需lotus_grpc_tls),从gsk出示lotus_tls_cert
+  lotus_grpc_tls : false            #grpc连接使用TLS,主gsk使用lotus_tls_cert lotus_tls_key(留空时使用crt key)作为服务端证书
+  lotus_tls_ca : ""                 #主gsk:校验从gsk客户端证书的CA 从gsk:校验主gsk证书的CA,留空使用系统根证书
+  lotus_tls_cert : ""               #证书路径 从gsk为客户端证书,主gsk为grpc服务端证书
+  lotus_tls_key : ""                #证书密钥路径
+  lotus_legacy_token : true         #兼容未升级的从gsk:主gsk接受旧版短链接请求中lotus_password的md5 token,从gsk同时携带token.所有gsk升级后建议关闭
 
   #增强配置项                                           
-  master_id : ["1","2"]             #群场景尚未开放获取管理员和列表能力,手动从日志中获取需要设置为管理,的user_id并填入(适用插件有权限判断场景)
+  master_id : ["1","2"]             #全局owner,可使用bind与role指令分配更多角色. 群场景尚未开放获取管理员和列表能力,手动从日志中获取需要设置为管理,的user_id并填入(适用插件有权限判断场景)
   record_sampleRate : 24000         #语音文件的采样率 最高48000 默认24000 单位Khz
   record_bitRate : 24000            #语音文件的比特率 默认25000 代表 25 kbps 最高无限 请根据带宽 您发送的实际码率调整
+  record_native_silk : false        #wav/mp3/ogg(opus)语音使用内置纯go转码,不需要安装ffmpeg,其他格式仍需ffmpeg.实验性,客户端播放尚未充分验证,默认使用ffmpeg+silk_codec
+  record_decode : false             #收到语音时在后台下载并解码silk/amr,存放在本地channel_temp;已解码的语音在record段的file和url中提供,未完成时file为xxx.record,可调用get_record等待结果,重启后仍可解码,语音地址与解码文件保留24小时
+  record_decode_type : "wav"        #语音解码的目标格式 wav或mp3 mp3需要安装ffmpeg,没有ffmpeg时退回wav
   card_nick : ""                    #默认为空,连接mirai-overflow时,请设置为非空,这里是机器人对用户称谓,为空为插件获取,mirai不支持
   auto_bind : true                  #测试功能,后期会移除
 
   #发图相关
-  oss_type : 0                      #请完善后方具体配置 完成#腾讯云配置...,0代表配置server dir port服务器自行上传(省钱),1,腾讯cos存储桶 2,百度oss存储桶 3,阿里oss存储桶
+  oss_type : 0                      #请完善后方具体配置 完成#腾讯云配置...,0代表配置server dir port服务器自行上传(省钱),1,腾讯cos存储桶 2,百度oss存储桶 3,阿里oss存储桶 4,S3兼容存储桶(MinIO R2等) 5,直接保存到本地channel_temp目录(不经过http回环,需要server_dir为公网地址)
   image_sizelimit : 0               #代表kb 腾讯api要求图片1500ms完成传输 如果图片发不出 请提升上行或设置此值 默认为0 不压缩
   image_limit : 100                 #每分钟上传的最大图片数量,可自行增加
   guild_url_image_to_base64 : false #解决频道发不了某些url图片,报错40003问题
@@ -148,6 +172,8 @@ settings:
 
   #增长营销类(推荐gensokyo-broadcast项目)
   self_introduce : ["",""]          #自我介绍,可设置多个随机发送,当不为空时,机器人被邀入群会发送自定义自我介绍 需手动添加新textintent   - "GroupAddRobotEventHandler"   - "GroupDelRobotEventHandler"
+  group_add_request_manual : false  #机器人被邀入群时上报的request事件需应用端调用set_group_add_request同意后才发送自我介绍,false时自动同意
+  group_notice_standard : false     #true时group_receive/group_reject的sub_type为enable/disable,机器人入群/被移出的通知中user_id为机器人自己,operator_id为操作者;false时与旧版本一致(sub_type为create,user_id为操作者)
 
 
   #API修改
@@ -162,6 +188,9 @@ settings:
   auto_put_interaction : false      #自动回应按钮回调的/interactions/{interaction_id} 注本api需要邮件申请,详细方法参考群公告:196173384
   put_interaction_delay : 0         #单位毫秒 表示回应已收到回调类型的按钮的毫秒数 会按用户进行区分 非全局delay
   put_interaction_except : []       #自动回复按钮的例外,当你想要自己用api回复,回复特殊状态时,将指令前缀填入进去(根据按钮的data字段判断的)
+  interaction_route : true          #通过keyboard段发出的回调按钮被点击时,回调只上报给在同一个群/频道/私聊中发出该按钮的应用端(正反ws),找不到、已断开或有多个应用端发出相同data时广播给所有应用端
+  stream_interval : 500             #单位毫秒 流式回复(open_stream/push_stream/close_stream)合并推送的间隔,期间收到的分段会合并为一次发送
+  stream_timeout : 60               #单位秒 流式回复超过这个时间没有新的分段时自动结束
 
   #Onebot修改
   twoway_echo : false               #是否采用双向echo,根据机器人选择,獭獭\早苗 true 红色问答\椛椛 或者其他 请使用 false
@@ -186,6 +215,9 @@ settings:
   keyboard_id : ""                  #自动转换图文信息到md所需要的按钮id *需要应用端支持双方向echo
   native_md : false                 #自动转换图文信息到md,使用原生markdown能力.
   enters_as_block : false           #自动转换图文信息到md,\r \r\n \n 替换为空格.
+  markdown_templates : []           #具名md模板,应用端用[CQ:markdown,template=名称,变量=值]发送 形如 - {name: "weather", template_id: "102xxx_xxx", params: ["city","temp"], content: "# {{.city}}\r气温{{.temp}}"} 不填template_id时content作为原生markdown填入变量,填了时content仅用于预览和校验,也可在webui中添加
+  markdown_validate : true          #发送前在本地校验md(图片宽高 链接白名单 模板参数),不通过时不发送并在日志中给出原因
+  markdown_link_whitelist : []      #md中允许的链接域名,如 ["example.com"] 会同时允许子域名,为空不校验 mqqapi://指令链接不受限制
 
   #发送行为修改
   lazy_message_id : false           #false=message_id 条条准确对应 true=message_id 按时间范围随机对应(适合主动推送bot)前提,有足够多的活跃信息刷新id池
@@ -196,16 +228,50 @@ settings:
   enableChangeWord : false          #敏感词替换系统,具有IN和OUT两个文本维度,会在运行目录下释放txt文件,一行一个,格式为aaa####bbb,作用是将aaa替换为bbb,输入替换是对用户输入进行替换,输出则是替换机器人发出的文本信息.
   defaultChangeWord : "*"           #默认替换词,当开启
 
+  #超长文本分段发送 对群和私聊生效,在段落、换行、句子处断开,cq码不会被拆开,各段以相同的msg_id和递增的msg_seq按顺序发出
+  split_length : 0                  #每段最多的字数,超过时分段发送,有一段失败时不再发送后面的段,0为不分段 建议1500
+  split_max_parts : 5               #一条信息最多分成几段发送(被动回复的次数有限)
+  split_overflow : ""               #超过split_max_parts时的处理 ""全部发送 truncate丢弃多余的段 button多余的段改为"下一页"回调按钮,点击后继续发送(按钮需要markdown权限) image多余的段渲染为一张图片随最后一段发送
+
+  #文字转图片 [CQ:text2img,text=内容,markdown=true] 把文本、简单markdown或表格渲染为png发送
+  text2img_font : ""                #中文字体文件路径(ttf/otf/ttc),为空时依次查找运行目录fonts文件夹和系统字体目录,都没有时含有中文的文本不能转为图片,修改后需要重启
+  text2img_font_url : ""            #找不到中文字体时从这个地址下载字体到运行目录fonts文件夹,如 https://github.com/notofonts/noto-cjk/raw/main/Sans/SubsetOTF/SC/NotoSansSC-Regular.otf 为空时不下载
+  text2img_width : 800              #图片宽度 像素
+  text2img_font_size : 24           #正文字号 像素
+  text2img_length : 0               #发送的文本超过这个字数时自动转为图片发送(帖子与合并转发除外),0为不转换
+  text2img_url : false              #文本中含有不在markdown_link_whitelist中的链接时自动转为图片发送(白名单为空时所有链接都转换)
+
+  #发送前审核 对群、私聊、频道、帖子发出的文本和图片逐条审核,拦截和改写的决定会写入审核日志
+  moderation_enable : false         #是否启用发送前审核
+  moderation_providers : ["rules"]  #按顺序执行的审核方,可选 rules(本地规则) webhook(http回调) cloud(使用oss_audit/t_audit等配置的云审核,仅url图片)
+  moderation_rules : []             #本地规则 形如 - {pattern: "赌博", action: "block"} 或 - {pattern: "\\d{11}", regex: true, action: "blur"} type填image时匹配图片url,action可选block blur replace,replace时使用replacement
+  moderation_webhook : ""           #http回调审核地址,POST json {"type":"text/image","text":"","image_url":"","image_base64":"","message_type":"","target_id":""} 返回 {"action":"pass/block/blur/replace","reason":"","replacement":""}
+  moderation_webhook_token : ""     #回调审核时携带的 Authorization: Bearer token 可为空
+  moderation_webhook_timeout : 3000 #回调审核超时 单位毫秒
+  moderation_fail_action : "pass"   #审核方出错(超时 网络错误)时的处理 pass放行 block拦截
+  moderation_image_action : "block" #cloud审核图片不合规时的处理 block拦截整条信息 blur模糊图片 replace替换为moderation_replace_image
+  moderation_replace_text : "[已屏蔽]" #文本replace未指定replacement时使用的替换文本
+  moderation_replace_image : ""     #图片replace时替换成的图片url,为空则直接去掉该图片
+  moderation_log : "moderation.log" #审核日志,每行一条json,位于log文件夹
+  moderation_log_pass : false       #审核通过的决定也写入审核日志,每条发出的信息都会记录,仅排查时开启
+
   #错误临时修复类
   fix_11300: false                  #修复11300报错,需要在develop_bot_id填入自己机器人的appid. 11300原因暂时未知,临时修复方案.
   http_only_bot : false             #这个配置项会自动配置,请不要修改,保持false.
   do_not_replace_appid : false      #在频道内机器人尝试at自己回at不到,保持false.群内机器人有发送用户头像url的需求时,true(因为用户头像url包含了appid,如果false就会出错.)
   
   #内置指令类
-  bind_prefix : "/bind"             #需设置   #增强配置项  master_id 可触发
+  bind_prefix : "/bind"             #需设置   #增强配置项  owner角色(含master_id) 可触发
   me_prefix : "/me"                 #需设置   #增强配置项  master_id 可触发
   unlock_prefix : "/unlock"         #频道私信卡住了? gsk可以帮到你 在任意子频道发送unlock 你会收到来自机器人的频道私信
   link_prefix : "/link"             #友情链接配置 配置custom_template_id后可用(https://www.yuque.com/km57bt/hlhnxg/tzbr84y59dbz6pib)
+  role_prefix : "/role"             #角色管理指令 owner可分配owner/admin/member/自定义角色,admin可管理群内member与自定义角色,角色会上报在sender.role 第一个owner由master_id、一次性指令码(指令码 owner)、webui或-idmap role set指定
+  disabled_commands : []            #关闭的框架指令名称,可选 bind me unlock link role help ping status whois,例如与应用端指令冲突时填写["help"]
+  help_prefix : ""                  #列出可用框架指令的触发词,如"/help",为空时关闭.注意与应用端的指令冲突
+  ping_prefix : ""                  #检查机器人是否在线并回复延迟的触发词,如"/ping",为空时关闭
+  status_prefix : ""                #查看连接与收发统计的触发词(admin),如"/status",为空时关闭
+  whois_prefix : ""                 #查询id映射的触发词(admin),如"/idmap whois",为空时关闭
+  intercept_commands : false        #框架指令处理后不再上报给应用端,避免应用端对同一指令重复回复.触发词为前缀匹配
   auto_link : false                 #友情链接最高礼仪,机器人被添加到群内时发送友情链接.
   music_prefix : "点歌"             #[CQ:music,type=qq,id=123] 在消息文本组合qq音乐歌曲id,可以发送点歌,这是歌曲按钮第二个按钮的填充内容,应为你的机器人点歌插件的指令.
   link_bots : ["",""]               #发送友情链接时 下方按钮携带的机器人 格式 "appid-qq-name","appid-qq-name"或"http://xxx.com-文字" 链接中的-号自行用%2D替换 如 cgi-bin替换为cgi%2Dbin
@@ -246,6 +312,18 @@ settings:
   a_OSS_AccessKeySecret : ""
   a_audit : false                   #是否审核图片 请先开通阿里云内容安全需企业认证。具体操作 请参见https://help.aliyun.com/document_detail/69806.html
 
+  #S3兼容存储配置(oss_type 4) 适用于MinIO Cloudflare R2 等
+  s3_endpoint : ""                  #形如 http://127.0.0.1:9000 或 https://<accountid>.r2.cloudflarestorage.com
+  s3_region : ""                    #地域 留空默认us-east-1,R2填auto
+  s3_bucket : ""                    #存储桶名称
+  s3_access_key : ""                #Access Key
+  s3_secret_key : ""                #Secret Key
+  s3_path_style : true              #使用路径风格 endpoint/bucket/key 访问,MinIO一般为true,虚拟主机风格 bucket.endpoint/key 为false
+  s3_public_url : ""                #对外访问的地址前缀,如R2的公开域名 https://pic.example.com 留空则使用endpoint拼接的地址,需要存储桶允许公开读
+
+  #审核配置 审核与存储分离,可以任意组合
+  oss_audit : ""                    #留空沿用上方t_audit b_audit a_audit的设置(只对对应厂商的oss_type生效),可填none tencent baidu aliyun,填写后对任意oss_type(包括0和5)生效,需要完善对应厂商的密钥
+
 `
 const Logo = `
 '                                                                                                      
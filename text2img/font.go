@@ -0,0 +1,349 @@
+package text2img
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// 字体 西文使用内嵌的Go字体,中文使用text2img_font配置的字体
+// 未配置时依次在运行目录的fonts文件夹、常见的系统位置和系统字体目录查找,仍没有时按text2img_font_url下载到fonts文件夹
+// 都没有找到时,含有内嵌字体没有的字的文本不渲染,避免发出满是方框的图片
+
+// 常见的中文字体位置 ttc取第一个字体
+var systemFonts = []string{
+	`C:\Windows\Fonts\msyh.ttc`,
+	`C:\Windows\Fonts\msyh.ttf`,
+	`C:\Windows\Fonts\simhei.ttf`,
+	`C:\Windows\Fonts\simsun.ttc`,
+	"/System/Library/Fonts/PingFang.ttc",
+	"/System/Library/Fonts/STHeiti Medium.ttc",
+	"/System/Library/Fonts/Hiragino Sans GB.ttc",
+	"/Library/Fonts/Arial Unicode.ttf",
+	"/usr/share/fonts/opentype/noto/NotoSansCJK-Regular.ttc",
+	"/usr/share/fonts/noto-cjk/NotoSansCJK-Regular.ttc",
+	"/usr/share/fonts/google-noto-cjk/NotoSansCJK-Regular.ttc",
+	"/usr/share/fonts/truetype/wqy/wqy-microhei.ttc",
+	"/usr/share/fonts/truetype/wqy/wqy-zenhei.ttc",
+	"/usr/share/fonts/wqy-microhei/wqy-microhei.ttc",
+	"/usr/share/fonts/truetype/droid/DroidSansFallbackFull.ttf",
+	"/system/fonts/NotoSansCJK-Regular.ttc",
+	"/system/fonts/DroidSansFallback.ttf",
+}
+
+// 系统字体目录 文件名含有这些词的字体视为中文字体(Debian/Alpine等发行版的字体包位置不同)
+var (
+	fontDirs     = []string{"/usr/share/fonts", "/usr/local/share/fonts"}
+	cjkFontNames = []string{"cjk", "wqy", "wenquanyi", "droidsansfallback", "sourcehansans", "notosanssc", "notosanstc", "msyh", "simhei", "simsun"}
+)
+
+// 下载的字体存放的目录
+const fontDir = "fonts"
+
+var fontHttpClient = &http.Client{Timeout: 2 * time.Minute}
+
+type style int
+
+const (
+	styleRegular style = iota
+	styleBold
+	styleCode
+)
+
+type fontSet struct {
+	regular *sfnt.Font
+	bold    *sfnt.Font
+	mono    *sfnt.Font
+	cjk     *sfnt.Font // 没有找到中文字体时为nil
+}
+
+var (
+	fonts     *fontSet
+	fontsErr  error
+	fontsOnce sync.Once
+)
+
+// loadFonts 第一次渲染时加载字体 修改text2img_font后需要重启
+func loadFonts() (*fontSet, error) {
+	fontsOnce.Do(func() {
+		set := &fontSet{}
+		if set.regular, fontsErr = opentype.Parse(goregular.TTF); fontsErr != nil {
+			return
+		}
+		if set.bold, fontsErr = opentype.Parse(gobold.TTF); fontsErr != nil {
+			return
+		}
+		if set.mono, fontsErr = opentype.Parse(gomono.TTF); fontsErr != nil {
+			return
+		}
+		path := findFont()
+		if path == "" && config.GetText2imgFontURL() != "" {
+			var err error
+			if path, err = downloadFont(config.GetText2imgFontURL()); err != nil {
+				mylog.Printf("text2img下载字体失败: %v", err)
+			}
+		}
+		if path == "" {
+			mylog.Printf("text2img未找到中文字体,含有中文的文本不能转为图片,请在text2img_font中设置字体文件,或把字体放到运行目录的fonts文件夹,或设置text2img_font_url")
+		} else if f, err := parseFontFile(path); err != nil {
+			mylog.Printf("text2img加载字体%s失败: %v", path, err)
+		} else {
+			set.cjk = f
+			mylog.Printf("text2img使用字体 %s", path)
+		}
+		fonts = set
+	})
+	return fonts, fontsErr
+}
+
+// covers 内嵌的西文字体能显示text中所有的字
+func (set *fontSet) covers(text string) bool {
+	var buf sfnt.Buffer
+	for _, r := range text {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			continue
+		}
+		if i, err := set.regular.GlyphIndex(&buf, r); err != nil || i == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func findFont() string {
+	if path := config.GetText2imgFont(); path != "" {
+		return path
+	}
+	for _, pattern := range []string{"*.ttf", "*.ttc", "*.otf"} {
+		if matches, _ := filepath.Glob(filepath.Join(fontDir, pattern)); len(matches) > 0 {
+			return matches[0]
+		}
+	}
+	for _, path := range systemFonts {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	for _, dir := range fontDirs {
+		if path := scanFontDir(dir); path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// scanFontDir 在字体目录中查找文件名像中文字体的第一个字体
+func scanFontDir(dir string) string {
+	found := ""
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".ttf", ".ttc", ".otf":
+		default:
+			return nil
+		}
+		name := strings.ToLower(d.Name())
+		for _, key := range cjkFontNames {
+			if strings.Contains(name, key) {
+				found = path
+				return filepath.SkipAll
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+// downloadFont 下载字体到fonts文件夹 下载完整后才改为字体的文件名,避免留下不完整的字体
+func downloadFont(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Base(u.Path)
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ttf", ".ttc", ".otf":
+	default:
+		return "", fmt.Errorf("text2img_font_url must point to a ttf/otf/ttc file: %s", rawURL)
+	}
+	mylog.Printf("text2img正在下载字体 %s", rawURL)
+	resp, err := fontHttpClient.Get(rawURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download %s: %s", rawURL, resp.Status)
+	}
+	if err := os.MkdirAll(fontDir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(fontDir, name+".*.part")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(fontDir, name)
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+func parseFontFile(path string) (*sfnt.Font, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("ttcf")) || strings.EqualFold(filepath.Ext(path), ".ttc") {
+		collection, err := opentype.ParseCollection(data)
+		if err != nil {
+			return nil, err
+		}
+		return collection.Font(0)
+	}
+	return opentype.Parse(data)
+}
+
+// face 一种字体的一个字号 fakeBold为true时错开一像素重复绘制
+type face struct {
+	font.Face
+	fakeBold bool
+}
+
+// faceChain 按顺序查找有这个字的字体
+type faceChain struct {
+	faces []face
+	size  float64
+}
+
+type faceKey struct {
+	size  float64
+	style style
+}
+
+// faces 一次渲染中使用的字体 font.Face不能并发使用,每次渲染单独创建
+type faces struct {
+	set    *fontSet
+	chains map[faceKey]*faceChain
+}
+
+func newFaces(set *fontSet) *faces {
+	return &faces{set: set, chains: make(map[faceKey]*faceChain)}
+}
+
+func (f *faces) chain(size float64, st style) *faceChain {
+	key := faceKey{size, st}
+	if c, ok := f.chains[key]; ok {
+		return c
+	}
+	c := &faceChain{size: size}
+	add := func(sf *sfnt.Font, fakeBold bool) {
+		if sf == nil {
+			return
+		}
+		ff, err := opentype.NewFace(sf, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone})
+		if err != nil {
+			mylog.Printf("Error creating font face: %v", err)
+			return
+		}
+		c.faces = append(c.faces, face{Face: ff, fakeBold: fakeBold})
+	}
+	switch st {
+	case styleBold:
+		add(f.set.bold, false)
+		add(f.set.cjk, true)
+	case styleCode:
+		add(f.set.mono, false)
+		add(f.set.cjk, false)
+	default:
+		add(f.set.regular, false)
+		add(f.set.cjk, false)
+	}
+	f.chains[key] = c
+	return c
+}
+
+// pick 有这个字的字体 都没有时返回nil和方框的宽度
+func (c *faceChain) pick(r rune) (*face, fixed.Int26_6) {
+	for i := range c.faces {
+		if adv, ok := c.faces[i].GlyphAdvance(r); ok {
+			return &c.faces[i], adv
+		}
+	}
+	return nil, fixed.I(int(c.size*0.6 + 0.5))
+}
+
+func (c *faceChain) measure(s string) int {
+	var w fixed.Int26_6
+	for _, r := range s {
+		_, adv := c.pick(r)
+		w += adv
+	}
+	return w.Ceil()
+}
+
+// draw 在基线(x,y)处绘制文本
+func (c *faceChain) draw(dst draw.Image, x, y int, s string, col color.Color) {
+	src := image.NewUniform(col)
+	dot := fixed.P(x, y)
+	for _, r := range s {
+		f, adv := c.pick(r)
+		if f == nil {
+			drawBox(dst, dot.X.Round(), y, adv.Round(), int(c.size*0.7), col)
+		} else if r != ' ' {
+			dr, mask, maskp, _, ok := f.Glyph(dot, r)
+			if ok {
+				draw.DrawMask(dst, dr, src, image.Point{}, mask, maskp, draw.Over)
+				if f.fakeBold {
+					draw.DrawMask(dst, dr.Add(image.Pt(1, 0)), src, image.Point{}, mask, maskp, draw.Over)
+				}
+			}
+		}
+		dot.X += adv
+	}
+}
+
+// drawBox 缺字时画一个方框
+func drawBox(dst draw.Image, x, baseline, w, h int, col color.Color) {
+	if w < 4 || h < 4 {
+		return
+	}
+	r := image.Rect(x+1, baseline-h, x+w-1, baseline)
+	src := image.NewUniform(col)
+	draw.Draw(dst, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+1), src, image.Point{}, draw.Over)
+	draw.Draw(dst, image.Rect(r.Min.X, r.Max.Y-1, r.Max.X, r.Max.Y), src, image.Point{}, draw.Over)
+	draw.Draw(dst, image.Rect(r.Min.X, r.Min.Y, r.Min.X+1, r.Max.Y), src, image.Point{}, draw.Over)
+	draw.Draw(dst, image.Rect(r.Max.X-1, r.Min.Y, r.Max.X, r.Max.Y), src, image.Point{}, draw.Over)
+}
@@ -0,0 +1,64 @@
+package text2img
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestScanFontDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"dejavu/DejaVuSans.ttf", "noto/NotoSansCJK-Regular.ttc", "noto/readme.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := scanFontDir(dir); got != filepath.Join(dir, "noto/NotoSansCJK-Regular.ttc") {
+		t.Errorf("scanFontDir = %q", got)
+	}
+	if got := scanFontDir(filepath.Join(dir, "dejavu")); got != "" {
+		t.Errorf("scanFontDir picked a font without CJK glyphs: %q", got)
+	}
+}
+
+func TestDownloadFont(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/font.ttf" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(goregular.TTF)
+	}))
+	defer server.Close()
+	t.Chdir(t.TempDir())
+
+	path, err := downloadFont(server.URL + "/font.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(fontDir, "font.ttf") || findFont() != path {
+		t.Errorf("downloaded to %q, findFont %q", path, findFont())
+	}
+	if _, err := parseFontFile(path); err != nil {
+		t.Errorf("parse downloaded font: %v", err)
+	}
+
+	// 下载失败时不留下文件
+	if _, err := downloadFont(server.URL + "/missing.ttf"); err == nil {
+		t.Error("expected an error for a missing font")
+	}
+	if _, err := downloadFont(server.URL + "/font.zip"); err == nil {
+		t.Error("expected an error for a non-font url")
+	}
+	if entries, _ := os.ReadDir(fontDir); len(entries) != 1 {
+		t.Errorf("fonts folder has %d files, want 1", len(entries))
+	}
+}
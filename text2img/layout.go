@@ -0,0 +1,181 @@
+package text2img
+
+import (
+	"regexp"
+	"strings"
+)
+
+// 把文本或简单的markdown解析为块 支持标题 列表 引用 代码块 分割线 表格 行内粗体 代码 链接
+// 纯文本中连续多行用制表符分隔且列数相同时视为表格
+
+type blockKind int
+
+const (
+	blockParagraph blockKind = iota
+	blockBlank
+	blockHeading
+	blockList
+	blockQuote
+	blockCode
+	blockRule
+	blockTable
+)
+
+type span struct {
+	text  string
+	style style
+	link  bool
+}
+
+type block struct {
+	kind   blockKind
+	level  int    // 标题级别 列表缩进
+	marker string // 列表符号
+	spans  []span
+	lines  []string   // 代码块
+	rows   [][]string // 表格 第一行为表头
+}
+
+var (
+	headingRE  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	listRE     = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	quoteRE    = regexp.MustCompile(`^>\s?(.*)$`)
+	ruleRE     = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	tableSepRE = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+	inlineRE   = regexp.MustCompile("`([^`]+)`|\\*\\*([^*]+)\\*\\*|__([^_]+)__|!\\[([^\\]]*)\\]\\(([^)\\s]*)\\)|\\[([^\\]]*)\\]\\(([^)\\s]*)\\)")
+)
+
+func splitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	return strings.Split(strings.TrimRight(text, "\n"), "\n")
+}
+
+// parseMarkdown 解析简单的markdown 每一行单独成段,保留应用端输出中的换行
+func parseMarkdown(text string) []block {
+	lines := splitLines(strings.ReplaceAll(text, "\t", "    "))
+	var blocks []block
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			b := block{kind: blockCode}
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				b.lines = append(b.lines, lines[i])
+			}
+			blocks = append(blocks, b)
+		case trimmed == "":
+			blocks = append(blocks, block{kind: blockBlank})
+		case ruleRE.MatchString(line):
+			blocks = append(blocks, block{kind: blockRule})
+		case strings.HasPrefix(trimmed, "|") && i+1 < len(lines) && tableSepRE.MatchString(strings.TrimSpace(lines[i+1])):
+			b := block{kind: blockTable, rows: [][]string{pipeCells(trimmed)}}
+			for i += 2; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				b.rows = append(b.rows, pipeCells(strings.TrimSpace(lines[i])))
+			}
+			i--
+			blocks = append(blocks, b)
+		default:
+			if m := headingRE.FindStringSubmatch(trimmed); m != nil {
+				blocks = append(blocks, block{kind: blockHeading, level: len(m[1]), spans: parseInline(m[2], styleBold)})
+			} else if m := listRE.FindStringSubmatch(line); m != nil {
+				marker := m[2]
+				if marker == "-" || marker == "*" || marker == "+" {
+					marker = "•"
+				}
+				blocks = append(blocks, block{kind: blockList, level: len(m[1]) / 2, marker: marker, spans: parseInline(m[3], styleRegular)})
+			} else if m := quoteRE.FindStringSubmatch(trimmed); m != nil {
+				blocks = append(blocks, block{kind: blockQuote, spans: parseInline(m[1], styleRegular)})
+			} else {
+				blocks = append(blocks, block{kind: blockParagraph, spans: parseInline(line, styleRegular)})
+			}
+		}
+	}
+	return blocks
+}
+
+// parseText 纯文本 不解析markdown
+func parseText(text string) []block {
+	lines := splitLines(text)
+	var blocks []block
+	for i := 0; i < len(lines); i++ {
+		if n := tabColumns(lines[i]); n > 1 {
+			j := i + 1
+			for j < len(lines) && tabColumns(lines[j]) == n {
+				j++
+			}
+			if j-i > 1 {
+				b := block{kind: blockTable}
+				for _, line := range lines[i:j] {
+					b.rows = append(b.rows, strings.Split(line, "\t"))
+				}
+				blocks = append(blocks, b)
+				i = j - 1
+				continue
+			}
+		}
+		line := strings.ReplaceAll(lines[i], "\t", "    ")
+		if strings.TrimSpace(line) == "" {
+			blocks = append(blocks, block{kind: blockBlank})
+			continue
+		}
+		blocks = append(blocks, block{kind: blockParagraph, spans: []span{{text: line}}})
+	}
+	return blocks
+}
+
+func tabColumns(line string) int {
+	if !strings.Contains(line, "\t") {
+		return 0
+	}
+	return strings.Count(line, "\t") + 1
+}
+
+func pipeCells(line string) []string {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+	cells := strings.Split(line, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// parseInline 行内的`代码` **粗体** 链接与图片 链接保留地址
+func parseInline(s string, base style) []span {
+	var spans []span
+	last := 0
+	for _, m := range inlineRE.FindAllStringSubmatchIndex(s, -1) {
+		if m[0] > last {
+			spans = append(spans, span{text: s[last:m[0]], style: base})
+		}
+		group := func(n int) string {
+			if m[2*n] < 0 {
+				return ""
+			}
+			return s[m[2*n]:m[2*n+1]]
+		}
+		switch {
+		case m[2] >= 0:
+			spans = append(spans, span{text: group(1), style: styleCode})
+		case m[4] >= 0:
+			spans = append(spans, span{text: group(2), style: styleBold})
+		case m[6] >= 0:
+			spans = append(spans, span{text: group(3), style: styleBold})
+		case m[8] >= 0:
+			spans = append(spans, span{text: "[图片]" + group(4), style: base, link: true})
+		default:
+			label, link := group(6), group(7)
+			text := label
+			if link != "" && link != label {
+				text = label + " (" + link + ")"
+			}
+			spans = append(spans, span{text: text, style: base, link: true})
+		}
+		last = m[1]
+	}
+	if last < len(s) {
+		spans = append(spans, span{text: s[last:], style: base})
+	}
+	return spans
+}
@@ -0,0 +1,409 @@
+package text2img
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+	"unicode"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+)
+
+// 图片最大高度 超出的内容省略
+const maxHeight = 16000
+
+var (
+	colorBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	colorText       = color.RGBA{0x24, 0x29, 0x2f, 0xff}
+	colorMuted      = color.RGBA{0x57, 0x60, 0x6a, 0xff}
+	colorLink       = color.RGBA{0x09, 0x69, 0xda, 0xff}
+	colorCodeBg     = color.RGBA{0xf6, 0xf8, 0xfa, 0xff}
+	colorBorder     = color.RGBA{0xd0, 0xd7, 0xde, 0xff}
+)
+
+// 标题相对正文的字号
+var headingScale = []float64{1, 1.6, 1.4, 1.25, 1.1, 1, 1}
+
+// Options 渲染参数 为零值时使用配置
+type Options struct {
+	Width    int     // 图片宽度 像素
+	FontSize float64 // 正文字号 像素
+	Markdown bool    // 按简单markdown排版 否则为纯文本
+}
+
+type textOp struct {
+	x, y  int // 基线位置
+	text  string
+	chain *faceChain
+	color color.Color
+}
+
+type rectOp struct {
+	rect  image.Rectangle
+	color color.Color
+}
+
+type renderer struct {
+	faces *faces
+	size  float64
+	width int
+	pad   int
+	texts []textOp
+	rects []rectOp
+	full  bool // 超过最大高度
+}
+
+// ErrNoCJKFont 没有加载中文字体,文本中有内嵌字体不能显示的字
+var ErrNoCJKFont = errors.New("text2img: no CJK font available, set text2img_font or text2img_font_url, or put a ttf/otf/ttc font into the fonts folder next to gensokyo")
+
+// Render 渲染为png
+func Render(text string, opts Options) ([]byte, error) {
+	set, err := loadFonts()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Width <= 0 {
+		opts.Width = config.GetText2imgWidth()
+	}
+	if opts.FontSize <= 0 {
+		opts.FontSize = float64(config.GetText2imgFontSize())
+	}
+	return render(set, text, opts)
+}
+
+// render 用指定的字体渲染 缺字时不画方框,直接返回ErrNoCJKFont
+func render(set *fontSet, text string, opts Options) ([]byte, error) {
+	blocks := parseText(text)
+	if opts.Markdown {
+		blocks = parseMarkdown(text)
+	}
+	if set.cjk == nil && !set.covers(blocksText(blocks)) {
+		return nil, ErrNoCJKFont
+	}
+	r := &renderer{
+		faces: newFaces(set),
+		size:  opts.FontSize,
+		width: opts.Width,
+		pad:   int(opts.FontSize),
+	}
+	height := r.layout(blocks)
+
+	img := image.NewRGBA(image.Rect(0, 0, r.width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(colorBackground), image.Point{}, draw.Src)
+	for _, op := range r.rects {
+		draw.Draw(img, op.rect, image.NewUniform(op.color), image.Point{}, draw.Over)
+	}
+	for _, op := range r.texts {
+		op.chain.draw(img, op.x, op.y, op.text, op.color)
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderBase64 渲染为base64编码的png 用于[CQ:image,file=base64://]
+func RenderBase64(text string, opts Options) (string, error) {
+	data, err := Render(text, opts)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// blocksText 排版后要绘制的全部文字
+func blocksText(blocks []block) string {
+	var sb strings.Builder
+	for _, b := range blocks {
+		sb.WriteString(b.marker)
+		for _, s := range b.spans {
+			sb.WriteString(s.text)
+		}
+		for _, line := range b.lines {
+			sb.WriteString(line)
+		}
+		for _, row := range b.rows {
+			for _, cell := range row {
+				for _, s := range parseInline(cell, styleRegular) {
+					sb.WriteString(s.text)
+				}
+			}
+		}
+	}
+	return sb.String()
+}
+
+func (r *renderer) lineHeight(size float64) int {
+	return int(size*1.6 + 0.5)
+}
+
+// layout 排版所有块 返回图片高度
+func (r *renderer) layout(blocks []block) int {
+	y := r.pad
+	left, right := r.pad, r.width-r.pad
+	for i, b := range blocks {
+		if y > maxHeight {
+			r.full = true
+			break
+		}
+		switch b.kind {
+		case blockBlank:
+			y += r.lineHeight(r.size) / 2
+		case blockParagraph:
+			y = r.flow(b.spans, left, right, y, r.size, colorText)
+		case blockHeading:
+			size := r.size * headingScale[b.level]
+			if i > 0 {
+				y += int(r.size / 2)
+			}
+			y = r.flow(b.spans, left, right, y, size, colorText)
+			if b.level <= 2 {
+				r.rects = append(r.rects, rectOp{image.Rect(left, y+2, right, y+3), colorBorder})
+				y += int(r.size / 2)
+			}
+		case blockList:
+			indent := left + b.level*int(r.size*1.5)
+			marker := b.marker
+			chain := r.faces.chain(r.size, styleRegular)
+			r.texts = append(r.texts, textOp{indent, y + r.baseline(r.size), marker, chain, colorMuted})
+			y = r.flow(b.spans, indent+chain.measure(marker)+int(r.size/2), right, y, r.size, colorText)
+		case blockQuote:
+			top := y
+			y = r.flow(b.spans, left+int(r.size), right, y, r.size, colorMuted)
+			r.rects = append(r.rects, rectOp{image.Rect(left, top, left+4, y), colorBorder})
+		case blockRule:
+			y += r.lineHeight(r.size) / 2
+			r.rects = append(r.rects, rectOp{image.Rect(left, y, right, y+2), colorBorder})
+			y += r.lineHeight(r.size) / 2
+		case blockCode:
+			top := y
+			y += r.pad / 2
+			for _, line := range b.lines {
+				y = r.flow([]span{{text: line, style: styleCode}}, left+r.pad/2, right-r.pad/2, y, r.size*0.9, colorText)
+			}
+			y += r.pad / 2
+			r.rects = append(r.rects, rectOp{image.Rect(left, top, right, y), colorCodeBg})
+			y += r.pad / 2
+		case blockTable:
+			y = r.table(b.rows, left, right, y) + r.pad/2
+		}
+	}
+	if r.full {
+		chain := r.faces.chain(r.size, styleRegular)
+		notice := "……(内容过长,已省略)"
+		if r.faces.set.cjk == nil {
+			notice = "... (truncated)"
+		}
+		r.texts = append(r.texts, textOp{left, y + r.baseline(r.size), notice, chain, colorMuted})
+		y += r.lineHeight(r.size)
+	}
+	return y + r.pad
+}
+
+func (r *renderer) baseline(size float64) int {
+	return int(size*1.2 + 0.5)
+}
+
+// flow 在left和right之间排版一段文本并自动换行 返回排完后的高度
+// 中日韩文字可以在任意处换行,西文按单词换行,过长的单词按字符拆开
+func (r *renderer) flow(spans []span, left, right, y int, size float64, base color.Color) int {
+	lh := r.lineHeight(size)
+	bl := r.baseline(size)
+	x := left
+	// 自动换行后行首的空格不绘制 原文行首的缩进保留
+	lineStart, wrapped := true, false
+	for _, s := range spans {
+		chain := r.faces.chain(size, s.style)
+		col := base
+		if s.link {
+			col = colorLink
+		}
+		for _, word := range words(s.text) {
+			w := chain.measure(word)
+			if word == " " && lineStart && wrapped {
+				continue
+			}
+			if x+w > right && !lineStart {
+				y += lh
+				x = left
+				lineStart, wrapped = true, true
+				if word == " " {
+					continue
+				}
+			}
+			if x+w > right {
+				// 整行都放不下的单词按字符拆开
+				for _, ch := range word {
+					cw := chain.measure(string(ch))
+					if x+cw > right && !lineStart {
+						y += lh
+						x = left
+						wrapped = true
+					}
+					r.addText(s, x, y+bl, string(ch), chain, col, cw, lh)
+					x += cw
+					lineStart = false
+				}
+				continue
+			}
+			r.addText(s, x, y+bl, word, chain, col, w, lh)
+			x += w
+			lineStart = false
+		}
+	}
+	return y + lh
+}
+
+func (r *renderer) addText(s span, x, baseline int, text string, chain *faceChain, col color.Color, w, lh int) {
+	if s.style == styleCode && text != " " {
+		top := baseline - r.baseline(chain.size) + (lh-int(chain.size*1.4))/2
+		r.rects = append(r.rects, rectOp{image.Rect(x, top, x+w, top+int(chain.size*1.4)), colorCodeBg})
+	}
+	r.texts = append(r.texts, textOp{x, baseline, text, chain, col})
+}
+
+// words 按换行单位拆分 中日韩文字逐字,空格单独一个,其余连续的字符为一个单词
+func words(s string) []string {
+	var list []string
+	start := -1
+	for i, ch := range s {
+		if ch == ' ' || isWide(ch) {
+			if start >= 0 {
+				list = append(list, s[start:i])
+				start = -1
+			}
+			list = append(list, string(ch))
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		list = append(list, s[start:])
+	}
+	return list
+}
+
+func isWide(ch rune) bool {
+	return unicode.In(ch, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(ch >= 0x3000 && ch <= 0x303f) || (ch >= 0xff00 && ch <= 0xffef)
+}
+
+// table 排版表格 列宽按内容分配,放不下时按比例缩小并在单元格内换行
+func (r *renderer) table(rows [][]string, left, right, y int) int {
+	cols := 0
+	for _, row := range rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	if cols == 0 {
+		return y
+	}
+	cellPad := int(r.size / 2)
+	natural := make([]int, cols)
+	for i, row := range rows {
+		st := styleRegular
+		if i == 0 {
+			st = styleBold
+		}
+		for j, cell := range row {
+			// 与flow一样逐词测量 避免取整误差导致换行
+			w := 2 * cellPad
+			for _, s := range parseInline(cell, st) {
+				chain := r.faces.chain(r.size, s.style)
+				for _, word := range words(s.text) {
+					w += chain.measure(word)
+				}
+			}
+			if w > natural[j] {
+				natural[j] = w
+			}
+		}
+	}
+	widths := columnWidths(natural, right-left, int(r.size*3))
+
+	border := func(rect image.Rectangle) {
+		r.rects = append(r.rects, rectOp{rect, colorBorder})
+	}
+	tableRight := left
+	for _, w := range widths {
+		tableRight += w
+	}
+	for i, row := range rows {
+		top := y
+		st := styleRegular
+		if i == 0 {
+			st = styleBold
+		}
+		bottom := y
+		x := left
+		for j := 0; j < cols; j++ {
+			cell := ""
+			if j < len(row) {
+				cell = row[j]
+			}
+			end := r.flow(parseInline(cell, st), x+cellPad, x+widths[j]-cellPad, y+cellPad/2, r.size, colorText)
+			if end > bottom {
+				bottom = end
+			}
+			x += widths[j]
+		}
+		bottom += cellPad / 2
+		if i == 0 {
+			r.rects = append(r.rects, rectOp{image.Rect(left, top, tableRight, bottom), colorCodeBg})
+		}
+		border(image.Rect(left, top, tableRight, top+1))
+		x = left
+		for _, w := range widths {
+			border(image.Rect(x, top, x+1, bottom))
+			x += w
+		}
+		border(image.Rect(tableRight-1, top, tableRight, bottom))
+		y = bottom
+	}
+	border(image.Rect(left, y-1, tableRight, y))
+	return y
+}
+
+// columnWidths 总宽度放得下时用内容宽度,否则较宽的列按比例缩小 每列不小于min
+func columnWidths(natural []int, total, min int) []int {
+	widths := make([]int, len(natural))
+	sum := 0
+	for _, w := range natural {
+		sum += w
+	}
+	if sum <= total {
+		copy(widths, natural)
+		return widths
+	}
+	// 不超过平均宽度的列保持原样,其余按内容宽度分配剩下的空间
+	fair := total / len(natural)
+	rest, wide := total, 0
+	for i, w := range natural {
+		if w <= fair {
+			widths[i] = w
+			rest -= w
+		} else {
+			wide += w
+		}
+	}
+	for i, w := range natural {
+		if w > fair {
+			widths[i] = w * rest / wide
+		}
+		if widths[i] < min {
+			widths[i] = min
+		}
+	}
+	return widths
+}
@@ -0,0 +1,127 @@
+package text2img
+
+import (
+	"bytes"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+// testFontSet 只有内嵌西文字体的字体 与找不到中文字体时一致
+func testFontSet(t *testing.T) *fontSet {
+	t.Helper()
+	set := &fontSet{}
+	var err error
+	if set.regular, err = opentype.Parse(goregular.TTF); err != nil {
+		t.Fatal(err)
+	}
+	if set.bold, err = opentype.Parse(gobold.TTF); err != nil {
+		t.Fatal(err)
+	}
+	if set.mono, err = opentype.Parse(gomono.TTF); err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestWords(t *testing.T) {
+	got := words("hello 世界ok  end")
+	want := []string{"hello", " ", "世", "界", "ok", " ", " ", "end"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("words = %q, want %q", got, want)
+	}
+}
+
+func TestColumnWidths(t *testing.T) {
+	if got := columnWidths([]int{100, 200}, 400, 30); !reflect.DeepEqual(got, []int{100, 200}) {
+		t.Fatalf("fitting widths = %v", got)
+	}
+	// 窄列保持原样 宽列按内容比例分配剩余空间
+	got := columnWidths([]int{50, 600, 300}, 500, 30)
+	if got[0] != 50 || got[1] != 600*450/900 || got[2] != 300*450/900 {
+		t.Fatalf("shrunk widths = %v", got)
+	}
+	// 不小于最小宽度
+	if got := columnWidths([]int{1000, 1000, 10000}, 300, 80); got[0] < 80 || got[1] < 80 {
+		t.Fatalf("min widths = %v", got)
+	}
+}
+
+func TestParseMarkdown(t *testing.T) {
+	text := "# 标题\n\n- item\n  2. sub\n> quote\n---\n```\ncode line\n```\n| a | b |\n|---|:-:|\n| 1 | **2** |\ntext `x` [link](http://a.b)"
+	blocks := parseMarkdown(text)
+	kinds := make([]blockKind, len(blocks))
+	for i, b := range blocks {
+		kinds[i] = b.kind
+	}
+	want := []blockKind{blockHeading, blockBlank, blockList, blockList, blockQuote, blockRule, blockCode, blockTable, blockParagraph}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("kinds = %v, want %v", kinds, want)
+	}
+	if blocks[2].marker != "•" || blocks[3].marker != "2." || blocks[3].level != 1 {
+		t.Fatalf("list blocks = %+v %+v", blocks[2], blocks[3])
+	}
+	if !reflect.DeepEqual(blocks[7].rows, [][]string{{"a", "b"}, {"1", "**2**"}}) {
+		t.Fatalf("table rows = %q", blocks[7].rows)
+	}
+	spans := blocks[8].spans
+	if len(spans) != 4 || spans[1].style != styleCode || !spans[3].link || spans[3].text != "link (http://a.b)" {
+		t.Fatalf("inline spans = %+v", spans)
+	}
+}
+
+func TestParseTextTable(t *testing.T) {
+	blocks := parseText("a\tb\n1\t2\nplain\tline\textra\n\nend")
+	if len(blocks) != 4 || blocks[0].kind != blockTable || len(blocks[0].rows) != 2 {
+		t.Fatalf("blocks = %+v", blocks)
+	}
+	// 列数不同的单独一行不是表格
+	if blocks[1].kind != blockParagraph || blocks[2].kind != blockBlank {
+		t.Fatalf("blocks = %+v", blocks)
+	}
+}
+
+func TestFlowWraps(t *testing.T) {
+	r := &renderer{faces: newFaces(testFontSet(t)), size: 20, width: 200, pad: 20}
+	left, right := 20, 180
+	end := r.flow([]span{{text: "the quick brown fox jumps over the lazy dog " + strings.Repeat("x", 40)}}, left, right, 0, 20, colorText)
+	if lines := end / r.lineHeight(20); lines < 3 {
+		t.Fatalf("text wrapped into %d lines", lines)
+	}
+	for _, op := range r.texts {
+		if op.x < left || op.x+op.chain.measure(op.text) > right {
+			t.Fatalf("%q at %d overflows [%d, %d]", op.text, op.x, left, right)
+		}
+		if op.text == " " && op.x == left {
+			t.Fatal("wrapped line starts with a space")
+		}
+	}
+}
+
+func TestRenderWithoutCJKFont(t *testing.T) {
+	set := testFontSet(t)
+	opts := Options{Width: 320, FontSize: 16, Markdown: true}
+	for _, text := range []string{"中文", "![alt](http://a.b/c.png)"} {
+		if _, err := render(set, text, opts); err != ErrNoCJKFont {
+			t.Fatalf("render(%q): err = %v, want %v", text, err, ErrNoCJKFont)
+		}
+	}
+
+	data, err := render(set, "# Title\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n- item • x", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 320 || img.Bounds().Dy() <= 16 {
+		t.Fatalf("image size = %v", img.Bounds())
+	}
+}
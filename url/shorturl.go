@@ -1,7 +1,6 @@
 package url
 
 import (
-	"crypto/md5"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
@@ -15,12 +14,15 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/gensokyo/backup"
 	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/lotus"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
 	"go.etcd.io/bbolt"
 )
 
 const (
+	DBName     = "gensokyo.db"
 	bucketName = "shortURLs"
 )
 
@@ -45,13 +47,14 @@ func generateHashedString(url string) string {
 	return hex.EncodeToString(hash[:3]) // 取前3个字节，得到6个字符的16进制表示
 }
 
-// 这里的数据库是在init创建的
-func init() {
+// InitializeDB 打开短链接数据库 需要在恢复待恢复的备份之后调用
+func InitializeDB() {
 	var err error
-	db, err = bbolt.Open("gensokyo.db", 0600, nil)
+	db, err = bbolt.Open(DBName, 0600, nil)
 	if err != nil {
 		panic(err)
 	}
+	backup.Register(DBName, db)
 
 	// Ensure bucket exists
 	err = db.Update(func(tx *bbolt.Tx) error {
@@ -126,7 +129,7 @@ func GenerateShortURL(longURL string) string {
 	// 根据portValue确定协议
 	protocol := "http"
 	portValue := config.GetPortValue()
-	if portValue == "443" ||config.GetForceSsl(){
+	if portValue == "443" || config.GetForceSsl() {
 		protocol = "https"
 	}
 
@@ -136,30 +139,12 @@ func GenerateShortURL(longURL string) string {
 		// 使用 url.Values 构造请求数据
 		formData := url.Values{}
 		formData.Set("url", longURL)
-		// 获取密码
-		password := config.GetLotusPassword()
-		// 如果密码不为空，则计算 MD5 值并添加 token
-		if password != "" {
-			hasher := md5.New()
-			hasher.Write([]byte(password))
-			token := hex.EncodeToString(hasher.Sum(nil))
-			// 添加 token
+		// 兼容未升级的主gsk
+		if token := lotus.LegacyToken(); token != "" {
 			formData.Set("token", token)
 		}
-
-		// 创建请求
-		req, err := http.NewRequest("POST", requestURL, strings.NewReader(formData.Encode()))
-		if err != nil {
-			mylog.Printf("Error creating new request: %v", err)
-			return ""
-		}
-
-		// 设置Content-Type为表单形式
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-		// 发送请求
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		// 使用lotus凭据签名请求
+		resp, err := lotus.PostForm(requestURL, formData)
 		if err != nil {
 			mylog.Printf("Error while generating short URL: %v", err)
 			return ""
@@ -169,7 +154,7 @@ func GenerateShortURL(longURL string) string {
 		// 处理响应
 		if resp.StatusCode != http.StatusOK {
 			mylog.Printf("Received non-200 status code: %d from server: %v", resp.StatusCode, requestURL)
-			mylog.Printf("返回码400请检查lotus密码是否正确!")
+			mylog.Printf("返回码401请检查lotus凭据是否正确!")
 			return ""
 		}
 
@@ -242,7 +227,7 @@ func getLongURLFromDB(shortURL string) (string, error) {
 	// 根据portValue确定协议
 	protocol := "http"
 	portValue := config.GetPortValue()
-	if portValue == "443" ||config.GetForceSsl(){
+	if portValue == "443" || config.GetForceSsl() {
 		protocol = "https"
 	}
 
@@ -250,7 +235,7 @@ func getLongURLFromDB(shortURL string) (string, error) {
 		serverDir := config.GetServer_dir()
 		url := fmt.Sprintf("%s://%s:%s/url/%s", protocol, serverDir, portValue, shortURL)
 
-		resp, err := http.Get(url)
+		resp, err := lotus.Get(url)
 		if err != nil {
 			return "", err
 		}
@@ -317,13 +302,12 @@ func isMalicious(decoded string) bool {
 // 短链接服务handler
 func CreateShortURLHandler(c *gin.Context) {
 	rawURL := c.PostForm("url")
-	token := c.PostForm("token") // 接收 token 参数
 
 	longURL := decodeBase64IfNeeded(rawURL)
 
-	// 检查 URL 是否有效，以及在密码不为空时检查 token
-	if longURL == "" || isMalicious(longURL) || !isValidURL(longURL) || (config.GetLotusPassword() != "" && !isValidToken(token)) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL or token"})
+	// 检查 URL 是否有效，lotus凭据由LotusAuth中间件校验
+	if longURL == "" || isMalicious(longURL) || !isValidURL(longURL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL"})
 		return
 	}
 
@@ -337,24 +321,6 @@ func CreateShortURLHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"shortURL": baseUrl + "/url/" + shortURL})
 }
 
-// isValidToken 检查 token 是否有效
-func isValidToken(token string) bool {
-	// 从配置中获取密码
-	password := config.GetLotusPassword()
-
-	// 如果密码为空，直接返回 true
-	if password == "" {
-		return true
-	}
-
-	// 计算 MD5
-	hasher := md5.New()
-	hasher.Write([]byte(password))
-	md5Password := hex.EncodeToString(hasher.Sum(nil))
-
-	return md5Password == token
-}
-
 // 短链接baseurl
 func GetBaseURL() string {
 	serverDir := config.GetServer_dir()
@@ -382,5 +348,6 @@ func RedirectFromShortURLHandler(c *gin.Context) {
 }
 
 func CloseDB() {
+	backup.Unregister(DBName)
 	db.Close()
 }
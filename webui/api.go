@@ -129,6 +129,31 @@ func CombinedMiddleware(api openapi.OpenAPI, apiV2 openapi.OpenAPI) gin.HandlerF
 				}
 				return
 			}
+			//lotus从gsk凭据管理
+			if c.Param("filepath") == "/api/"+appIDStr+"/lotus/secondaries" {
+				handleLotusSecondaries(c)
+				return
+			}
+			//角色管理
+			if c.Param("filepath") == "/api/"+appIDStr+"/roles" {
+				handleRoles(c)
+				return
+			}
+			//idmap管理
+			if strings.HasPrefix(c.Param("filepath"), "/api/"+appIDStr+"/idmap/") {
+				handleIdmap(c, strings.TrimPrefix(c.Param("filepath"), "/api/"+appIDStr+"/idmap/"))
+				return
+			}
+			//数据库备份
+			if strings.HasPrefix(c.Param("filepath"), "/api/"+appIDStr+"/backup/") {
+				handleBackup(c, strings.TrimPrefix(c.Param("filepath"), "/api/"+appIDStr+"/backup/"))
+				return
+			}
+			//md模板与预览
+			if strings.HasPrefix(c.Param("filepath"), "/api/"+appIDStr+"/markdown/") {
+				handleMarkdown(c, strings.TrimPrefix(c.Param("filepath"), "/api/"+appIDStr+"/markdown/"))
+				return
+			}
 			// 如果还有其他API端点，可以在这里继续添加...
 		} else {
 			// 否则，处理静态文件请求
@@ -0,0 +1,61 @@
+package webui
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/gensokyo/backup"
+)
+
+// handleBackup 列出、创建、校验数据库备份,恢复在下次启动时生效,需要登录
+func handleBackup(c *gin.Context, action string) {
+	if !isLoggedIn(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not logged in"})
+		return
+	}
+
+	switch {
+	case action == "list" && c.Request.Method == http.MethodGet:
+		manifests, err := backup.List()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		pending, _ := os.ReadFile(backup.PendingFile)
+		c.JSON(http.StatusOK, gin.H{"dir": backup.Dir(), "backups": manifests, "pending": string(pending)})
+	case action == "create" && c.Request.Method == http.MethodPost:
+		manifest, err := backup.Snapshot()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, manifest)
+	case action == "verify" && c.Request.Method == http.MethodGet:
+		manifest, err := backup.Verify(c.Query("name"))
+		if errors.Is(err, backup.ErrSnapshotNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true, "files": manifest.Files})
+	case action == "restore" && c.Request.Method == http.MethodPost:
+		if err := backup.ScheduleRestore(c.Query("name")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "重启gensokyo后恢复"})
+	case action == "restore" && c.Request.Method == http.MethodDelete:
+		if err := os.Remove(backup.PendingFile); err != nil && !os.IsNotExist(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	default:
+		c.Status(http.StatusMethodNotAllowed)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hoshinonyaruko/gensokyo/backup"
 	"go.etcd.io/bbolt"
 )
 
@@ -27,6 +28,7 @@ func InitializeDB() {
 	if err != nil {
 		log.Fatalf("Error opening DB: %v", err)
 	}
+	backup.Register(DBName, db)
 
 	db.Update(func(tx *bbolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists([]byte(CookieBucket))
@@ -35,6 +37,7 @@ func InitializeDB() {
 }
 
 func CloseDB() {
+	backup.Unregister(DBName)
 	db.Close()
 }
 
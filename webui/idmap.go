@@ -0,0 +1,125 @@
+package webui
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+)
+
+// handleIdmap 搜索、修改、检查和导入导出id映射,需要登录
+func handleIdmap(c *gin.Context, action string) {
+	if !isLoggedIn(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not logged in"})
+		return
+	}
+
+	switch {
+	case action == "search" && c.Request.Method == http.MethodGet:
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "200"))
+		q := strings.TrimSpace(c.Query("q"))
+		// 优先返回精确匹配
+		exact, err := idmap.LookupMapping(q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		list, err := idmap.ListMappings(q, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"exact": exact, "mappings": list})
+	case action == "subkeys" && c.Request.Method == http.MethodGet:
+		keys, err := idmap.FindSubKeysByIdPro(c.Query("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": c.Query("id"), "keys": keys})
+	case action == "rebind" && c.Request.Method == http.MethodPost:
+		var req struct {
+			Old     int64 `json:"old"`
+			New     int64 `json:"new"`
+			OldUser int64 `json:"old_user"`
+			NewUser int64 `json:"new_user"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		var err error
+		if req.OldUser != 0 || req.NewUser != 0 {
+			err = idmap.RebindVirtualValuePro(req.Old, req.New, req.OldUser, req.NewUser)
+		} else {
+			err = idmap.RebindVirtualValue(req.Old, req.New)
+		}
+		if errors.Is(err, idmap.ErrMappingConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, req)
+	case action == "orphans" && c.Request.Method == http.MethodGet:
+		orphans, err := idmap.FindOrphans()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"orphans": orphans})
+	case action == "orphans" && c.Request.Method == http.MethodDelete:
+		removed, kept, err := idmap.RemoveOrphans()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"removed": removed, "kept": kept})
+	case action == "export" && c.Request.Method == http.MethodGet:
+		format := c.DefaultQuery("format", "json")
+		contentType := "application/json"
+		if format == "csv" {
+			contentType = "text/csv"
+		}
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=idmap.%s", format))
+		if err := idmap.ExportMappings(c.Writer, format); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+		}
+	case action == "import" && c.Request.Method == http.MethodPost:
+		imported, conflicts, err := idmap.ImportMappings(c.Request.Body, c.DefaultQuery("format", "json"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"imported": imported, "conflicts": conflicts})
+	case action == "collisions" && c.Request.Method == http.MethodGet:
+		recorded, err := idmap.ListHashCollisions()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		scanned, nonHash, err := idmap.ScanHashCollisions()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recorded": recorded, "scanned": scanned, "non_hash": nonHash})
+	case action == "migrate" && c.Request.Method == http.MethodPost:
+		// 默认只预览 apply=true时写入
+		report, err := idmap.MigrateIDs(c.Query("target"), c.Query("apply") == "true")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	default:
+		c.Status(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,71 @@
+package webui
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/gensokyo/lotus"
+)
+
+// handleLotusSecondaries 列出、签发、吊销和删除从gsk凭据,需要登录
+func handleLotusSecondaries(c *gin.Context) {
+	if !isLoggedIn(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not logged in"})
+		return
+	}
+
+	switch c.Request.Method {
+	case http.MethodGet:
+		list, err := lotus.ListSecondaries()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"secondaries": list})
+	case http.MethodPost:
+		var req struct {
+			ID string `json:"id"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		s, err := lotus.CreateSecondary(req.ID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// 密钥只在签发时返回一次,填入从gsk的lotus_id和lotus_secret
+		c.JSON(http.StatusOK, s)
+	case http.MethodPut:
+		revoked, err := strconv.ParseBool(c.Query("revoked"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revoked"})
+			return
+		}
+		if err := lotus.SetRevoked(c.Query("id"), revoked); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": c.Query("id"), "revoked": revoked})
+	case http.MethodDelete:
+		if err := lotus.DeleteSecondary(c.Query("id")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": c.Query("id")})
+	default:
+		c.Status(http.StatusMethodNotAllowed)
+	}
+}
+
+// isLoggedIn 检查webui登录cookie
+func isLoggedIn(c *gin.Context) bool {
+	cookieValue, err := c.Cookie("login_cookie")
+	if err != nil {
+		return false
+	}
+	isValid, err := ValidateCookie(cookieValue)
+	return err == nil && isValid
+}
@@ -0,0 +1,74 @@
+package webui
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/gensokyo/markdown"
+	"github.com/hoshinonyaruko/gensokyo/structs"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// handleMarkdown 管理具名md模板并预览md,需要登录
+func handleMarkdown(c *gin.Context, action string) {
+	if !isLoggedIn(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not logged in"})
+		return
+	}
+
+	switch {
+	case action == "templates" && c.Request.Method == http.MethodGet:
+		list, err := markdown.List()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"templates": list})
+	case action == "templates" && c.Request.Method == http.MethodPost:
+		var t structs.MarkdownTemplate
+		if err := c.ShouldBindJSON(&t); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		if err := markdown.Save(t); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "problems": markdown.Problems(err)})
+			return
+		}
+		c.JSON(http.StatusOK, t)
+	case action == "templates" && c.Request.Method == http.MethodDelete:
+		err := markdown.Delete(c.Query("name"))
+		if errors.Is(err, markdown.ErrUnknownTemplate) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"name": c.Query("name")})
+	case action == "preview" && c.Request.Method == http.MethodPost:
+		// 与[CQ:markdown]的data相同 template+vars使用具名模板,markdown为直接给出的md
+		var req struct {
+			Template string                 `json:"template"`
+			Vars     map[string]interface{} `json:"vars"`
+			Markdown *dto.Markdown          `json:"markdown"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		md := req.Markdown
+		if req.Template != "" {
+			var err error
+			md, _, err = markdown.Build(req.Template, req.Vars)
+			if err != nil {
+				c.JSON(http.StatusOK, markdown.PreviewResult{Problems: markdown.Problems(err)})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, markdown.Preview(md))
+	default:
+		c.Status(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,53 @@
+package webui
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+)
+
+// handleRoles 列出、分配和移除角色,需要登录 scope为global或群/频道id
+func handleRoles(c *gin.Context) {
+	if !isLoggedIn(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not logged in"})
+		return
+	}
+
+	switch c.Request.Method {
+	case http.MethodGet:
+		list, err := idmap.ListRoles(c.Query("scope"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"roles": list})
+	case http.MethodPost:
+		var req struct {
+			Scope  string `json:"scope"`
+			UserID string `json:"user_id"`
+			Role   string `json:"role"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		if req.Scope == "" {
+			req.Scope = idmap.RoleScopeGlobal
+		}
+		entry, err := idmap.SetRole(req.Scope, req.UserID, req.Role)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, entry)
+	case http.MethodDelete:
+		if err := idmap.RemoveRole(c.Query("scope"), c.Query("user_id")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"scope": c.Query("scope"), "user_id": c.Query("user_id")})
+	default:
+		c.Status(http.StatusMethodNotAllowed)
+	}
+}
@@ -87,6 +87,7 @@ func (client *WebSocketClient) handleIncomingMessages(cancel context.CancelFunc)
 		_, msg, err := client.conn.ReadMessage()
 		if err != nil {
 			mylog.Println("WebSocket connection closed:", err)
+			botstats.RecordReverseWsDisconnected()
 			cancel() // 取消心跳 goroutine
 			if !client.isReconnecting {
 				go client.Reconnect()
@@ -157,6 +158,7 @@ func (client *WebSocketClient) Reconnect() {
 	}
 	// 复用现有的client完成重连
 	client.conn = conn
+	botstats.RecordReverseWsConnected()
 
 	// 再次发送元事件
 	message := map[string]interface{}{
@@ -244,34 +246,13 @@ func (client *WebSocketClient) sendHeartbeat(ctx context.Context, botID uint64,
 		case <-ctx.Done():
 			return
 		case <-time.After(time.Duration(heartbeatinterval) * time.Second):
-			messageReceived, messageSent, lastMessageTime, err := botstats.GetStats()
-			if err != nil {
-				mylog.Printf("心跳错误,获取机器人发信状态错误:%v", err)
-			}
 			message := map[string]interface{}{
 				"post_type":       "meta_event",
 				"meta_event_type": "heartbeat",
 				"time":            int(time.Now().Unix()),
 				"self_id":         botID,
-				"status": map[string]interface{}{
-					"app_enabled":     true,
-					"app_good":        true,
-					"app_initialized": true,
-					"good":            true,
-					"online":          true,
-					"plugins_good":    nil,
-					"stat": map[string]int{
-						"packet_received":   34933,
-						"packet_sent":       8513,
-						"packet_lost":       0,
-						"message_received":  messageReceived,
-						"message_sent":      messageSent,
-						"disconnect_times":  0,
-						"lost_times":        0,
-						"last_message_time": int(lastMessageTime),
-					},
-				},
-				"interval": 5000, // 以毫秒为单位
+				"status":          botstats.GetStatus(),
+				"interval":        heartbeatinterval * 1000, // 以毫秒为单位
 			}
 			client.SendMessage(message)
 			// 重发失败的消息
@@ -345,6 +326,7 @@ func NewWebSocketClient(urlStr string, botID uint64, api openapi.OpenAPI, apiv2
 		closeCh:      make(chan struct{}),
 	}
 	go client.startWriter() // 启动写 Goroutine
+	botstats.RecordReverseWsConnected()
 
 	// Sending initial message similar to your setupB function
 	message := map[string]interface{}{